@@ -1,18 +1,22 @@
 package client
 
 import (
-	"encoding/binary"
 	"encoding/hex"
 	"errors"
-	"io"
 	"log"
 	"net"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/aecra/PeerCodeX/coder"
 	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/protocol"
+	"github.com/aecra/PeerCodeX/tools"
+	"github.com/aecra/PeerCodeX/tracker"
+)
+
+var (
+	errSelf   = errors.New("connected to self")
+	errBanned = errors.New("node is banned")
 )
 
 func CheckServer(addr string) bool {
@@ -22,12 +26,12 @@ func CheckServer(addr string) bool {
 // client type is used to connect to a server
 type Client struct {
 	Addr       string
-	Hash       []byte
+	InfoHash   []byte // infohash of the swarm
 	Generation *dc.Generation
 }
 
-func NewClient(addr string, hash []byte, generation *dc.Generation) *Client {
-	return &Client{Addr: addr, Hash: hash, Generation: generation}
+func NewClient(addr string, infoHash []byte, generation *dc.Generation) *Client {
+	return &Client{Addr: addr, InfoHash: infoHash, Generation: generation}
 }
 
 var StartClientChan = make(chan *Client)
@@ -53,6 +57,20 @@ func init() {
 		}
 	}()
 
+	// announce to trackers
+	go func() {
+		for {
+			time.Sleep(11 * time.Second)
+			dc.FileListMutex.RLock()
+			for _, file := range dc.FileList {
+				if isAnnounceDue(file) {
+					go AnnounceToTrackers(file, tracker.EventNone)
+				}
+			}
+			dc.FileListMutex.RUnlock()
+		}
+	}()
+
 	// search for enough neighbours
 	go func() {
 		for {
@@ -60,8 +78,9 @@ func init() {
 			dc.FileListMutex.RLock()
 			for _, file := range dc.FileList {
 				go func(file *dc.File) {
+					// delete nodes which is not on
+					onNodes := make([]string, 0)
 					for _, generation := range file.Generations {
-						// delete nodes which is not on
 						generation.NodesMutex.Lock()
 						oldNeighbours := generation.Nodes
 						generation.Nodes = make([]*dc.Node, 0)
@@ -70,28 +89,35 @@ func init() {
 								continue
 							}
 							generation.Nodes = append(generation.Nodes, node)
+							if node.IsOn == true {
+								onNodes = append(onNodes, node.Addr)
+							}
 						}
+						generation.NodesMutex.Unlock()
+					}
 
-						// get new neighbours
-						newNeighbours := make([]string, 0)
-						if len(generation.Nodes) < 10 {
-							for _, node := range generation.Nodes {
-								if node.IsOn == true {
-									c := NewClient(node.Addr, generation.Hash, generation)
-									neighbours := c.GetNeighbours()
-									for _, neighbour := range neighbours {
-										if !isSelf(neighbour) {
-											newNeighbours = append(newNeighbours, neighbour)
-										}
-									}
-								}
-								if len(generation.Nodes)+len(newNeighbours) >= 10 {
-									break
-								}
+					// neighbours are shared by the whole swarm, so every node
+					// is asked only once per file
+					onNodes = tools.RemoveDuplicateElement(onNodes)
+					newNeighbours := make([]string, 0)
+					if len(onNodes) < 10 {
+						newNeighbours = append(newNeighbours, bootstrap(file)...)
+					}
+					for _, addr := range onNodes {
+						if len(onNodes)+len(newNeighbours) >= 10 {
+							break
+						}
+						c := NewClient(addr, file.InfoHash, nil)
+						for _, neighbour := range c.GetNeighbours() {
+							if neighbour != "" && !isSelf(neighbour) {
+								newNeighbours = append(newNeighbours, neighbour)
 							}
 						}
-						generation.Nodes = append(generation.Nodes, oldNeighbours...)
-						generation.NodesMutex.Unlock()
+					}
+					for _, neighbour := range tools.RemoveDuplicateElement(newNeighbours) {
+						if !dc.IsBanned(protocol.PeerID{}, neighbour) {
+							file.AddNode(neighbour)
+						}
 					}
 				}(file)
 			}
@@ -100,6 +126,36 @@ func init() {
 	}()
 }
 
+// bootstrap asks the announce nodes of a file for neighbours tier by tier,
+// later tiers are only asked when no node of the tiers before answers
+func bootstrap(file *dc.File) []string {
+	for _, tier := range file.GetAnnounceTiers() {
+		neighbours := make([]string, 0)
+		answered := false
+		for _, addr := range tier {
+			if isSelf(addr) {
+				continue
+			}
+			result := NewClient(addr, file.InfoHash, nil).GetNeighbours()
+			file.ReportAnnounce(addr, result != nil)
+			if result == nil {
+				continue
+			}
+			answered = true
+			neighbours = append(neighbours, addr)
+			for _, neighbour := range result {
+				if neighbour != "" && !isSelf(neighbour) {
+					neighbours = append(neighbours, neighbour)
+				}
+			}
+		}
+		if answered {
+			return neighbours
+		}
+	}
+	return nil
+}
+
 func isSelf(addr string) bool {
 	// split ip/host and port
 	var host, port string
@@ -161,19 +217,50 @@ func RequestForFile(file *dc.File) {
 func RequestForGeneration(generation *dc.Generation) {
 	log.Println("RequestForGeneration: ", hex.EncodeToString(generation.Hash))
 	generation.StartReceiving()
-	generation.NodesMutex.RLock()
-	defer generation.NodesMutex.RUnlock()
-	for _, node := range generation.Nodes {
-		if node.IsOn == true && node.HaveClient == false {
-			// start a new client
-			c := NewClient(node.Addr, generation.Hash, generation)
-			connChan := make(chan net.Conn)
-			go c.Start(connChan)
-			conn := <-connChan
-			node.HaveClient = true
-			generation.AddConn(conn)
+	if !generation.IsDownloading() {
+		return
+	}
+
+	// claim the nodes first, the handshake must not hold the lock since
+	// the server adds nodes under it
+	// deprioritized nodes are only requested from if no other node is
+	addrs := make([]string, 0)
+	generation.NodesMutex.Lock()
+	for _, deprioritized := range []bool{false, true} {
+		if deprioritized && len(addrs) > 0 {
+			break
+		}
+		for _, node := range generation.Nodes {
+			if generation.File.IsAnnounceDead(node.Addr) || node.IsBanned() {
+				continue
+			}
+			if node.Reputation().IsDeprioritized() != deprioritized {
+				continue
+			}
+			if node.IsOn == true && node.HaveClient == false {
+				node.HaveClient = true
+				addrs = append(addrs, node.Addr)
+			}
 		}
 	}
+	generation.NodesMutex.Unlock()
+
+	for _, addr := range addrs {
+		// request the generation over the session to the node
+		s, err := openSession(generation.File, addr)
+		// a busy node is up, it refuses for its limits
+		generation.File.ReportAnnounce(addr, err == nil || errors.Is(err, protocol.ErrBusy))
+		if err != nil {
+			generation.SetHaveClient(addr, false)
+			continue
+		}
+		stream, err := s.request(generation)
+		if err != nil {
+			generation.SetHaveClient(addr, false)
+			continue
+		}
+		generation.AddConn(addr, stream)
+	}
 }
 
 func CkeckAllServerStatus() {
@@ -192,157 +279,144 @@ func CkeckServerStatus(addr string) {
 	return
 }
 
-func handleShake(client *Client, conn net.Conn, infohash []byte, reserved []byte) ([]byte, uint16, error) {
-	// handshake
-	pstrlen := []byte{0x0e}
-	pstr := []byte("Network Coding")
-	serverport := []byte{0x00, 0x00}
+// dial connects to a node over the transport negotiated with it, the
+// deadline of the connection is cleared by handShake. The connection is
+// rate limited as one to the node and, if it is shared, of the file.
+func dial(addr string, infoHash []byte) (*protocol.Transport, error) {
+	if dc.IsBanned(protocol.PeerID{}, addr) {
+		return nil, errBanned
+	}
+	conn, err := net.DialTimeout("tcp", addr, protocol.HandshakeTimeout)
+	if err != nil {
+		reportError(addr, err)
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(protocol.HandshakeTimeout))
+	limited := dc.LimitConn(conn)
+	dc.LimitPeer(limited, addr)
+	if file := dc.GetFileByInfoHash(infoHash); file != nil {
+		file.LimitConn(limited)
+	}
+	t, err := protocol.Negotiate(limited, addr, false, dc.GetSecurity())
+	if err != nil {
+		reportError(addr, err)
+		conn.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// reportError counts timeouts and protocol errors against the reputation
+// of the node, other failures of the connection are not its fault
+func reportError(addr string, err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		dc.ReportTimeout(addr)
+	} else if protocol.IsProtocolError(err) {
+		dc.ReportProtocolError(addr)
+	}
+}
+
+// handShake sends the handshake for the swarm and checks the response,
+// both sides prove their identity for it. The node is recorded under its
+// peer id, which is returned.
+func handShake(t *protocol.Transport, addr string, infoHash []byte) (id protocol.PeerID, err error) {
+	defer func() {
+		if err != nil {
+			reportError(addr, err)
+		}
+	}()
 	port, _ := strconv.Atoi(dc.GetPort())
-	binary.BigEndian.PutUint16(serverport, uint16(port))
-	// combine all
-	sbuf := append(pstrlen, pstr...)
-	sbuf = append(sbuf, reserved...)
-	sbuf = append(sbuf, infohash...)
-	sbuf = append(sbuf, serverport...)
-	// send
-	_, err := conn.Write(sbuf)
+	local := protocol.NewHandshake(infoHash, uint16(port))
+	file := dc.GetFileByInfoHash(infoHash)
+	if file != nil {
+		local.SetField(file.Field.ID())
+	}
+	if err := protocol.WriteHandshake(t, local); err != nil {
+		return protocol.PeerID{}, errors.New("send handshake failed")
+	}
+	response, err := protocol.ReadHandshake(t)
 	if err != nil {
-		return nil, 0, errors.New("send handshake failed")
+		return protocol.PeerID{}, err
+	}
+	if string(response.InfoHash[:]) != string(infoHash) {
+		return protocol.PeerID{}, errors.New("infohash is not equal")
 	}
-	// read response
-	rbuf := make([]byte, 45)
-	n, err := io.ReadFull(conn, rbuf)
-	if err != nil || n != 45 {
-		return nil, 0, errors.New("read handshake failed")
+	if file != nil && response.Field() != file.Field.ID() {
+		return protocol.PeerID{}, protocol.ErrFieldMismatch
 	}
-	// pstrlen
-	if rbuf[0] != 0x0e {
-		return nil, 0, errors.New("pstrlen is not 14")
+	if err := t.WriteIdentity(local); err != nil {
+		return protocol.PeerID{}, err
 	}
-	// protocolName
-	if string(rbuf[1:15]) != "Network Coding" {
-		return nil, 0, errors.New("protocolName is not Network Coding")
+	id, err = t.ReadIdentity(response)
+	if err != nil {
+		return protocol.PeerID{}, err
 	}
-	if string(rbuf[23:43]) != string(infohash) {
-		return nil, 0, errors.New("infohash is not equal")
+	if id == dc.GetSecurity().Identity.PeerID() {
+		return id, errSelf
 	}
-	// serverport
-	serverport = rbuf[43:45]
-	return rbuf[15:23], binary.BigEndian.Uint16(serverport), nil
+	if dc.IsBanned(id, addr) {
+		return id, errBanned
+	}
+	dc.AddPeer(id, addr)
+	return id, t.SetDeadline(time.Time{})
 }
 
 func (c *Client) IsServerAlive() bool {
-	// create a TCP connection
-	conn, err := net.Dial("tcp", c.Addr)
+	conn, err := dial(c.Addr, c.InfoHash)
 	if err != nil {
 		return false
 	}
 	defer conn.Close()
 
-	reserved := []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-	reserved1, _, err := handleShake(c, conn, c.Hash, reserved)
-	if err != nil || reserved1[0] != 0x01 {
+	if _, err := handShake(conn, c.Addr, c.InfoHash); err != nil {
+		// a busy node is up, it refuses for its limits
+		return errors.Is(err, protocol.ErrBusy)
+	}
+	if err := protocol.WriteMessage(conn, protocol.NewKeepAlive()); err != nil {
 		return false
 	}
-	return true
+	m, err := protocol.ReadMessage(conn)
+	return err == nil && m.Type == protocol.MsgKeepAlive
 }
 
 func (c *Client) GetNeighbours() []string {
-	// create a TCP connection
-	conn, err := net.Dial("tcp", c.Addr)
+	conn, err := dial(c.Addr, c.InfoHash)
 	if err != nil {
 		return nil
 	}
 	defer conn.Close()
 
-	reserved := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-	reserved1, _, err := handleShake(c, conn, c.Hash, reserved)
-	if err != nil || reserved1[1] != 0x01 {
+	if _, err := handShake(conn, c.Addr, c.InfoHash); err != nil {
 		return nil
 	}
-	// receive byte 0x01
-	typeBuf := make([]byte, 1)
-	_, err = io.ReadFull(conn, typeBuf)
-	if err != nil || typeBuf[0] != 0x01 {
+	if err := protocol.WriteMessage(conn, protocol.NewGetNeighbours()); err != nil {
 		return nil
 	}
-	// read response
-	pstrlenbuf := make([]byte, 4)
-	_, err = io.ReadFull(conn, pstrlenbuf)
-	if err != nil {
-		return nil
-	}
-	// get the length of neighbours str
-	length := binary.BigEndian.Uint32(pstrlenbuf)
-	rbuf := make([]byte, length)
-	l, err := io.ReadFull(conn, rbuf)
-	if err != nil || uint32(l) != length {
-		return nil
+	// the node may announce its generations first
+	for {
+		m, err := protocol.ReadMessage(conn)
+		if err != nil {
+			return nil
+		}
+		switch m.Type {
+		case protocol.MsgNeighbours:
+			return m.Neighbours()
+		case protocol.MsgHaveGeneration, protocol.MsgKeepAlive:
+		default:
+			return nil
+		}
 	}
-
-	return strings.Split(string(rbuf), ",")
 }
 
-func (c *Client) Start(connChan chan net.Conn) {
-	// create a TCP connection
-	log.Println("Dialed to ", c.Addr, "for ", hex.EncodeToString(c.Hash))
-	conn, err := net.Dial("tcp", c.Addr)
+// GetPeerID returns the peer id the node proves in the handshake, and
+// whether the connection to it is encrypted
+func (c *Client) GetPeerID() (protocol.PeerID, bool, error) {
+	conn, err := dial(c.Addr, c.InfoHash)
 	if err != nil {
-		return
+		return protocol.PeerID{}, false, err
 	}
 	defer conn.Close()
-	connChan <- conn
-
-	reserved := []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00}
-	reserved1, _, err := handleShake(c, conn, c.Hash, reserved)
-	if err != nil || reserved1[2] != 0x01 {
-		return
-	}
-
-	// receive codedPieces
-	for {
-		// receive byte 0x02
-		typeBuf := make([]byte, 1)
-		_, err = io.ReadFull(conn, typeBuf)
-		if err != nil || typeBuf[0] != 0x02 {
-			log.Println("receive byte 0x02 failed or ", err)
-			return
-		}
-
-		codedPiece := coder.CodedPiece{}
-		// read vector
-		lenBuf := make([]byte, 8)
-		n, err := io.ReadFull(conn, lenBuf)
-		if err != nil || n != 8 {
-			log.Println("read vector length length is not 8 or ", err)
-			return
-		}
-		vlen := binary.BigEndian.Uint64(lenBuf)
-		vectorBuf := make([]byte, vlen)
-		n, err = io.ReadFull(conn, vectorBuf)
-		if err != nil || n != int(vlen) {
-			log.Println("read vector length is not ", vlen, " or ", err)
-			return
-		}
-		codedPiece.Vector = vectorBuf
-		// read piece
-		lenBuf = make([]byte, 8)
-		n, err = io.ReadFull(conn, lenBuf)
-		if err != nil || n != 8 {
-			log.Println("read piece length length is not 8 or ", err)
-			return
-		}
-		plen := binary.BigEndian.Uint64(lenBuf)
-		pieceBuf := make([]byte, plen)
-		n, err = io.ReadFull(conn, pieceBuf)
-		if err != nil || n != int(plen) {
-			log.Println("read piece length is not ", plen, " or ", err)
-			return
-		}
-		codedPiece.Piece = pieceBuf
-		if c.Generation.AddCodedPieceChan == nil {
-			return
-		}
-		c.Generation.AddCodedPieceChan <- &codedPiece
-	}
+	id, err := handShake(conn, c.Addr, make([]byte, 20))
+	return id, conn.PeerKey != nil, err
 }
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/dht"
+)
+
+// The DHT listens on UDP with the same port as the service, so the
+// announce nodes of seeds double as DHT bootstrap nodes.
+var (
+	dhtNode  *dht.DHT
+	dhtMutex = sync.Mutex{}
+)
+
+func init() {
+	// look up and announce every file in the DHT
+	go func() {
+		for {
+			time.Sleep(97 * time.Second)
+			RefreshDHT()
+		}
+	}()
+}
+
+// StartDHT starts the DHT node at host:port, and joins the DHT through the
+// announce nodes of the added seeds and the extra bootstrap nodes
+func StartDHT(host string, port string, bootstrap []string) error {
+	dhtMutex.Lock()
+	defer dhtMutex.Unlock()
+	if dhtNode != nil {
+		return nil
+	}
+	d, err := dht.New(net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	dhtNode = d
+	log.Println("DHT started at " + d.Addr().String() + " with ID " + d.ID().String())
+	go func() {
+		bootstrapDHT(d, bootstrap)
+		RefreshDHT()
+	}()
+	return nil
+}
+
+func StopDHT() {
+	dhtMutex.Lock()
+	defer dhtMutex.Unlock()
+	if dhtNode == nil {
+		return
+	}
+	dhtNode.Close()
+	dhtNode = nil
+}
+
+func getDHT() *dht.DHT {
+	dhtMutex.Lock()
+	defer dhtMutex.Unlock()
+	return dhtNode
+}
+
+func bootstrapDHT(d *dht.DHT, extra []string) {
+	addrs := append([]string{}, extra...)
+	dc.FileListMutex.RLock()
+	for _, file := range dc.FileList {
+		for _, tier := range file.GetAnnounceTiers() {
+			addrs = append(addrs, tier...)
+		}
+	}
+	dc.FileListMutex.RUnlock()
+	for _, node := range dc.GetNodeStatusList() {
+		addrs = append(addrs, node.Addr)
+	}
+
+	bootstrap := make([]string, 0)
+	for _, addr := range addrs {
+		if addr != "" && !isSelf(addr) {
+			bootstrap = append(bootstrap, addr)
+		}
+	}
+	if err := d.Bootstrap(bootstrap); err != nil {
+		log.Println("DHT bootstrap: " + err.Error())
+	}
+}
+
+// RefreshDHT looks up peers of every file in the DHT, adds them as nodes
+// and announces this node as a peer of every file
+func RefreshDHT() {
+	d := getDHT()
+	if d == nil {
+		return
+	}
+	if d.Size() == 0 {
+		bootstrapDHT(d, nil)
+	}
+
+	dc.FileListMutex.RLock()
+	files := make([]*dc.File, len(dc.FileList))
+	copy(files, dc.FileList)
+	dc.FileListMutex.RUnlock()
+
+	port, _ := strconv.Atoi(dc.GetPort())
+	for _, file := range files {
+		peers, err := d.GetPeers(file.InfoHash)
+		if err != nil {
+			log.Println("DHT get_peers: " + err.Error())
+			continue
+		}
+		for _, peer := range peers {
+			if !isSelf(peer) {
+				file.AddNode(peer)
+			}
+		}
+		if err := d.AnnouncePeer(file.InfoHash, port); err != nil {
+			log.Println("DHT announce_peer: " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/protocol"
+)
+
+// session is the connection to a node for a file. Every generation of the
+// file received from the node is requested over the same connection, and
+// the coded pieces are dispatched by generation index.
+type session struct {
+	addr        string
+	file        *dc.File
+	conn        *protocol.Conn
+	netConn     net.Conn
+	generations map[uint32]*receiving
+	mutex       sync.Mutex
+	choked      bool // the node sends no pieces, credit is not granted
+	closed      bool
+	done        chan struct{}
+}
+
+// receiving is a generation requested over a session
+type receiving struct {
+	generation *dc.Generation
+	credit     uint // credit granted to the node which is not used yet
+	rank       uint // rank last reported to the node
+}
+
+// dialing is a session being dialed, callers wanting the same session
+// wait for done instead of dialing again
+type dialing struct {
+	done    chan struct{}
+	session *session
+	err     error
+}
+
+var (
+	sessions      = make(map[string]*session)
+	dialings      = make(map[string]*dialing)
+	sessionsMutex sync.Mutex
+)
+
+func sessionKey(file *dc.File, addr string) string {
+	return string(file.InfoHash) + addr
+}
+
+// openSession returns the session to addr for the file, dialing a new one
+// if there is none yet. The key is only reserved under sessionsMutex, so
+// that dialing one node doesn't hold up sessions to the others.
+func openSession(file *dc.File, addr string) (*session, error) {
+	key := sessionKey(file, addr)
+	sessionsMutex.Lock()
+	if s, ok := sessions[key]; ok {
+		sessionsMutex.Unlock()
+		return s, nil
+	}
+	if d, ok := dialings[key]; ok {
+		sessionsMutex.Unlock()
+		<-d.done
+		return d.session, d.err
+	}
+	d := &dialing{done: make(chan struct{})}
+	dialings[key] = d
+	sessionsMutex.Unlock()
+
+	d.session, d.err = dialSession(file, addr)
+	sessionsMutex.Lock()
+	delete(dialings, key)
+	if d.err == nil {
+		sessions[key] = d.session
+	}
+	sessionsMutex.Unlock()
+	close(d.done)
+	if d.err != nil {
+		return nil, d.err
+	}
+	go d.session.receive()
+	go d.session.refreshCredit()
+	return d.session, nil
+}
+
+// dialSession dials addr and shakes hands with it for the file
+func dialSession(file *dc.File, addr string) (*session, error) {
+	log.Println("Dialed to ", addr)
+	conn, err := dial(addr, file.InfoHash)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := handShake(conn, addr, file.InfoHash); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s := &session{
+		addr:        addr,
+		file:        file,
+		conn:        protocol.NewConn(conn),
+		netConn:     conn,
+		generations: make(map[uint32]*receiving),
+		done:        make(chan struct{}),
+	}
+	s.conn.SetMaxPayloadSize(file.MaxPayloadSize())
+	return s, nil
+}
+
+// request asks the node for coded pieces of the generation, the returned
+// stream stops them when closed
+func (s *session) request(generation *dc.Generation) (io.Closer, error) {
+	index := uint32(generation.Index)
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil, errSessionClosed
+	}
+	if _, ok := s.generations[index]; !ok {
+		s.generations[index] = &receiving{generation: generation}
+	}
+	s.mutex.Unlock()
+
+	if err := s.conn.WriteMessage(protocol.NewRequestGeneration(index)); err != nil {
+		s.close()
+		return nil, err
+	}
+	if err := s.grant(index); err != nil {
+		s.close()
+		return nil, err
+	}
+	return &generationStream{session: s, index: index}, nil
+}
+
+// grant tops up the credit of the node for the generation as far as the
+// decoder still needs pieces and the node does not choke, and reports the
+// rank if it changed
+func (s *session) grant(index uint32) error {
+	s.mutex.Lock()
+	r, ok := s.generations[index]
+	s.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	// pieces of other nodes are checked against hashes of the source
+	// pieces under a key they don't know, which one node is asked for
+	if key, ok := r.generation.CheckKey(s.addr); ok {
+		if err := s.conn.WriteMessage(protocol.NewRequestChecks(index, key)); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	if s.generations[index] != r {
+		s.mutex.Unlock()
+		return nil
+	}
+	credit := uint(0)
+	if r.credit < dc.CreditWindow && !s.choked && !r.generation.AwaitsChecks(s.addr) {
+		credit = r.generation.GrantCredit(dc.CreditWindow - r.credit)
+		r.credit += credit
+	}
+	rank := r.generation.Rank()
+	rankChanged := rank != r.rank
+	r.rank = rank
+	s.mutex.Unlock()
+
+	if rankChanged {
+		if err := s.conn.WriteMessage(protocol.NewRankUpdate(index, uint32(rank))); err != nil {
+			return err
+		}
+		// the sender codes pieces innovative for the decoder from now on
+		if subspace := r.generation.Subspace(); subspace != nil {
+			if err := s.conn.WriteMessage(protocol.NewSubspace(index, subspace)); err != nil {
+				return err
+			}
+		}
+	}
+	if credit > 0 {
+		return s.conn.WriteMessage(protocol.NewCredit(index, uint32(credit)))
+	}
+	return nil
+}
+
+// refreshCredit grants credit again which is released without a piece
+// of the session arriving, e.g. for linearly dependent pieces
+func (s *session) refreshCredit() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		s.mutex.Lock()
+		indexes := make([]uint32, 0, len(s.generations))
+		for index := range s.generations {
+			indexes = append(indexes, index)
+		}
+		s.mutex.Unlock()
+		for _, index := range indexes {
+			if err := s.grant(index); err != nil {
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+// setChoked records whether the node chokes, the credit granted to it is
+// void once it does. Credit is granted again once it unchokes.
+func (s *session) setChoked(choked bool) error {
+	s.mutex.Lock()
+	s.choked = choked
+	indexes := make([]uint32, 0, len(s.generations))
+	for index, r := range s.generations {
+		if choked {
+			r.generation.ReleaseCredit(r.credit)
+			r.credit = 0
+		}
+		indexes = append(indexes, index)
+	}
+	s.mutex.Unlock()
+	if choked {
+		return nil
+	}
+	for _, index := range indexes {
+		if err := s.grant(index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove forgets the generation and releases its unused credit
+func (s *session) remove(index uint32) (*receiving, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r, ok := s.generations[index]
+	if !ok {
+		return nil, false
+	}
+	delete(s.generations, index)
+	r.generation.CancelChecks(s.addr)
+	r.generation.ReleaseCredit(r.credit)
+	r.credit = 0
+	return r, len(s.generations) == 0
+}
+
+// stop tells the node to stop sending pieces of the generation, the
+// connection is closed when no generation is left
+func (s *session) stop(index uint32) {
+	r, empty := s.remove(index)
+	if r == nil {
+		return
+	}
+	if err := s.conn.WriteMessage(protocol.NewStop(index)); err != nil || empty {
+		s.close()
+	}
+}
+
+// received accounts a piece against the credit of the node and returns
+// the generation it belongs to
+func (s *session) received(index uint32) *dc.Generation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r, ok := s.generations[index]
+	if !ok {
+		return nil
+	}
+	if r.credit > 0 {
+		r.credit--
+	}
+	return r.generation
+}
+
+func (s *session) close() {
+	sessionsMutex.Lock()
+	if sessions[sessionKey(s.file, s.addr)] == s {
+		delete(sessions, sessionKey(s.file, s.addr))
+	}
+	sessionsMutex.Unlock()
+
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mutex.Unlock()
+	s.netConn.Close()
+}
+
+func (s *session) receive() {
+	defer func() {
+		s.close()
+		// the remaining generations may be received from the node again
+		s.mutex.Lock()
+		generations := s.generations
+		s.generations = make(map[uint32]*receiving)
+		s.mutex.Unlock()
+		for _, r := range generations {
+			r.generation.CancelChecks(s.addr)
+			r.generation.ReleaseCredit(r.credit)
+			r.generation.SetHaveClient(s.addr, false)
+		}
+	}()
+
+	for {
+		m, err := s.conn.ReadMessage()
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Println(err)
+			}
+			return
+		}
+		switch m.Type {
+		case protocol.MsgPiece:
+			index, codedPiece, err := m.Piece(s.file.Field)
+			if err != nil {
+				log.Println(err)
+				dc.ReportProtocolError(s.addr)
+				return
+			}
+			s.file.AddDownloaded(len(m.Payload))
+			generation := s.received(index)
+			if generation == nil {
+				// stopped already, pieces in flight are dropped
+				continue
+			}
+			// a polluted piece would corrupt the whole generation, the
+			// node sending it is dropped. Pieces failing the checks are
+			// only refused, the checks may be wrong.
+			err = generation.VerifyCodedPiece(codedPiece, s.addr)
+			if errors.Is(err, dc.ErrFailedChecks) {
+				generation.ReleaseCredit(1)
+				log.Println(s.addr + ": " + err.Error())
+				s.stop(index)
+				continue
+			}
+			if err != nil {
+				generation.ReleaseCredit(1)
+				log.Println(s.addr + ": " + err.Error())
+				dc.ReportHashFailure(s.addr)
+				s.conn.WriteMessage(protocol.NewError(err.Error()))
+				return
+			}
+			if !generation.PutCodedPiece(codedPiece, s.addr) {
+				generation.ReleaseCredit(1)
+				s.stop(index)
+				continue
+			}
+			if err := s.grant(index); err != nil {
+				log.Println(err)
+				return
+			}
+		case protocol.MsgChecks:
+			index, hashes, err := m.Checks()
+			if err != nil {
+				log.Println(err)
+				dc.ReportProtocolError(s.addr)
+				return
+			}
+			s.mutex.Lock()
+			r, ok := s.generations[index]
+			s.mutex.Unlock()
+			if !ok {
+				// stopped already
+				continue
+			}
+			if !r.generation.SetChecks(s.addr, hashes) {
+				dc.ReportProtocolError(s.addr)
+				s.conn.WriteMessage(protocol.NewError(protocol.ErrUnexpected.Error()))
+				return
+			}
+			if err := s.grant(index); err != nil {
+				log.Println(err)
+				return
+			}
+		case protocol.MsgStop:
+			// the node has nothing to send for the generation
+			index, err := m.Index()
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			if r, _ := s.remove(index); r != nil {
+				r.generation.SetHaveClient(s.addr, false)
+			}
+		case protocol.MsgChoke, protocol.MsgUnchoke:
+			if err := s.setChoked(m.Type == protocol.MsgChoke); err != nil {
+				log.Println(err)
+				return
+			}
+		case protocol.MsgError:
+			log.Println(s.addr + ": " + m.Reason())
+			return
+		case protocol.MsgKeepAlive, protocol.MsgHaveGeneration, protocol.MsgRankUpdate, protocol.MsgSubspace:
+		default:
+			dc.ReportProtocolError(s.addr)
+			s.conn.WriteMessage(protocol.NewError(protocol.ErrUnexpected.Error()))
+			return
+		}
+	}
+}
+
+// generationStream is the part of a session which carries one generation
+type generationStream struct {
+	session *session
+	index   uint32
+}
+
+func (g *generationStream) Close() error {
+	g.session.stop(g.index)
+	return nil
+}
+
+var errSessionClosed = errors.New("session is closed")
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/tracker"
+)
+
+type announceState struct {
+	started   bool
+	completed bool
+	next      time.Time
+}
+
+var (
+	announceStates = make(map[string]*announceState) // by infohash
+	announceMutex  = sync.Mutex{}
+)
+
+func isAnnounceDue(file *dc.File) bool {
+	announceMutex.Lock()
+	defer announceMutex.Unlock()
+	state, ok := announceStates[string(file.InfoHash)]
+	return !ok || time.Now().After(state.next)
+}
+
+// AnnounceToTrackers reports the progress of a file to its trackers and
+// adds the peers they return. Tiers are tried in order until a tracker of
+// a tier answers. Without an event, started and completed are sent when
+// they are due.
+func AnnounceToTrackers(file *dc.File, event string) {
+	tiers := file.GetTrackerTiers()
+	if len(tiers) == 0 {
+		return
+	}
+
+	completed := file.GetCompleted()
+	isCompleted := true
+	for _, c := range completed {
+		isCompleted = isCompleted && c
+	}
+
+	announceMutex.Lock()
+	state, ok := announceStates[string(file.InfoHash)]
+	if !ok {
+		state = &announceState{}
+		announceStates[string(file.InfoHash)] = state
+	}
+	if event == tracker.EventNone {
+		if !state.started {
+			event = tracker.EventStarted
+		} else if isCompleted && !state.completed {
+			event = tracker.EventCompleted
+		}
+	}
+	// do not announce again before this one finishes
+	state.next = time.Now().Add(tracker.DefaultInterval * time.Second)
+	announceMutex.Unlock()
+
+	port, _ := strconv.Atoi(dc.GetPort())
+	req := &tracker.Request{
+		InfoHash:   file.InfoHash,
+		Port:       uint16(port),
+		Uploaded:   file.GetUploaded(),
+		Downloaded: file.GetDownloaded(),
+		Completed:  tracker.NewBitfield(completed),
+		Event:      event,
+	}
+	for _, tier := range tiers {
+		for _, announceURL := range tier {
+			resp, err := tracker.Announce(announceURL, req)
+			file.ReportAnnounce(announceURL, err == nil)
+			if err != nil {
+				log.Println("announce to " + announceURL + ": " + err.Error())
+				continue
+			}
+
+			for _, peer := range resp.Peers {
+				if !isSelf(peer.Addr) {
+					file.AddNode(peer.Addr)
+				}
+			}
+			announceMutex.Lock()
+			switch event {
+			case tracker.EventStarted:
+				state.started = true
+			case tracker.EventCompleted:
+				state.completed = true
+			case tracker.EventStopped:
+				state.started = false
+			}
+			if resp.Interval > 0 {
+				state.next = time.Now().Add(time.Duration(resp.Interval) * time.Second)
+			}
+			announceMutex.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aecra/PeerCodeX/client"
+	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/protocol"
+	"github.com/aecra/PeerCodeX/ratelimit"
+	"github.com/aecra/PeerCodeX/seed"
+	"github.com/aecra/PeerCodeX/server"
+	"github.com/aecra/PeerCodeX/tools"
+	"github.com/aecra/PeerCodeX/tracker"
+)
+
+// daemon owns the running server and shuts everything down on a signal
+type daemon struct {
+	server  *server.Server
+	errChan chan error
+	signals chan os.Signal
+}
+
+func defaultStateDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "PeerCodeX")
+}
+
+// daemonConfig holds the flags shared by the commands which run a node
+type daemonConfig struct {
+	host         string
+	port         string
+	stateDir     string
+	dht          bool
+	dhtBootstrap string
+	encryption   string
+	pins         string
+	limits       *rateLimitFlags
+	server       server.Limits
+	decodeMemory string
+	pieceCache   string
+}
+
+// rateLimitFlags are the flags setting bandwidth limits, only the flags
+// which are given change the limits
+type rateLimitFlags struct {
+	fs                                         *flag.FlagSet
+	upload, download, peerUpload, peerDownload string
+	fileUpload, fileDownload                   string
+	uploadSchedule, downloadSchedule           string
+}
+
+func addRateLimitFlags(fs *flag.FlagSet) *rateLimitFlags {
+	limits := &rateLimitFlags{fs: fs}
+	fs.StringVar(&limits.upload, "upload-limit", "0", "upload rate of all connections, e.g. 5MB/s, 0 is unlimited")
+	fs.StringVar(&limits.download, "download-limit", "0", "download rate of all connections")
+	fs.StringVar(&limits.peerUpload, "peer-upload-limit", "0", "upload rate to each peer")
+	fs.StringVar(&limits.peerDownload, "peer-download-limit", "0", "download rate from each peer")
+	fs.StringVar(&limits.fileUpload, "file-upload-limit", "0", "upload rate of each file")
+	fs.StringVar(&limits.fileDownload, "file-download-limit", "0", "download rate of each file")
+	fs.StringVar(&limits.uploadSchedule, "upload-schedule", "", "upload rates of all connections by time, e.g. \"1MB/s 09:00-17:00 mon-fri; 0 00:00-24:00 sat,sun\"")
+	fs.StringVar(&limits.downloadSchedule, "download-schedule", "", "download rates of all connections by time")
+	return limits
+}
+
+// apply changes the limits by the flags which are given
+func (f *rateLimitFlags) apply(limits dc.RateLimits) (dc.RateLimits, error) {
+	var err error
+	rates := map[string]struct {
+		value string
+		rate  *int64
+	}{
+		"upload-limit":        {f.upload, &limits.Upload},
+		"download-limit":      {f.download, &limits.Download},
+		"peer-upload-limit":   {f.peerUpload, &limits.PeerUpload},
+		"peer-download-limit": {f.peerDownload, &limits.PeerDownload},
+		"file-upload-limit":   {f.fileUpload, &limits.FileUpload},
+		"file-download-limit": {f.fileDownload, &limits.FileDownload},
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch fl.Name {
+		case "upload-schedule":
+			limits.UploadSchedule = f.uploadSchedule
+		case "download-schedule":
+			limits.DownloadSchedule = f.downloadSchedule
+		default:
+			if r, ok := rates[fl.Name]; ok {
+				if *r.rate, err = ratelimit.ParseRate(r.value); err != nil {
+					err = errors.New(fl.Name + ": " + err.Error())
+				}
+			}
+		}
+	})
+	if err != nil {
+		return limits, err
+	}
+	return limits, limits.Validate()
+}
+
+// applyRateLimits loads the limits kept in the state directory, changes
+// them by the flags which are given and keeps them again
+func applyRateLimits(flags *rateLimitFlags) (dc.RateLimits, error) {
+	if err := dc.LoadRateLimits(); err != nil {
+		return dc.RateLimits{}, err
+	}
+	limits, err := flags.apply(dc.GetRateLimits())
+	if err != nil {
+		return limits, err
+	}
+	if err := dc.SetRateLimits(limits); err != nil {
+		return limits, err
+	}
+	return limits, dc.SaveRateLimits()
+}
+
+func addDaemonFlags(fs *flag.FlagSet) *daemonConfig {
+	config := &daemonConfig{}
+	fs.StringVar(&config.host, "host", "0.0.0.0", "service host")
+	fs.StringVar(&config.port, "port", "8080", "service port")
+	fs.StringVar(&config.stateDir, "state", defaultStateDir(), "directory to keep session state in, empty to disable")
+	fs.BoolVar(&config.dht, "dht", true, "find peers through the DHT on the UDP service port")
+	fs.StringVar(&config.dhtBootstrap, "dht-bootstrap", "", "comma separated DHT nodes to bootstrap from besides the announce nodes")
+	fs.StringVar(&config.encryption, "encryption", "on", "encryption of peer connections: off, on if the peer supports it, or require")
+	fs.StringVar(&config.pins, "pin", "", "comma separated addr=key identity keys expected of peers, pinned peers must encrypt")
+	config.limits = addRateLimitFlags(fs)
+	fs.IntVar(&config.server.MaxConnections, "max-connections", server.DefaultLimits.MaxConnections, "peer connections served at once, 0 is unlimited")
+	fs.IntVar(&config.server.MaxConnectionsPerIP, "max-connections-per-ip", server.DefaultLimits.MaxConnectionsPerIP, "peer connections served at once from one IP address")
+	fs.IntVar(&config.server.MaxGenerationPeers, "max-generation-peers", server.DefaultLimits.MaxGenerationPeers, "peers sent pieces of one generation at once")
+	fs.IntVar(&config.server.UploadSlots, "upload-slots", server.DefaultLimits.UploadSlots, "peers unchoked for uploading the most to this node, besides one optimistic unchoke")
+	fs.StringVar(&config.decodeMemory, "decode-memory", "512MB", "memory of generations decoded at once, the rest are decoded on disk")
+	fs.StringVar(&config.pieceCache, "piece-cache", "64MB", "memory of source pieces kept for coding, a generation for reading each piece once")
+	return config
+}
+
+func startDaemon(config *daemonConfig) (*daemon, error) {
+	if err := dc.SetStateDir(config.stateDir); err != nil {
+		return nil, err
+	}
+	encryption, err := protocol.ParseEncryption(config.encryption)
+	if err != nil {
+		return nil, err
+	}
+	pins, err := protocol.ParsePins(config.pins)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := dc.LoadIdentity()
+	if err != nil {
+		return nil, err
+	}
+	dc.SetSecurity(&protocol.Security{Encryption: encryption, Identity: identity, Pins: pins})
+	log.Printf("Identity: %x, peer id %s", identity.PublicKey(), identity.PeerID())
+	if _, err := applyRateLimits(config.limits); err != nil {
+		return nil, err
+	}
+	decodeMemory, err := tools.ParseByteSize(config.decodeMemory)
+	if err != nil {
+		return nil, errors.New("decode-memory: " + err.Error())
+	}
+	dc.SetDecoderMemory(decodeMemory)
+	pieceCache, err := tools.ParseByteSize(config.pieceCache)
+	if err != nil {
+		return nil, errors.New("piece-cache: " + err.Error())
+	}
+	dc.SetPieceCacheSize(pieceCache)
+
+	// resume the previous session
+	downloading, err := dc.LoadState()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &daemon{
+		server:  server.NewServer(),
+		errChan: make(chan error, 1),
+		signals: make(chan os.Signal, 1),
+	}
+	signal.Notify(d.signals, syscall.SIGINT, syscall.SIGTERM)
+
+	d.server.SetHost(config.host)
+	d.server.SetPort(config.port)
+	d.server.SetLimits(config.server)
+	dc.SetHost(config.host)
+	dc.SetPort(config.port)
+	go d.server.Start(d.errChan)
+	if config.dht {
+		bootstrap := tools.RemoveDuplicateElement(strings.Split(config.dhtBootstrap, ","))
+		if err := client.StartDHT(config.host, config.port, bootstrap); err != nil {
+			log.Println("DHT: " + err.Error())
+		}
+	}
+	for _, file := range downloading {
+		client.RequestForFile(file)
+	}
+	return d, nil
+}
+
+// wait blocks until a signal arrives, the server fails or done is closed,
+// then stops the server and every generation that is still receiving
+func (d *daemon) wait(done <-chan struct{}) error {
+	var err error
+	select {
+	case sig := <-d.signals:
+		log.Println("Received " + sig.String() + ", shutting down")
+	case err = <-d.errChan:
+	case <-done:
+	}
+	signal.Stop(d.signals)
+
+	if saveErr := dc.SaveState(); saveErr != nil {
+		log.Println("save state: " + saveErr.Error())
+	}
+	d.server.Stop()
+	client.StopDHT()
+	dc.FileListMutex.RLock()
+	files := make([]*dc.File, len(dc.FileList))
+	copy(files, dc.FileList)
+	dc.FileListMutex.RUnlock()
+	for _, file := range files {
+		file.StopReceivingCodedPiece()
+		client.AnnounceToTrackers(file, tracker.EventStopped)
+	}
+	return err
+}
+
+func addSeed(path string) (*dc.File, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	// the seed may be restored from the previous session already
+	if dc.GetFileByPath(path) == nil {
+		if err := dc.AddFile(path); err != nil {
+			return nil, err
+		}
+	}
+	file := dc.GetFileByPath(path)
+	if file == nil {
+		return nil, errors.New("file not found")
+	}
+	client.RequestForFile(file)
+	go client.AnnounceToTrackers(file, tracker.EventNone)
+	return file, nil
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	config := addDaemonFlags(fs)
+	fs.Parse(args)
+
+	d, err := startDaemon(config)
+	if err != nil {
+		return err
+	}
+	for _, path := range fs.Args() {
+		if _, err := addSeed(path); err != nil {
+			log.Println(path + ": " + err.Error())
+		}
+	}
+	return d.wait(nil)
+}
+
+func runAdd(args []string) error {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	config := addDaemonFlags(fs)
+	keepSeeding := fs.Bool("seed", false, "keep serving the file after it is downloaded")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one seed file")
+	}
+
+	d, err := startDaemon(config)
+	if err != nil {
+		return err
+	}
+	file, err := addSeed(fs.Arg(0))
+	if err != nil {
+		d.wait(closedChan())
+		return err
+	}
+
+	var done chan struct{}
+	if !*keepSeeding {
+		done = make(chan struct{})
+		go func() {
+			for file.GetProcessRate() < 1 {
+				time.Sleep(time.Second)
+			}
+			log.Println(file.GetTargetFile() + " is downloaded")
+			close(done)
+		}()
+	}
+	return d.wait(done)
+}
+
+func runCreateSeed(args []string) error {
+	fs := flag.NewFlagSet("create-seed", flag.ExitOnError)
+	comment := fs.String("comment", "", "comment stored in the seed")
+	announce := fs.String("announce", "", "address of the announce node")
+	announceList := fs.String("announce-list", "", "backup announce nodes, tiers separated by ';' of nodes separated by ','")
+	generationLength := fs.String("generation-length", "128MB", "length of a generation")
+	pieceLength := fs.String("piece-length", "1MB", "length of a source piece")
+	sparsity := fs.Float64("sparsity", seed.DefaultSparsity, "probability of a zero coefficient in coding vectors")
+	field := fs.String("field", seed.DefaultField, "finite field used for coding: gf2, gf256 or gf65536")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one path")
+	}
+
+	options := seed.Options{Sparsity: *sparsity, Field: *field}
+	var err error
+	if options.GenerationLength, err = tools.ParseByteSize(*generationLength); err != nil {
+		return errors.New("generation length: " + err.Error())
+	}
+	if options.PieceLength, err = tools.ParseByteSize(*pieceLength); err != nil {
+		return errors.New("piece length: " + err.Error())
+	}
+
+	path, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return seed.CreateSeedFileWithOptions(path, *comment, *announce, *announceList, options)
+}
+
+func runLimit(args []string) error {
+	fs := flag.NewFlagSet("limit", flag.ExitOnError)
+	stateDir := fs.String("state", defaultStateDir(), "directory of the node to limit")
+	flags := addRateLimitFlags(fs)
+	fs.Parse(args)
+	if *stateDir == "" {
+		return errors.New("expected a state directory")
+	}
+	if err := dc.SetStateDir(*stateDir); err != nil {
+		return err
+	}
+
+	// a running node picks the limits up from the state directory
+	limits, err := applyRateLimits(flags)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Upload:            " + ratelimit.FormatRate(limits.Upload))
+	fmt.Println("Download:          " + ratelimit.FormatRate(limits.Download))
+	fmt.Println("Peer upload:       " + ratelimit.FormatRate(limits.PeerUpload))
+	fmt.Println("Peer download:     " + ratelimit.FormatRate(limits.PeerDownload))
+	fmt.Println("File upload:       " + ratelimit.FormatRate(limits.FileUpload))
+	fmt.Println("File download:     " + ratelimit.FormatRate(limits.FileDownload))
+	fmt.Println("Upload schedule:   " + limits.UploadSchedule)
+	fmt.Println("Download schedule: " + limits.DownloadSchedule)
+	return nil
+}
+
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	stateDir := fs.String("state", defaultStateDir(), "directory to read checkpointed progress from")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("expected at least one seed file")
+	}
+	if err := dc.SetStateDir(*stateDir); err != nil {
+		return err
+	}
+
+	for _, path := range fs.Args() {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		file, err := dc.ReadProgress(path)
+		if err != nil {
+			return errors.New(path + ": " + err.Error())
+		}
+
+		downloaded := 0
+		for _, rate := range file.Generations {
+			if rate == 1 {
+				downloaded++
+			}
+		}
+		fmt.Println("Name:        " + file.NcFile.Info.Name)
+		fmt.Println("Target:      " + file.Target)
+		fmt.Printf("Infohash:    %x\n", file.InfoHash)
+		fmt.Println("Length:      " + tools.FormatByteSize(file.NcFile.Info.Length))
+		fmt.Printf("Coding:      %s generations, %s pieces, sparsity %g, %s\n",
+			tools.FormatByteSize(file.NcFile.GetGenerationLength()), tools.FormatByteSize(file.NcFile.GetPieceLength()),
+			file.NcFile.GetSparsity(), file.NcFile.GetField())
+		for _, announce := range file.Announces {
+			fmt.Printf("Announce:    tier %d %s\n", announce.Tier, announce.Addr)
+		}
+		if file.NcFile.IsDir() {
+			fmt.Printf("Files:       %d\n", len(file.NcFile.Info.Files))
+		}
+		fmt.Printf("Generations: %d/%d downloaded, %.2f%%\n", downloaded, len(file.Generations), file.GetProcessRate()*100)
+		for i, rate := range file.Generations {
+			state := "missing"
+			if rate == 1 {
+				state = "downloaded"
+			} else if rate > 0 {
+				state = fmt.Sprintf("%.2f%%", rate*100)
+			}
+			fmt.Printf("  %4d %x %s\n", i, file.NcFile.Info.Hash[i], state)
+		}
+	}
+	return nil
+}
+
+func runPeers(args []string) error {
+	fs := flag.NewFlagSet("peers", flag.ExitOnError)
+	addr := fs.String("addr", "", "node to ask instead of the announce nodes of the seed")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one seed file")
+	}
+
+	path, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	file, err := dc.NewFile(path)
+	if err != nil {
+		return err
+	}
+	if len(file.Generations) == 0 {
+		return errors.New("seed has no generations")
+	}
+	generation := file.Generations[0]
+
+	addrs := []string{}
+	if *addr != "" {
+		addrs = append(addrs, *addr)
+	} else {
+		for _, node := range generation.Nodes {
+			addrs = append(addrs, node.Addr)
+		}
+	}
+
+	for _, a := range addrs {
+		status := "off"
+		if client.NewClient(a, make([]byte, 20), nil).IsServerAlive() {
+			status = "on"
+		}
+		if id, encrypted, err := client.NewClient(a, nil, nil).GetPeerID(); err == nil {
+			status += " peer " + id.String()
+			if encrypted {
+				status += " encrypted"
+			} else {
+				status += " plain"
+			}
+		} else if errors.Is(err, protocol.ErrBusy) {
+			status += " busy"
+		}
+		fmt.Println(a + " " + status)
+		for _, neighbour := range client.NewClient(a, file.InfoHash, generation).GetNeighbours() {
+			if neighbour != "" {
+				fmt.Println("  " + neighbour)
+			}
+		}
+	}
+	return nil
+}
+
+func runTracker(args []string) error {
+	fs := flag.NewFlagSet("tracker", flag.ExitOnError)
+	addr := fs.String("addr", ":6969", "address to serve announces on")
+	interval := fs.Duration("interval", tracker.DefaultInterval*time.Second, "interval between announces of peers")
+
+	maxSwarms := fs.Int("max-swarms", tracker.DefaultMaxSwarms, "maximum number of swarms tracked at once")
+	fs.Parse(args)
+
+	t := tracker.NewTracker()
+	t.SetInterval(*interval)
+	t.SetMaxSwarms(*maxSwarms)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go t.Run(ctx)
+	httpServer := &http.Server{Addr: *addr, Handler: t.Handler()}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		sig := <-signals
+		log.Println("Received " + sig.String() + ", shutting down")
+		httpServer.Close()
+	}()
+
+	log.Println("Tracker started at http://" + *addr + "/announce")
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func closedChan() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
@@ -0,0 +1,60 @@
+// Command peercodex is the headless entry point of PeerCodeX. It drives the
+// same dc, server, client and seed packages as the GUI without linking Fyne,
+// so seeders can run on machines without a display.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []*command{
+	{"serve", "serve [-host host] [-port port] [-state dir] [-dht=false] [-dht-bootstrap a,b] [seed.nc ...]", runServe},
+	{"add", "add [-host host] [-port port] [-state dir] [-dht=false] [-dht-bootstrap a,b] [-seed] <seed.nc>", runAdd},
+	{"create-seed", "create-seed [-comment text] [-announce addr] [-announce-list a,b;c] [-generation-length 128MB] [-piece-length 1MB] [-sparsity 0.95] [-field gf2|gf256|gf65536] <path>", runCreateSeed},
+	{"limit", "limit [-state dir] [-upload-limit 5MB/s] [-download-limit rate] [-peer-upload-limit rate] [-peer-download-limit rate] [-file-upload-limit rate] [-file-download-limit rate] [-upload-schedule rules] [-download-schedule rules]", runLimit},
+	{"status", "status [-state dir] <seed.nc> ...", runStatus},
+	{"peers", "peers [-addr host:port] <seed.nc>", runPeers},
+	{"tracker", "tracker [-addr :6969] [-interval 60s] [-max-swarms 100000]", runTracker},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: peercodex <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintln(os.Stderr, "  "+c.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "peercodex "+name+": "+err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "peercodex: unknown command "+name)
+	usage()
+	os.Exit(2)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/aecra/PeerCodeX/coder"
 	"github.com/aecra/PeerCodeX/coder/decoder"
 	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 // generate random data of N-bytes
@@ -83,10 +84,14 @@ func BenchmarkGaussElimRLNCDecoder3(t *testing.B) {
 }
 
 func decode(t *testing.B, pieceCount uint, total uint, p float64) {
+	decodeWith(t, decoder.NewGaussElimRLNCDecoder, pieceCount, total, p)
+}
+
+func decodeWith(t *testing.B, newDecoder func(galoisfield.Field, uint) decoder.Decoder, pieceCount uint, total uint, p float64) {
 	rand.Seed(time.Now().UnixNano())
 
 	data := generateData(total)
-	enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(data, pieceCount, p)
+	enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount, p)
 	if err != nil {
 		t.Fatalf("Error: %s\n", err.Error())
 	}
@@ -101,7 +106,7 @@ func decode(t *testing.B, pieceCount uint, total uint, p float64) {
 	totalDuration := 0 * time.Second
 	count := 0
 	for i := 0; i < t.N; i++ {
-		td, ct := decode_(t, pieceCount, pieces)
+		td, ct := decode_(t, newDecoder(galoisfield.GF256, pieceCount), pieceCount, pieces)
 		totalDuration += td
 		count += ct
 	}
@@ -112,8 +117,7 @@ func decode(t *testing.B, pieceCount uint, total uint, p float64) {
 	t.ReportMetric(float64(total)/(float64(totalDuration.Seconds())/float64(t.N))/(1<<20), "MB/s")
 }
 
-func decode_(t *testing.B, pieceCount uint, pieces []*coder.CodedPiece) (time.Duration, int) {
-	dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+func decode_(t *testing.B, dec decoder.Decoder, pieceCount uint, pieces []*coder.CodedPiece) (time.Duration, int) {
 	count := 0
 	// randomly shuffle piece ordering
 	rand.Shuffle(int(8*pieceCount), func(i, j int) {
@@ -127,8 +131,13 @@ func decode_(t *testing.B, pieceCount uint, pieces []*coder.CodedPiece) (time.Du
 			break
 		}
 
+		// the pieces are decoded again, which mustn't see them reduced
+		piece := &coder.CodedPiece{
+			Vector: append(coder.CodingVector{}, pieces[j].Vector...),
+			Piece:  append(coder.Piece{}, pieces[j].Piece...),
+		}
 		begin := time.Now()
-		dec.AddPiece(pieces[j])
+		dec.AddPiece(piece)
 		totalDuration += time.Since(begin)
 	}
 
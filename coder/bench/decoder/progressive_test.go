@@ -0,0 +1,39 @@
+package decoder_test
+
+import (
+	"testing"
+
+	"github.com/aecra/PeerCodeX/coder/decoder"
+)
+
+// Progressive decoding against elimination of the whole matrix per piece,
+// by the number of pieces
+func BenchmarkProgressiveRLNCDecoder(t *testing.B) {
+	for _, total := range []struct {
+		name string
+		size uint
+	}{{"1M", 1 << 20}, {"16M", 1 << 24}} {
+		size := total.size
+		t.Run(total.name, func(b *testing.B) {
+			for _, bench := range []struct {
+				name       string
+				pieceCount uint
+			}{{"32 Pieces", 1 << 5}, {"64 Pieces", 1 << 6}, {"128 Pieces", 1 << 7}, {"256 Pieces", 1 << 8}, {"512 Pieces", 1 << 9}} {
+				pieceCount := bench.pieceCount
+				b.Run(bench.name, func(b *testing.B) {
+					b.Run("GaussElim", func(b *testing.B) { decodeWith(b, decoder.NewGaussElimRLNCDecoder, pieceCount, size, 0.95) })
+					b.Run("Progressive", func(b *testing.B) { decodeWith(b, decoder.NewProgressiveRLNCDecoder, pieceCount, size, 0.95) })
+				})
+			}
+		})
+	}
+}
+
+// Effect of Generation Size on progressive decoding speed
+func BenchmarkProgressiveRLNCDecoder2(t *testing.B) {
+	t.Run("128 Pieces", func(b *testing.B) {
+		b.Run("1 M", func(b *testing.B) { decodeWith(b, decoder.NewProgressiveRLNCDecoder, 1<<7, 1<<20, 0.95) })
+		b.Run("16 M", func(b *testing.B) { decodeWith(b, decoder.NewProgressiveRLNCDecoder, 1<<7, 1<<24, 0.95) })
+		b.Run("128 M", func(b *testing.B) { decodeWith(b, decoder.NewProgressiveRLNCDecoder, 1<<7, 1<<27, 0.95) })
+	})
+}
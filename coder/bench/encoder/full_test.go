@@ -1,6 +1,7 @@
 package encoder_test
 
 import (
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"math/rand"
 	"testing"
 	"time"
@@ -47,7 +48,7 @@ func fullEncode(t *testing.B, pieceCount uint, total uint) {
 	rand.Seed(time.Now().UnixNano())
 
 	data := generateData(total)
-	enc, err := encoder.NewFullRLNCEncoderWithPieceCount(data, pieceCount)
+	enc, err := encoder.NewFullRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 	if err != nil {
 		t.Fatalf("Error: %s\n", err.Error())
 	}
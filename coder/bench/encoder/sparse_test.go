@@ -1,6 +1,7 @@
 package encoder_test
 
 import (
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"math/rand"
 	"testing"
 	"time"
@@ -71,7 +72,7 @@ func sparseEncode(t *testing.B, pieceCount uint, total uint, p float64) {
 	rand.Seed(time.Now().UnixNano())
 
 	data := generateData(total)
-	enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(data, pieceCount, p)
+	enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount, p)
 	if err != nil {
 		t.Fatalf("Error: %s\n", err.Error())
 	}
@@ -0,0 +1,41 @@
+package encoder_test
+
+import (
+	"bytes"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/aecra/PeerCodeX/coder/encoder"
+)
+
+// Effect of the cache on the speed of streaming encoding, a cache of the
+// whole generation is as fast as holding it in memory
+func BenchmarkStreamingRLNCEncoder(b *testing.B) {
+	b.Run("128 piece 16MB", func(b *testing.B) {
+		b.Run("no cache", func(b *testing.B) { streamingEncode(b, 1<<7, 1<<24, 0.95, 0) })
+		b.Run("4MB cache", func(b *testing.B) { streamingEncode(b, 1<<7, 1<<24, 0.95, 1<<22) })
+		b.Run("16MB cache", func(b *testing.B) { streamingEncode(b, 1<<7, 1<<24, 0.95, 1<<24) })
+	})
+}
+
+func streamingEncode(t *testing.B, pieceCount uint, total uint, p float64, cacheSize uint) {
+	// non-reproducible random number sequence
+	rand.Seed(time.Now().UnixNano())
+
+	data := generateData(total)
+	enc, err := encoder.NewStreamingRLNCEncoder(galoisfield.GF256, bytes.NewReader(data), 0, total, pieceCount, p, encoder.NewPieceCache(cacheSize), "")
+	if err != nil {
+		t.Fatalf("Error: %s\n", err.Error())
+	}
+
+	t.ReportAllocs()
+	t.SetBytes(int64(total+enc.Padding()) + int64(enc.CodedPieceLen()))
+	t.ResetTimer()
+
+	// keep generating encoded pieces on-the-fly
+	for i := 0; i < t.N; i++ {
+		enc.CodedPiece()
+	}
+}
@@ -1,6 +1,7 @@
 package encoder_test
 
 import (
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"math/rand"
 	"testing"
 	"time"
@@ -24,7 +25,7 @@ func systematicEncode(t *testing.B, pieceCount uint, total uint) {
 	rand.Seed(time.Now().UnixNano())
 
 	data := generateData(total)
-	enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(data, pieceCount)
+	enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 	if err != nil {
 		t.Fatalf("Error: %s\n", err.Error())
 	}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/aecra/PeerCodeX/coder"
 	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"github.com/aecra/PeerCodeX/coder/recoder"
 )
 
@@ -42,7 +43,7 @@ func recode(t *testing.B, pieceCount uint, total uint) {
 
 	// -- encode
 	data := generateData(total)
-	enc, err := encoder.NewFullRLNCEncoderWithPieceCount(data, pieceCount)
+	enc, err := encoder.NewFullRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 	if err != nil {
 		t.Fatalf("Error: %s\n", err.Error())
 	}
@@ -54,7 +55,7 @@ func recode(t *testing.B, pieceCount uint, total uint) {
 	// -- encoding ends
 
 	// -- recode
-	rec := recoder.NewFullRLNCRecoder(pieces)
+	rec := recoder.NewFullRLNCRecoder(galoisfield.GF256, pieces)
 
 	t.ReportAllocs()
 	t.SetBytes(int64((pieceCount+total/pieceCount)*pieceCount) + int64(pieceCount+total/pieceCount))
@@ -1,10 +1,9 @@
 package coder
 
 import (
-	"crypto/rand"
 	"math"
 
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 // A piece of data is nothing but a byte array
@@ -12,18 +11,18 @@ type Piece []byte
 
 // Multiple pieces are coded together by performing
 // symbol by symbol finite field arithmetic, where
-// a single byte is a symbol
+// a symbol is one element of the field ( 1 or 2 bytes )
 //
-// `by` is coding coefficient
-func (p *Piece) Multiply(piece Piece, by byte, field *galoisfield.GF) {
-	for i := range piece {
-		(*p)[i] = field.Add((*p)[i], field.Mul(piece[i], by))
-	}
+// `by` is coding coefficient, symbols are multiplied
+// in vector registers where the CPU supports it
+func (p *Piece) Multiply(piece Piece, by uint16, field galoisfield.Field) {
+	field.MulAddSlice(*p, piece, by)
 }
 
 // One component of coded piece; holding
 // information regarding how original pieces are
-// combined together
+// combined together, as one symbol of the field
+// per original piece
 type CodingVector []byte
 
 // Coded piece along with randomly generated coding vector
@@ -31,6 +30,10 @@ type CodingVector []byte
 type CodedPiece struct {
 	Vector CodingVector
 	Piece  Piece
+	// Encoding of Vector on the wire, it must be reset to FullVector
+	// by whoever changes Vector after coding
+	Encoding VectorEncoding
+	Seed     uint64 // regenerates Vector, if it's a SeededVector
 }
 
 // Total length of coded piece --- len(coding_vector) + len(piece)
@@ -53,11 +56,12 @@ func (c *CodedPiece) Flatten() []byte {
 // systematically i.e. piece is actually
 // uncoded, just being augmented that it's coded
 // which is why coding vector has only one
-// non-zero element ( 1 )
-func (c *CodedPiece) IsSystematic() bool {
+// non-zero element ( 1 ), compared symbol by
+// symbol of the field it's coded over
+func (c *CodedPiece) IsSystematic(field galoisfield.Field) bool {
 	pos := -1
-	for i := 0; i < len(c.Vector); i++ {
-		switch c.Vector[i] {
+	for i := 0; i < len(c.Vector)/field.SymbolSize(); i++ {
+		switch field.Symbol(c.Vector, i) {
 		case 0:
 			continue
 
@@ -72,20 +76,28 @@ func (c *CodedPiece) IsSystematic() bool {
 
 		}
 	}
-	return pos >= 0 && pos < len(c.Vector)
+	return pos >= 0
 }
 
-// Generates random coding vector of specified length
+// Generates random coding vector over field, for n pieces
+// coded together
 //
 // No specific randomization choice is made, default available
 // source is used
-func GenerateCodingVector(n uint) CodingVector {
-	vector := make(CodingVector, n)
-	// ignoring error, because it always succeeds
-	rand.Read(vector)
+func GenerateCodingVector(field galoisfield.Field, n uint) CodingVector {
+	vector := make(CodingVector, n*uint(field.SymbolSize()))
+	field.Random(vector)
 	return vector
 }
 
+// Size of each of pieceCount pieces, length bytes are split
+// into, it's rounded up to whole symbols of field
+func PieceSize(field galoisfield.Field, length uint, pieceCount uint) uint {
+	symbol := uint(field.SymbolSize())
+	size := (length + pieceCount - 1) / pieceCount
+	return (size + symbol - 1) / symbol * symbol
+}
+
 // Given whole chunk of data & desired size of each pieces ( in terms of bytes ),
 // it'll split chunk into pieces, which are to be used by encoder for performing RLNC
 //
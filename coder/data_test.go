@@ -9,6 +9,7 @@ import (
 
 	"github.com/aecra/PeerCodeX/coder"
 	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 // Generates `N`-bytes of random data from default
@@ -91,7 +92,7 @@ func TestCodedPiecesForRecoding(t *testing.T) {
 	data := generateData(uint(size))
 	pieceCount := 3
 	codedPieceCount := pieceCount + 2
-	enc, err := encoder.NewFullRLNCEncoderWithPieceCount(data, uint(pieceCount))
+	enc, err := encoder.NewFullRLNCEncoderWithPieceCount(galoisfield.GF256, data, uint(pieceCount))
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -134,22 +135,36 @@ func TestCodedPiecesForRecoding(t *testing.T) {
 
 func TestIsSystematic(t *testing.T) {
 	piece_1 := coder.CodedPiece{Vector: []byte{0, 1, 0, 0}, Piece: []byte{1, 2, 3}}
-	if !piece_1.IsSystematic() {
+	if !piece_1.IsSystematic(galoisfield.GF256) {
 		t.Fatalf("%v should be systematic\n", piece_1)
 	}
 
 	piece_2 := coder.CodedPiece{Vector: []byte{1, 1, 0, 0}, Piece: []byte{1, 2, 3}}
-	if piece_2.IsSystematic() {
+	if piece_2.IsSystematic(galoisfield.GF256) {
 		t.Fatalf("%v shouldn't be systematic\n", piece_2)
 	}
 
 	piece_3 := coder.CodedPiece{Vector: []byte{0, 0, 1, 0}, Piece: []byte{1, 2, 3}}
-	if !piece_3.IsSystematic() {
+	if !piece_3.IsSystematic(galoisfield.GF256) {
 		t.Fatalf("%v should be systematic\n", piece_3)
 	}
 
 	piece_4 := coder.CodedPiece{Vector: []byte{0, 0, 0, 0}, Piece: []byte{1, 2, 3}}
-	if piece_4.IsSystematic() {
+	if piece_4.IsSystematic(galoisfield.GF256) {
 		t.Fatalf("%v shouldn't be systematic\n", piece_4)
 	}
+
+	// symbols of GF(2^16) are two bytes, only 0x0001 is one
+	piece_5 := coder.CodedPiece{Vector: []byte{0, 0, 0, 1}, Piece: []byte{1, 2, 3, 4}}
+	if !piece_5.IsSystematic(galoisfield.GF65536) {
+		t.Fatalf("%v should be systematic over GF(2^16)\n", piece_5)
+	}
+	piece_6 := coder.CodedPiece{Vector: []byte{0, 0, 1, 0}, Piece: []byte{1, 2, 3, 4}}
+	if piece_6.IsSystematic(galoisfield.GF65536) {
+		t.Fatalf("%v shouldn't be systematic over GF(2^16)\n", piece_6)
+	}
+	piece_7 := coder.CodedPiece{Vector: []byte{0, 1, 0, 1}, Piece: []byte{1, 2, 3, 4}}
+	if piece_7.IsSystematic(galoisfield.GF65536) {
+		t.Fatalf("%v shouldn't be systematic over GF(2^16)\n", piece_7)
+	}
 }
@@ -0,0 +1,178 @@
+package decoder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+	"github.com/aecra/PeerCodeX/coder/matrix"
+)
+
+// A decoder which can persist its partially decoded state, so that
+// coded pieces already received survive a restart
+type Checkpointer interface {
+	Checkpoint(w io.Writer) error
+}
+
+var checkpointMagic = [4]byte{'N', 'C', 'C', 'K'}
+
+const checkpointVersion = 1
+
+// checkpoint header: magic, version, expected piece count, row count,
+// coding vector length & coded piece length --- followed by rows, each
+// being coding vector ++ coded piece
+type checkpointHeader struct {
+	Magic       [4]byte
+	Version     uint32
+	PieceCount  uint32
+	Rows        uint32
+	VectorLen   uint32
+	PieceLength uint64
+}
+
+// Checkpoint - Writes current coefficient & coded piece matrices
+// to `w`, which can later be fed to `NewGaussElimRLNCDecoderFromCheckpoint`
+// for resuming decoding from where it's left
+func (d *GaussElimRLNCDecoder) Checkpoint(w io.Writer) error {
+	return writeCheckpoint(w, d.state.field, d.expected, d.PieceLength(), d.CodedPieces())
+}
+
+// writeCheckpoint writes the rows of a decoder for pieceCount pieces of
+// pieceLength bytes, coded over field
+func writeCheckpoint(w io.Writer, field galoisfield.Field, pieceCount uint, pieceLength uint, rows []*coder.CodedPiece) error {
+	header := checkpointHeader{
+		Magic:      checkpointMagic,
+		Version:    checkpointVersion,
+		PieceCount: uint32(pieceCount),
+		Rows:       uint32(len(rows)),
+	}
+	if header.Rows > 0 {
+		header.VectorLen = uint32(pieceCount) * uint32(field.SymbolSize())
+		header.PieceLength = uint64(pieceLength)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err := bw.Write(row.Vector); err != nil {
+			return err
+		}
+		if _, err := bw.Write(row.Piece); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// CheckpointRank - Piece count & rank of the decoder state written by
+// `Checkpoint`, read from the header alone, so that progress can be shown
+// without restoring a decoder
+func CheckpointRank(r io.Reader) (pieceCount uint, rank uint, err error) {
+	header := checkpointHeader{}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return 0, 0, err
+	}
+	if header.Magic != checkpointMagic || header.Version != checkpointVersion || header.Rows > header.PieceCount {
+		return 0, 0, coder.ErrBadCheckpoint
+	}
+	return uint(header.PieceCount), uint(header.Rows), nil
+}
+
+// readCheckpoint checks the header of a checkpoint written for pieceCount
+// pieces coded over field, then hands its rows to add one at a time
+func readCheckpoint(r io.Reader, field galoisfield.Field, pieceCount uint, add func(*coder.CodedPiece) error) error {
+	br := bufio.NewReader(r)
+	header := checkpointHeader{}
+	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	if header.Magic != checkpointMagic || header.Version != checkpointVersion {
+		return coder.ErrBadCheckpoint
+	}
+	if uint(header.PieceCount) != pieceCount || header.Rows > header.PieceCount ||
+		(header.Rows > 0 && header.VectorLen != header.PieceCount*uint32(field.SymbolSize())) {
+		return coder.ErrBadCheckpoint
+	}
+
+	for i := 0; i < int(header.Rows); i++ {
+		piece := &coder.CodedPiece{Vector: make([]byte, header.VectorLen), Piece: make([]byte, header.PieceLength)}
+		if _, err := io.ReadFull(br, piece.Vector); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(br, piece.Piece); err != nil {
+			return err
+		}
+		if err := add(piece); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads back decoder state written by `Checkpoint`, returning a decoder
+// which already holds all useful pieces received before checkpointing
+//
+// `pieceCount` is #-of pieces coded together over `field`, checkpoint
+// written for some other generation shape is rejected
+func NewGaussElimRLNCDecoderFromCheckpoint(r io.Reader, field galoisfield.Field, pieceCount uint) (Decoder, error) {
+	br := bufio.NewReader(r)
+	header := checkpointHeader{}
+	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != checkpointMagic || header.Version != checkpointVersion {
+		return nil, coder.ErrBadCheckpoint
+	}
+	if uint(header.PieceCount) != pieceCount || header.Rows > header.PieceCount ||
+		(header.Rows > 0 && header.VectorLen != header.PieceCount*uint32(field.SymbolSize())) {
+		return nil, coder.ErrBadCheckpoint
+	}
+
+	coeffs := make(matrix.Matrix, header.Rows, pieceCount)
+	coded := make(matrix.Matrix, header.Rows, pieceCount)
+	for i := 0; i < int(header.Rows); i++ {
+		coeffs[i] = make([]byte, header.VectorLen)
+		if _, err := io.ReadFull(br, coeffs[i]); err != nil {
+			return nil, err
+		}
+		coded[i] = make([]byte, header.PieceLength)
+		if _, err := io.ReadFull(br, coded[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	state := &GaussElimDecoderState{
+		field:      field,
+		pieceCount: pieceCount,
+		coeffs:     coeffs,
+		coded:      coded,
+	}
+	// rows checkpointed by DiskRLNCDecoder are as received
+	if header.Rows > 0 {
+		state.Rref()
+	}
+	return &GaussElimRLNCDecoder{
+		expected: pieceCount,
+		useful:   uint(header.Rows),
+		received: uint(header.Rows),
+		state:    state,
+	}, nil
+}
+
+// CodedPieces - Returns rows held by decoder as coded pieces, which are
+// still valid linear combinations of original pieces & can be used for
+// ( re-)building a recoder
+func (d *GaussElimRLNCDecoder) CodedPieces() []*coder.CodedPiece {
+	coeffs := d.state.CoefficientMatrix()
+	coded := d.state.CodedPieceMatrix()
+
+	pieces := make([]*coder.CodedPiece, 0, len(coeffs))
+	for i := range coeffs {
+		pieces = append(pieces, &coder.CodedPiece{Vector: coeffs[i], Piece: coded[i]})
+	}
+	return pieces
+}
@@ -0,0 +1,86 @@
+package decoder_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/decoder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+func TestGaussElimRLNCDecoderCheckpoint(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	pieceCount := 64
+	pieceLength := 4096
+	pieces := generatePieces(uint(pieceCount), uint(pieceLength))
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
+
+	dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, uint(pieceCount))
+	for i := 0; i < pieceCount/2; i++ {
+		if err := dec.AddPiece(enc.CodedPiece()); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := dec.(decoder.Checkpointer).Checkpoint(buf); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	restored, err := decoder.NewGaussElimRLNCDecoderFromCheckpoint(buf, galoisfield.GF256, uint(pieceCount))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if restored.Required() != dec.Required() {
+		t.Fatalf("expected %d pieces to be required after restoring, found %d\n", dec.Required(), restored.Required())
+	}
+
+	for !restored.IsDecoded() {
+		if err := restored.AddPiece(enc.CodedPiece()); err != nil && !errors.Is(err, coder.ErrAllUsefulPiecesReceived) {
+			t.Fatal(err.Error())
+		}
+	}
+
+	d_pieces, err := restored.GetPieces()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := 0; i < pieceCount; i++ {
+		if !bytes.Equal(pieces[i], d_pieces[i]) {
+			t.Fatal("decoded data doesn't match !")
+		}
+	}
+}
+
+func TestCheckpointRank(t *testing.T) {
+	pieces := generatePieces(32, 256)
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
+	dec := decoder.NewProgressiveRLNCDecoder(galoisfield.GF256, 32)
+	for i := 0; i < 10; i++ {
+		if err := dec.AddPiece(enc.CodedPiece()); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := dec.(decoder.Checkpointer).Checkpoint(buf); err != nil {
+		t.Fatal(err.Error())
+	}
+	if pieceCount, rank, err := decoder.CheckpointRank(buf); err != nil || pieceCount != 32 || rank != 10 {
+		t.Fatalf("expected rank 10 of 32 pieces, got %d of %d: %v", rank, pieceCount, err)
+	}
+	if _, _, err := decoder.CheckpointRank(bytes.NewReader(make([]byte, 28))); !errors.Is(err, coder.ErrBadCheckpoint) {
+		t.Fatal("expected malformed checkpoint to be rejected")
+	}
+}
+
+func TestGaussElimRLNCDecoderBadCheckpoint(t *testing.T) {
+	if _, err := decoder.NewGaussElimRLNCDecoderFromCheckpoint(bytes.NewReader(make([]byte, 28)), galoisfield.GF256, 64); !errors.Is(err, coder.ErrBadCheckpoint) {
+		t.Fatal("expected malformed checkpoint to be rejected")
+	}
+}
@@ -10,4 +10,5 @@ type Decoder interface {
 	AddPiece(piece *coder.CodedPiece) error
 	GetPiece(index uint) (coder.Piece, error)
 	GetPieces() ([]coder.Piece, error)
+	Subspace() *coder.Subspace
 }
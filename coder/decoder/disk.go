@@ -0,0 +1,287 @@
+package decoder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+	"github.com/aecra/PeerCodeX/coder/matrix"
+)
+
+// chunkBudget bounds the bytes of coded pieces a DiskRLNCDecoder holds in
+// memory while decoding, spread over a chunk of every row
+const chunkBudget = 8 << 20
+
+// DiskRLNCDecoder decodes like GaussElimRLNCDecoder, but only keeps the
+// coding vectors in memory. Linearly independent coded pieces are spilled
+// as received to rows of a temporary file. Once enough of them are
+// received, the inverse of the coding vectors is applied to the rows in
+// chunks of columns, which leaves the decoded pieces in the file.
+//
+// Pieces can only be read back once all of them are decoded. Close
+// removes the temporary file.
+type DiskRLNCDecoder struct {
+	field       galoisfield.Field
+	expected    uint
+	pieceLength uint
+	vectors     matrix.Matrix // row i of the file is coded with vector i
+	subspace    *coder.Subspace
+	file        *os.File
+	decoded     bool
+}
+
+// PieceLength - Returns piece length in bytes, 0 if no pieces are
+// added yet
+func (d *DiskRLNCDecoder) PieceLength() uint {
+	return d.pieceLength
+}
+
+func (d *DiskRLNCDecoder) IsDecoded() bool {
+	return d.decoded
+}
+
+func (d *DiskRLNCDecoder) Required() uint {
+	return d.expected - d.subspace.Rank()
+}
+
+func (d *DiskRLNCDecoder) ProcessRate() float64 {
+	return float64(d.subspace.Rank()) / float64(d.expected)
+}
+
+// AddPiece - Spills a linearly independent coded piece to the file,
+// pieces which aren't are dropped. The last piece required decodes all.
+func (d *DiskRLNCDecoder) AddPiece(piece *coder.CodedPiece) error {
+	if d.decoded {
+		return coder.ErrAllUsefulPiecesReceived
+	}
+	if len(piece.Vector) != int(d.expected)*d.field.SymbolSize() {
+		return coder.ErrCodingVectorLengthMismatch
+	}
+	if d.pieceLength == 0 {
+		d.pieceLength = uint(len(piece.Piece))
+	} else if uint(len(piece.Piece)) != d.pieceLength {
+		return coder.ErrCodedDataLengthMismatch
+	}
+	if !d.subspace.IsInnovative(piece.Vector) {
+		return nil
+	}
+
+	row := uint(len(d.vectors))
+	if _, err := d.file.WriteAt(piece.Piece, int64(row*d.pieceLength)); err != nil {
+		return err
+	}
+	vector := make(coder.CodingVector, len(piece.Vector))
+	copy(vector, piece.Vector)
+	d.vectors = append(d.vectors, vector)
+	d.subspace.Add(vector)
+
+	if d.subspace.Rank() < d.expected {
+		return nil
+	}
+	return d.decode()
+}
+
+// decode applies the inverse of the coding vectors to the rows, a chunk
+// of columns at a time
+func (d *DiskRLNCDecoder) decode() error {
+	inverse, err := invert(d.field, d.vectors)
+	if err != nil {
+		return err
+	}
+
+	// of whole symbols
+	symbol := uint(d.field.SymbolSize())
+	chunk := uint(chunkBudget) / d.expected / symbol * symbol
+	if chunk == 0 {
+		chunk = symbol
+	}
+	coded := make([]coder.Piece, d.expected)
+	decoded := make([]coder.Piece, d.expected)
+	for i := range coded {
+		coded[i] = make(coder.Piece, chunk)
+		decoded[i] = make(coder.Piece, chunk)
+	}
+	for start := uint(0); start < d.pieceLength; start += chunk {
+		length := chunk
+		if start+length > d.pieceLength {
+			length = d.pieceLength - start
+		}
+		for i := range coded {
+			if _, err := d.file.ReadAt(coded[i][:length], int64(uint(i)*d.pieceLength+start)); err != nil {
+				return err
+			}
+		}
+		coder.DefaultPool.Columns(int(length), func(from, to int) {
+			for i := range decoded {
+				out := decoded[i][from:to]
+				for k := range out {
+					out[k] = 0
+				}
+				for j := range coded {
+					d.field.MulAddSlice(out, coded[j][from:to], d.field.Symbol(inverse[i], j))
+				}
+			}
+		})
+		for i := range decoded {
+			if _, err := d.file.WriteAt(decoded[i][:length], int64(uint(i)*d.pieceLength+start)); err != nil {
+				return err
+			}
+		}
+	}
+	d.decoded = true
+	return nil
+}
+
+// invert returns the inverse of a square matrix by Gauss-Jordan
+// elimination
+func invert(field galoisfield.Field, m matrix.Matrix) (matrix.Matrix, error) {
+	n := len(m)
+	work := make(matrix.Matrix, n)
+	inverse := make(matrix.Matrix, n)
+	for i := range m {
+		work[i] = make([]byte, len(m[i]))
+		copy(work[i], m[i])
+		inverse[i] = make([]byte, len(m[i]))
+		field.SetSymbol(inverse[i], i, 1)
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && field.Symbol(work[pivot], col) == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, coder.ErrMoreUsefulPiecesRequired
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+
+		inv := field.Inv(field.Symbol(work[col], col))
+		field.MulSlice(work[col], work[col], inv)
+		field.MulSlice(inverse[col], inverse[col], inv)
+		for row := 0; row < n; row++ {
+			factor := field.Symbol(work[row], col)
+			if row == col || factor == 0 {
+				continue
+			}
+			field.MulAddSlice(work[row], work[col], factor)
+			field.MulAddSlice(inverse[row], inverse[col], factor)
+		}
+	}
+	return inverse, nil
+}
+
+// GetPiece - Reads a decoded piece back from the file, pieces are only
+// available once all are decoded
+func (d *DiskRLNCDecoder) GetPiece(i uint) (coder.Piece, error) {
+	if i >= d.expected {
+		return nil, coder.ErrPieceOutOfBound
+	}
+	if !d.decoded {
+		return nil, coder.ErrPieceNotDecodedYet
+	}
+	piece := make(coder.Piece, d.pieceLength)
+	if _, err := d.file.ReadAt(piece, int64(i*d.pieceLength)); err != nil {
+		return nil, err
+	}
+	return piece, nil
+}
+
+// GetPieces - Reads all decoded pieces back into memory, GetPiece reads
+// them one at a time instead
+func (d *DiskRLNCDecoder) GetPieces() ([]coder.Piece, error) {
+	if !d.decoded {
+		return nil, coder.ErrMoreUsefulPiecesRequired
+	}
+	pieces := make([]coder.Piece, 0, d.expected)
+	for i := uint(0); i < d.expected; i++ {
+		piece, err := d.GetPiece(i)
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, piece)
+	}
+	return pieces, nil
+}
+
+func (d *DiskRLNCDecoder) Subspace() *coder.Subspace {
+	return d.subspace.Clone()
+}
+
+// Checkpoint - Writes the coded pieces received so far in the format of
+// GaussElimRLNCDecoder, the rows are streamed from the file
+func (d *DiskRLNCDecoder) Checkpoint(w io.Writer) error {
+	if d.decoded {
+		// the rows are no coded pieces any more, but the checkpoint of
+		// a decoded generation is never used
+		return coder.ErrAllUsefulPiecesReceived
+	}
+	header := checkpointHeader{
+		Magic:      checkpointMagic,
+		Version:    checkpointVersion,
+		PieceCount: uint32(d.expected),
+		Rows:       uint32(len(d.vectors)),
+	}
+	if header.Rows > 0 {
+		header.VectorLen = uint32(d.expected) * uint32(d.field.SymbolSize())
+		header.PieceLength = uint64(d.pieceLength)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	for i, vector := range d.vectors {
+		if _, err := bw.Write(vector); err != nil {
+			return err
+		}
+		row := io.NewSectionReader(d.file, int64(uint(i)*d.pieceLength), int64(d.pieceLength))
+		if _, err := io.Copy(bw, row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Close removes the file the coded pieces are spilled to
+func (d *DiskRLNCDecoder) Close() error {
+	err := d.file.Close()
+	if removeErr := os.Remove(d.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// Returns a decoder for pieceCount pieces coded together over field,
+// which spills coded pieces to a temporary file in dir, or the default
+// directory for temporary files if dir is empty
+func NewDiskRLNCDecoder(field galoisfield.Field, pieceCount uint, dir string) (Decoder, error) {
+	file, err := os.CreateTemp(dir, "decoder-*")
+	if err != nil {
+		return nil, err
+	}
+	return &DiskRLNCDecoder{
+		field:    field,
+		expected: pieceCount,
+		vectors:  make(matrix.Matrix, 0, pieceCount),
+		subspace: coder.NewSubspace(field, pieceCount),
+		file:     file,
+	}, nil
+}
+
+// Reads back decoder state written by `Checkpoint` of either decoder into
+// a new DiskRLNCDecoder, one row at a time
+func NewDiskRLNCDecoderFromCheckpoint(r io.Reader, field galoisfield.Field, pieceCount uint, dir string) (Decoder, error) {
+	dec, err := NewDiskRLNCDecoder(field, pieceCount, dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := readCheckpoint(r, field, pieceCount, dec.AddPiece); err != nil {
+		dec.(*DiskRLNCDecoder).Close()
+		return nil, err
+	}
+	return dec, nil
+}
@@ -0,0 +1,120 @@
+package decoder_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/decoder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+func TestNewDiskRLNCDecoder(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	pieceCount := 128
+	pieceLength := 8192
+	pieces := generatePieces(uint(pieceCount), uint(pieceLength))
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
+
+	dir := t.TempDir()
+	dec, err := decoder.NewDiskRLNCDecoder(galoisfield.GF256, uint(pieceCount), dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer dec.(*decoder.DiskRLNCDecoder).Close()
+
+	for !dec.IsDecoded() {
+		required := dec.Required()
+		if _, err := dec.GetPiece(0); !errors.Is(err, coder.ErrPieceNotDecodedYet) {
+			t.Fatal("expected pieces not to be readable before decoding")
+		}
+		if err := dec.AddPiece(enc.CodedPiece()); err != nil {
+			t.Fatal(err.Error())
+		}
+		if dec.Required() > required {
+			t.Fatal("expected required piece count to monotonically decrease")
+		}
+	}
+	if err := dec.AddPiece(enc.CodedPiece()); !errors.Is(err, coder.ErrAllUsefulPiecesReceived) {
+		t.Fatal("expected error indication, received nothing !")
+	}
+
+	d_pieces, err := dec.GetPieces()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := 0; i < pieceCount; i++ {
+		if !bytes.Equal(pieces[i], d_pieces[i]) {
+			t.Fatal("decoded data doesn't match !")
+		}
+	}
+
+	if err := dec.(*decoder.DiskRLNCDecoder).Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatal("expected spilled pieces to be removed on close")
+	}
+}
+
+func TestDiskRLNCDecoderCheckpoint(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	pieceCount := 64
+	pieceLength := 4096
+	pieces := generatePieces(uint(pieceCount), uint(pieceLength))
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
+
+	dec, err := decoder.NewDiskRLNCDecoder(galoisfield.GF256, uint(pieceCount), t.TempDir())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer dec.(*decoder.DiskRLNCDecoder).Close()
+	for i := 0; i < pieceCount/2; i++ {
+		if err := dec.AddPiece(enc.CodedPiece()); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := dec.(decoder.Checkpointer).Checkpoint(buf); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// either decoder resumes from the checkpoint of the other
+	restored, err := decoder.NewGaussElimRLNCDecoderFromCheckpoint(bytes.NewReader(buf.Bytes()), galoisfield.GF256, uint(pieceCount))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	spilled, err := decoder.NewDiskRLNCDecoderFromCheckpoint(bytes.NewReader(buf.Bytes()), galoisfield.GF256, uint(pieceCount), t.TempDir())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer spilled.(*decoder.DiskRLNCDecoder).Close()
+
+	for _, dec := range []decoder.Decoder{restored, spilled} {
+		if dec.Required() != uint(pieceCount/2) {
+			t.Fatalf("expected %d pieces to be required after restoring, found %d\n", pieceCount/2, dec.Required())
+		}
+		for !dec.IsDecoded() {
+			if err := dec.AddPiece(enc.CodedPiece()); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		d_pieces, err := dec.GetPieces()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for i := 0; i < pieceCount; i++ {
+			if !bytes.Equal(pieces[i], d_pieces[i]) {
+				t.Fatal("decoded data doesn't match !")
+			}
+		}
+	}
+}
@@ -2,7 +2,7 @@ package decoder
 
 import (
 	"github.com/aecra/PeerCodeX/coder"
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 type GaussElimRLNCDecoder struct {
@@ -106,6 +106,16 @@ func (d *GaussElimRLNCDecoder) GetPieces() ([]coder.Piece, error) {
 	return pieces, nil
 }
 
+// Subspace - Span of coding vectors received so far, to be sent
+// to senders so that they only send innovative pieces
+func (d *GaussElimRLNCDecoder) Subspace() *coder.Subspace {
+	subspace := coder.NewSubspace(d.state.field, d.expected)
+	for _, vector := range d.state.CoefficientMatrix() {
+		subspace.Add(vector)
+	}
+	return subspace
+}
+
 // If minimum #-of linearly independent coded pieces required
 // for decoding coded pieces --- is provided with,
 // it returns a decoder, which keeps applying
@@ -114,8 +124,9 @@ func (d *GaussElimRLNCDecoder) GetPieces() ([]coder.Piece, error) {
 // As soon as minimum #-of linearly independent pieces are obtained
 // which is generally equal to original #-of pieces, decoded pieces
 // can be read back
-func NewGaussElimRLNCDecoder(pieceCount uint) Decoder {
-	gf := galoisfield.DefaultGF256
-	state := NewGaussElimDecoderStateWithPieceCount(gf, pieceCount)
+//
+// Pieces are decoded over field, the one they're coded over
+func NewGaussElimRLNCDecoder(field galoisfield.Field, pieceCount uint) Decoder {
+	state := NewGaussElimDecoderStateWithPieceCount(field, pieceCount)
 	return &GaussElimRLNCDecoder{expected: pieceCount, state: state}
 }
@@ -1,15 +1,13 @@
 package decoder
 
 import (
-	"sync"
-
 	"github.com/aecra/PeerCodeX/coder"
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"github.com/aecra/PeerCodeX/coder/matrix"
 )
 
 type GaussElimDecoderState struct {
-	field      *galoisfield.GF
+	field      galoisfield.Field
 	pieceCount uint
 	coeffs     matrix.Matrix
 	coded      matrix.Matrix
@@ -24,19 +22,49 @@ func min(a, b int) int {
 	return b
 }
 
+// rowOp adds quotient times the pivot row to a row of coded pieces
+type rowOp struct {
+	row      int
+	quotient uint16
+}
+
+// eliminate applies row operations with the pivot row to coded pieces,
+// split across column ranges on the shared pool
+func (d *GaussElimDecoderState) eliminate(pivot int, ops []rowOp) {
+	if len(ops) == 0 {
+		return
+	}
+	coder.DefaultPool.Columns(len(d.coded[pivot]), func(start, end int) {
+		src := d.coded[pivot][start:end]
+		for _, op := range ops {
+			d.field.MulAddSlice(d.coded[op.row][start:end], src, op.quotient)
+		}
+	})
+}
+
+// symbols returns the coefficients in every row of m
+func (d *GaussElimDecoderState) symbols(m matrix.Matrix) int {
+	return int(m.Cols()) / d.field.SymbolSize()
+}
+
+// from returns the symbols of row from col on
+func (d *GaussElimDecoderState) from(row []byte, col int) []byte {
+	return row[col*d.field.SymbolSize():]
+}
+
 func (d *GaussElimDecoderState) clean_forward() {
 	var (
 		rows     int = int(d.coeffs.Rows())
-		cols     int = int(d.coeffs.Cols())
+		cols     int = d.symbols(d.coeffs)
 		boundary int = min(rows, cols)
 	)
 
 	for i := 0; i < boundary; i++ {
-		if d.coeffs[i][i] == 0 {
+		if d.field.Symbol(d.coeffs[i], i) == 0 {
 			non_zero_col := false
 			pivot := i + 1
 			for ; pivot < rows; pivot++ {
-				if d.coeffs[pivot][i] != 0 {
+				if d.field.Symbol(d.coeffs[pivot], i) != 0 {
 					non_zero_col = true
 					break
 				}
@@ -60,42 +88,33 @@ func (d *GaussElimDecoderState) clean_forward() {
 			}
 		}
 
-		var wg sync.WaitGroup
+		ops := make([]rowOp, 0, rows-i-1)
 		for j := i + 1; j < rows; j++ {
-			if d.coeffs[j][i] == 0 {
+			if d.field.Symbol(d.coeffs[j], i) == 0 {
 				continue
 			}
 
-			quotient := d.field.Div(d.coeffs[j][i], d.coeffs[i][i])
-			for k := i; k < cols; k++ {
-				d.coeffs[j][k] = d.field.Add(d.coeffs[j][k], d.field.Mul(d.coeffs[i][k], quotient))
-			}
-
-			wg.Add(1)
-			go func(j int, quotient byte) {
-				defer wg.Done()
-				for k := 0; k < len(d.coded[0]); k++ {
-					d.coded[j][k] = d.field.Add(d.coded[j][k], d.field.Mul(d.coded[i][k], quotient))
-				}
-			}(j, quotient)
+			quotient := d.field.Div(d.field.Symbol(d.coeffs[j], i), d.field.Symbol(d.coeffs[i], i))
+			d.field.MulAddSlice(d.from(d.coeffs[j], i), d.from(d.coeffs[i], i), quotient)
+			ops = append(ops, rowOp{j, quotient})
 		}
-		wg.Wait()
+		d.eliminate(i, ops)
 	}
 }
 
 func (d *GaussElimDecoderState) clean_forward_li() {
 	var (
 		rows     int = int(d.coeffsLI.Rows())
-		cols     int = int(d.coeffsLI.Cols())
+		cols     int = d.symbols(d.coeffsLI)
 		boundary int = min(rows, cols)
 	)
 
 	for i := 0; i < boundary; i++ {
-		if d.coeffsLI[i][i] == 0 {
+		if d.field.Symbol(d.coeffsLI[i], i) == 0 {
 			non_zero_col := false
 			pivot := i + 1
 			for ; pivot < rows; pivot++ {
-				if d.coeffsLI[pivot][i] != 0 {
+				if d.field.Symbol(d.coeffsLI[pivot], i) != 0 {
 					non_zero_col = true
 					break
 				}
@@ -114,14 +133,12 @@ func (d *GaussElimDecoderState) clean_forward_li() {
 		}
 
 		for j := i + 1; j < rows; j++ {
-			if d.coeffsLI[j][i] == 0 {
+			if d.field.Symbol(d.coeffsLI[j], i) == 0 {
 				continue
 			}
 
-			quotient := d.field.Div(d.coeffsLI[j][i], d.coeffsLI[i][i])
-			for k := i; k < cols; k++ {
-				d.coeffsLI[j][k] = d.field.Add(d.coeffsLI[j][k], d.field.Mul(d.coeffsLI[i][k], quotient))
-			}
+			quotient := d.field.Div(d.field.Symbol(d.coeffsLI[j], i), d.field.Symbol(d.coeffsLI[i], i))
+			d.field.MulAddSlice(d.from(d.coeffsLI[j], i), d.from(d.coeffsLI[i], i), quotient)
 		}
 	}
 }
@@ -129,92 +146,68 @@ func (d *GaussElimDecoderState) clean_forward_li() {
 func (d *GaussElimDecoderState) clean_backward() {
 	var (
 		rows     int = int(d.coeffs.Rows())
-		cols     int = int(d.coeffs.Cols())
+		cols     int = d.symbols(d.coeffs)
 		boundary int = min(rows, cols)
 	)
 
 	for i := boundary - 1; i >= 0; i-- {
-		if d.coeffs[i][i] == 0 {
+		if d.field.Symbol(d.coeffs[i], i) == 0 {
 			continue
 		}
 
-		var wg sync.WaitGroup
+		ops := make([]rowOp, 0, i)
 		for j := 0; j < i; j++ {
-			if d.coeffs[j][i] == 0 {
+			if d.field.Symbol(d.coeffs[j], i) == 0 {
 				continue
 			}
 
-			quotient := d.field.Div(d.coeffs[j][i], d.coeffs[i][i])
-			for k := i; k < cols; k++ {
-				d.coeffs[j][k] = d.field.Add(d.coeffs[j][k], d.field.Mul(d.coeffs[i][k], quotient))
-			}
-
-			wg.Add(1)
-			go func(j int, quotient byte) {
-				defer wg.Done()
-				for k := 0; k < len(d.coded[0]); k++ {
-					d.coded[j][k] = d.field.Add(d.coded[j][k], d.field.Mul(d.coded[i][k], quotient))
-				}
-			}(j, quotient)
+			quotient := d.field.Div(d.field.Symbol(d.coeffs[j], i), d.field.Symbol(d.coeffs[i], i))
+			d.field.MulAddSlice(d.from(d.coeffs[j], i), d.from(d.coeffs[i], i), quotient)
+			ops = append(ops, rowOp{j, quotient})
 		}
-		wg.Wait()
+		d.eliminate(i, ops)
 
-		if d.coeffs[i][i] == 1 {
+		if d.field.Symbol(d.coeffs[i], i) == 1 {
 			continue
 		}
 
-		inv := d.field.Div(1, d.coeffs[i][i])
-		d.coeffs[i][i] = 1
-		for j := i + 1; j < cols; j++ {
-			if d.coeffs[i][j] == 0 {
-				continue
-			}
-
-			d.coeffs[i][j] = d.field.Mul(d.coeffs[i][j], inv)
-		}
-
-		for j := 0; j < len(d.coded[0]); j++ {
-			d.coded[i][j] = d.field.Mul(d.coded[i][j], inv)
-		}
+		inv := d.field.Div(1, d.field.Symbol(d.coeffs[i], i))
+		d.field.SetSymbol(d.coeffs[i], i, 1)
+		d.field.MulSlice(d.from(d.coeffs[i], i+1), d.from(d.coeffs[i], i+1), inv)
+		coder.DefaultPool.Columns(len(d.coded[i]), func(start, end int) {
+			d.field.MulSlice(d.coded[i][start:end], d.coded[i][start:end], inv)
+		})
 	}
 }
 
 func (d *GaussElimDecoderState) clean_backward_li() {
 	var (
 		rows     int = int(d.coeffsLI.Rows())
-		cols     int = int(d.coeffsLI.Cols())
+		cols     int = d.symbols(d.coeffsLI)
 		boundary int = min(rows, cols)
 	)
 
 	for i := boundary - 1; i >= 0; i-- {
-		if d.coeffsLI[i][i] == 0 {
+		if d.field.Symbol(d.coeffsLI[i], i) == 0 {
 			continue
 		}
 
 		for j := 0; j < i; j++ {
-			if d.coeffsLI[j][i] == 0 {
+			if d.field.Symbol(d.coeffsLI[j], i) == 0 {
 				continue
 			}
 
-			quotient := d.field.Div(d.coeffsLI[j][i], d.coeffsLI[i][i])
-			for k := i; k < cols; k++ {
-				d.coeffsLI[j][k] = d.field.Add(d.coeffsLI[j][k], d.field.Mul(d.coeffsLI[i][k], quotient))
-			}
+			quotient := d.field.Div(d.field.Symbol(d.coeffsLI[j], i), d.field.Symbol(d.coeffsLI[i], i))
+			d.field.MulAddSlice(d.from(d.coeffsLI[j], i), d.from(d.coeffsLI[i], i), quotient)
 		}
 
-		if d.coeffsLI[i][i] == 1 {
+		if d.field.Symbol(d.coeffsLI[i], i) == 1 {
 			continue
 		}
 
-		inv := d.field.Div(1, d.coeffsLI[i][i])
-		d.coeffsLI[i][i] = 1
-		for j := i + 1; j < cols; j++ {
-			if d.coeffsLI[i][j] == 0 {
-				continue
-			}
-
-			d.coeffsLI[i][j] = d.field.Mul(d.coeffsLI[i][j], inv)
-		}
+		inv := d.field.Div(1, d.field.Symbol(d.coeffsLI[i], i))
+		d.field.SetSymbol(d.coeffsLI[i], i, 1)
+		d.field.MulSlice(d.from(d.coeffsLI[i], i+1), d.from(d.coeffsLI[i], i+1), inv)
 	}
 }
 
@@ -388,20 +381,20 @@ func (d *GaussElimDecoderState) GetPiece(idx uint) (coder.Piece, error) {
 		return d.coded[idx], nil
 	}
 
-	cols := int(d.coeffs.Cols())
+	cols := d.symbols(d.coeffs)
 	decoded := true
 
 OUT:
 	for i := 0; i < cols; i++ {
 		switch i {
 		case int(idx):
-			if d.coeffs[idx][i] != 1 {
+			if d.field.Symbol(d.coeffs[idx], i) != 1 {
 				decoded = false
 				break OUT
 			}
 
 		default:
-			if d.coeffs[idx][i] == 0 {
+			if d.field.Symbol(d.coeffs[idx], i) == 0 {
 				decoded = false
 				break OUT
 			}
@@ -418,12 +411,12 @@ OUT:
 	return buf, nil
 }
 
-func NewGaussElimDecoderStateWithPieceCount(gf *galoisfield.GF, pieceCount uint) *GaussElimDecoderState {
+func NewGaussElimDecoderStateWithPieceCount(gf galoisfield.Field, pieceCount uint) *GaussElimDecoderState {
 	coeffs := make([][]byte, 0, pieceCount)
 	coded := make([][]byte, 0, pieceCount)
 	return &GaussElimDecoderState{field: gf, pieceCount: pieceCount, coeffs: coeffs, coded: coded}
 }
 
-func NewGaussElimDecoderState(gf *galoisfield.GF, coeffs, coded matrix.Matrix) *GaussElimDecoderState {
+func NewGaussElimDecoderState(gf galoisfield.Field, coeffs, coded matrix.Matrix) *GaussElimDecoderState {
 	return &GaussElimDecoderState{field: gf, pieceCount: uint(len(coeffs)), coeffs: coeffs, coded: coded}
 }
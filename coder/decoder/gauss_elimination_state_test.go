@@ -4,12 +4,12 @@ import (
 	"testing"
 
 	"github.com/aecra/PeerCodeX/coder/decoder"
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"github.com/aecra/PeerCodeX/coder/matrix"
 )
 
 func TestMatrixRref(t *testing.T) {
-	field := galoisfield.DefaultGF256
+	field := galoisfield.GF256
 
 	{
 		m := matrix.Matrix{{70, 137, 2, 152}, {223, 92, 234, 98}, {217, 141, 33, 44}, {145, 135, 71, 45}}
@@ -52,7 +52,7 @@ func TestMatrixRref(t *testing.T) {
 }
 
 func TestMatrixRank(t *testing.T) {
-	field := galoisfield.DefaultGF256
+	field := galoisfield.GF256
 
 	{
 		m := matrix.Matrix{{70, 137, 2, 152}, {223, 92, 234, 98}, {217, 141, 33, 44}, {145, 135, 71, 45}}
@@ -7,9 +7,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aecra/PeerCodeX/coder"
 	"github.com/aecra/PeerCodeX/coder/decoder"
 	"github.com/aecra/PeerCodeX/coder/encoder"
-	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 // Generates `N`-bytes of random data from default
@@ -38,14 +39,14 @@ func TestNewGaussElimRLNCDecoder(t *testing.T) {
 	pieceLength := 8192
 	codedPieceCount := pieceCount + 2
 	pieces := generatePieces(uint(pieceCount), uint(pieceLength))
-	enc := encoder.NewFullRLNCEncoder(pieces)
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
 
 	coded := make([]*coder.CodedPiece, 0, codedPieceCount)
 	for i := 0; i < codedPieceCount; i++ {
 		coded = append(coded, enc.CodedPiece())
 	}
 
-	dec := decoder.NewGaussElimRLNCDecoder(uint(pieceCount))
+	dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, uint(pieceCount))
 	neededPieceCount := uint(pieceCount)
 	for i := 0; i < codedPieceCount; i++ {
 
@@ -95,3 +96,49 @@ func TestNewGaussElimRLNCDecoder(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodersOverFields(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	for _, field := range []galoisfield.Field{galoisfield.GF2, galoisfield.GF65536} {
+		pieceCount := uint(32)
+		// odd length, to be padded to whole symbols of every piece
+		data := generateData(4095)
+		enc, err := encoder.NewFullRLNCEncoderWithPieceCount(field, data, pieceCount)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		disk, err := decoder.NewDiskRLNCDecoder(field, pieceCount, t.TempDir())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer disk.(*decoder.DiskRLNCDecoder).Close()
+
+		decoders := []decoder.Decoder{
+			decoder.NewGaussElimRLNCDecoder(field, pieceCount),
+			decoder.NewProgressiveRLNCDecoder(field, pieceCount),
+			disk,
+		}
+		for _, dec := range decoders {
+			for !dec.IsDecoded() {
+				if err := dec.AddPiece(enc.CodedPiece()); err != nil {
+					t.Fatalf("%s: %s", field.Name(), err.Error())
+				}
+			}
+			d_pieces, err := dec.GetPieces()
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			decoded := make([]byte, 0, len(data)+int(enc.Padding()))
+			for _, piece := range d_pieces {
+				if len(piece)%field.SymbolSize() != 0 {
+					t.Fatalf("%s: piece of %d bytes isn't made of whole symbols", field.Name(), len(piece))
+				}
+				decoded = append(decoded, piece...)
+			}
+			if !bytes.Equal(data, decoded[:len(data)]) {
+				t.Fatalf("%s: decoded data doesn't match !", field.Name())
+			}
+		}
+	}
+}
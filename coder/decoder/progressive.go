@@ -0,0 +1,211 @@
+package decoder
+
+import (
+	"io"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+// ProgressiveRLNCDecoder performs Gauss-Jordan elimination on-the-fly,
+// one coded piece at a time. Rows held are always in reduced row echelon
+// form, so a new piece is only reduced against the pivots of existing
+// rows, and only its own pivot is eliminated from them in turn. That's
+// O(n * pieceLength) work per piece, where GaussElimRLNCDecoder redoes
+// the elimination of the whole matrix.
+type ProgressiveRLNCDecoder struct {
+	field       galoisfield.Field
+	expected    uint
+	pieceLength uint
+	rows        []*coder.CodedPiece // 1 at own pivot, 0 at pivots of other rows
+	pivots      []int               // row of every pivot column, -1 if none
+}
+
+// PieceLength - Returns piece length in bytes, 0 if no pieces are
+// added yet
+func (d *ProgressiveRLNCDecoder) PieceLength() uint {
+	return d.pieceLength
+}
+
+func (d *ProgressiveRLNCDecoder) IsDecoded() bool {
+	return uint(len(d.rows)) >= d.expected
+}
+
+func (d *ProgressiveRLNCDecoder) Required() uint {
+	return d.expected - uint(len(d.rows))
+}
+
+func (d *ProgressiveRLNCDecoder) ProcessRate() float64 {
+	return float64(len(d.rows)) / float64(d.expected)
+}
+
+// AddPiece - Reduces the coded piece against rows held, it's kept as a
+// new row only if it's linearly independent of them. Like with
+// GaussElimRLNCDecoder, a piece kept is reduced in place.
+func (d *ProgressiveRLNCDecoder) AddPiece(piece *coder.CodedPiece) error {
+	if d.IsDecoded() {
+		return coder.ErrAllUsefulPiecesReceived
+	}
+	if len(piece.Vector) != int(d.expected)*d.field.SymbolSize() {
+		return coder.ErrCodingVectorLengthMismatch
+	}
+	if d.pieceLength == 0 {
+		d.pieceLength = uint(len(piece.Piece))
+	} else if uint(len(piece.Piece)) != d.pieceLength {
+		return coder.ErrCodedDataLengthMismatch
+	}
+
+	// rows held have 0 at pivots of each other, so the coefficient of
+	// every row eliminated is the one the piece has at its pivot. The
+	// coding vector is reduced first, so that a piece which isn't
+	// linearly independent is left as it is.
+	reduced := make(coder.CodingVector, len(piece.Vector))
+	copy(reduced, piece.Vector)
+	reduce := make([]*coder.CodedPiece, 0, len(d.rows))
+	coeffs := make([]uint16, 0, len(d.rows))
+	for p, i := range d.pivots {
+		if c := d.field.Symbol(piece.Vector, p); i >= 0 && c != 0 {
+			d.field.MulAddSlice(reduced, d.rows[i].Vector, c)
+			reduce = append(reduce, d.rows[i])
+			coeffs = append(coeffs, c)
+		}
+	}
+	pivot := 0
+	for pivot < int(d.expected) && d.field.Symbol(reduced, pivot) == 0 {
+		pivot++
+	}
+	if pivot == int(d.expected) {
+		return nil
+	}
+	copy(piece.Vector, reduced)
+	piece.Encoding = coder.FullVector
+
+	inv := d.field.Inv(d.field.Symbol(piece.Vector, pivot))
+	d.field.MulSlice(piece.Vector, piece.Vector, inv)
+
+	// back-substitute the new pivot
+	substitute := make([]*coder.CodedPiece, 0, len(d.rows))
+	factors := make([]uint16, 0, len(d.rows))
+	for _, row := range d.rows {
+		if c := d.field.Symbol(row.Vector, pivot); c != 0 {
+			d.field.MulAddSlice(row.Vector, piece.Vector, c)
+			substitute = append(substitute, row)
+			factors = append(factors, c)
+		}
+	}
+
+	// every step only mixes bytes of the same column, so each column
+	// range goes through all of them on its own
+	coder.DefaultPool.Columns(len(piece.Piece), func(start, end int) {
+		dst := piece.Piece[start:end]
+		for k, row := range reduce {
+			d.field.MulAddSlice(dst, row.Piece[start:end], coeffs[k])
+		}
+		if inv != 1 {
+			d.field.MulSlice(dst, dst, inv)
+		}
+		for k, row := range substitute {
+			d.field.MulAddSlice(row.Piece[start:end], dst, factors[k])
+		}
+	})
+
+	d.pivots[pivot] = len(d.rows)
+	d.rows = append(d.rows, piece)
+	return nil
+}
+
+// GetPiece - Returns piece i once it's decoded, which may happen before
+// all pieces are, as soon as the row with its pivot has no other
+// non-zero coefficient
+func (d *ProgressiveRLNCDecoder) GetPiece(i uint) (coder.Piece, error) {
+	if i >= d.expected {
+		return nil, coder.ErrPieceOutOfBound
+	}
+	if d.pivots[i] < 0 {
+		return nil, coder.ErrPieceNotDecodedYet
+	}
+	row := d.rows[d.pivots[i]]
+	if d.IsDecoded() {
+		return row.Piece, nil
+	}
+	for k := 0; k < int(d.expected); k++ {
+		if uint(k) != i && d.field.Symbol(row.Vector, k) != 0 {
+			return nil, coder.ErrPieceNotDecodedYet
+		}
+	}
+
+	// the row may still change as pieces are added
+	piece := make(coder.Piece, len(row.Piece))
+	copy(piece, row.Piece)
+	return piece, nil
+}
+
+// GetPieces - Get a list of all decoded pieces, given full
+// decoding has happened
+func (d *ProgressiveRLNCDecoder) GetPieces() ([]coder.Piece, error) {
+	if !d.IsDecoded() {
+		return nil, coder.ErrMoreUsefulPiecesRequired
+	}
+	pieces := make([]coder.Piece, 0, d.expected)
+	for i := uint(0); i < d.expected; i++ {
+		pieces = append(pieces, d.rows[d.pivots[i]].Piece)
+	}
+	return pieces, nil
+}
+
+func (d *ProgressiveRLNCDecoder) Subspace() *coder.Subspace {
+	pivots := make([]uint, len(d.rows))
+	vectors := make([]coder.CodingVector, len(d.rows))
+	for pivot, i := range d.pivots {
+		if i >= 0 {
+			pivots[i] = uint(pivot)
+			vectors[i] = d.rows[i].Vector
+		}
+	}
+	return coder.NewSubspaceFromRows(d.field, d.expected, pivots, vectors)
+}
+
+// CodedPieces - Returns copies of rows held by decoder as coded pieces,
+// which can be used for ( re-)building a recoder
+func (d *ProgressiveRLNCDecoder) CodedPieces() []*coder.CodedPiece {
+	pieces := make([]*coder.CodedPiece, 0, len(d.rows))
+	for _, row := range d.rows {
+		pieces = append(pieces, &coder.CodedPiece{
+			Vector: append(coder.CodingVector{}, row.Vector...),
+			Piece:  append(coder.Piece{}, row.Piece...),
+		})
+	}
+	return pieces
+}
+
+// Checkpoint - Writes rows held in the format of GaussElimRLNCDecoder,
+// which can later be fed to `NewProgressiveRLNCDecoderFromCheckpoint`
+func (d *ProgressiveRLNCDecoder) Checkpoint(w io.Writer) error {
+	return writeCheckpoint(w, d.field, d.expected, d.pieceLength, d.rows)
+}
+
+// Returns a decoder for pieceCount pieces coded together over field,
+// which keeps decoded pieces as ready as possible as coded pieces are
+// added
+func NewProgressiveRLNCDecoder(field galoisfield.Field, pieceCount uint) Decoder {
+	pivots := make([]int, pieceCount)
+	for i := range pivots {
+		pivots[i] = -1
+	}
+	return &ProgressiveRLNCDecoder{
+		field:    field,
+		expected: pieceCount,
+		rows:     make([]*coder.CodedPiece, 0, pieceCount),
+		pivots:   pivots,
+	}
+}
+
+// Reads back decoder state written by `Checkpoint` of any decoder into a
+// new ProgressiveRLNCDecoder
+func NewProgressiveRLNCDecoderFromCheckpoint(r io.Reader, field galoisfield.Field, pieceCount uint) (Decoder, error) {
+	dec := NewProgressiveRLNCDecoder(field, pieceCount)
+	if err := readCheckpoint(r, field, pieceCount, dec.AddPiece); err != nil {
+		return nil, err
+	}
+	return dec, nil
+}
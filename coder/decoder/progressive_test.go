@@ -0,0 +1,134 @@
+package decoder_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/decoder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+func TestNewProgressiveRLNCDecoder(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	pieceCount := 128
+	pieceLength := 8192
+	codedPieceCount := pieceCount + 2
+	pieces := generatePieces(uint(pieceCount), uint(pieceLength))
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
+
+	dec := decoder.NewProgressiveRLNCDecoder(galoisfield.GF256, uint(pieceCount))
+	for i := 0; i < codedPieceCount; i++ {
+		required := dec.Required()
+		piece := enc.CodedPiece()
+		if err := dec.AddPiece(piece); errors.Is(err, coder.ErrAllUsefulPiecesReceived) {
+			break
+		} else if err != nil {
+			t.Fatal(err.Error())
+		}
+		if dec.Required() > required {
+			t.Fatal("expected required piece count to monotonically decrease")
+		}
+		if subspace := dec.Subspace(); subspace.Rank() != uint(pieceCount)-dec.Required() {
+			t.Fatalf("expected subspace of rank %d, found %d", uint(pieceCount)-dec.Required(), subspace.Rank())
+		}
+	}
+
+	if !dec.IsDecoded() {
+		t.Fatal("expected to be fully decoded !")
+	}
+	d_pieces, err := dec.GetPieces()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := 0; i < pieceCount; i++ {
+		if !bytes.Equal(pieces[i], d_pieces[i]) {
+			t.Fatal("decoded data doesn't match !")
+		}
+	}
+}
+
+func TestProgressiveRLNCDecoder_GetPiece(t *testing.T) {
+	pieceCount := 16
+	pieces := generatePieces(uint(pieceCount), 64)
+	dec := decoder.NewProgressiveRLNCDecoder(galoisfield.GF256, uint(pieceCount))
+
+	// piece 1 is decoded by the second of these, the others aren't yet
+	vectors := []coder.CodingVector{make(coder.CodingVector, pieceCount), make(coder.CodingVector, pieceCount)}
+	vectors[0][0], vectors[0][1], vectors[0][2] = 1, 2, 3
+	vectors[1][0], vectors[1][1], vectors[1][2] = 1, 3, 3
+	for _, vector := range vectors {
+		piece := make(coder.Piece, 64)
+		for i, c := range vector {
+			piece.Multiply(pieces[i], uint16(c), galoisfield.GF256)
+		}
+		if err := dec.AddPiece(&coder.CodedPiece{Vector: vector, Piece: piece}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	if piece, err := dec.GetPiece(1); err != nil || !bytes.Equal(piece, pieces[1]) {
+		t.Fatal("expected piece 1 to be decoded")
+	}
+	for _, i := range []uint{0, 2, 3} {
+		if _, err := dec.GetPiece(i); !errors.Is(err, coder.ErrPieceNotDecodedYet) {
+			t.Fatalf("expected piece %d not to be decoded yet", i)
+		}
+	}
+	if _, err := dec.GetPiece(uint(pieceCount)); !errors.Is(err, coder.ErrPieceOutOfBound) {
+		t.Fatal("expected out of bound piece to be rejected")
+	}
+}
+
+func TestProgressiveRLNCDecoderCheckpoint(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	pieceCount := 64
+	pieces := generatePieces(uint(pieceCount), 4096)
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
+
+	dec := decoder.NewProgressiveRLNCDecoder(galoisfield.GF256, uint(pieceCount))
+	for i := 0; i < pieceCount/2; i++ {
+		if err := dec.AddPiece(enc.CodedPiece()); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := dec.(decoder.Checkpointer).Checkpoint(buf); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// either decoder resumes from the checkpoint of the other
+	restored, err := decoder.NewGaussElimRLNCDecoderFromCheckpoint(bytes.NewReader(buf.Bytes()), galoisfield.GF256, uint(pieceCount))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	progressive, err := decoder.NewProgressiveRLNCDecoderFromCheckpoint(bytes.NewReader(buf.Bytes()), galoisfield.GF256, uint(pieceCount))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, dec := range []decoder.Decoder{restored, progressive} {
+		if dec.Required() != uint(pieceCount/2) {
+			t.Fatalf("expected %d pieces to be required after restoring, found %d\n", pieceCount/2, dec.Required())
+		}
+		for !dec.IsDecoded() {
+			if err := dec.AddPiece(enc.CodedPiece()); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		d_pieces, err := dec.GetPieces()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for i := 0; i < pieceCount; i++ {
+			if !bytes.Equal(pieces[i], d_pieces[i]) {
+				t.Fatal("decoded data doesn't match !")
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package encoder
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/aecra/PeerCodeX/coder"
+)
+
+// PieceCache holds recently read original pieces of streaming encoders, up
+// to a number of bytes in total. One cache may be shared by the encoders of
+// many generations, pieces are told apart by the key of their encoder.
+//
+// Cached pieces are only ever read, so they are handed out without copying.
+type PieceCache struct {
+	mutex    sync.Mutex
+	capacity uint
+	size     uint
+	order    *list.List // of *cachedPiece, most recently used first
+	pieces   map[cacheKey]*list.Element
+}
+
+type cacheKey struct {
+	key   string
+	index uint
+}
+
+type cachedPiece struct {
+	key   cacheKey
+	piece coder.Piece
+}
+
+// NewPieceCache returns a cache holding at most capacity bytes of pieces
+func NewPieceCache(capacity uint) *PieceCache {
+	return &PieceCache{
+		capacity: capacity,
+		order:    list.New(),
+		pieces:   make(map[cacheKey]*list.Element),
+	}
+}
+
+// Get returns the cached piece of the encoder with key, or nil
+func (c *PieceCache) Get(key string, index uint) coder.Piece {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.pieces[cacheKey{key, index}]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*cachedPiece).piece
+}
+
+// Put caches a piece of the encoder with key, evicting the least recently
+// used pieces to make room for it. Pieces larger than the cache are not
+// cached.
+func (c *PieceCache) Put(key string, index uint, piece coder.Piece) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if uint(len(piece)) > c.capacity {
+		return
+	}
+	k := cacheKey{key, index}
+	if element, ok := c.pieces[k]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.size+uint(len(piece)) > c.capacity {
+		c.evict(c.order.Back())
+	}
+	c.pieces[k] = c.order.PushFront(&cachedPiece{key: k, piece: piece})
+	c.size += uint(len(piece))
+}
+
+// SetCapacity changes the bytes of pieces the cache holds at most,
+// evicting the least recently used pieces beyond it
+func (c *PieceCache) SetCapacity(capacity uint) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.capacity = capacity
+	for c.size > c.capacity {
+		c.evict(c.order.Back())
+	}
+}
+
+// Capacity returns the bytes of pieces the cache holds at most
+func (c *PieceCache) Capacity() uint {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.capacity
+}
+
+// Drop forgets the pieces of the encoder with key
+func (c *PieceCache) Drop(key string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for k, element := range c.pieces {
+		if k.key == key {
+			c.evict(element)
+		}
+	}
+}
+
+// Size returns the bytes of pieces cached
+func (c *PieceCache) Size() uint {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+func (c *PieceCache) evict(element *list.Element) {
+	cached := c.order.Remove(element).(*cachedPiece)
+	delete(c.pieces, cached.key)
+	c.size -= uint(len(cached.piece))
+}
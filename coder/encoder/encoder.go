@@ -1,6 +1,9 @@
 package encoder
 
-import "github.com/aecra/PeerCodeX/coder"
+import (
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
 
 type Encoder interface {
 	PieceCount() uint
@@ -9,4 +12,85 @@ type Encoder interface {
 	CodedPieceLen() uint
 	Padding() uint
 	CodedPiece() *coder.CodedPiece
+	InnovativeCodedPiece(subspace *coder.Subspace) (*coder.CodedPiece, error)
+}
+
+// How many random coded pieces are drawn before falling back to
+// an original piece which is known to be innovative
+const innovativeAttempts = 4
+
+// Keeps drawing coded pieces until one is innovative for the subspace
+// of a receiver. Random pieces of sparse coding miss rather often, so
+// after a few attempts original piece of a column, which subspace lacks,
+// is returned in uncoded form --- which is always innovative
+//
+// Original piece i is obtained by calling original, see heldPieces
+func innovativeCodedPiece(field galoisfield.Field, codedPiece func() *coder.CodedPiece, pieceCount uint, original func(i uint) (coder.Piece, error), subspace *coder.Subspace) (*coder.CodedPiece, error) {
+	if subspace.PieceCount() != pieceCount {
+		return nil, coder.ErrCodingVectorLengthMismatch
+	}
+	for i := 0; i < innovativeAttempts; i++ {
+		piece := codedPiece()
+		if piece != nil && subspace.IsInnovative(piece.Vector) {
+			return piece, nil
+		}
+	}
+	return uncodedPiece(field, pieceCount, original, subspace)
+}
+
+// uncodedPiece returns the original piece of a column subspace lacks, in
+// uncoded form
+func uncodedPiece(field galoisfield.Field, pieceCount uint, original func(i uint) (coder.Piece, error), subspace *coder.Subspace) (*coder.CodedPiece, error) {
+	idx, ok := subspace.MissingPiece()
+	if !ok {
+		return nil, coder.ErrNotInnovative
+	}
+	source, err := original(idx)
+	if err != nil {
+		return nil, err
+	}
+	vector := make(coder.CodingVector, pieceCount*uint(field.SymbolSize()))
+	field.SetSymbol(vector, int(idx), 1)
+	piece := make(coder.Piece, len(source))
+	copy(piece, source)
+	return &coder.CodedPiece{
+		Vector:   vector,
+		Piece:    piece,
+		Encoding: coder.SparseVector,
+	}, nil
+}
+
+// originalPiecesWithPieceCount splits data into pieceCount pieces like
+// coder.OriginalPiecesFromDataAndPieceCount, but of whole symbols of
+// field, padding data at end as needed
+func originalPiecesWithPieceCount(field galoisfield.Field, data []byte, pieceCount uint) ([]coder.Piece, uint, error) {
+	symbol := uint(field.SymbolSize())
+	if symbol == 1 || pieceCount < 2 || pieceCount > uint(len(data)) {
+		return coder.OriginalPiecesFromDataAndPieceCount(data, pieceCount)
+	}
+	rest := uint(len(data)) % (symbol * pieceCount)
+	if rest == 0 {
+		return coder.OriginalPiecesFromDataAndPieceCount(data, pieceCount)
+	}
+	padded := make([]byte, uint(len(data))+symbol*pieceCount-rest)
+	copy(padded, data)
+	pieces, _, err := coder.OriginalPiecesFromDataAndPieceCount(padded, pieceCount)
+	return pieces, uint(len(padded) - len(data)), err
+}
+
+// originalPiecesWithPieceSize splits data like
+// coder.OriginalPiecesFromDataAndPieceSize, pieceSize must be of whole
+// symbols of field
+func originalPiecesWithPieceSize(field galoisfield.Field, data []byte, pieceSize uint) ([]coder.Piece, uint, error) {
+	if pieceSize%uint(field.SymbolSize()) != 0 {
+		return nil, 0, coder.ErrPieceSizeMisaligned
+	}
+	return coder.OriginalPiecesFromDataAndPieceSize(data, pieceSize)
+}
+
+// heldPieces returns original pieces held in memory to innovativeCodedPiece
+func heldPieces(pieces []coder.Piece) (uint, func(i uint) (coder.Piece, error)) {
+	return uint(len(pieces)), func(i uint) (coder.Piece, error) {
+		return pieces[i], nil
+	}
 }
@@ -1,12 +1,12 @@
 package encoder
 
 import (
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
 	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 type FullRLNCEncoder struct {
-	field  *galoisfield.GF
+	field  galoisfield.Field
 	pieces []coder.Piece
 	extra  uint
 }
@@ -46,7 +46,7 @@ func (f *FullRLNCEncoder) DecodableLen() uint {
 // Here N = len(pieces), original pieces which are
 // being coded together
 func (f *FullRLNCEncoder) CodedPieceLen() uint {
-	return f.PieceCount() + f.PieceSize()
+	return f.PieceCount()*uint(f.field.SymbolSize()) + f.PieceSize()
 }
 
 // How many extra padding bytes added at end of
@@ -61,35 +61,48 @@ func (f *FullRLNCEncoder) Padding() uint {
 // coding coefficients & performing full-RLNC with
 // all original pieces
 func (f *FullRLNCEncoder) CodedPiece() *coder.CodedPiece {
-	vector := coder.GenerateCodingVector(f.PieceCount())
+	vector, seed := coder.GenerateSeededCodingVector(f.field, f.PieceCount())
 	piece := make(coder.Piece, f.PieceSize())
-	for i := range f.pieces {
-		piece.Multiply(f.pieces[i], vector[i], f.field)
-	}
+	coder.DefaultPool.Columns(len(piece), func(start, end int) {
+		for i := range f.pieces {
+			f.field.MulAddSlice(piece[start:end], f.pieces[i][start:end], f.field.Symbol(vector, i))
+		}
+	})
 	return &coder.CodedPiece{
-		Vector: vector,
-		Piece:  piece,
+		Vector:   vector,
+		Piece:    piece,
+		Encoding: coder.SeededVector,
+		Seed:     seed,
 	}
 }
 
+// Returns a coded piece, which is guaranteed to be innovative
+// for a receiver holding `subspace`
+func (f *FullRLNCEncoder) InnovativeCodedPiece(subspace *coder.Subspace) (*coder.CodedPiece, error) {
+	pieceCount, original := heldPieces(f.pieces)
+	return innovativeCodedPiece(f.field, f.CodedPiece, pieceCount, original, subspace)
+}
+
 // Provide with original pieces on which fullRLNC to be performed
-// & get encoder, to be used for on-the-fly generation
+// over field & get encoder, to be used for on-the-fly generation
 // to N-many coded pieces
-func NewFullRLNCEncoder(pieces []coder.Piece) Encoder {
-	return &FullRLNCEncoder{pieces: pieces, field: galoisfield.DefaultGF256}
+//
+// Pieces must be of whole symbols of the field
+func NewFullRLNCEncoder(field galoisfield.Field, pieces []coder.Piece) Encoder {
+	return &FullRLNCEncoder{pieces: pieces, field: field}
 }
 
 // If you know #-of pieces you want to code together, invoking
 // this function splits whole data chunk into N-pieces, with padding
 // bytes appended at end of last piece, if required & prepares
 // full RLNC encoder for obtaining coded pieces
-func NewFullRLNCEncoderWithPieceCount(data []byte, pieceCount uint) (Encoder, error) {
-	pieces, padding, err := coder.OriginalPiecesFromDataAndPieceCount(data, pieceCount)
+func NewFullRLNCEncoderWithPieceCount(field galoisfield.Field, data []byte, pieceCount uint) (Encoder, error) {
+	pieces, padding, err := originalPiecesWithPieceCount(field, data, pieceCount)
 	if err != nil {
 		return nil, err
 	}
 
-	enc := NewFullRLNCEncoder(pieces)
+	enc := NewFullRLNCEncoder(field, pieces)
 	fenc := enc.(*FullRLNCEncoder)
 	fenc.extra = padding
 	return fenc, nil
@@ -98,13 +111,13 @@ func NewFullRLNCEncoderWithPieceCount(data []byte, pieceCount uint) (Encoder, er
 // If you want to have N-bytes piece size for each, this
 // function generates M-many pieces each of N-bytes size, which are ready
 // to be coded together with full RLNC
-func NewFullRLNCEncoderWithPieceSize(data []byte, pieceSize uint) (Encoder, error) {
-	pieces, padding, err := coder.OriginalPiecesFromDataAndPieceSize(data, pieceSize)
+func NewFullRLNCEncoderWithPieceSize(field galoisfield.Field, data []byte, pieceSize uint) (Encoder, error) {
+	pieces, padding, err := originalPiecesWithPieceSize(field, data, pieceSize)
 	if err != nil {
 		return nil, err
 	}
 
-	enc := NewFullRLNCEncoder(pieces)
+	enc := NewFullRLNCEncoder(field, pieces)
 	fenc := enc.(*FullRLNCEncoder)
 	fenc.extra = padding
 	return fenc, nil
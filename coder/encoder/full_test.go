@@ -8,9 +8,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aecra/PeerCodeX/coder"
 	"github.com/aecra/PeerCodeX/coder/decoder"
 	"github.com/aecra/PeerCodeX/coder/encoder"
-	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 // Generates `N`-bytes of random data from default
@@ -38,7 +39,7 @@ func fullEncoderFlow(t *testing.T, enc encoder.Encoder, pieceCount, codedPieceCo
 		coded = append(coded, enc.CodedPiece())
 	}
 
-	dec := decoder.NewGaussElimRLNCDecoder(uint(pieceCount))
+	dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, uint(pieceCount))
 	for i := 0; i < codedPieceCount; i++ {
 		if i < pieceCount {
 			if _, err := dec.GetPieces(); !(err != nil && errors.Is(err, coder.ErrMoreUsefulPiecesRequired)) {
@@ -84,7 +85,7 @@ func TestNewFullRLNCEncoder(t *testing.T) {
 	pieceLength := 8192
 	codedPieceCount := pieceCount + 2
 	pieces := generatePieces(uint(pieceCount), uint(pieceLength))
-	enc := encoder.NewFullRLNCEncoder(pieces)
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
 
 	fullEncoderFlow(t, enc, pieceCount, codedPieceCount, pieces)
 }
@@ -103,7 +104,7 @@ func TestNewFullRLNCEncoderWithPieceCount(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	enc, err := encoder.NewFullRLNCEncoderWithPieceCount(data, pieceCount)
+	enc, err := encoder.NewFullRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -126,7 +127,7 @@ func TestNewFullRLNCEncoderWithPieceSize(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	enc, err := encoder.NewFullRLNCEncoderWithPieceSize(data, pieceSize)
+	enc, err := encoder.NewFullRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -134,6 +135,26 @@ func TestNewFullRLNCEncoderWithPieceSize(t *testing.T) {
 	fullEncoderFlow(t, enc, pieceCount, codedPieceCount, pieces)
 }
 
+func TestFullRLNCEncoderOverGF65536(t *testing.T) {
+	field := galoisfield.GF65536
+	data := generateData(1001)
+	if _, err := encoder.NewFullRLNCEncoderWithPieceSize(field, data, 63); !errors.Is(err, coder.ErrPieceSizeMisaligned) {
+		t.Fatalf("expected odd piece size to be rejected, got %v", err)
+	}
+
+	enc, err := encoder.NewFullRLNCEncoderWithPieceCount(field, data, 8)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// 1001 bytes padded to 8 pieces of 63 symbols
+	if enc.Padding() != 7 || enc.CodedPieceLen() != 8*2+126 {
+		t.Fatalf("unexpected padding %d or coded piece length %d", enc.Padding(), enc.CodedPieceLen())
+	}
+	if c_piece := enc.CodedPiece(); len(c_piece.Vector) != 16 || len(c_piece.Piece) != 126 {
+		t.Fatalf("unexpected coded piece of %d + %d bytes", len(c_piece.Vector), len(c_piece.Piece))
+	}
+}
+
 func TestFullRLNCEncoderPadding(t *testing.T) {
 	rand.Seed(time.Now().UnixNano())
 
@@ -143,7 +164,7 @@ func TestFullRLNCEncoderPadding(t *testing.T) {
 			pieceCount := uint(2<<1 + rand.Intn(2<<8))
 			data := generateData(size)
 
-			enc, err := encoder.NewFullRLNCEncoderWithPieceCount(data, pieceCount)
+			enc, err := encoder.NewFullRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 			if err != nil {
 				t.Fatalf("Error: %s\n", err.Error())
 			}
@@ -164,7 +185,7 @@ func TestFullRLNCEncoderPadding(t *testing.T) {
 			pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 			data := generateData(size)
 
-			enc, err := encoder.NewFullRLNCEncoderWithPieceSize(data, pieceSize)
+			enc, err := encoder.NewFullRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize)
 			if err != nil {
 				t.Fatalf("Error: %s\n", err.Error())
 			}
@@ -187,7 +208,7 @@ func TestFullRLNCEncoder_CodedPieceLen(t *testing.T) {
 		pieceCount := uint(2<<1 + rand.Intn(2<<8))
 		data := generateData(size)
 
-		enc, err := encoder.NewFullRLNCEncoderWithPieceCount(data, pieceCount)
+		enc, err := encoder.NewFullRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
@@ -206,7 +227,7 @@ func TestFullRLNCEncoder_CodedPieceLen(t *testing.T) {
 		pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 		data := generateData(size)
 
-		enc, err := encoder.NewFullRLNCEncoderWithPieceSize(data, pieceSize)
+		enc, err := encoder.NewFullRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
@@ -249,12 +270,12 @@ func TestFullRLNCEncoder_DecodableLen(t *testing.T) {
 		pieceCount := uint(2<<1 + rand.Intn(2<<8))
 		data := generateData(size)
 
-		enc, err := encoder.NewFullRLNCEncoderWithPieceCount(data, pieceCount)
+		enc, err := encoder.NewFullRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
 
-		dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+		dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
 		flow(enc, dec)
 	})
 
@@ -264,12 +285,12 @@ func TestFullRLNCEncoder_DecodableLen(t *testing.T) {
 		pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 		data := generateData(size)
 
-		enc, err := encoder.NewFullRLNCEncoderWithPieceSize(data, pieceSize)
+		enc, err := encoder.NewFullRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
 
-		dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+		dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
 		flow(enc, dec)
 	})
 }
@@ -4,11 +4,11 @@ import (
 	"math/rand"
 
 	"github.com/aecra/PeerCodeX/coder"
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 type SparseRLNCEncoder struct {
-	field       *galoisfield.GF
+	field       galoisfield.Field
 	probability float64
 	pieces      []coder.Piece
 	extra       uint
@@ -49,7 +49,7 @@ func (s *SparseRLNCEncoder) DecodableLen() uint {
 // Here N = len(pieces), original pieces which are
 // being coded together
 func (s *SparseRLNCEncoder) CodedPieceLen() uint {
-	return s.PieceCount() + s.PieceSize()
+	return s.PieceCount()*uint(s.field.SymbolSize()) + s.PieceSize()
 }
 
 // How many extra padding bytes added at end of
@@ -64,30 +64,42 @@ func (s *SparseRLNCEncoder) Padding() uint {
 // coding coefficients & performing sparse-RLNC with
 // all original pieces
 func (s *SparseRLNCEncoder) CodedPiece() *coder.CodedPiece {
-	vector := coder.GenerateCodingVector(s.PieceCount())
+	vector := coder.GenerateCodingVector(s.field, s.PieceCount())
 	// set some elements to zero
-	for i := range vector {
+	for i := 0; i < int(s.PieceCount()); i++ {
 		if rand.Float64() <= s.probability {
-			vector[i] = 0
+			s.field.SetSymbol(vector, i, 0)
 		}
 	}
 	piece := make(coder.Piece, s.PieceSize())
-	for i := range s.pieces {
-		piece.Multiply(s.pieces[i], vector[i], s.field)
-	}
+	coder.DefaultPool.Columns(len(piece), func(start, end int) {
+		for i := range s.pieces {
+			s.field.MulAddSlice(piece[start:end], s.pieces[i][start:end], s.field.Symbol(vector, i))
+		}
+	})
 	return &coder.CodedPiece{
-		Vector: vector,
-		Piece:  piece,
+		Vector:   vector,
+		Piece:    piece,
+		Encoding: coder.SparseOrFull(s.field, vector),
 	}
 }
 
+// Returns a coded piece, which is guaranteed to be innovative
+// for a receiver holding `subspace`
+func (s *SparseRLNCEncoder) InnovativeCodedPiece(subspace *coder.Subspace) (*coder.CodedPiece, error) {
+	pieceCount, original := heldPieces(s.pieces)
+	return innovativeCodedPiece(s.field, s.CodedPiece, pieceCount, original, subspace)
+}
+
 // Provide with original pieces on which sparseRLNC to be performed
-// & get encoder, to be used for on-the-fly generation
+// over field & get encoder, to be used for on-the-fly generation
 // to N-many coded pieces
-func NewSparseRLNCEncoder(pieces []coder.Piece, probability float64) Encoder {
+//
+// Pieces must be of whole symbols of the field
+func NewSparseRLNCEncoder(field galoisfield.Field, pieces []coder.Piece, probability float64) Encoder {
 	return &SparseRLNCEncoder{
 		pieces:      pieces,
-		field:       galoisfield.DefaultGF256,
+		field:       field,
 		probability: probability,
 	}
 }
@@ -96,33 +108,37 @@ func NewSparseRLNCEncoder(pieces []coder.Piece, probability float64) Encoder {
 // this function splits whole data chunk into N-pieces, with padding
 // bytes appended at end of last piece, if required & prepares
 // sparse RLNC encoder for obtaining coded pieces
-func NewSparseRLNCEncoderWithPieceCount(data []byte, pieceCount uint, probability float64) (Encoder, error) {
-	pieces, padding, err := coder.OriginalPiecesFromDataAndPieceCount(data, pieceCount)
+func NewSparseRLNCEncoderWithPieceCount(field galoisfield.Field, data []byte, pieceCount uint, probability float64) (Encoder, error) {
+	pieces, padding, err := originalPiecesWithPieceCount(field, data, pieceCount)
 	if err != nil {
 		return nil, err
 	}
 
-	// make sure probability is not too high
-	if probability > 1-float64(6)/float64(pieceCount) {
-		probability = 1 - float64(6)/float64(pieceCount)
-	}
-
-	enc := NewSparseRLNCEncoder(pieces, probability)
+	enc := NewSparseRLNCEncoder(field, pieces, maxProbability(probability, pieceCount))
 	fenc := enc.(*SparseRLNCEncoder)
 	fenc.extra = padding
 	return fenc, nil
 }
 
+// Make sure probability is not too high, so that coded pieces are still
+// innovative often enough
+func maxProbability(probability float64, pieceCount uint) float64 {
+	if probability > 1-float64(6)/float64(pieceCount) {
+		return 1 - float64(6)/float64(pieceCount)
+	}
+	return probability
+}
+
 // If you want to have N-bytes piece size for each, this
 // function generates M-many pieces each of N-bytes size, which are ready
 // to be coded together with sparse RLNC
-func NewSparseRLNCEncoderWithPieceSize(data []byte, pieceSize uint, probability float64) (Encoder, error) {
-	pieces, padding, err := coder.OriginalPiecesFromDataAndPieceSize(data, pieceSize)
+func NewSparseRLNCEncoderWithPieceSize(field galoisfield.Field, data []byte, pieceSize uint, probability float64) (Encoder, error) {
+	pieces, padding, err := originalPiecesWithPieceSize(field, data, pieceSize)
 	if err != nil {
 		return nil, err
 	}
 
-	enc := NewSparseRLNCEncoder(pieces, probability)
+	enc := NewSparseRLNCEncoder(field, pieces, probability)
 	fenc := enc.(*SparseRLNCEncoder)
 	fenc.extra = padding
 	return fenc, nil
@@ -8,9 +8,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aecra/PeerCodeX/coder"
 	"github.com/aecra/PeerCodeX/coder/decoder"
 	"github.com/aecra/PeerCodeX/coder/encoder"
-	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 func sparseEncoderFlow(t *testing.T, enc encoder.Encoder, pieceCount, codedPieceCount int, pieces []coder.Piece) {
@@ -19,7 +20,7 @@ func sparseEncoderFlow(t *testing.T, enc encoder.Encoder, pieceCount, codedPiece
 		coded = append(coded, enc.CodedPiece())
 	}
 
-	dec := decoder.NewGaussElimRLNCDecoder(uint(pieceCount))
+	dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, uint(pieceCount))
 	for i := 0; i < codedPieceCount; i++ {
 		if i < pieceCount {
 			if _, err := dec.GetPieces(); !(err != nil && errors.Is(err, coder.ErrMoreUsefulPiecesRequired)) {
@@ -65,7 +66,7 @@ func TestNewSparseRLNCEncoder(t *testing.T) {
 	pieceLength := 8192
 	codedPieceCount := pieceCount + 2
 	pieces := generatePieces(uint(pieceCount), uint(pieceLength))
-	enc := encoder.NewSparseRLNCEncoder(pieces, 0.5)
+	enc := encoder.NewSparseRLNCEncoder(galoisfield.GF256, pieces, 0.5)
 
 	sparseEncoderFlow(t, enc, pieceCount, codedPieceCount, pieces)
 }
@@ -84,7 +85,7 @@ func TestNewSparseRLNCEncoderWithPieceCount(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(data, pieceCount, 0.5)
+	enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount, 0.5)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -107,7 +108,7 @@ func TestNewSparseRLNCEncoderWithPieceSize(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	enc, err := encoder.NewSparseRLNCEncoderWithPieceSize(data, pieceSize, 0.5)
+	enc, err := encoder.NewSparseRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize, 0.5)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -124,7 +125,7 @@ func TestSparseRLNCEncoderPadding(t *testing.T) {
 			pieceCount := uint(2<<1 + rand.Intn(2<<8))
 			data := generateData(size)
 
-			enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(data, pieceCount, 0.5)
+			enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount, 0.5)
 			if err != nil {
 				t.Fatalf("Error: %s\n", err.Error())
 			}
@@ -145,7 +146,7 @@ func TestSparseRLNCEncoderPadding(t *testing.T) {
 			pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 			data := generateData(size)
 
-			enc, err := encoder.NewSparseRLNCEncoderWithPieceSize(data, pieceSize, 0.5)
+			enc, err := encoder.NewSparseRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize, 0.5)
 			if err != nil {
 				t.Fatalf("Error: %s\n", err.Error())
 			}
@@ -168,7 +169,7 @@ func TestSparseRLNCEncoder_CodedPieceLen(t *testing.T) {
 		pieceCount := uint(2<<1 + rand.Intn(2<<8))
 		data := generateData(size)
 
-		enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(data, pieceCount, 0.5)
+		enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount, 0.5)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
@@ -187,7 +188,7 @@ func TestSparseRLNCEncoder_CodedPieceLen(t *testing.T) {
 		pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 		data := generateData(size)
 
-		enc, err := encoder.NewSparseRLNCEncoderWithPieceSize(data, pieceSize, 0.5)
+		enc, err := encoder.NewSparseRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize, 0.5)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
@@ -230,12 +231,12 @@ func TestSparseRLNCEncoder_DecodableLen(t *testing.T) {
 		pieceCount := uint(2<<1 + rand.Intn(2<<8))
 		data := generateData(size)
 
-		enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(data, pieceCount, 0.5)
+		enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount, 0.5)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
 
-		dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+		dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
 		flow(enc, dec)
 	})
 
@@ -245,12 +246,49 @@ func TestSparseRLNCEncoder_DecodableLen(t *testing.T) {
 		pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 		data := generateData(size)
 
-		enc, err := encoder.NewSparseRLNCEncoderWithPieceSize(data, pieceSize, 0.5)
+		enc, err := encoder.NewSparseRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize, 0.5)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
 
-		dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+		dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
 		flow(enc, dec)
 	})
 }
+
+func TestSparseRLNCEncoder_InnovativeCodedPiece(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	pieceCount := 64
+	pieces := generatePieces(uint(pieceCount), 1024)
+	// mostly zero coding vectors are often not innovative
+	enc := encoder.NewSparseRLNCEncoder(galoisfield.GF256, pieces, 0.95)
+	dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, uint(pieceCount))
+
+	for i := 0; i < pieceCount; i++ {
+		piece, err := enc.InnovativeCodedPiece(dec.Subspace())
+		if err != nil {
+			t.Fatal(err)
+		}
+		required := dec.Required()
+		if err := dec.AddPiece(piece); err != nil {
+			t.Fatal(err)
+		}
+		if dec.Required() != required-1 {
+			t.Fatal("coded piece is not innovative")
+		}
+	}
+
+	d_pieces, err := dec.GetPieces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < pieceCount; i++ {
+		if !bytes.Equal(pieces[i], d_pieces[i]) {
+			t.Fatal("decoded data doesn't match !")
+		}
+	}
+	if _, err := enc.InnovativeCodedPiece(dec.Subspace()); !errors.Is(err, coder.ErrNotInnovative) {
+		t.Fatalf("expected ErrNotInnovative, got %v", err)
+	}
+}
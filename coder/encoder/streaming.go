@@ -0,0 +1,161 @@
+package encoder
+
+import (
+	"io"
+	"math/rand"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+// StreamingRLNCEncoder performs sparse RLNC like SparseRLNCEncoder, but
+// never holds the whole generation in memory. Original pieces are read
+// from the source one at a time as a coded piece is computed, and only
+// pieces with a non-zero coefficient are read at all. Pieces read may be
+// kept in a cache shared by many encoders.
+type StreamingRLNCEncoder struct {
+	field       galoisfield.Field
+	probability float64
+	source      io.ReaderAt
+	offset      int64 // of the data in source
+	length      uint  // of the data, without padding
+	pieceCount  uint
+	pieceSize   uint
+	extra       uint
+	cache       *PieceCache
+	key         string // tells the pieces of this encoder apart in cache
+}
+
+// Total #-of pieces being coded together
+func (s *StreamingRLNCEncoder) PieceCount() uint {
+	return s.pieceCount
+}
+
+// Pieces which are coded together are all of same size, the last one is
+// padded with zeros
+func (s *StreamingRLNCEncoder) PieceSize() uint {
+	return s.pieceSize
+}
+
+// N * codedPieceLen bytes of linearly independent coded pieces are
+// required for decoding
+func (s *StreamingRLNCEncoder) DecodableLen() uint {
+	return s.PieceCount() * s.CodedPieceLen()
+}
+
+func (s *StreamingRLNCEncoder) CodedPieceLen() uint {
+	return s.PieceCount()*uint(s.field.SymbolSize()) + s.PieceSize()
+}
+
+func (s *StreamingRLNCEncoder) Padding() uint {
+	return s.extra
+}
+
+// piece returns original piece i, from the cache if it holds it
+func (s *StreamingRLNCEncoder) piece(i uint) (coder.Piece, error) {
+	if i >= s.pieceCount {
+		return nil, coder.ErrPieceOutOfBound
+	}
+	if piece := s.cache.Get(s.key, i); piece != nil {
+		return piece, nil
+	}
+	piece := make(coder.Piece, s.pieceSize)
+	start := i * s.pieceSize
+	if start < s.length {
+		end := start + s.pieceSize
+		if end > s.length {
+			end = s.length
+		}
+		if _, err := s.source.ReadAt(piece[:end-start], s.offset+int64(start)); err != nil {
+			return nil, err
+		}
+	}
+	s.cache.Put(s.key, i, piece)
+	return piece, nil
+}
+
+// codingVector returns a random sparse coding vector
+func (s *StreamingRLNCEncoder) codingVector() coder.CodingVector {
+	vector := coder.GenerateCodingVector(s.field, s.PieceCount())
+	// set some elements to zero
+	for i := 0; i < int(s.pieceCount); i++ {
+		if rand.Float64() <= s.probability {
+			s.field.SetSymbol(vector, i, 0)
+		}
+	}
+	return vector
+}
+
+// Returns a coded piece, coded by streaming over the original pieces with
+// a non-zero coefficient, or nil if one of them can't be read
+func (s *StreamingRLNCEncoder) CodedPiece() *coder.CodedPiece {
+	return s.codedPiece(s.codingVector())
+}
+
+// codedPiece codes the original pieces with the coefficients of vector
+func (s *StreamingRLNCEncoder) codedPiece(vector coder.CodingVector) *coder.CodedPiece {
+	piece := make(coder.Piece, s.PieceSize())
+	for i := 0; i < int(s.pieceCount); i++ {
+		c := s.field.Symbol(vector, i)
+		if c == 0 {
+			continue
+		}
+		original, err := s.piece(uint(i))
+		if err != nil {
+			return nil
+		}
+		coder.DefaultPool.Columns(len(piece), func(start, end int) {
+			s.field.MulAddSlice(piece[start:end], original[start:end], c)
+		})
+	}
+	return &coder.CodedPiece{
+		Vector:   vector,
+		Piece:    piece,
+		Encoding: coder.SparseOrFull(s.field, vector),
+	}
+}
+
+// Returns a coded piece, which is guaranteed to be innovative
+// for a receiver holding `subspace`. Coding vectors are checked against
+// subspace before any original piece is read for them.
+func (s *StreamingRLNCEncoder) InnovativeCodedPiece(subspace *coder.Subspace) (*coder.CodedPiece, error) {
+	if subspace.PieceCount() != s.pieceCount {
+		return nil, coder.ErrCodingVectorLengthMismatch
+	}
+	for i := 0; i < innovativeAttempts; i++ {
+		vector := s.codingVector()
+		if !subspace.IsInnovative(vector) {
+			continue
+		}
+		if piece := s.codedPiece(vector); piece != nil {
+			return piece, nil
+		}
+	}
+	return uncodedPiece(s.field, s.pieceCount, s.piece, subspace)
+}
+
+// Prepares a streaming sparse RLNC encoder over field for length bytes at
+// offset of source, split into pieceCount pieces the way
+// NewSparseRLNCEncoderWithPieceCount splits them. Pieces read are kept in
+// cache under key, which may be nil for no caching.
+func NewStreamingRLNCEncoder(field galoisfield.Field, source io.ReaderAt, offset int64, length uint, pieceCount uint, probability float64, cache *PieceCache, key string) (Encoder, error) {
+	if pieceCount < 2 {
+		return nil, coder.ErrBadPieceCount
+	}
+	if pieceCount > length {
+		return nil, coder.ErrPieceCountMoreThanTotalBytes
+	}
+	pieceSize := coder.PieceSize(field, length, pieceCount)
+	return &StreamingRLNCEncoder{
+		field:       field,
+		probability: maxProbability(probability, pieceCount),
+		source:      source,
+		offset:      offset,
+		length:      length,
+		pieceCount:  pieceCount,
+		pieceSize:   pieceSize,
+		extra:       pieceCount*pieceSize - length,
+		cache:       cache,
+		key:         key,
+	}, nil
+}
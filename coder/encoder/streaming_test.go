@@ -0,0 +1,170 @@
+package encoder_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/decoder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+func TestNewStreamingRLNCEncoder(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	size := uint(2<<10 + rand.Intn(2<<10))
+	pieceCount := uint(2<<1 + rand.Intn(2<<8))
+	codedPieceCount := pieceCount + 2
+	data := generateData(size)
+	t.Logf("\nTotal Data: %d bytes\nPiece Count: %d\nCoded Piece Count: %d\n", size, pieceCount, codedPieceCount)
+
+	pieces, padding, err := coder.OriginalPiecesFromDataAndPieceCount(data, pieceCount)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the data is read from the middle of the source
+	source := bytes.NewReader(append(append(generateData(100), data...), generateData(100)...))
+	enc, err := encoder.NewStreamingRLNCEncoder(galoisfield.GF256, source, 100, size, pieceCount, 0.5, nil, "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if enc.Padding() != padding || enc.PieceSize() != uint(len(pieces[0])) {
+		t.Fatalf("expected %dB pieces with %dB padding, found %dB with %dB", len(pieces[0]), padding, enc.PieceSize(), enc.Padding())
+	}
+
+	sparseEncoderFlow(t, enc, int(pieceCount), int(codedPieceCount), pieces)
+}
+
+func TestStreamingRLNCEncoder_InnovativeCodedPiece(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	pieceCount := uint(64)
+	data := generateData(64 * 1024)
+	pieces, _, err := coder.OriginalPiecesFromDataAndPieceCount(data, pieceCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cache holds a quarter of the generation
+	cache := encoder.NewPieceCache(16 * 1024)
+	enc, err := encoder.NewStreamingRLNCEncoder(galoisfield.GF256, bytes.NewReader(data), 0, uint(len(data)), pieceCount, 0.95, cache, "generation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
+
+	for i := uint(0); i < pieceCount; i++ {
+		piece, err := enc.InnovativeCodedPiece(dec.Subspace())
+		if err != nil {
+			t.Fatal(err)
+		}
+		required := dec.Required()
+		if err := dec.AddPiece(piece); err != nil {
+			t.Fatal(err)
+		}
+		if dec.Required() != required-1 {
+			t.Fatal("coded piece is not innovative")
+		}
+		if cache.Size() > 16*1024 {
+			t.Fatalf("cache holds %dB, more than its capacity", cache.Size())
+		}
+	}
+
+	d_pieces, err := dec.GetPieces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range pieces {
+		if !bytes.Equal(pieces[i], d_pieces[i]) {
+			t.Fatal("decoded data doesn't match !")
+		}
+	}
+	if _, err := enc.InnovativeCodedPiece(dec.Subspace()); !errors.Is(err, coder.ErrNotInnovative) {
+		t.Fatalf("expected ErrNotInnovative, got %v", err)
+	}
+
+	cache.Drop("generation")
+	if cache.Size() != 0 {
+		t.Fatalf("expected empty cache, holds %dB", cache.Size())
+	}
+}
+
+// countingReader counts the reads of the pieces of a streaming encoder
+type countingReader struct {
+	*bytes.Reader
+	reads int
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	c.reads++
+	return c.Reader.ReadAt(p, off)
+}
+
+func TestStreamingRLNCEncoder_ReadsOnlyInnovative(t *testing.T) {
+	pieceCount := uint(16)
+	data := generateData(16 * 1024)
+	source := &countingReader{Reader: bytes.NewReader(data)}
+	enc, err := encoder.NewStreamingRLNCEncoder(galoisfield.GF256, source, 0, uint(len(data)), pieceCount, 0.5, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the receiver spans every piece but the first
+	subspace := coder.NewSubspace(galoisfield.GF256, pieceCount)
+	for i := 1; i < int(pieceCount); i++ {
+		vector := make(coder.CodingVector, pieceCount)
+		vector[i] = 1
+		subspace.Add(vector)
+	}
+
+	piece, err := enc.InnovativeCodedPiece(subspace)
+	if err != nil || !subspace.IsInnovative(piece.Vector) {
+		t.Fatalf("expected an innovative piece, got %v", err)
+	}
+	subspace.Add(piece.Vector)
+	source.reads = 0
+	if _, err := enc.InnovativeCodedPiece(subspace); !errors.Is(err, coder.ErrNotInnovative) {
+		t.Fatalf("expected ErrNotInnovative, got %v", err)
+	}
+	if source.reads != 0 {
+		t.Fatalf("%d pieces read for vectors the receiver spans", source.reads)
+	}
+}
+
+func TestPieceCache(t *testing.T) {
+	cache := encoder.NewPieceCache(3)
+	cache.Put("a", 0, coder.Piece{0})
+	cache.Put("a", 1, coder.Piece{1})
+	cache.Put("b", 0, coder.Piece{2})
+	// a/0 is used last, so a/1 is evicted
+	if piece := cache.Get("a", 0); !bytes.Equal(piece, coder.Piece{0}) {
+		t.Fatalf("unexpected piece %v", piece)
+	}
+	cache.Put("b", 1, coder.Piece{3})
+	if cache.Get("a", 1) != nil || cache.Get("b", 0) == nil || cache.Get("b", 1) == nil {
+		t.Fatal("expected the least recently used piece to be evicted")
+	}
+	cache.Put("c", 0, coder.Piece{0, 1, 2, 3})
+	if cache.Get("c", 0) != nil || cache.Size() != 3 {
+		t.Fatal("expected a piece larger than the cache not to be cached")
+	}
+
+	cache.SetCapacity(1)
+	if cache.Size() > 1 || cache.Capacity() != 1 {
+		t.Fatalf("cache holds %dB beyond its capacity", cache.Size())
+	}
+	cache.SetCapacity(4)
+	cache.Put("c", 0, coder.Piece{0, 1, 2, 3})
+	if cache.Capacity() != 4 || cache.Get("c", 0) == nil {
+		t.Fatal("expected the cache to hold a piece within its new capacity")
+	}
+
+	var none *encoder.PieceCache
+	none.Put("a", 0, coder.Piece{0})
+	if none.Get("a", 0) != nil {
+		t.Fatal("expected nil cache to hold nothing")
+	}
+}
@@ -2,12 +2,12 @@ package encoder
 
 import (
 	"github.com/aecra/PeerCodeX/coder"
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 type SystematicRLNCEncoder struct {
 	currentPieceId uint
-	field          *galoisfield.GF
+	field          galoisfield.Field
 	pieces         []coder.Piece
 	extra          uint
 }
@@ -47,7 +47,7 @@ func (s *SystematicRLNCEncoder) DecodableLen() uint {
 // Here N = len(pieces), original pieces which are
 // being coded together
 func (s *SystematicRLNCEncoder) CodedPieceLen() uint {
-	return s.PieceCount() + s.PieceSize()
+	return s.PieceCount()*uint(s.field.SymbolSize()) + s.PieceSize()
 }
 
 // If any extra padding bytes added at end of original
@@ -64,8 +64,8 @@ func (s *SystematicRLNCEncoder) systematicCodingVector(idx uint) coder.CodingVec
 		return nil
 	}
 
-	vector := make(coder.CodingVector, s.PieceCount())
-	vector[idx] = 1
+	vector := make(coder.CodingVector, s.PieceCount()*uint(s.field.SymbolSize()))
+	s.field.SetSymbol(vector, int(idx), 1)
 	return vector
 }
 
@@ -92,41 +92,55 @@ func (s *SystematicRLNCEncoder) CodedPiece() *coder.CodedPiece {
 
 		s.currentPieceId++
 		return &coder.CodedPiece{
-			Vector: vector,
-			Piece:  piece,
+			Vector:   vector,
+			Piece:    piece,
+			Encoding: coder.SparseVector,
 		}
 	}
 
-	vector := coder.GenerateCodingVector(s.PieceCount())
+	vector, seed := coder.GenerateSeededCodingVector(s.field, s.PieceCount())
 	piece := make(coder.Piece, s.PieceSize())
-	for i := range s.pieces {
-		piece.Multiply(s.pieces[i], vector[i], s.field)
-	}
+	coder.DefaultPool.Columns(len(piece), func(start, end int) {
+		for i := range s.pieces {
+			s.field.MulAddSlice(piece[start:end], s.pieces[i][start:end], s.field.Symbol(vector, i))
+		}
+	})
 	return &coder.CodedPiece{
-		Vector: vector,
-		Piece:  piece,
+		Vector:   vector,
+		Piece:    piece,
+		Encoding: coder.SeededVector,
+		Seed:     seed,
 	}
 }
 
+// Returns a coded piece, which is guaranteed to be innovative
+// for a receiver holding `subspace`
+func (s *SystematicRLNCEncoder) InnovativeCodedPiece(subspace *coder.Subspace) (*coder.CodedPiece, error) {
+	pieceCount, original := heldPieces(s.pieces)
+	return innovativeCodedPiece(s.field, s.CodedPiece, pieceCount, original, subspace)
+}
+
 // When you've already splitted original data chunk into pieces
 // of same length ( in terms of bytes ), this function can be used
-// for creating one systematic RLNC encoder, which delivers coded pieces
-// on-the-fly
-func NewSystematicRLNCEncoder(pieces []coder.Piece) Encoder {
-	return &SystematicRLNCEncoder{currentPieceId: 0, pieces: pieces, field: galoisfield.DefaultGF256}
+// for creating one systematic RLNC encoder over field, which delivers
+// coded pieces on-the-fly
+//
+// Pieces must be of whole symbols of the field
+func NewSystematicRLNCEncoder(field galoisfield.Field, pieces []coder.Piece) Encoder {
+	return &SystematicRLNCEncoder{currentPieceId: 0, pieces: pieces, field: field}
 }
 
 // If you know #-of pieces you want to code together, invoking
 // this function splits whole data chunk into N-pieces, with padding
 // bytes appended at end of last piece, if required & prepares
 // full RLNC encoder for obtaining coded pieces
-func NewSystematicRLNCEncoderWithPieceCount(data []byte, pieceCount uint) (Encoder, error) {
-	pieces, padding, err := coder.OriginalPiecesFromDataAndPieceCount(data, pieceCount)
+func NewSystematicRLNCEncoderWithPieceCount(field galoisfield.Field, data []byte, pieceCount uint) (Encoder, error) {
+	pieces, padding, err := originalPiecesWithPieceCount(field, data, pieceCount)
 	if err != nil {
 		return nil, err
 	}
 
-	enc := NewSystematicRLNCEncoder(pieces)
+	enc := NewSystematicRLNCEncoder(field, pieces)
 	senc := enc.(*SystematicRLNCEncoder)
 	senc.extra = padding
 	return senc, nil
@@ -135,13 +149,13 @@ func NewSystematicRLNCEncoderWithPieceCount(data []byte, pieceCount uint) (Encod
 // If you want to have N-bytes piece size for each, this
 // function generates M-many pieces each of N-bytes size, which are ready
 // to be coded together with full RLNC
-func NewSystematicRLNCEncoderWithPieceSize(data []byte, pieceSize uint) (Encoder, error) {
-	pieces, padding, err := coder.OriginalPiecesFromDataAndPieceSize(data, pieceSize)
+func NewSystematicRLNCEncoderWithPieceSize(field galoisfield.Field, data []byte, pieceSize uint) (Encoder, error) {
+	pieces, padding, err := originalPiecesWithPieceSize(field, data, pieceSize)
 	if err != nil {
 		return nil, err
 	}
 
-	enc := NewSystematicRLNCEncoder(pieces)
+	enc := NewSystematicRLNCEncoder(field, pieces)
 	senc := enc.(*SystematicRLNCEncoder)
 	senc.extra = padding
 	return senc, nil
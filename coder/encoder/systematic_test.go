@@ -11,28 +11,31 @@ import (
 	"github.com/aecra/PeerCodeX/coder"
 	"github.com/aecra/PeerCodeX/coder/decoder"
 	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
 func TestSystematicRLNCCoding(t *testing.T) {
 	rand.Seed(time.Now().UnixNano())
 
-	var (
-		pieceCount      uint            = uint(2<<1 + rand.Intn(2<<8))
-		pieceLength     uint            = 8192
-		codedPieceCount uint            = pieceCount * 2
-		pieces          []coder.Piece   = generatePieces(pieceCount, pieceLength)
-		enc             encoder.Encoder = encoder.NewSystematicRLNCEncoder(pieces)
-	)
+	for _, field := range []galoisfield.Field{galoisfield.GF256, galoisfield.GF65536} {
+		var (
+			pieceCount      uint            = uint(2<<1 + rand.Intn(2<<8))
+			pieceLength     uint            = 8192
+			codedPieceCount uint            = pieceCount * 2
+			pieces          []coder.Piece   = generatePieces(pieceCount, pieceLength)
+			enc             encoder.Encoder = encoder.NewSystematicRLNCEncoder(field, pieces)
+		)
 
-	for i := 0; i < int(codedPieceCount); i++ {
-		c_piece := enc.CodedPiece()
-		if i < int(pieceCount) {
-			if !c_piece.IsSystematic() {
-				t.Fatal("expected piece to be systematic coded")
-			}
-		} else {
-			if c_piece.IsSystematic() {
-				t.Fatal("expected piece to be random coded")
+		for i := 0; i < int(codedPieceCount); i++ {
+			c_piece := enc.CodedPiece()
+			if i < int(pieceCount) {
+				if !c_piece.IsSystematic(field) {
+					t.Fatalf("expected piece to be systematic coded over %s", field.Name())
+				}
+			} else {
+				if c_piece.IsSystematic(field) {
+					t.Fatalf("expected piece to be random coded over %s", field.Name())
+				}
 			}
 		}
 	}
@@ -48,8 +51,8 @@ func TestNewSystematicRLNC(t *testing.T) {
 		)
 
 		pieces := generatePieces(pieceCount, pieceLength)
-		enc := encoder.NewSystematicRLNCEncoder(pieces)
-		dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+		enc := encoder.NewSystematicRLNCEncoder(galoisfield.GF256, pieces)
+		dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
 
 		encoderFlow(t, enc, dec, pieceCount, pieces)
 	})
@@ -59,7 +62,7 @@ func TestNewSystematicRLNC(t *testing.T) {
 		pieceCount := uint(2<<1 + rand.Intn(2<<8))
 		data := generateData(size)
 
-		enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(data, pieceCount)
+		enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
@@ -69,7 +72,7 @@ func TestNewSystematicRLNC(t *testing.T) {
 			t.Fatal(err.Error())
 		}
 
-		dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+		dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
 		encoderFlow(t, enc, dec, pieceCount, pieces)
 	})
 
@@ -79,7 +82,7 @@ func TestNewSystematicRLNC(t *testing.T) {
 		pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 		data := generateData(size)
 
-		enc, err := encoder.NewSystematicRLNCEncoderWithPieceSize(data, pieceSize)
+		enc, err := encoder.NewSystematicRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
@@ -89,7 +92,7 @@ func TestNewSystematicRLNC(t *testing.T) {
 			t.Fatal(err.Error())
 		}
 
-		dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+		dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
 		encoderFlow(t, enc, dec, pieceCount, pieces)
 	})
 }
@@ -132,7 +135,7 @@ func TestSystematicRLNCEncoder_Padding(t *testing.T) {
 			pieceCount := uint(2<<1 + rand.Intn(2<<8))
 			data := generateData(size)
 
-			enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(data, pieceCount)
+			enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 			if err != nil {
 				t.Fatalf("Error: %s\n", err.Error())
 			}
@@ -153,7 +156,7 @@ func TestSystematicRLNCEncoder_Padding(t *testing.T) {
 			pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 			data := generateData(size)
 
-			enc, err := encoder.NewSystematicRLNCEncoderWithPieceSize(data, pieceSize)
+			enc, err := encoder.NewSystematicRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize)
 			if err != nil {
 				t.Fatalf("Error: %s\n", err.Error())
 			}
@@ -176,7 +179,7 @@ func TestSystematicRLNCEncoder_CodedPieceLen(t *testing.T) {
 		pieceCount := uint(2<<1 + rand.Intn(2<<8))
 		data := generateData(size)
 
-		enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(data, pieceCount)
+		enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
@@ -195,7 +198,7 @@ func TestSystematicRLNCEncoder_CodedPieceLen(t *testing.T) {
 		pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 		data := generateData(size)
 
-		enc, err := encoder.NewSystematicRLNCEncoderWithPieceSize(data, pieceSize)
+		enc, err := encoder.NewSystematicRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
@@ -238,12 +241,12 @@ func TestSystematicRLNCEncoder_DecodableLen(t *testing.T) {
 		pieceCount := uint(2<<1 + rand.Intn(2<<8))
 		data := generateData(size)
 
-		enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(data, pieceCount)
+		enc, err := encoder.NewSystematicRLNCEncoderWithPieceCount(galoisfield.GF256, data, pieceCount)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
 
-		dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+		dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
 		flow(enc, dec)
 	})
 
@@ -253,12 +256,12 @@ func TestSystematicRLNCEncoder_DecodableLen(t *testing.T) {
 		pieceCount := uint(math.Ceil(float64(size) / float64(pieceSize)))
 		data := generateData(size)
 
-		enc, err := encoder.NewSystematicRLNCEncoderWithPieceSize(data, pieceSize)
+		enc, err := encoder.NewSystematicRLNCEncoderWithPieceSize(galoisfield.GF256, data, pieceSize)
 		if err != nil {
 			t.Fatalf("Error: %s\n", err.Error())
 		}
 
-		dec := decoder.NewGaussElimRLNCDecoder(pieceCount)
+		dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, pieceCount)
 		flow(enc, dec)
 	})
 }
@@ -9,9 +9,16 @@ var (
 	ErrCopyFailedDuringPieceConstruction = errors.New("failed to copy whole data before splitting into pieces")
 	ErrPieceCountMoreThanTotalBytes      = errors.New("requested piece count > total bytes of original data")
 	ErrZeroPieceSize                     = errors.New("pieces can't be sized as zero byte")
+	ErrPieceSizeMisaligned               = errors.New("piece size isn't a multiple of the symbol size of the field")
 	ErrBadPieceCount                     = errors.New("minimum 2 pieces required for RLNC")
 	ErrCodedDataLengthMismatch           = errors.New("coded data length != coded piece count x coded piece length")
 	ErrCodingVectorLengthMismatch        = errors.New("coding vector length > coded piece length ( in total )")
 	ErrPieceNotDecodedYet                = errors.New("piece not decoded yet, more pieces required")
 	ErrPieceOutOfBound                   = errors.New("requested piece index >= pieceCount ( pieces coded together )")
+	ErrBadCheckpoint                     = errors.New("decoder checkpoint is malformed or of unknown version")
+	ErrBadSubspace                       = errors.New("subspace is malformed")
+	ErrBadVector                         = errors.New("encoded coding vector is malformed")
+	ErrNotInnovative                     = errors.New("no piece held is innovative for the subspace")
+	ErrBadHash                           = errors.New("hash of source piece is malformed")
+	ErrPolluted                          = errors.New("coded piece does not match the hashes of source pieces")
 )
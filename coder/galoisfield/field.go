@@ -0,0 +1,131 @@
+// Package galoisfield provides the finite fields pieces are coded over.
+//
+// Elements of a field are stored as symbols of SymbolSize bytes, big
+// endian, so that a coding vector holds one symbol for every piece coded
+// together, and a piece is a sequence of symbols the coefficients apply
+// to. Slices are always processed in whole symbols.
+package galoisfield
+
+import (
+	"crypto/rand"
+	"errors"
+
+	tableGF "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+)
+
+var ErrUnknownField = errors.New("unknown field")
+
+// ID identifies a field in seeds and handshakes, it's log2 of the order
+type ID byte
+
+// Field is a finite field of characteristic 2, which coding vectors and
+// pieces are combined over
+type Field interface {
+	ID() ID
+	// Name is the name of the field in seeds and on the command line
+	Name() string
+	// Size returns the order of the field, i.e. the number of elements
+	Size() uint
+	// SymbolSize returns the bytes every element is stored in
+	SymbolSize() int
+
+	// Symbol returns symbol i of data
+	Symbol(data []byte, i int) uint16
+	// SetSymbol sets symbol i of data to x
+	SetSymbol(data []byte, i int, x uint16)
+	// Random fills data with random elements
+	Random(data []byte)
+
+	Mul(x, y uint16) uint16
+	Div(x, y uint16) uint16
+	Inv(x uint16) uint16
+
+	// MulAddSlice computes dst[i] = dst[i] + c*src[i] for every symbol
+	// of src, dst must be at least as long as src
+	MulAddSlice(dst, src []byte, c uint16)
+	// MulSlice computes dst[i] = c*src[i] for every symbol of src, dst
+	// must be at least as long as src and may be src itself
+	MulSlice(dst, src []byte, c uint16)
+}
+
+var (
+	// GF2 codes with coefficients 0 and 1 only, so that coding comes down
+	// to XOR of pieces. Pieces are bytes like with GF256, whose arithmetic
+	// GF2 shares as GF(2) is a subfield of GF(2**8).
+	GF2 Field = gf2{gf256{tableGF.DefaultGF256}}
+	// GF256 is GF(2**8), with a symbol per byte
+	GF256 Field = gf256{tableGF.DefaultGF256}
+	// GF65536 is GF(2**16), with a symbol per 2 bytes. Coding vectors take
+	// twice the space, but make linear dependency far less likely with
+	// thousands of pieces coded together.
+	GF65536 Field = newGF65536()
+
+	// Default is the field of seeds which don't name one
+	Default = GF256
+
+	fields = []Field{GF2, GF256, GF65536}
+)
+
+// ByID returns the field identified by id
+func ByID(id ID) (Field, error) {
+	for _, f := range fields {
+		if f.ID() == id {
+			return f, nil
+		}
+	}
+	return nil, ErrUnknownField
+}
+
+// ByName returns the field named name
+func ByName(name string) (Field, error) {
+	for _, f := range fields {
+		if f.Name() == name {
+			return f, nil
+		}
+	}
+	return nil, ErrUnknownField
+}
+
+type gf256 struct {
+	gf *tableGF.GF
+}
+
+func (gf256) ID() ID          { return 8 }
+func (gf256) Name() string    { return "gf256" }
+func (f gf256) Size() uint    { return f.gf.Size() }
+func (gf256) SymbolSize() int { return 1 }
+func (gf256) Random(v []byte) { rand.Read(v) }
+func (gf256) Symbol(data []byte, i int) uint16 {
+	return uint16(data[i])
+}
+
+func (gf256) SetSymbol(data []byte, i int, x uint16) {
+	data[i] = byte(x)
+}
+
+func (f gf256) Mul(x, y uint16) uint16 { return uint16(f.gf.Mul(byte(x), byte(y))) }
+func (f gf256) Div(x, y uint16) uint16 { return uint16(f.gf.Div(byte(x), byte(y))) }
+func (f gf256) Inv(x uint16) uint16    { return uint16(f.gf.Inv(byte(x))) }
+
+func (f gf256) MulAddSlice(dst, src []byte, c uint16) {
+	f.gf.MulAddSlice(dst, src, byte(c))
+}
+
+func (f gf256) MulSlice(dst, src []byte, c uint16) {
+	f.gf.MulSlice(dst, src, byte(c))
+}
+
+type gf2 struct {
+	gf256
+}
+
+func (gf2) ID() ID       { return 1 }
+func (gf2) Name() string { return "gf2" }
+func (gf2) Size() uint   { return 2 }
+
+func (gf2) Random(v []byte) {
+	rand.Read(v)
+	for i := range v {
+		v[i] &= 1
+	}
+}
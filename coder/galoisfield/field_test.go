@@ -0,0 +1,96 @@
+package galoisfield_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+var fields = []galoisfield.Field{galoisfield.GF2, galoisfield.GF256, galoisfield.GF65536}
+
+func randomElement(f galoisfield.Field) uint16 {
+	v := make([]byte, f.SymbolSize())
+	f.Random(v)
+	return f.Symbol(v, 0)
+}
+
+func TestFieldArithmetic(t *testing.T) {
+	for _, f := range fields {
+		for i := 0; i < 1000; i++ {
+			x, y, z := randomElement(f), randomElement(f), randomElement(f)
+			if uint(x) >= f.Size() {
+				t.Fatalf("%s: random element %d out of field", f.Name(), x)
+			}
+			if f.Mul(x, y) != f.Mul(y, x) {
+				t.Fatalf("%s: multiplication isn't commutative", f.Name())
+			}
+			if f.Mul(x, y^z) != f.Mul(x, y)^f.Mul(x, z) {
+				t.Fatalf("%s: multiplication isn't distributive", f.Name())
+			}
+			if f.Mul(f.Mul(x, y), z) != f.Mul(x, f.Mul(y, z)) {
+				t.Fatalf("%s: multiplication isn't associative", f.Name())
+			}
+			if y == 0 {
+				continue
+			}
+			if f.Mul(f.Div(x, y), y) != x {
+				t.Fatalf("%s: (%d / %d) * %d != %d", f.Name(), x, y, y, x)
+			}
+			if f.Mul(f.Inv(y), y) != 1 {
+				t.Fatalf("%s: %d * 1/%d != 1", f.Name(), y, y)
+			}
+		}
+	}
+}
+
+func TestFieldSlices(t *testing.T) {
+	for _, f := range fields {
+		// both sides of the table threshold of GF(2**16)
+		for _, n := range []int{2, 64, 4096} {
+			src := make([]byte, n)
+			dst := make([]byte, n)
+			rand.Read(src)
+			rand.Read(dst)
+			c := randomElement(f)
+
+			expected := make([]byte, n)
+			product := make([]byte, n)
+			for i := 0; i < n/f.SymbolSize(); i++ {
+				p := f.Mul(c, f.Symbol(src, i))
+				f.SetSymbol(product, i, p)
+				f.SetSymbol(expected, i, f.Symbol(dst, i)^p)
+			}
+
+			f.MulAddSlice(dst, src, c)
+			if !bytes.Equal(dst, expected) {
+				t.Fatalf("%s: MulAddSlice of %d bytes by %d", f.Name(), n, c)
+			}
+			f.MulSlice(src, src, c)
+			if !bytes.Equal(src, product) {
+				t.Fatalf("%s: MulSlice of %d bytes by %d", f.Name(), n, c)
+			}
+		}
+	}
+}
+
+func TestFieldByID(t *testing.T) {
+	for _, f := range fields {
+		if byID, err := galoisfield.ByID(f.ID()); err != nil || byID != f {
+			t.Fatalf("%s isn't found by ID %d", f.Name(), f.ID())
+		}
+		if byName, err := galoisfield.ByName(f.Name()); err != nil || byName != f {
+			t.Fatalf("%s isn't found by name", f.Name())
+		}
+		if f.Size() != 1<<f.ID() {
+			t.Fatalf("%s has %d elements", f.Name(), f.Size())
+		}
+	}
+	if _, err := galoisfield.ByName("gf3"); err != galoisfield.ErrUnknownField {
+		t.Fatal("unknown field is found")
+	}
+	if _, err := galoisfield.ByID(0); err != galoisfield.ErrUnknownField {
+		t.Fatal("unknown field ID is found")
+	}
+}
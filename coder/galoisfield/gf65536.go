@@ -0,0 +1,144 @@
+package galoisfield
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+
+	tableGF "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+)
+
+const (
+	// x^16 + x^12 + x^3 + x + 1, primitive with generator 2
+	poly65536 = 0x1100b
+	// below this many bytes slices are multiplied symbol by symbol,
+	// above it through tables of the coefficient built for the call
+	tableThreshold = 1024
+)
+
+// gf65536 multiplies through log and exp tables, exp is doubled so that
+// the sum of two logarithms needs no reduction
+type gf65536 struct {
+	log []uint16
+	exp []uint16
+}
+
+func newGF65536() *gf65536 {
+	const m = 1<<16 - 1
+	f := &gf65536{log: make([]uint16, 1<<16), exp: make([]uint16, 2*m)}
+	x := uint32(1)
+	for i := 0; i < m; i++ {
+		if x == 1 && i != 0 {
+			panic("galoisfield: 2 is not a generator of GF(2**16)")
+		}
+		f.exp[i] = uint16(x)
+		f.exp[i+m] = uint16(x)
+		f.log[x] = uint16(i)
+		x <<= 1
+		if x&(1<<16) != 0 {
+			x ^= poly65536
+		}
+	}
+	return f
+}
+
+func (*gf65536) ID() ID          { return 16 }
+func (*gf65536) Name() string    { return "gf65536" }
+func (*gf65536) Size() uint      { return 1 << 16 }
+func (*gf65536) SymbolSize() int { return 2 }
+func (*gf65536) Random(v []byte) { rand.Read(v) }
+
+func (*gf65536) Symbol(data []byte, i int) uint16 {
+	return binary.BigEndian.Uint16(data[2*i:])
+}
+
+func (*gf65536) SetSymbol(data []byte, i int, x uint16) {
+	binary.BigEndian.PutUint16(data[2*i:], x)
+}
+
+func (f *gf65536) Mul(x, y uint16) uint16 {
+	if x == 0 || y == 0 {
+		return 0
+	}
+	return f.exp[uint(f.log[x])+uint(f.log[y])]
+}
+
+func (f *gf65536) Div(x, y uint16) uint16 {
+	if y == 0 {
+		panic(tableGF.ErrDivByZero)
+	}
+	if x == 0 {
+		return 0
+	}
+	return f.exp[1<<16-1+uint(f.log[x])-uint(f.log[y])]
+}
+
+func (f *gf65536) Inv(x uint16) uint16 {
+	if x == 0 {
+		panic(tableGF.ErrDivByZero)
+	}
+	return f.exp[1<<16-1-uint(f.log[x])]
+}
+
+// tables returns the products of c with every high and every low byte
+// of a symbol
+func (f *gf65536) tables(c uint16) (high, low *[256]uint16) {
+	high, low = new([256]uint16), new([256]uint16)
+	for b := uint16(1); b < 256; b++ {
+		high[b] = f.Mul(c, b<<8)
+		low[b] = f.Mul(c, b)
+	}
+	return high, low
+}
+
+func (f *gf65536) MulAddSlice(dst, src []byte, c uint16) {
+	n := len(src) &^ 1
+	switch c {
+	case 0:
+		return
+	case 1:
+		subtle.XORBytes(dst, dst[:n], src[:n])
+		return
+	}
+	dst = dst[:n]
+	if n < tableThreshold {
+		logC := uint(f.log[c])
+		for i := 0; i < n; i += 2 {
+			if s := binary.BigEndian.Uint16(src[i:]); s != 0 {
+				p := f.exp[logC+uint(f.log[s])]
+				dst[i] ^= byte(p >> 8)
+				dst[i+1] ^= byte(p)
+			}
+		}
+		return
+	}
+	high, low := f.tables(c)
+	for i := 0; i < n; i += 2 {
+		p := high[src[i]] ^ low[src[i+1]]
+		dst[i] ^= byte(p >> 8)
+		dst[i+1] ^= byte(p)
+	}
+}
+
+func (f *gf65536) MulSlice(dst, src []byte, c uint16) {
+	n := len(src) &^ 1
+	dst = dst[:n]
+	if c == 0 {
+		for i := range dst {
+			dst[i] = 0
+		}
+		return
+	}
+	if n < tableThreshold {
+		for i := 0; i < n; i += 2 {
+			binary.BigEndian.PutUint16(dst[i:], f.Mul(c, binary.BigEndian.Uint16(src[i:])))
+		}
+		return
+	}
+	high, low := f.tables(c)
+	for i := 0; i < n; i += 2 {
+		p := high[src[i]] ^ low[src[i+1]]
+		dst[i] = byte(p >> 8)
+		dst[i+1] = byte(p)
+	}
+}
@@ -0,0 +1,91 @@
+package tableGF
+
+import "crypto/subtle"
+
+// nibbles holds the products of a coefficient with every low and every
+// high nibble, so that a byte is multiplied by two lookups into 16 entry
+// tables, which fit in one vector register. The layout is relied upon by
+// the assembly kernels.
+type nibbles struct {
+	low  [16]byte
+	high [16]byte
+}
+
+// kernel multiplies every byte of src by c with the nibble tables of c,
+// mulAdd adds the products to dst and mul stores them in dst. dst is
+// exactly as long as src, and may be src itself.
+type kernel struct {
+	mulAdd func(tables *nibbles, dst, src []byte)
+	mul    func(tables *nibbles, dst, src []byte)
+}
+
+var (
+	// kernels supported by the CPU by name, filled in by init on
+	// architectures with vectorised kernels
+	kernels = map[string]kernel{"generic": {mulAddGeneric, mulGeneric}}
+	// the fastest kernel supported by the CPU
+	selected     = kernels["generic"]
+	selectedName = "generic"
+)
+
+// useKernel selects a supported kernel, kernels are registered in order
+// of preference so the last one selected is used
+func useKernel(name string, k kernel) {
+	kernels[name] = k
+	selected = k
+	selectedName = name
+}
+
+// Kernel returns the name of the multiplication kernel selected for the
+// CPU, "generic" if no vectorised one is supported
+func Kernel() string { return selectedName }
+
+func mulAddGeneric(tables *nibbles, dst, src []byte) {
+	dst = dst[:len(src)]
+	for i, s := range src {
+		dst[i] ^= tables.low[s&0x0f] ^ tables.high[s>>4]
+	}
+}
+
+func mulGeneric(tables *nibbles, dst, src []byte) {
+	dst = dst[:len(src)]
+	for i, s := range src {
+		dst[i] = tables.low[s&0x0f] ^ tables.high[s>>4]
+	}
+}
+
+// buildNibbles computes the nibble tables of every element of the field
+func (gf *GF) buildNibbles() {
+	n := gf.Size()
+	gf.nibbles = make([]nibbles, n)
+	for c := uint(0); c < n; c++ {
+		for x := uint(0); x < 16; x++ {
+			if x < n {
+				gf.nibbles[c].low[x] = gf.Mul(byte(c), byte(x))
+			}
+			if x<<4 < n {
+				gf.nibbles[c].high[x] = gf.Mul(byte(c), byte(x<<4))
+			}
+		}
+	}
+}
+
+// MulAddSlice computes dst[i] = dst[i] + c*src[i] in GF(2**k) for every
+// byte of src, dst must be at least as long as src. Bytes are multiplied
+// in vector registers where the CPU supports it.
+func (gf *GF) MulAddSlice(dst, src []byte, c byte) {
+	switch c {
+	case 0:
+		return
+	case 1:
+		subtle.XORBytes(dst, dst[:len(src)], src)
+		return
+	}
+	selected.mulAdd(&gf.nibbles[c], dst[:len(src)], src)
+}
+
+// MulSlice computes dst[i] = c*src[i] in GF(2**k) for every byte of src,
+// dst must be at least as long as src and may be src itself
+func (gf *GF) MulSlice(dst, src []byte, c byte) {
+	selected.mul(&gf.nibbles[c], dst[:len(src)], src)
+}
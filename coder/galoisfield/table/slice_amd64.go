@@ -0,0 +1,32 @@
+//go:build !purego
+
+package tableGF
+
+import "golang.org/x/sys/cpu"
+
+//go:noescape
+func mulAddSSSE3(tables *nibbles, dst, src *byte, n int)
+
+//go:noescape
+func mulSSSE3(tables *nibbles, dst, src *byte, n int)
+
+//go:noescape
+func mulAddAVX2(tables *nibbles, dst, src *byte, n int)
+
+//go:noescape
+func mulAVX2(tables *nibbles, dst, src *byte, n int)
+
+func init() {
+	if cpu.X86.HasSSSE3 {
+		useKernel("ssse3", kernel{
+			mulAdd: vectorised(mulAddSSSE3, mulAddGeneric, 16),
+			mul:    vectorised(mulSSSE3, mulGeneric, 16),
+		})
+	}
+	if cpu.X86.HasAVX2 {
+		useKernel("avx2", kernel{
+			mulAdd: vectorised(mulAddAVX2, mulAddGeneric, 32),
+			mul:    vectorised(mulAVX2, mulGeneric, 32),
+		})
+	}
+}
@@ -0,0 +1,134 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// Each byte of src is split into nibbles, which index the tables of
+// products by PSHUFB. The products of both are added to dst by the mulAdd
+// kernels, and stored in dst by the mul kernels.
+
+// func mulAddSSSE3(tables *nibbles, dst, src *byte, n int)
+TEXT ·mulAddSSSE3(SB), NOSPLIT, $0-32
+	MOVQ tables+0(FP), AX
+	MOVQ dst+8(FP), DI
+	MOVQ src+16(FP), SI
+	MOVQ n+24(FP), CX
+
+	MOVOU 0(AX), X0  // products of low nibbles
+	MOVOU 16(AX), X1 // products of high nibbles
+	MOVQ  $0x0f0f0f0f0f0f0f0f, DX
+	MOVQ  DX, X2
+	PUNPCKLQDQ X2, X2 // nibble mask
+
+loop:
+	MOVOU (SI), X3
+	MOVOU X3, X4
+	PSRLQ $4, X4
+	PAND  X2, X3
+	PAND  X2, X4
+	MOVOU X0, X5
+	PSHUFB X3, X5
+	MOVOU X1, X6
+	PSHUFB X4, X6
+	PXOR  X5, X6
+	MOVOU (DI), X7
+	PXOR  X6, X7
+	MOVOU X7, (DI)
+
+	ADDQ $16, SI
+	ADDQ $16, DI
+	SUBQ $16, CX
+	JNZ  loop
+	RET
+
+// func mulAddAVX2(tables *nibbles, dst, src *byte, n int)
+TEXT ·mulAddAVX2(SB), NOSPLIT, $0-32
+	MOVQ tables+0(FP), AX
+	MOVQ dst+8(FP), DI
+	MOVQ src+16(FP), SI
+	MOVQ n+24(FP), CX
+
+	VBROADCASTI128 0(AX), Y0  // products of low nibbles
+	VBROADCASTI128 16(AX), Y1 // products of high nibbles
+	MOVQ           $0x0f, DX
+	MOVQ           DX, X2
+	VPBROADCASTB   X2, Y2     // nibble mask
+
+loop:
+	VMOVDQU (SI), Y3
+	VPSRLQ  $4, Y3, Y4
+	VPAND   Y2, Y3, Y3
+	VPAND   Y2, Y4, Y4
+	VPSHUFB Y3, Y0, Y5
+	VPSHUFB Y4, Y1, Y6
+	VPXOR   Y5, Y6, Y5
+	VPXOR   (DI), Y5, Y5
+	VMOVDQU Y5, (DI)
+
+	ADDQ $32, SI
+	ADDQ $32, DI
+	SUBQ $32, CX
+	JNZ  loop
+	VZEROUPPER
+	RET
+
+// func mulSSSE3(tables *nibbles, dst, src *byte, n int)
+TEXT ·mulSSSE3(SB), NOSPLIT, $0-32
+	MOVQ tables+0(FP), AX
+	MOVQ dst+8(FP), DI
+	MOVQ src+16(FP), SI
+	MOVQ n+24(FP), CX
+
+	MOVOU 0(AX), X0  // products of low nibbles
+	MOVOU 16(AX), X1 // products of high nibbles
+	MOVQ  $0x0f0f0f0f0f0f0f0f, DX
+	MOVQ  DX, X2
+	PUNPCKLQDQ X2, X2 // nibble mask
+
+loop:
+	MOVOU (SI), X3
+	MOVOU X3, X4
+	PSRLQ $4, X4
+	PAND  X2, X3
+	PAND  X2, X4
+	MOVOU X0, X5
+	PSHUFB X3, X5
+	MOVOU X1, X6
+	PSHUFB X4, X6
+	PXOR  X5, X6
+	MOVOU X6, (DI)
+
+	ADDQ $16, SI
+	ADDQ $16, DI
+	SUBQ $16, CX
+	JNZ  loop
+	RET
+
+// func mulAVX2(tables *nibbles, dst, src *byte, n int)
+TEXT ·mulAVX2(SB), NOSPLIT, $0-32
+	MOVQ tables+0(FP), AX
+	MOVQ dst+8(FP), DI
+	MOVQ src+16(FP), SI
+	MOVQ n+24(FP), CX
+
+	VBROADCASTI128 0(AX), Y0  // products of low nibbles
+	VBROADCASTI128 16(AX), Y1 // products of high nibbles
+	MOVQ           $0x0f, DX
+	MOVQ           DX, X2
+	VPBROADCASTB   X2, Y2     // nibble mask
+
+loop:
+	VMOVDQU (SI), Y3
+	VPSRLQ  $4, Y3, Y4
+	VPAND   Y2, Y3, Y3
+	VPAND   Y2, Y4, Y4
+	VPSHUFB Y3, Y0, Y5
+	VPSHUFB Y4, Y1, Y6
+	VPXOR   Y5, Y6, Y5
+	VMOVDQU Y5, (DI)
+
+	ADDQ $32, SI
+	ADDQ $32, DI
+	SUBQ $32, CX
+	JNZ  loop
+	VZEROUPPER
+	RET
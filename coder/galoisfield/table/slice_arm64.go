@@ -0,0 +1,17 @@
+//go:build !purego
+
+package tableGF
+
+//go:noescape
+func mulAddNEON(tables *nibbles, dst, src *byte, n int)
+
+//go:noescape
+func mulNEON(tables *nibbles, dst, src *byte, n int)
+
+func init() {
+	// NEON is part of every arm64 CPU
+	useKernel("neon", kernel{
+		mulAdd: vectorised(mulAddNEON, mulAddGeneric, 16),
+		mul:    vectorised(mulNEON, mulGeneric, 16),
+	})
+}
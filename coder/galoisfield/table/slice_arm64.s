@@ -0,0 +1,55 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// Each byte of src is split into nibbles, which index the tables of
+// products by TBL. The products of both are added to dst by mulAddNEON,
+// and stored in dst by mulNEON.
+
+// func mulAddNEON(tables *nibbles, dst, src *byte, n int)
+TEXT ·mulAddNEON(SB), NOSPLIT, $0-32
+	MOVD tables+0(FP), R0
+	MOVD dst+8(FP), R1
+	MOVD src+16(FP), R2
+	MOVD n+24(FP), R3
+
+	VLD1 (R0), [V0.B16, V1.B16] // products of low & high nibbles
+	VMOVI $15, V2.B16           // nibble mask
+
+loop:
+	VLD1.P 16(R2), [V3.B16]
+	VLD1   (R1), [V4.B16]
+	VUSHR  $4, V3.B16, V5.B16
+	VAND   V2.B16, V3.B16, V3.B16
+	VTBL   V3.B16, [V0.B16], V6.B16
+	VTBL   V5.B16, [V1.B16], V7.B16
+	VEOR   V6.B16, V7.B16, V6.B16
+	VEOR   V6.B16, V4.B16, V4.B16
+	VST1.P [V4.B16], 16(R1)
+
+	SUBS $16, R3, R3
+	BNE  loop
+	RET
+
+// func mulNEON(tables *nibbles, dst, src *byte, n int)
+TEXT ·mulNEON(SB), NOSPLIT, $0-32
+	MOVD tables+0(FP), R0
+	MOVD dst+8(FP), R1
+	MOVD src+16(FP), R2
+	MOVD n+24(FP), R3
+
+	VLD1 (R0), [V0.B16, V1.B16] // products of low & high nibbles
+	VMOVI $15, V2.B16           // nibble mask
+
+loop:
+	VLD1.P 16(R2), [V3.B16]
+	VUSHR  $4, V3.B16, V5.B16
+	VAND   V2.B16, V3.B16, V3.B16
+	VTBL   V3.B16, [V0.B16], V6.B16
+	VTBL   V5.B16, [V1.B16], V7.B16
+	VEOR   V6.B16, V7.B16, V6.B16
+	VST1.P [V6.B16], 16(R1)
+
+	SUBS $16, R3, R3
+	BNE  loop
+	RET
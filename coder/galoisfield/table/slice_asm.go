@@ -0,0 +1,15 @@
+//go:build (amd64 || arm64) && !purego
+
+package tableGF
+
+// vectorised wraps an assembly kernel taking whole vectors of width
+// bytes, the rest is left to the generic kernel
+func vectorised(asm func(tables *nibbles, dst, src *byte, n int), generic func(tables *nibbles, dst, src []byte), width int) func(tables *nibbles, dst, src []byte) {
+	return func(tables *nibbles, dst, src []byte) {
+		n := len(src) &^ (width - 1)
+		if n > 0 {
+			asm(tables, &dst[0], &src[0], n)
+		}
+		generic(tables, dst[n:], src[n:])
+	}
+}
@@ -0,0 +1,78 @@
+package tableGF
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestMulAddSlice(t *testing.T) {
+	gf := DefaultGF256
+	for name, kernel := range kernels {
+		// lengths around the vector widths, at unaligned offsets
+		for _, n := range []int{0, 1, 15, 16, 17, 31, 32, 33, 63, 64, 1000} {
+			src := make([]byte, n+3)
+			dst := make([]byte, n+3)
+			rand.Read(src)
+			rand.Read(dst)
+			for _, c := range []byte{2, 3, 0x80, 0xff, byte(rand.Intn(254) + 2)} {
+				expected := append([]byte{}, dst...)
+				for i := 0; i < n; i++ {
+					expected[i+1] ^= gf.Mul(src[i+2], c)
+				}
+				kernel.mulAdd(&gf.nibbles[c], dst[1:n+1], src[2:n+2])
+				if !bytes.Equal(dst, expected) {
+					t.Fatalf("%s: wrong sums of products of %d bytes by %d", name, n, c)
+				}
+
+				// products in place
+				for i := 0; i < n; i++ {
+					expected[i+1] = gf.Mul(dst[i+1], c)
+				}
+				kernel.mul(&gf.nibbles[c], dst[1:n+1], dst[1:n+1])
+				if !bytes.Equal(dst, expected) {
+					t.Fatalf("%s: wrong products of %d bytes by %d", name, n, c)
+				}
+			}
+		}
+	}
+}
+
+func TestMulSlice(t *testing.T) {
+	for _, gf := range []*GF{DefaultGF16, Poly84310_g3, Poly84320_g2} {
+		src := make([]byte, 100)
+		for i := range src {
+			src[i] = byte(rand.Intn(int(gf.Size())))
+		}
+		for c := uint(0); c < gf.Size(); c++ {
+			product := make([]byte, len(src))
+			gf.MulSlice(product, src, byte(c))
+			sum := append([]byte{}, src...)
+			gf.MulAddSlice(sum, src, byte(c))
+			for i := range src {
+				if product[i] != gf.Mul(src[i], byte(c)) || sum[i] != src[i]^product[i] {
+					t.Fatalf("wrong product of %d by %d", src[i], c)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkMulAddSlice(b *testing.B) {
+	gf := DefaultGF256
+	for name, kernel := range kernels {
+		for _, n := range []int{1 << 10, 1 << 16} {
+			b.Run(fmt.Sprintf("%s %dB", name, n), func(b *testing.B) {
+				src := make([]byte, n)
+				dst := make([]byte, n)
+				rand.Read(src)
+				b.SetBytes(int64(n))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					kernel.mulAdd(&gf.nibbles[0x57], dst, src)
+				}
+			})
+		}
+	}
+}
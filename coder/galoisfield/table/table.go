@@ -23,9 +23,10 @@ type params struct {
 // GF represents a particular permutation of GF(2**k) for some fixed k.
 type GF struct {
 	params
-	m   uint
-	log []byte
-	exp []byte
+	m       uint
+	log     []byte
+	exp     []byte
+	nibbles []nibbles // by coefficient, for multiplying slices
 }
 
 var (
@@ -150,6 +151,7 @@ func New(n, p uint, g byte) *GF {
 		gf.log[x] = byte(i)
 		x = mulSlow(x, g, byte(p), k)
 	}
+	gf.buildNibbles()
 
 	mu.Lock()
 	singleton, found = global[params]
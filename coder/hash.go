@@ -0,0 +1,109 @@
+package coder
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+// HashLength - Number of checks, in bytes, of the homomorphic hash of a piece
+const HashLength = 8
+
+// CheckKeyLength - Length of keys made by NewCheckKey
+const CheckKeyLength = 32
+
+// HomomorphicHash - Hash of a piece which is linear over the field, i.e.
+// the hash of a combination of pieces is the same combination of their
+// hashes. It is computed as HashLength dot products of the piece with
+// check vectors expanded from key, so the hash of a coded or recoded
+// piece can be checked against the hashes of the source pieces, without
+// decoding.
+//
+// Symbols are those of the field pieces are coded over, a partial last
+// symbol is padded with zeros. GF2 hashes like GF256, as it shares its
+// arithmetic.
+//
+// Anyone knowing the key can craft a polluted piece passing the hash, by
+// adding a piece whose hash is zero. Hashes under a public key, like the
+// generation hash, only detect corruption. Pollution is detected against
+// hashes under a key kept secret from the senders, see NewCheckKey.
+func HomomorphicHash(field galoisfield.Field, key []byte, piece Piece) []byte {
+	size := field.SymbolSize()
+	if len(piece)%size != 0 {
+		padded := make(Piece, len(piece)+size-len(piece)%size)
+		copy(padded, piece)
+		piece = padded
+	}
+	bits := 8 * size
+	hash := make([]byte, HashLength)
+	checks := newCheckVectors(key)
+	for i := 0; i < len(piece)/size; i++ {
+		r := checks.next()
+		symbol := field.Symbol(piece, i)
+		if symbol == 0 {
+			continue
+		}
+		for j := 0; j < HashLength/size; j++ {
+			check := uint16(r>>(bits*j)) & uint16(1<<bits-1)
+			field.SetSymbol(hash, j, field.Symbol(hash, j)^field.Mul(check, symbol))
+		}
+	}
+	return hash
+}
+
+// VerifyCodedPiece - Checks the hash of a coded piece against the
+// combination of hashes of source pieces given by its coding vector
+func VerifyCodedPiece(field galoisfield.Field, key []byte, codedPiece *CodedPiece, hashes [][]byte) error {
+	size := field.SymbolSize()
+	if len(codedPiece.Vector) != len(hashes)*size {
+		return ErrCodingVectorLengthMismatch
+	}
+	expected := make([]byte, HashLength)
+	for i := range hashes {
+		c := field.Symbol(codedPiece.Vector, i)
+		if c == 0 {
+			continue
+		}
+		if len(hashes[i]) != HashLength {
+			return ErrBadHash
+		}
+		field.MulAddSlice(expected, hashes[i], c)
+	}
+	hash := HomomorphicHash(field, key, codedPiece.Piece)
+	for j := range hash {
+		if hash[j] != expected[j] {
+			return ErrPolluted
+		}
+	}
+	return nil
+}
+
+// NewCheckKey - Random key of check vectors, which a receiver keeps secret
+// from the peers sending it pieces. The hashes of the source pieces under
+// it have to be computed by a node holding them.
+func NewCheckKey() []byte {
+	key := make([]byte, CheckKeyLength)
+	rand.Read(key)
+	return key
+}
+
+// checkVectors - splitmix64 generator seeded by the key, every output
+// holds the symbols of all check vectors at one position of the piece
+type checkVectors struct {
+	state uint64
+}
+
+func newCheckVectors(key []byte) *checkVectors {
+	seed := sha256.Sum256(key)
+	return &checkVectors{state: binary.BigEndian.Uint64(seed[:8])}
+}
+
+func (c *checkVectors) next() uint64 {
+	c.state += 0x9e3779b97f4a7c15
+	z := c.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
@@ -0,0 +1,191 @@
+package coder_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+	"github.com/aecra/PeerCodeX/coder/recoder"
+)
+
+func TestHomomorphicHash(t *testing.T) {
+	key := []byte("generation hash")
+	data := make([]byte, 1<<14+100)
+	rand.Read(data)
+	pieceCount := uint(16)
+	pieces, _, err := coder.OriginalPiecesFromDataAndPieceCount(data, pieceCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := make([][]byte, len(pieces))
+	for i, piece := range pieces {
+		hashes[i] = coder.HomomorphicHash(galoisfield.GF256, key, piece)
+	}
+
+	enc := encoder.NewSparseRLNCEncoder(galoisfield.GF256, pieces, 0.5)
+	codedPieces := make([]*coder.CodedPiece, 0)
+	for i := 0; i < 8; i++ {
+		codedPiece := enc.CodedPiece()
+		if err := coder.VerifyCodedPiece(galoisfield.GF256, key, codedPiece, hashes); err != nil {
+			t.Fatalf("coded piece %d: %v", i, err)
+		}
+		codedPieces = append(codedPieces, codedPiece)
+	}
+
+	// recoded pieces are checked against the same hashes
+	rec := recoder.NewFullRLNCRecoder(galoisfield.GF256, codedPieces)
+	recoded, err := rec.CodedPiece()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := coder.VerifyCodedPiece(galoisfield.GF256, key, recoded, hashes); err != nil {
+		t.Fatal(err)
+	}
+
+	polluted := &coder.CodedPiece{Vector: recoded.Vector, Piece: make(coder.Piece, len(recoded.Piece))}
+	copy(polluted.Piece, recoded.Piece)
+	polluted.Piece[len(polluted.Piece)/2] ^= 1
+	if err := coder.VerifyCodedPiece(galoisfield.GF256, key, polluted, hashes); !errors.Is(err, coder.ErrPolluted) {
+		t.Fatalf("expected polluted piece to be detected, got %v", err)
+	}
+	if err := coder.VerifyCodedPiece(galoisfield.GF256, []byte("other key"), recoded, hashes); !errors.Is(err, coder.ErrPolluted) {
+		t.Fatalf("expected hashes of another key not to match, got %v", err)
+	}
+	if err := coder.VerifyCodedPiece(galoisfield.GF256, key, recoded, hashes[1:]); !errors.Is(err, coder.ErrCodingVectorLengthMismatch) {
+		t.Fatalf("expected length mismatch, got %v", err)
+	}
+}
+
+func TestHomomorphicHashOverFields(t *testing.T) {
+	key := []byte("generation hash")
+	for _, field := range []galoisfield.Field{galoisfield.GF2, galoisfield.GF65536} {
+		data := make([]byte, 1<<12)
+		rand.Read(data)
+		pieceCount := uint(8)
+		pieces, _, err := coder.OriginalPiecesFromDataAndPieceCount(data, pieceCount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes := make([][]byte, len(pieces))
+		for i, piece := range pieces {
+			hashes[i] = coder.HomomorphicHash(field, key, piece)
+		}
+
+		enc := encoder.NewFullRLNCEncoder(field, pieces)
+		codedPiece := enc.CodedPiece()
+		if err := coder.VerifyCodedPiece(field, key, codedPiece, hashes); err != nil {
+			t.Fatalf("%s: %v", field.Name(), err)
+		}
+		codedPiece.Piece[0] ^= 1
+		if err := coder.VerifyCodedPiece(field, key, codedPiece, hashes); !errors.Is(err, coder.ErrPolluted) {
+			t.Fatalf("%s: expected polluted piece to be detected, got %v", field.Name(), err)
+		}
+	}
+}
+
+func TestCraftedPollution(t *testing.T) {
+	field := galoisfield.GF256
+	public := []byte("generation hash")
+	data := make([]byte, 1<<10)
+	rand.Read(data)
+	pieces, _, err := coder.OriginalPiecesFromDataAndPieceCount(data, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := coder.NewCheckKey()
+	publicHashes := make([][]byte, len(pieces))
+	secretHashes := make([][]byte, len(pieces))
+	for i, piece := range pieces {
+		publicHashes[i] = coder.HomomorphicHash(field, public, piece)
+		secretHashes[i] = coder.HomomorphicHash(field, secret, piece)
+	}
+
+	// a piece in the kernel of the public checks: the hashes of the first
+	// HashLength+1 unit pieces are linearly dependent, their dependency
+	// hashes to zero
+	n := coder.HashLength + 1
+	columns := make([][]byte, n)
+	for j := range columns {
+		unit := make(coder.Piece, len(pieces[0]))
+		unit[j] = 1
+		columns[j] = coder.HomomorphicHash(field, public, unit)
+	}
+	kernel := make(coder.Piece, len(pieces[0]))
+	copy(kernel, nullVector(field, columns))
+	if !bytes.Equal(coder.HomomorphicHash(field, public, kernel), make([]byte, coder.HashLength)) {
+		t.Fatal("crafted piece does not hash to zero")
+	}
+
+	enc := encoder.NewFullRLNCEncoder(field, pieces)
+	honest := enc.CodedPiece()
+	polluted := &coder.CodedPiece{Vector: honest.Vector, Piece: make(coder.Piece, len(honest.Piece))}
+	copy(polluted.Piece, honest.Piece)
+	field.MulAddSlice(polluted.Piece, kernel, 1)
+
+	if err := coder.VerifyCodedPiece(field, public, polluted, publicHashes); err != nil {
+		t.Fatalf("expected crafted piece to pass the public checks, got %v", err)
+	}
+	if err := coder.VerifyCodedPiece(field, secret, honest, secretHashes); err != nil {
+		t.Fatal(err)
+	}
+	if err := coder.VerifyCodedPiece(field, secret, polluted, secretHashes); !errors.Is(err, coder.ErrPolluted) {
+		t.Fatalf("expected crafted piece to fail the secret checks, got %v", err)
+	}
+}
+
+// nullVector returns a nonzero combination of the columns summing to zero,
+// there must be more columns than rows
+func nullVector(field galoisfield.Field, columns [][]byte) []byte {
+	rows := len(columns[0])
+	m := make([][]uint16, rows)
+	for r := range m {
+		m[r] = make([]uint16, len(columns))
+		for j, column := range columns {
+			m[r][j] = uint16(column[r])
+		}
+	}
+	pivots := make([]int, 0, rows)
+	r := 0
+	for j := 0; j < len(columns) && r < rows; j++ {
+		p := r
+		for p < rows && m[p][j] == 0 {
+			p++
+		}
+		if p == rows {
+			continue
+		}
+		m[r], m[p] = m[p], m[r]
+		inv := field.Inv(m[r][j])
+		for k := range m[r] {
+			m[r][k] = field.Mul(m[r][k], inv)
+		}
+		for q := range m {
+			if q != r && m[q][j] != 0 {
+				c := m[q][j]
+				for k := range m[q] {
+					m[q][k] ^= field.Mul(c, m[r][k])
+				}
+			}
+		}
+		pivots = append(pivots, j)
+		r++
+	}
+	// the first column without a pivot is set to one
+	free := 0
+	for i, j := range pivots {
+		if j != i {
+			break
+		}
+		free++
+	}
+	v := make([]byte, len(columns))
+	v[free] = 1
+	for i, j := range pivots {
+		v[j] = byte(m[i][free])
+	}
+	return v
+}
@@ -2,9 +2,10 @@ package matrix
 
 import (
 	"github.com/aecra/PeerCodeX/coder"
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 )
 
+// Rows of symbols of a field, which take 1 or 2 bytes each
 type Matrix [][]byte
 
 // Cell by cell value comparision of two matrices, which
@@ -33,7 +34,7 @@ func (m *Matrix) Rows() uint {
 	return uint(len(*m))
 }
 
-// #-of columns in matrix
+// #-of columns in matrix, in bytes
 //
 // This isn't expected to change after initialised
 func (m *Matrix) Cols() uint {
@@ -42,26 +43,19 @@ func (m *Matrix) Cols() uint {
 
 // Multiplies two matrices ( which can be multiplied )
 // in order `m x with`
-func (m *Matrix) Multiply(field *galoisfield.GF, with Matrix) (Matrix, error) {
-	if m.Cols() != with.Rows() {
+//
+// Every row of the product is the combination of rows of
+// `with`, weighted by symbols of the row of `m`
+func (m *Matrix) Multiply(field galoisfield.Field, with Matrix) (Matrix, error) {
+	if m.Cols() != with.Rows()*uint(field.SymbolSize()) {
 		return nil, coder.ErrMatrixDimensionMismatch
 	}
 
 	mult := make([][]byte, m.Rows())
 	for i := 0; i < len(*m); i++ {
 		mult[i] = make([]byte, with.Cols())
-	}
-
-	for i := 0; i < int(m.Rows()); i++ {
-		for j := 0; j < int(with.Cols()); j++ {
-
-			for k := 0; k < int(m.Cols()); k++ {
-				if (*m)[i][k] == 0 || with[k][j] == 0 {
-					continue
-				}
-				mult[i][j] = field.Add(mult[i][j], field.Mul((*m)[i][k], with[k][j]))
-			}
-
+		for k := range with {
+			field.MulAddSlice(mult[i], with[k], field.Symbol((*m)[i], k))
 		}
 	}
 
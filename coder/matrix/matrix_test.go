@@ -5,13 +5,13 @@ import (
 	"errors"
 	"testing"
 
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
-	"github.com/aecra/PeerCodeX/coder/matrix"
 	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+	"github.com/aecra/PeerCodeX/coder/matrix"
 )
 
 func TestMatrixMultiplication(t *testing.T) {
-	field := galoisfield.DefaultGF256
+	field := galoisfield.GF256
 
 	m_1 := matrix.Matrix{{102, 82, 165, 0}}
 	m_2 := matrix.Matrix{{157, 233, 247}, {160, 28, 233}, {149, 234, 117}, {200, 181, 55}}
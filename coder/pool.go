@@ -0,0 +1,89 @@
+package coder
+
+import (
+	"runtime"
+	"sync"
+)
+
+// MinColumns is the fewest bytes of a piece worth handing to another
+// worker, smaller pieces are processed by the caller alone
+const MinColumns = 32 << 10
+
+// Pool splits byte-wise operations over pieces into column ranges, which
+// are processed by a fixed set of workers. A single pool is shared by all
+// encoders and decoders, so that generations coded at the same time
+// share the workers instead of each adding their own.
+type Pool struct {
+	workers int
+	ranges  chan columnRange
+}
+
+type columnRange struct {
+	fn         func(start, end int)
+	start, end int
+	wg         *sync.WaitGroup
+}
+
+// DefaultPool is the pool used by encoders, recoders and decoders, with
+// a worker for every CPU Go code runs on
+var DefaultPool = NewPool(runtime.GOMAXPROCS(0))
+
+// NewPool starts a pool of workers, with one worker there's no
+// parallelism and operations run on the caller
+func NewPool(workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &Pool{workers: workers, ranges: make(chan columnRange, workers)}
+	// the caller takes a range itself
+	for i := 1; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	for r := range p.ranges {
+		r.fn(r.start, r.end)
+		r.wg.Done()
+	}
+}
+
+// Workers returns the number of ranges an operation is split into at most
+func (p *Pool) Workers() int {
+	return p.workers
+}
+
+// Columns calls fn on disjoint ranges covering columns [0, n), and
+// returns once all calls have. The caller processes a range itself, and
+// every range no worker is free for, so a busy pool doesn't run more
+// ranges in parallel than it has workers. fn must not use the pool.
+func (p *Pool) Columns(n int, fn func(start, end int)) {
+	count := n / MinColumns
+	if count > p.workers {
+		count = p.workers
+	}
+	if count <= 1 {
+		fn(0, n)
+		return
+	}
+	// multiple of the widest vector kernel
+	size := (n/count + 63) &^ 63
+
+	var wg sync.WaitGroup
+	for start := size; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		select {
+		case p.ranges <- columnRange{fn, start, end, &wg}:
+		default:
+			fn(start, end)
+			wg.Done()
+		}
+	}
+	fn(0, size)
+	wg.Wait()
+}
@@ -0,0 +1,53 @@
+package coder_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/coder"
+)
+
+func TestPoolColumns(t *testing.T) {
+	for _, workers := range []int{1, 3, 8} {
+		pool := coder.NewPool(workers)
+		for _, n := range []int{0, 1, coder.MinColumns, 2*coder.MinColumns + 1, 5 * coder.MinColumns, 100*coder.MinColumns + 7} {
+			covered := make([]byte, n)
+			pool.Columns(n, func(start, end int) {
+				for i := start; i < end; i++ {
+					covered[i]++
+				}
+			})
+			for i, c := range covered {
+				if c != 1 {
+					t.Fatalf("%d workers, %d columns: column %d covered %d times", workers, n, i, c)
+				}
+			}
+		}
+	}
+}
+
+func TestPoolConcurrentCallers(t *testing.T) {
+	pool := coder.NewPool(4)
+	n := 16 * coder.MinColumns
+
+	var wg sync.WaitGroup
+	for caller := 0; caller < 16; caller++ {
+		wg.Add(1)
+		go func(caller int) {
+			defer wg.Done()
+			data := make([]byte, n)
+			pool.Columns(n, func(start, end int) {
+				for i := start; i < end; i++ {
+					data[i] = byte(caller)
+				}
+			})
+			for i, b := range data {
+				if b != byte(caller) {
+					t.Errorf("caller %d: column %d not processed", caller, i)
+					return
+				}
+			}
+		}(caller)
+	}
+	wg.Wait()
+}
@@ -2,12 +2,12 @@ package recoder
 
 import (
 	"github.com/aecra/PeerCodeX/coder"
-	galoisfield "github.com/aecra/PeerCodeX/coder/galoisfield/table"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"github.com/aecra/PeerCodeX/coder/matrix"
 )
 
 type FullRLNCRecoder struct {
-	field        *galoisfield.GF
+	field        galoisfield.Field
 	pieces       []*coder.CodedPiece
 	codingMatrix matrix.Matrix
 }
@@ -26,11 +26,13 @@ func (r *FullRLNCRecoder) fill() {
 // finite field & performing full RLNC with all coded pieces
 func (r *FullRLNCRecoder) CodedPiece() (*coder.CodedPiece, error) {
 	pieceCount := uint(len(r.pieces))
-	vector := coder.GenerateCodingVector(pieceCount)
+	vector := coder.GenerateCodingVector(r.field, pieceCount)
 	piece := make(coder.Piece, len(r.pieces[0].Piece))
-	for i := range r.pieces {
-		piece.Multiply(r.pieces[i].Piece, vector[i], r.field)
-	}
+	coder.DefaultPool.Columns(len(piece), func(start, end int) {
+		for i := range r.pieces {
+			r.field.MulAddSlice(piece[start:end], r.pieces[i].Piece[start:end], r.field.Symbol(vector, i))
+		}
+	})
 
 	vector_ := matrix.Matrix{vector}
 	mult, err := vector_.Multiply(r.field, r.codingMatrix)
@@ -39,11 +41,38 @@ func (r *FullRLNCRecoder) CodedPiece() (*coder.CodedPiece, error) {
 	}
 
 	return &coder.CodedPiece{
-		Vector: mult[0],
-		Piece:  piece,
+		Vector:   mult[0],
+		Piece:    piece,
+		Encoding: coder.SparseOrFull(r.field, mult[0]),
 	}, nil
 }
 
+// How many random recoded pieces are drawn before falling back to
+// a held piece which is known to be innovative
+const innovativeAttempts = 4
+
+// Returns a recoded piece, which is guaranteed to be innovative for
+// a receiver holding `subspace`. If none of held coded pieces is
+// innovative for it, no combination of them is either
+func (r *FullRLNCRecoder) InnovativeCodedPiece(subspace *coder.Subspace) (*coder.CodedPiece, error) {
+	for i := 0; i < innovativeAttempts; i++ {
+		piece, err := r.CodedPiece()
+		if err != nil {
+			return nil, err
+		}
+		if subspace.IsInnovative(piece.Vector) {
+			return piece, nil
+		}
+	}
+
+	for _, piece := range r.pieces {
+		if subspace.IsInnovative(piece.Vector) {
+			return piece, nil
+		}
+	}
+	return nil, coder.ErrNotInnovative
+}
+
 func (r *FullRLNCRecoder) AddCodedPiece(piece *coder.CodedPiece) {
 	r.pieces = append(r.pieces, piece)
 	r.fill()
@@ -52,9 +81,9 @@ func (r *FullRLNCRecoder) AddCodedPiece(piece *coder.CodedPiece) {
 // Provide with all coded pieces, which are to be used
 // for performing fullRLNC ( read recoding of coded data )
 // & get back recoder which is used for on-the-fly construction
-// of N-many recoded pieces
-func NewFullRLNCRecoder(pieces []*coder.CodedPiece) *FullRLNCRecoder {
-	rec := &FullRLNCRecoder{field: galoisfield.DefaultGF256, pieces: pieces}
+// of N-many recoded pieces, over the field pieces are coded over
+func NewFullRLNCRecoder(field galoisfield.Field, pieces []*coder.CodedPiece) *FullRLNCRecoder {
+	rec := &FullRLNCRecoder{field: field, pieces: pieces}
 	rec.fill()
 	return rec
 }
@@ -63,11 +92,11 @@ func NewFullRLNCRecoder(pieces []*coder.CodedPiece) *FullRLNCRecoder {
 // will be splitted into structured coded pieces ( read having two components
 // i.e. coding vector & piece ) & recoder to be returned, which can be used
 // for on-the-fly random piece recoding
-func NewFullRLNCRecoderWithFlattenData(data []byte, pieceCount uint, piecesCodedTogether uint) (*FullRLNCRecoder, error) {
-	codedPieces, err := coder.CodedPiecesForRecoding(data, pieceCount, piecesCodedTogether)
+func NewFullRLNCRecoderWithFlattenData(field galoisfield.Field, data []byte, pieceCount uint, piecesCodedTogether uint) (*FullRLNCRecoder, error) {
+	codedPieces, err := coder.CodedPiecesForRecoding(data, pieceCount, piecesCodedTogether*uint(field.SymbolSize()))
 	if err != nil {
 		return nil, err
 	}
 
-	return NewFullRLNCRecoder(codedPieces), nil
+	return NewFullRLNCRecoder(field, codedPieces), nil
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/aecra/PeerCodeX/coder"
 	"github.com/aecra/PeerCodeX/coder/decoder"
 	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"github.com/aecra/PeerCodeX/coder/recoder"
 )
 
@@ -32,8 +33,8 @@ func generatePieces(pieceCount uint, pieceLength uint) []coder.Piece {
 	return pieces
 }
 
-func recoderFlow(t *testing.T, rec recoder.Recoder, pieceCount int, pieces []coder.Piece) {
-	dec := decoder.NewGaussElimRLNCDecoder(uint(pieceCount))
+func recoderFlow(t *testing.T, field galoisfield.Field, rec recoder.Recoder, pieceCount int, pieces []coder.Piece) {
+	dec := decoder.NewGaussElimRLNCDecoder(field, uint(pieceCount))
 	for {
 		r_piece, err := rec.CodedPiece()
 		if err != nil {
@@ -67,15 +68,15 @@ func TestNewFullRLNCRecoder(t *testing.T) {
 	pieceLength := 8192
 	codedPieceCount := pieceCount + 2
 	pieces := generatePieces(uint(pieceCount), uint(pieceLength))
-	enc := encoder.NewFullRLNCEncoder(pieces)
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
 
 	coded := make([]*coder.CodedPiece, 0, codedPieceCount)
 	for i := 0; i < codedPieceCount; i++ {
 		coded = append(coded, enc.CodedPiece())
 	}
 
-	rec := recoder.NewFullRLNCRecoder(coded)
-	recoderFlow(t, rec, pieceCount, pieces)
+	rec := recoder.NewFullRLNCRecoder(galoisfield.GF256, coded)
+	recoderFlow(t, galoisfield.GF256, rec, pieceCount, pieces)
 }
 
 func TestNewFullRLNCRecoderWithFlattenData(t *testing.T) {
@@ -85,7 +86,7 @@ func TestNewFullRLNCRecoderWithFlattenData(t *testing.T) {
 	pieceLength := 8192
 	codedPieceCount := pieceCount + 2
 	pieces := generatePieces(uint(pieceCount), uint(pieceLength))
-	enc := encoder.NewFullRLNCEncoder(pieces)
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
 
 	coded := make([]*coder.CodedPiece, 0, codedPieceCount)
 	for i := 0; i < codedPieceCount; i++ {
@@ -97,10 +98,68 @@ func TestNewFullRLNCRecoderWithFlattenData(t *testing.T) {
 		codedFlattened = append(codedFlattened, coded[i].Flatten()...)
 	}
 
-	rec, err := recoder.NewFullRLNCRecoderWithFlattenData(codedFlattened, uint(codedPieceCount), uint(pieceCount))
+	rec, err := recoder.NewFullRLNCRecoderWithFlattenData(galoisfield.GF256, codedFlattened, uint(codedPieceCount), uint(pieceCount))
 	if err != nil {
 		t.Fatal(err.Error())
 	}
 
-	recoderFlow(t, rec, pieceCount, pieces)
+	recoderFlow(t, galoisfield.GF256, rec, pieceCount, pieces)
+}
+
+func TestFullRLNCRecoder_InnovativeCodedPiece(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	pieceCount := 32
+	pieces := generatePieces(uint(pieceCount), 1024)
+	enc := encoder.NewFullRLNCEncoder(galoisfield.GF256, pieces)
+
+	// relay holds half of the subspace, receiver a part of it already
+	coded := make([]*coder.CodedPiece, 0, pieceCount/2)
+	for i := 0; i < pieceCount/2; i++ {
+		coded = append(coded, enc.CodedPiece())
+	}
+	rec := recoder.NewFullRLNCRecoder(galoisfield.GF256, coded)
+	dec := decoder.NewGaussElimRLNCDecoder(galoisfield.GF256, uint(pieceCount))
+	for i := 0; i < 4; i++ {
+		dec.AddPiece(coded[i])
+	}
+
+	received := 0
+	for {
+		piece, err := rec.InnovativeCodedPiece(dec.Subspace())
+		if errors.Is(err, coder.ErrNotInnovative) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		required := dec.Required()
+		dec.AddPiece(piece)
+		if dec.Required() != required-1 {
+			t.Fatal("recoded piece is not innovative")
+		}
+		received++
+	}
+	if received != pieceCount/2-4 {
+		t.Fatalf("expected %d innovative pieces, got %d", pieceCount/2-4, received)
+	}
+}
+
+func TestFullRLNCRecoderOverFields(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	for _, field := range []galoisfield.Field{galoisfield.GF2, galoisfield.GF65536} {
+		pieceCount := 32
+		pieces := generatePieces(uint(pieceCount), 1024)
+		enc := encoder.NewFullRLNCEncoder(field, pieces)
+
+		// enough pieces to span the whole space, even with GF(2)
+		coded := make([]*coder.CodedPiece, 0, 2*pieceCount)
+		for i := 0; i < 2*pieceCount; i++ {
+			coded = append(coded, enc.CodedPiece())
+		}
+
+		rec := recoder.NewFullRLNCRecoder(field, coded)
+		recoderFlow(t, field, rec, pieceCount, pieces)
+	}
 }
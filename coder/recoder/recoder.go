@@ -6,4 +6,5 @@ type Recoder interface {
 	fill()
 	AddCodedPiece(piece *coder.CodedPiece)
 	CodedPiece() (*coder.CodedPiece, error)
+	InnovativeCodedPiece(subspace *coder.Subspace) (*coder.CodedPiece, error)
 }
@@ -0,0 +1,205 @@
+package coder
+
+import (
+	"encoding/binary"
+
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+// Subspace - Span of coding vectors held by a decoder, kept in reduced
+// row echelon form. A sender knowing the subspace of a receiver can tell
+// whether a coded piece is innovative ( read linearly independent ) for it
+type Subspace struct {
+	field      galoisfield.Field
+	pieceCount uint
+	pivots     []uint         // pivot column of every row
+	rows       []CodingVector // 1 at own pivot, 0 at pivots of other rows
+}
+
+func NewSubspace(field galoisfield.Field, pieceCount uint) *Subspace {
+	return &Subspace{field: field, pieceCount: pieceCount}
+}
+
+func (s *Subspace) PieceCount() uint {
+	return s.pieceCount
+}
+
+// Rank - Dimension of the subspace
+func (s *Subspace) Rank() uint {
+	return uint(len(s.rows))
+}
+
+// vectorLen - Bytes of a coding vector of the subspace
+func (s *Subspace) vectorLen() int {
+	return int(s.pieceCount) * s.field.SymbolSize()
+}
+
+// reduce - Eliminates pivot columns of the subspace from a copy of
+// vector, which is zero only if vector is inside the subspace
+func (s *Subspace) reduce(vector CodingVector) CodingVector {
+	reduced := make(CodingVector, s.vectorLen())
+	copy(reduced, vector)
+	for i, row := range s.rows {
+		c := s.field.Symbol(reduced, int(s.pivots[i]))
+		if c == 0 {
+			continue
+		}
+		s.field.MulAddSlice(reduced, row, c)
+	}
+	return reduced
+}
+
+// IsInnovative - Whether a coded piece with this coding vector would
+// increase rank of the decoder holding the subspace
+func (s *Subspace) IsInnovative(vector CodingVector) bool {
+	if len(vector) != s.vectorLen() {
+		return false
+	}
+	for _, c := range s.reduce(vector) {
+		if c != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Add - Extends subspace by a coding vector, returns false if vector
+// is not innovative, in which case subspace stays as it is
+func (s *Subspace) Add(vector CodingVector) bool {
+	if len(vector) != s.vectorLen() {
+		return false
+	}
+	reduced := s.reduce(vector)
+	pivot := -1
+	for k := 0; k < int(s.pieceCount); k++ {
+		if s.field.Symbol(reduced, k) != 0 {
+			pivot = k
+			break
+		}
+	}
+	if pivot < 0 {
+		return false
+	}
+
+	inv := s.field.Inv(s.field.Symbol(reduced, pivot))
+	s.field.MulSlice(reduced, reduced, inv)
+	for _, row := range s.rows {
+		c := s.field.Symbol(row, pivot)
+		if c == 0 {
+			continue
+		}
+		s.field.MulAddSlice(row, reduced, c)
+	}
+	s.pivots = append(s.pivots, uint(pivot))
+	s.rows = append(s.rows, reduced)
+	return true
+}
+
+// MissingPiece - Index of an original piece whose unit coding vector is
+// outside of the subspace, false if subspace spans whole space
+func (s *Subspace) MissingPiece() (uint, bool) {
+	isPivot := s.pivotSet()
+	for k := uint(0); k < s.pieceCount; k++ {
+		if !isPivot[k] {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Subspace) pivotSet() []bool {
+	isPivot := make([]bool, s.pieceCount)
+	for _, p := range s.pivots {
+		isPivot[p] = true
+	}
+	return isPivot
+}
+
+// NewSubspaceFromRows - Subspace spanned by rows which are already in
+// reduced row echelon form, with 1 at the pivot column of every row and
+// 0 at pivots of other rows. Rows are copied.
+func NewSubspaceFromRows(field galoisfield.Field, pieceCount uint, pivots []uint, rows []CodingVector) *Subspace {
+	s := &Subspace{field: field, pieceCount: pieceCount, pivots: pivots, rows: rows}
+	return s.Clone()
+}
+
+func (s *Subspace) Clone() *Subspace {
+	clone := &Subspace{
+		field:      s.field,
+		pieceCount: s.pieceCount,
+		pivots:     make([]uint, len(s.pivots)),
+		rows:       make([]CodingVector, len(s.rows)),
+	}
+	copy(clone.pivots, s.pivots)
+	for i, row := range s.rows {
+		clone.rows[i] = make(CodingVector, len(row))
+		copy(clone.rows[i], row)
+	}
+	return clone
+}
+
+// Bytes - Compact form of the subspace: piece count, rank & pivot columns,
+// followed by only the non-pivot columns of every row, as pivot columns
+// of the reduced row echelon form are known to be 0 or 1
+func (s *Subspace) Bytes() []byte {
+	rank := len(s.rows)
+	free := int(s.pieceCount) - rank
+	symbol := s.field.SymbolSize()
+	buf := make([]byte, 8+4*rank+rank*free*symbol)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(s.pieceCount))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(rank))
+	for i, p := range s.pivots {
+		binary.BigEndian.PutUint32(buf[8+4*i:], uint32(p))
+	}
+
+	isPivot := s.pivotSet()
+	off := 8 + 4*rank
+	for _, row := range s.rows {
+		for k := range isPivot {
+			if !isPivot[k] {
+				off += copy(buf[off:], row[k*symbol:(k+1)*symbol])
+			}
+		}
+	}
+	return buf
+}
+
+// Reads back subspace written by `Bytes`
+func NewSubspaceFromBytes(field galoisfield.Field, data []byte) (*Subspace, error) {
+	if len(data) < 8 {
+		return nil, ErrBadSubspace
+	}
+	pieceCount := uint64(binary.BigEndian.Uint32(data[0:4]))
+	rank := uint64(binary.BigEndian.Uint32(data[4:8]))
+	symbol := uint64(field.SymbolSize())
+	if rank > pieceCount || uint64(len(data)) != 8+4*rank+rank*(pieceCount-rank)*symbol {
+		return nil, ErrBadSubspace
+	}
+
+	s := NewSubspace(field, uint(pieceCount))
+	s.pivots = make([]uint, rank)
+	isPivot := make([]bool, pieceCount)
+	for i := range s.pivots {
+		p := uint64(binary.BigEndian.Uint32(data[8+4*i:]))
+		if p >= pieceCount || isPivot[p] {
+			return nil, ErrBadSubspace
+		}
+		s.pivots[i] = uint(p)
+		isPivot[p] = true
+	}
+
+	off := 8 + 4*rank
+	s.rows = make([]CodingVector, rank)
+	for i := range s.rows {
+		row := make(CodingVector, pieceCount*symbol)
+		field.SetSymbol(row, int(s.pivots[i]), 1)
+		for k := uint64(0); k < pieceCount; k++ {
+			if !isPivot[k] {
+				copy(row[k*symbol:(k+1)*symbol], data[off:])
+				off += symbol
+			}
+		}
+		s.rows[i] = row
+	}
+	return s, nil
+}
@@ -0,0 +1,126 @@
+package coder_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+func TestSubspace(t *testing.T) {
+	pieceCount := uint(32)
+	subspace := coder.NewSubspace(galoisfield.GF256, pieceCount)
+
+	// span of a few random vectors, along with some combination of them
+	vectors := make([]coder.CodingVector, 0)
+	for i := 0; i < 10; i++ {
+		vector := coder.GenerateCodingVector(galoisfield.GF256, pieceCount)
+		if !subspace.Add(vector) {
+			t.Fatal("random vector is expected to be innovative")
+		}
+		vectors = append(vectors, vector)
+	}
+	if subspace.Rank() != 10 {
+		t.Fatalf("expected rank 10, got %d", subspace.Rank())
+	}
+
+	combination := make(coder.Piece, pieceCount)
+	for _, vector := range vectors {
+		combination.Multiply(coder.Piece(vector), 7, galoisfield.GF256)
+	}
+	if subspace.IsInnovative(coder.CodingVector(combination)) || subspace.Add(coder.CodingVector(combination)) {
+		t.Fatal("combination of added vectors is not innovative")
+	}
+	if subspace.Rank() != 10 {
+		t.Fatal("rank changed by non-innovative vector")
+	}
+
+	idx, ok := subspace.MissingPiece()
+	if !ok {
+		t.Fatal("subspace is not full")
+	}
+	unit := make(coder.CodingVector, pieceCount)
+	unit[idx] = 1
+	if !subspace.IsInnovative(unit) {
+		t.Fatal("unit vector of missing piece is expected to be innovative")
+	}
+
+	decoded, err := coder.NewSubspaceFromBytes(galoisfield.GF256, subspace.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Rank() != subspace.Rank() || decoded.PieceCount() != pieceCount {
+		t.Fatal("subspace changed by encoding")
+	}
+	for _, vector := range vectors {
+		if decoded.IsInnovative(vector) {
+			t.Fatal("decoded subspace lost a vector")
+		}
+	}
+	if !decoded.IsInnovative(unit) {
+		t.Fatal("decoded subspace gained a vector")
+	}
+	if len(subspace.Bytes()) != 8+4*10+10*(32-10) {
+		t.Fatalf("unexpected encoded length %d", len(subspace.Bytes()))
+	}
+
+	clone := subspace.Clone()
+	for clone.Add(coder.GenerateCodingVector(galoisfield.GF256, pieceCount)) {
+	}
+	if clone.Rank() != pieceCount || subspace.Rank() != 10 {
+		t.Fatal("clone is expected to be independent")
+	}
+	if _, ok := clone.MissingPiece(); ok {
+		t.Fatal("full subspace misses no piece")
+	}
+
+	if _, err := coder.NewSubspaceFromBytes(galoisfield.GF256, subspace.Bytes()[:20]); !errors.Is(err, coder.ErrBadSubspace) {
+		t.Fatalf("expected ErrBadSubspace, got %v", err)
+	}
+}
+
+func TestSubspaceOverFields(t *testing.T) {
+	pieceCount := uint(16)
+	field := galoisfield.GF65536
+	subspace := coder.NewSubspace(field, pieceCount)
+	vectors := make([]coder.CodingVector, 0)
+	for i := 0; i < 6; i++ {
+		vector := coder.GenerateCodingVector(field, pieceCount)
+		if len(vector) != int(pieceCount)*field.SymbolSize() {
+			t.Fatalf("expected coding vector of %d bytes, got %d", int(pieceCount)*field.SymbolSize(), len(vector))
+		}
+		if !subspace.Add(vector) {
+			t.Fatal("random vector is expected to be innovative")
+		}
+		vectors = append(vectors, vector)
+	}
+
+	combination := make(coder.Piece, len(vectors[0]))
+	for i, vector := range vectors {
+		combination.Multiply(coder.Piece(vector), uint16(0x1234*(i+1)), field)
+	}
+	if subspace.IsInnovative(coder.CodingVector(combination)) {
+		t.Fatal("combination of added vectors is not innovative")
+	}
+	if subspace.IsInnovative(coder.CodingVector(combination[:pieceCount])) {
+		t.Fatal("vector of a byte per piece is not of the field")
+	}
+
+	data := subspace.Bytes()
+	if len(data) != 8+4*6+6*(16-6)*2 {
+		t.Fatalf("unexpected encoded length %d", len(data))
+	}
+	decoded, err := coder.NewSubspaceFromBytes(field, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vector := range vectors {
+		if decoded.IsInnovative(vector) {
+			t.Fatal("decoded subspace lost a vector")
+		}
+	}
+	if _, err := coder.NewSubspaceFromBytes(galoisfield.GF256, data); !errors.Is(err, coder.ErrBadSubspace) {
+		t.Fatalf("expected subspace of another field to be rejected, got %v", err)
+	}
+}
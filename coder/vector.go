@@ -0,0 +1,152 @@
+package coder
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+// VectorEncoding - How the coding vector of a coded piece is sent to
+// another peer, chosen by the encoder coding the piece. Vectors are held
+// in full in memory whatever their encoding.
+type VectorEncoding byte
+
+const (
+	// [symbol]..., every symbol of the vector
+	FullVector VectorEncoding = 0x00
+	// [piece count 4][count 4]([index 4][symbol])..., non-zero symbols only
+	SparseVector VectorEncoding = 0x01
+	// [piece count 4][seed 8], vector is regenerated by SeededCodingVector
+	SeededVector VectorEncoding = 0x02
+)
+
+// MaxVectorPieceCount bounds the piece count of sparse and seeded vectors
+// read back, so that a few bytes never allocate a vector of any length
+const MaxVectorPieceCount = 1 << 16
+
+// splitMix64 - Generator of SeededCodingVector, it's part of the wire
+// format, so it must never change
+type splitMix64 uint64
+
+func (s *splitMix64) next() uint64 {
+	*s += 0x9e3779b97f4a7c15
+	z := uint64(*s)
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// SeededCodingVector - Coding vector of n random elements of field, drawn
+// deterministically from seed, so that the seed stands for the vector
+func SeededCodingVector(field galoisfield.Field, n uint, seed uint64) CodingVector {
+	vector := make(CodingVector, n*uint(field.SymbolSize()))
+	mask := uint16(field.Size() - 1)
+	gen := splitMix64(seed)
+	for i := 0; i < int(n); i++ {
+		field.SetSymbol(vector, i, uint16(gen.next())&mask)
+	}
+	return vector
+}
+
+// GenerateSeededCodingVector - Random coding vector over field for n
+// pieces coded together, along with the seed regenerating it
+func GenerateSeededCodingVector(field galoisfield.Field, n uint) (CodingVector, uint64) {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	seed := binary.BigEndian.Uint64(buf)
+	return SeededCodingVector(field, n, seed), seed
+}
+
+// SparseOrFull - Encoding of vector taking fewer bytes, out of the sparse
+// and the full one
+func SparseOrFull(field galoisfield.Field, vector CodingVector) VectorEncoding {
+	symbol := field.SymbolSize()
+	nonZero := 0
+	for i := 0; i < len(vector)/symbol; i++ {
+		if field.Symbol(vector, i) != 0 {
+			nonZero++
+		}
+	}
+	if 8+nonZero*(4+symbol) < len(vector) {
+		return SparseVector
+	}
+	return FullVector
+}
+
+// EncodedVector - Coding vector of the piece in its encoding, to be read
+// back by DecodeVector
+func (c *CodedPiece) EncodedVector(field galoisfield.Field) []byte {
+	symbol := field.SymbolSize()
+	pieceCount := len(c.Vector) / symbol
+	switch c.Encoding {
+	case SeededVector:
+		buf := make([]byte, 12)
+		binary.BigEndian.PutUint32(buf[0:4], uint32(pieceCount))
+		binary.BigEndian.PutUint64(buf[4:12], c.Seed)
+		return buf
+
+	case SparseVector:
+		buf := make([]byte, 8, 8+pieceCount/8*(4+symbol))
+		binary.BigEndian.PutUint32(buf[0:4], uint32(pieceCount))
+		count := uint32(0)
+		for i := 0; i < pieceCount; i++ {
+			if field.Symbol(c.Vector, i) == 0 {
+				continue
+			}
+			buf = binary.BigEndian.AppendUint32(buf, uint32(i))
+			buf = append(buf, c.Vector[i*symbol:(i+1)*symbol]...)
+			count++
+		}
+		binary.BigEndian.PutUint32(buf[4:8], count)
+		return buf
+
+	default:
+		return c.Vector
+	}
+}
+
+// DecodeVector - Reads back coding vector written by `EncodedVector`, a
+// full vector is returned as it is, without copying
+func DecodeVector(field galoisfield.Field, encoding VectorEncoding, data []byte) (CodingVector, error) {
+	symbol := uint64(field.SymbolSize())
+	switch encoding {
+	case FullVector:
+		if uint64(len(data))%symbol != 0 {
+			return nil, ErrBadVector
+		}
+		return data, nil
+
+	case SeededVector:
+		if len(data) != 12 {
+			return nil, ErrBadVector
+		}
+		pieceCount := uint64(binary.BigEndian.Uint32(data[0:4]))
+		if pieceCount > MaxVectorPieceCount {
+			return nil, ErrBadVector
+		}
+		return SeededCodingVector(field, uint(pieceCount), binary.BigEndian.Uint64(data[4:12])), nil
+
+	case SparseVector:
+		if len(data) < 8 {
+			return nil, ErrBadVector
+		}
+		pieceCount := uint64(binary.BigEndian.Uint32(data[0:4]))
+		count := uint64(binary.BigEndian.Uint32(data[4:8]))
+		if pieceCount > MaxVectorPieceCount || uint64(len(data)) != 8+count*(4+symbol) {
+			return nil, ErrBadVector
+		}
+		vector := make(CodingVector, pieceCount*symbol)
+		for off := uint64(8); off < uint64(len(data)); off += 4 + symbol {
+			i := uint64(binary.BigEndian.Uint32(data[off:]))
+			if i >= pieceCount {
+				return nil, ErrBadVector
+			}
+			copy(vector[i*symbol:(i+1)*symbol], data[off+4:off+4+symbol])
+		}
+		return vector, nil
+
+	default:
+		return nil, ErrBadVector
+	}
+}
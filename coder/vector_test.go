@@ -0,0 +1,98 @@
+package coder_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+func TestVectorEncodings(t *testing.T) {
+	for _, field := range []galoisfield.Field{galoisfield.GF2, galoisfield.GF256, galoisfield.GF65536} {
+		pieceCount := uint(64)
+		symbol := field.SymbolSize()
+
+		vector, seed := coder.GenerateSeededCodingVector(field, pieceCount)
+		if !bytes.Equal(vector, coder.SeededCodingVector(field, pieceCount, seed)) {
+			t.Fatalf("%s: seed doesn't regenerate the vector", field.Name())
+		}
+		for i := 0; i < int(pieceCount); i++ {
+			if uint(field.Symbol(vector, i)) >= field.Size() {
+				t.Fatalf("%s: seeded vector holds %d", field.Name(), field.Symbol(vector, i))
+			}
+		}
+
+		sparse := make(coder.CodingVector, pieceCount*uint(symbol))
+		field.SetSymbol(sparse, 3, 1)
+		field.SetSymbol(sparse, 40, uint16(field.Size()-1))
+		if coder.SparseOrFull(field, sparse) != coder.SparseVector || coder.SparseOrFull(field, vector) != coder.FullVector {
+			t.Fatalf("%s: unexpected choice of encoding", field.Name())
+		}
+
+		pieces := []*coder.CodedPiece{
+			{Vector: vector, Encoding: coder.FullVector},
+			{Vector: vector, Encoding: coder.SeededVector, Seed: seed},
+			{Vector: sparse, Encoding: coder.SparseVector},
+			{Vector: vector, Encoding: coder.SparseVector},
+		}
+		for _, piece := range pieces {
+			data := piece.EncodedVector(field)
+			decoded, err := coder.DecodeVector(field, piece.Encoding, data)
+			if err != nil {
+				t.Fatalf("%s: encoding %d: %v", field.Name(), piece.Encoding, err)
+			}
+			if !bytes.Equal(decoded, piece.Vector) {
+				t.Fatalf("%s: vector changed by encoding %d", field.Name(), piece.Encoding)
+			}
+		}
+		if n := len(pieces[1].EncodedVector(field)); n != 12 {
+			t.Fatalf("%s: seeded vector of %d bytes", field.Name(), n)
+		}
+		if n := len(pieces[2].EncodedVector(field)); n != 8+2*(4+symbol) {
+			t.Fatalf("%s: sparse vector of %d bytes", field.Name(), n)
+		}
+	}
+}
+
+func TestEncodersChooseVectorEncoding(t *testing.T) {
+	field := galoisfield.GF256
+	pieces := make([]coder.Piece, 128)
+	for i := range pieces {
+		pieces[i] = generateData(64)
+	}
+
+	full := encoder.NewFullRLNCEncoder(field, pieces).CodedPiece()
+	if full.Encoding != coder.SeededVector || !bytes.Equal(full.Vector, coder.SeededCodingVector(field, 128, full.Seed)) {
+		t.Fatal("expected full RLNC vector to be seeded")
+	}
+	sparse := encoder.NewSparseRLNCEncoder(field, pieces, 0.95).CodedPiece()
+	if sparse.Encoding != coder.SparseOrFull(field, sparse.Vector) {
+		t.Fatal("expected sparse RLNC vector to be sent in fewer bytes")
+	}
+	systematic := encoder.NewSystematicRLNCEncoder(field, pieces).CodedPiece()
+	if systematic.Encoding != coder.SparseVector || len(systematic.EncodedVector(field)) != 8+4+1 {
+		t.Fatal("expected uncoded piece to be sent with a sparse vector")
+	}
+}
+
+func TestMalformedVectors(t *testing.T) {
+	field := galoisfield.GF65536
+	for _, c := range []struct {
+		encoding coder.VectorEncoding
+		data     []byte
+	}{
+		{coder.FullVector, []byte{1, 2, 3}},                                          // partial symbol
+		{coder.SeededVector, []byte{0, 0, 0, 4, 1}},                                  // short seed
+		{coder.SeededVector, []byte{0, 1, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}},             // too many pieces
+		{coder.SparseVector, []byte{0, 0, 0, 4, 0, 0, 0, 2, 0, 0, 0, 1, 0xab, 0xcd}}, // missing entry
+		{coder.SparseVector, []byte{0, 0, 0, 4, 0, 0, 0, 1, 0, 0, 0, 4, 0xab, 0xcd}}, // index out of vector
+		{coder.VectorEncoding(0xff), nil},
+	} {
+		if _, err := coder.DecodeVector(field, c.encoding, c.data); !errors.Is(err, coder.ErrBadVector) {
+			t.Fatalf("expected ErrBadVector for encoding %d of %v, got %v", c.encoding, c.data, err)
+		}
+	}
+}
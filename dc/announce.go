@@ -0,0 +1,140 @@
+package dc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aecra/PeerCodeX/tracker"
+)
+
+const (
+	maxAnnounceFailures = 3                // failures in a row before an announce is dead
+	announceRetryDelay  = time.Minute      // first delay before a dead announce is retried
+	maxAnnounceDelay    = 60 * time.Minute // longest delay before a dead announce is retried
+)
+
+// Announce is a bootstrap node from the seed, along with its health
+type Announce struct {
+	Addr        string
+	Tier        int // 0 is the announce of the seed, then the tiers of the announce list
+	Failures    int // failures in a row
+	LastFailure time.Time
+	LastSuccess time.Time
+}
+
+// IsDead reports whether the announce failed too often to be tried now.
+// A dead announce is retried with exponential backoff.
+func (a *Announce) IsDead() bool {
+	if a.Failures < maxAnnounceFailures {
+		return false
+	}
+	delay := announceRetryDelay << (a.Failures - maxAnnounceFailures)
+	if delay > maxAnnounceDelay || delay <= 0 {
+		delay = maxAnnounceDelay
+	}
+	return time.Since(a.LastFailure) < delay
+}
+
+type announces struct {
+	list  []*Announce
+	mutex sync.RWMutex
+}
+
+// newAnnounces merges the announce and the tiers of the announce list,
+// every address is kept in its first tier only
+func newAnnounces(announce string, tiers [][]string) *announces {
+	a := &announces{list: make([]*Announce, 0)}
+	seen := map[string]struct{}{}
+	add := func(addr string, tier int) {
+		if addr == "" {
+			return
+		}
+		if _, ok := seen[addr]; ok {
+			return
+		}
+		seen[addr] = struct{}{}
+		a.list = append(a.list, &Announce{Addr: addr, Tier: tier})
+	}
+	add(announce, 0)
+	for i, tier := range tiers {
+		for _, addr := range tier {
+			add(addr, i+1)
+		}
+	}
+	return a
+}
+
+// peers returns the addresses of announces which are peers, not trackers
+func (a *announces) peers() []string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	addrs := make([]string, 0, len(a.list))
+	for _, item := range a.list {
+		if !tracker.IsTrackerURL(item.Addr) {
+			addrs = append(addrs, item.Addr)
+		}
+	}
+	return addrs
+}
+
+func (a *announces) get(addr string) *Announce {
+	for _, item := range a.list {
+		if item.Addr == addr {
+			return item
+		}
+	}
+	return nil
+}
+
+func (a *announces) report(addr string, ok bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	item := a.get(addr)
+	if item == nil {
+		return
+	}
+	if ok {
+		item.Failures = 0
+		item.LastSuccess = time.Now()
+	} else {
+		item.Failures++
+		item.LastFailure = time.Now()
+	}
+}
+
+func (a *announces) isDead(addr string) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	item := a.get(addr)
+	return item != nil && item.IsDead()
+}
+
+// tiers returns the addresses of announces which are not dead, grouped by
+// tier in order. Only trackers or only peers are returned.
+func (a *announces) tiers(trackers bool) [][]string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	tiers := make([][]string, 0)
+	last := -1
+	for _, item := range a.list {
+		if item.IsDead() || tracker.IsTrackerURL(item.Addr) != trackers {
+			continue
+		}
+		if item.Tier != last {
+			tiers = append(tiers, make([]string, 0))
+			last = item.Tier
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], item.Addr)
+	}
+	return tiers
+}
+
+func (a *announces) status() []Announce {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	status := make([]Announce, len(a.list))
+	for i, item := range a.list {
+		status[i] = *item
+	}
+	return status
+}
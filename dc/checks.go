@@ -0,0 +1,199 @@
+package dc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aecra/PeerCodeX/coder"
+)
+
+// checksTimeout is how long the pieces of other nodes wait for the checks
+// asked of a node, another node is asked after it
+const checksTimeout = 30 * time.Second
+
+// ErrFailedChecks - a piece doesn't match the checks of its generation,
+// its sender is only blamed once the checks are proven right
+var ErrFailedChecks = errors.New("coded piece does not match the checks of source pieces")
+
+// checks are the hashes of the source pieces of a generation under a key
+// of this node, computed by the node holding the generation they are
+// asked of. Senders never learn the key, so they can't craft a polluted
+// piece passing the checks, unlike the hashes of the seed.
+type checks struct {
+	key    []byte
+	hashes [][]byte
+	from   string   // node which sent the checks, its own pieces aren't checked
+	failed []string // senders of pieces which failed the checks
+}
+
+// checksRequest is a key sent to a node asking it for checks
+type checksRequest struct {
+	key []byte
+	at  time.Time
+}
+
+// CheckKey returns the key to ask the node at addr for checks under, false
+// if there are checks already or they are asked of another node, or the
+// generation is downloaded
+func (g *Generation) CheckKey(addr string) ([]byte, bool) {
+	if g.downloaded() {
+		return nil, false
+	}
+	g.checksMutex.Lock()
+	defer g.checksMutex.Unlock()
+	if g.checks != nil || g.checksRefused[addr] || g.isAskingChecks() {
+		return nil, false
+	}
+	if _, ok := g.checksRequests[addr]; ok {
+		return nil, false
+	}
+	key := coder.NewCheckKey()
+	g.checksRequests[addr] = checksRequest{key: key, at: time.Now()}
+	return key, true
+}
+
+// isAskingChecks reports whether checks are asked of a node which may
+// still send them, the caller holds checksMutex
+func (g *Generation) isAskingChecks() bool {
+	for _, request := range g.checksRequests {
+		if time.Since(request.at) < checksTimeout {
+			return true
+		}
+	}
+	return false
+}
+
+// SetChecks records the checks sent by the node at addr, empty hashes
+// tell that it doesn't hold the generation. It reports false for checks
+// which were not asked of the node or don't fit the generation.
+func (g *Generation) SetChecks(addr string, hashes []byte) bool {
+	g.checksMutex.Lock()
+	defer g.checksMutex.Unlock()
+	request, ok := g.checksRequests[addr]
+	if !ok {
+		return false
+	}
+	delete(g.checksRequests, addr)
+	if len(hashes) == 0 {
+		g.checksRefused[addr] = true
+		return true
+	}
+	if uint(len(hashes)) != g.File.GetPieceCount(g.Hash)*coder.HashLength {
+		return false
+	}
+	if g.checks != nil {
+		// checks of another node arrived first
+		return true
+	}
+	c := &checks{key: request.key, from: addr}
+	for i := 0; i < len(hashes); i += coder.HashLength {
+		c.hashes = append(c.hashes, hashes[i:i+coder.HashLength])
+	}
+	g.checks = c
+	g.checksRequests = make(map[string]checksRequest)
+	return true
+}
+
+// CancelChecks forgets the checks asked of the node at addr, which won't
+// send them
+func (g *Generation) CancelChecks(addr string) {
+	g.checksMutex.Lock()
+	defer g.checksMutex.Unlock()
+	delete(g.checksRequests, addr)
+}
+
+// AwaitsChecks reports whether the pieces of the node at addr have to wait
+// for the checks asked of another node
+func (g *Generation) AwaitsChecks(addr string) bool {
+	g.checksMutex.Lock()
+	defer g.checksMutex.Unlock()
+	if g.checks != nil {
+		return false
+	}
+	if _, ok := g.checksRequests[addr]; ok {
+		return false
+	}
+	return g.isAskingChecks()
+}
+
+// verifyChecks checks a piece from the node at from against the checks,
+// pieces pass until there are any. Once pieces of two senders fail, the
+// checks are taken to be wrong, their sender is penalised and they are
+// asked of another node.
+func (g *Generation) verifyChecks(codedPiece *coder.CodedPiece, from string) error {
+	g.checksMutex.Lock()
+	c := g.checks
+	if c == nil || from == c.from {
+		g.checksMutex.Unlock()
+		return nil
+	}
+	if coder.VerifyCodedPiece(g.File.Field, c.key, codedPiece, c.hashes) == nil {
+		g.checksMutex.Unlock()
+		return nil
+	}
+	c.failed = appendAddr(c.failed, from)
+	wrong := len(c.failed) > 1
+	if wrong {
+		g.checks = nil
+		g.checksRefused[c.from] = true
+	}
+	g.checksMutex.Unlock()
+
+	if wrong {
+		log.Println("Generation(" + hex.EncodeToString(g.Hash) + ") checks of " + c.from + " fail pieces of several senders")
+		g.File.penalize(c.from)
+	}
+	return ErrFailedChecks
+}
+
+// checkOffenders returns the senders of pieces which failed the checks if
+// the decoded generation proves them right, or the node which sent them
+// otherwise. The checks are done with. The caller holds decoderMutex.
+func (g *Generation) checkOffenders() []string {
+	g.checksMutex.Lock()
+	c := g.checks
+	g.checks = nil
+	g.checksRequests = make(map[string]checksRequest)
+	g.checksMutex.Unlock()
+	if c == nil {
+		return nil
+	}
+	i := 0
+	err := g.decodedData(func(_ int64, data []byte) error {
+		if !bytes.Equal(coder.HomomorphicHash(g.File.Field, c.key, data), c.hashes[i]) {
+			return ErrFailedChecks
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		return []string{c.from}
+	}
+	// pieces past the end of a short generation are all padding
+	for ; i < len(c.hashes); i++ {
+		if !bytes.Equal(c.hashes[i], make([]byte, coder.HashLength)) {
+			return []string{c.from}
+		}
+	}
+	return c.failed
+}
+
+// HashPieces returns the hashes of the source pieces under key, for a
+// node asking for checks, or nil if the generation is not downloaded
+func (g *Generation) HashPieces(key []byte) ([]byte, error) {
+	if !g.downloaded() {
+		return nil, nil
+	}
+	return g.File.NcFile.HashPieces(g.File.GetStorage(), int(g.Index), key)
+}
+
+// downloaded reports whether the generation is downloaded, it's taken
+// before checksMutex
+func (g *Generation) downloaded() bool {
+	g.decoderMutex.Lock()
+	defer g.decoderMutex.Unlock()
+	return g.isDownloaded
+}
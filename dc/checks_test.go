@@ -0,0 +1,84 @@
+package dc
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+)
+
+func TestChecks(t *testing.T) {
+	f, data := newTestFile(t, 16<<10)
+	g := f.Generations[0]
+	pieces, _, err := coder.OriginalPiecesFromDataAndPieceCount(data[:64<<10], f.GetPieceCount(g.Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := encoder.NewFullRLNCEncoder(f.Field, pieces)
+
+	// checks asked of a node which lies fail the pieces of honest senders,
+	// the second sender failing them gives it away
+	key, ok := g.CheckKey("liar")
+	if !ok {
+		t.Fatal("no key to ask for checks")
+	}
+	if _, ok := g.CheckKey("a"); ok || !g.AwaitsChecks("a") || g.AwaitsChecks("liar") {
+		t.Fatal("checks are asked of two nodes at once")
+	}
+	if g.SetChecks("a", make([]byte, len(pieces)*coder.HashLength)) {
+		t.Fatal("checks which were not asked for are taken")
+	}
+	if !g.SetChecks("liar", bytes.Repeat([]byte{1}, len(pieces)*coder.HashLength)) {
+		t.Fatal("checks are refused")
+	}
+	if err := g.VerifyCodedPiece(enc.CodedPiece(), "liar"); err != nil {
+		t.Fatalf("pieces of the node sending the checks are checked against them: %v", err)
+	}
+	for _, from := range []string{"a", "a", "b"} {
+		if err := g.VerifyCodedPiece(enc.CodedPiece(), from); !errors.Is(err, ErrFailedChecks) {
+			t.Fatalf("expected the checks to fail, got %v", err)
+		}
+	}
+	if _, ok := g.CheckKey("liar"); ok {
+		t.Fatal("checks are asked again of the node which lied")
+	}
+	if err := g.VerifyCodedPiece(enc.CodedPiece(), "a"); err != nil {
+		t.Fatalf("wrong checks are kept: %v", err)
+	}
+
+	// right checks let honest pieces pass, and prove right the senders of
+	// pieces which failed them once the generation is decoded
+	if key, ok = g.CheckKey("honest"); !ok {
+		t.Fatal("no key to ask for checks")
+	}
+	hashes, err := f.NcFile.HashPieces(bytes.NewReader(data), 0, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.SetChecks("honest", hashes) {
+		t.Fatal("checks are refused")
+	}
+	if err := g.VerifyCodedPiece(enc.CodedPiece(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	g.checks.failed = []string{"polluter"}
+	var offenders []string
+	for i := 0; i < 2*len(pieces) && !g.downloaded(); i++ {
+		offenders = g.addCodedPiece(enc.CodedPiece(), "a")
+	}
+	if !g.downloaded() {
+		t.Fatal("generation is not decoded")
+	}
+	if !reflect.DeepEqual(offenders, []string{"polluter"}) {
+		t.Fatalf("blamed %v, expected the sender of the failed piece", offenders)
+	}
+	if g.checks != nil {
+		t.Fatal("checks are kept after decoding")
+	}
+	if _, ok := g.CheckKey("b"); ok {
+		t.Fatal("checks are asked of a downloaded generation")
+	}
+}
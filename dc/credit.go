@@ -0,0 +1,64 @@
+package dc
+
+import "github.com/aecra/PeerCodeX/coder"
+
+// Coded pieces are only sent against credit granted by the receiver. The
+// credit of a generation is shared by all of its senders, so together they
+// never have more pieces in flight than the decoder still needs.
+
+const CreditWindow = 8 // most pieces in flight from a single sender
+
+// Rank returns the number of linearly independent pieces received
+func (g *Generation) Rank() uint {
+	g.decoderMutex.Lock()
+	defer g.decoderMutex.Unlock()
+	if g.isDownloaded {
+		return g.File.GetPieceCount(g.Hash)
+	}
+	if g.Decoder == nil {
+		return 0
+	}
+	return g.File.GetPieceCount(g.Hash) - g.Decoder.Required()
+}
+
+// Subspace returns the span of the coding vectors received, nil if the
+// generation is not being decoded
+func (g *Generation) Subspace() *coder.Subspace {
+	g.decoderMutex.Lock()
+	defer g.decoderMutex.Unlock()
+	if g.isDownloaded || g.Decoder == nil {
+		return nil
+	}
+	return g.Decoder.Subspace()
+}
+
+// GrantCredit returns how many more pieces a sender may send, at most
+// max. The granted credit is in flight until it is released.
+func (g *Generation) GrantCredit(max uint) uint {
+	if !g.isDownloading {
+		return 0
+	}
+	rank := g.Rank()
+	g.creditMutex.Lock()
+	defer g.creditMutex.Unlock()
+	needed := g.File.GetPieceCount(g.Hash) - rank
+	if needed <= g.inFlight {
+		return 0
+	}
+	if credit := needed - g.inFlight; credit < max {
+		max = credit
+	}
+	g.inFlight += max
+	return max
+}
+
+// ReleaseCredit returns credit which is used up by a decoded piece or
+// will not be used by a stopped sender
+func (g *Generation) ReleaseCredit(credit uint) {
+	g.creditMutex.Lock()
+	defer g.creditMutex.Unlock()
+	if credit > g.inFlight {
+		credit = g.inFlight
+	}
+	g.inFlight -= credit
+}
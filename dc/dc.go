@@ -6,16 +6,34 @@ import (
 	"time"
 
 	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/protocol"
 	"github.com/aecra/PeerCodeX/tools"
 )
 
 var (
 	FileList      = make([]*File, 0)
 	FileListMutex = sync.RWMutex{}
+	fileIndex     = make(map[string]*File) // files by infohash, guarded by FileListMutex
 	host          = "0.0.0.0"
 	port          = "8080"
+	pieceCache    = encoder.NewPieceCache(DefaultPieceCacheSize) // source pieces read by the encoders of all generations
 )
 
+// DefaultPieceCacheSize bounds the memory the encoders of all generations
+// keep source pieces in unless set otherwise. If a generation of the
+// files served fits, coding a piece never reads again what coding the
+// previous one read.
+const DefaultPieceCacheSize = 64 << 20
+
+// SetPieceCacheSize sets the memory the encoders keep source pieces in
+func SetPieceCacheSize(size int64) {
+	if size < 0 {
+		size = 0
+	}
+	pieceCache.SetCapacity(uint(size))
+}
+
 func init() {
 	// check encoder status
 	go func() {
@@ -43,12 +61,23 @@ func GetFileByPath(path string) *File {
 
 func DeleteFileByPath(path string) {
 	FileListMutex.Lock()
-	defer FileListMutex.Unlock()
+	var deleted *File
 	for i, item := range FileList {
 		if item.Path == path {
 			FileList = append(FileList[:i], FileList[i+1:]...)
+			delete(fileIndex, string(item.InfoHash))
+			deleted = item
+			break
 		}
 	}
+	FileListMutex.Unlock()
+	if deleted == nil {
+		return
+	}
+	// streams are closed before the decoders are dropped, so that no piece
+	// received meanwhile brings a decoder back
+	deleted.close()
+	deleted.removeCheckpoints()
 }
 
 func AddFile(path string) error {
@@ -63,22 +92,25 @@ func AddFile(path string) error {
 	}
 
 	FileListMutex.Lock()
+	defer FileListMutex.Unlock()
+	if _, ok := fileIndex[string(file.InfoHash)]; ok {
+		// the checkpoints restored are the ones of the file added before
+		file.close()
+		return errors.New("file already exists")
+	}
 	FileList = append(FileList, file)
-	FileListMutex.Unlock()
+	fileIndex[string(file.InfoHash)] = file
 	return nil
 }
 
-func IsGenerationExist(hash []byte) bool {
+func GetFileByInfoHash(infoHash []byte) *File {
 	FileListMutex.RLock()
 	defer FileListMutex.RUnlock()
-	for _, item := range FileList {
-		for _, h := range item.NcFile.Info.Hash {
-			if tools.CompareHash(hash, h) {
-				return true
-			}
-		}
-	}
-	return false
+	return fileIndex[string(infoHash)]
+}
+
+func IsFileExist(infoHash []byte) bool {
+	return GetFileByInfoHash(infoHash) != nil
 }
 
 func GetHost() string {
@@ -97,84 +129,63 @@ func SetPort(p string) {
 	port = p
 }
 
-func GetNeighbours(hash []byte) []*Node {
+func GetNeighbours(infoHash []byte) []*Node {
 	FileListMutex.RLock()
 	defer FileListMutex.RUnlock()
-	// return atmost 10 neighbours
+	// return atmost 10 neighbours, nodes of the same swarm first
 	neighbours := make([]*Node, 0)
-	for _, f := range FileList {
-		for _, g := range f.Generations {
-			if tools.CompareHash(g.Hash, hash) {
-				g.NodesMutex.RLock()
-				for _, n := range g.Nodes {
-					if len(neighbours) >= 10 {
-						return neighbours
-					}
-					neighbours = append(neighbours, n)
-				}
-				g.NodesMutex.RUnlock()
-			}
-		}
+	if f, ok := fileIndex[string(infoHash)]; ok {
+		neighbours = f.appendNodes(neighbours, 10)
 	}
 	for _, f := range FileList {
-		for _, g := range f.Generations {
-			if !tools.CompareHash(g.Hash, hash) {
-				g.NodesMutex.RLock()
-				for _, n := range g.Nodes {
-					if len(neighbours) >= 10 {
-						return neighbours
-					}
-					neighbours = append(neighbours, n)
-				}
-				g.NodesMutex.RUnlock()
-			}
+		if len(neighbours) >= 10 {
+			break
+		}
+		if !tools.CompareHash(f.InfoHash, infoHash) {
+			neighbours = f.appendNodes(neighbours, 10)
 		}
 	}
 	return neighbours
 }
 
-func GetCodedPiece(hash []byte) *coder.CodedPiece {
-	FileListMutex.RLock()
-	defer FileListMutex.RUnlock()
-	for _, f := range FileList {
-		for _, g := range f.Generations {
-			if tools.CompareHash(g.Hash, hash) {
-				return g.GetCodedPiece()
-			}
-		}
+func GetCodedPiece(infoHash []byte, index uint) *coder.CodedPiece {
+	f := GetFileByInfoHash(infoHash)
+	if f == nil {
+		return nil
 	}
-	return nil
+	g := f.GetGeneration(index)
+	if g == nil {
+		return nil
+	}
+	return g.GetCodedPiece()
 }
 
+// GetNodeStatusList returns a node per identity, merged over every
+// generation. The nodes are copies, a node is on if it is on anywhere.
 func GetNodeStatusList() []*Node {
 	FileListMutex.RLock()
 	defer FileListMutex.RUnlock()
-	nodes := make([]*Node, 0)
+	result := []*Node{}
+	index := map[string]*Node{}
 	for _, f := range FileList {
 		for _, g := range f.Generations {
 			g.NodesMutex.RLock()
 			for _, n := range g.Nodes {
-				nodes = append(nodes, n)
+				item, ok := index[n.key()]
+				if !ok {
+					item = &Node{ID: n.ID, Addr: n.Addr}
+					index[n.key()] = item
+					result = append(result, item)
+				}
+				for _, addr := range n.Addrs {
+					item.Addrs = appendAddr(item.Addrs, addr)
+				}
+				item.IsOn = item.IsOn || n.IsOn
+				item.HaveClient = item.HaveClient || n.HaveClient
 			}
 			g.NodesMutex.RUnlock()
 		}
 	}
-	result := []*Node{}
-	temp := map[string]struct{}{}
-	for _, item := range nodes {
-		if _, ok := temp[item.Addr]; !ok {
-			temp[item.Addr] = struct{}{}
-			result = append(result, item)
-		}
-	}
-	// if there is a node is on, set it to true
-	for i, item := range result {
-		for _, node := range nodes {
-			if item.Addr == node.Addr && node.IsOn {
-				result[i].IsOn = true
-			}
-		}
-	}
 	return result
 }
 
@@ -182,6 +193,7 @@ func UpdateNodeStatus(address string, status bool) {
 	FileListMutex.RLock()
 	defer FileListMutex.RUnlock()
 	for _, f := range FileList {
+		f.ReportAnnounce(address, status)
 		for _, g := range f.Generations {
 			g.NodesMutex.RLock()
 			for _, n := range g.Nodes {
@@ -202,6 +214,16 @@ func AddNode(addr string) {
 	}
 }
 
+// AddPeer records a peer which proved its identity at addr
+func AddPeer(id protocol.PeerID, addr string) {
+	rememberPeerID(id, addr)
+	FileListMutex.RLock()
+	defer FileListMutex.RUnlock()
+	for _, f := range FileList {
+		f.AddPeer(id, addr)
+	}
+}
+
 func DeleteNode(addr string) {
 	FileListMutex.RLock()
 	defer FileListMutex.RUnlock()
@@ -0,0 +1,75 @@
+package dc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/coder"
+)
+
+func TestAddAndDeleteFile(t *testing.T) {
+	path, _ := newTestSeed(t, 16<<10)
+	copyPath := filepath.Join(t.TempDir(), "copy.nc")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(copyPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetStateDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer SetStateDir("")
+
+	_, before := GetDecoderMemory()
+	if err := AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+	f := GetFileByPath(path)
+	f.StartReceivingCodedPiece()
+	// the checkpoint is restored by the file added again
+	g := f.Generations[0]
+	g.AddCodedPiece(&coder.CodedPiece{Vector: coder.CodingVector{1, 2, 3, 4}, Piece: make(coder.Piece, f.NcFile.GetPieceLength())}, "")
+	if err := g.SaveCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	_, used := GetDecoderMemory()
+	if used == before {
+		t.Fatal("expected decoders to reserve memory")
+	}
+	// the same swarm under another path is refused without keeping memory
+	if err := AddFile(copyPath); err == nil {
+		t.Fatal("expected the same infohash to be refused")
+	}
+	if _, after := GetDecoderMemory(); after != used {
+		t.Fatalf("refused file holds %dB of decoder memory", after-used)
+	}
+
+	DeleteFileByPath(path)
+	if GetFileByInfoHash(f.InfoHash) != nil {
+		t.Fatal("expected the file to be deleted")
+	}
+	for _, g := range f.Generations {
+		if g.isDownloading || g.Decoder != nil || len(g.streams) != 0 {
+			t.Fatalf("generation %d is still received", g.Index)
+		}
+	}
+	if _, after := GetDecoderMemory(); after != before {
+		t.Fatalf("deleted file holds %dB of decoder memory", after-before)
+	}
+}
+
+func TestGenerationsByHash(t *testing.T) {
+	f, _ := newTestFile(t, 16<<10)
+	for i, g := range f.Generations {
+		if f.GetSerialNumber(g.Hash) != uint(i) || f.generationOf(g.Hash) != g {
+			t.Fatalf("generation %d is not found by its hash", i)
+		}
+	}
+	if f.generationOf(make([]byte, 20)) != nil {
+		t.Fatal("unknown hash names a generation")
+	}
+}
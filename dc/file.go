@@ -1,18 +1,28 @@
 package dc
 
 import (
-	"math"
+	"encoding/hex"
+	"log"
 	"path/filepath"
+	"sync/atomic"
 
 	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+	"github.com/aecra/PeerCodeX/protocol"
 	"github.com/aecra/PeerCodeX/seed"
-	"github.com/aecra/PeerCodeX/tools"
 )
 
 type File struct {
 	NcFile      *seed.NcFile
 	Path        string
+	InfoHash    []byte            // SHA-1 of the info dictionary, identifies the swarm
+	Field       galoisfield.Field // field generations are coded over
 	Generations []*Generation
+	hashIndex   map[string]uint // serial numbers of generations by hash, the first of equal ones
+	announces   *announces      // bootstrap nodes of the seed and their health
+	limiters    *limiters       // bandwidth limits of the connections of this file
+	uploaded    int64           // bytes of coded pieces sent, accessed atomically
+	downloaded  int64           // bytes of coded pieces received, accessed atomically
 }
 
 func NewFile(path string) (*File, error) {
@@ -21,104 +31,194 @@ func NewFile(path string) (*File, error) {
 		return nil, err
 	}
 
+	field, err := ncfile.GetCodingField()
+	if err != nil {
+		return nil, err
+	}
+
+	infoHash, err := ncfile.InfoHash()
+	if err != nil {
+		return nil, err
+	}
+
 	file := &File{
 		NcFile:      ncfile,
 		Path:        path,
+		InfoHash:    infoHash,
+		Field:       field,
 		Generations: make([]*Generation, len(ncfile.Info.Hash)),
+		hashIndex:   make(map[string]uint, len(ncfile.Info.Hash)),
+		announces:   newAnnounces(ncfile.Announce, ncfile.AnnounceList),
+		limiters:    newFileLimiters(),
 	}
 	isDownloadedBools, err := ncfile.IsFileDownloaded(filepath.Dir(path))
 	if err != nil {
 		return nil, err
 	}
-	announceList := make([]string, 0)
-	announceList = append(announceList, ncfile.Announce)
-	for _, item := range announceList {
-		isExist := false
-		for _, announce := range announceList {
-			if announce == item {
-				isExist = true
-				break
-			}
+	// trackers are announced to by the client, they do not serve pieces
+	announceList := file.announces.peers()
+	for i, h := range ncfile.Info.Hash {
+		if _, ok := file.hashIndex[string(h)]; !ok {
+			file.hashIndex[string(h)] = uint(i)
 		}
-		if !isExist {
-			announceList = append(announceList, item)
+		file.Generations[i] = NewGeneration(file, uint(i), h, announceList, isDownloadedBools[i])
+		// resume from saved session, if any
+		for _, addr := range getRestoredNodes(h) {
+			file.Generations[i].AddNode(addr)
+		}
+		if err := file.Generations[i].restoreCheckpoint(); err != nil {
+			log.Println("Generation(" + hex.EncodeToString(h) + ") checkpoint: " + err.Error())
 		}
-	}
-	for i, h := range ncfile.Info.Hash {
-		file.Generations[i] = NewGeneration(file, h, announceList, isDownloadedBools[i])
 	}
 	return file, nil
 }
 
 func (f *File) AddCodedPiece(hash []byte, codedPiece *coder.CodedPiece) {
-	for _, g := range f.Generations {
-		if tools.CompareHash(g.Hash, hash) {
-			g.AddCodedPiece(codedPiece)
-			return
-		}
+	if g := f.generationOf(hash); g != nil {
+		g.AddCodedPiece(codedPiece, "")
 	}
 }
 
 func (f *File) StartReceivingCodedPiece() {
-	for _, h := range f.NcFile.Info.Hash {
-		f.StartReceiving(h)
+	for _, g := range f.Generations {
+		g.StartReceiving()
 	}
 }
 
 func (f *File) StartReceiving(hash []byte) {
-	for _, g := range f.Generations {
-		if tools.CompareHash(g.Hash, hash) {
-			g.StartReceiving()
-			return
-		}
+	if g := f.generationOf(hash); g != nil {
+		g.StartReceiving()
 	}
 }
 
 func (f *File) StopReceivingCodedPiece() {
-	for _, h := range f.NcFile.Info.Hash {
-		f.StopReceiving(h)
+	for _, g := range f.Generations {
+		g.StopReceiving()
 	}
 }
 
 func (f *File) StopReceiving(hash []byte) {
-	for _, g := range f.Generations {
-		if tools.CompareHash(g.Hash, hash) {
-			g.StopReceiving()
-			return
-		}
+	if g := f.generationOf(hash); g != nil {
+		g.StopReceiving()
 	}
 }
 
-func (f *File) GetSerialNumber(hash []byte) uint {
-	for i, h := range f.NcFile.Info.Hash {
-		if tools.CompareHash(h, hash) {
-			return uint(i)
-		}
+// generationOf returns the generation of the given hash, or nil if the
+// file has none
+func (f *File) generationOf(hash []byte) *Generation {
+	index, ok := f.hashIndex[string(hash)]
+	if !ok {
+		return nil
 	}
-	return 0
+	return f.Generations[index]
+}
+
+// GetGeneration returns the generation with the given serial number, or
+// nil if it is out of range
+func (f *File) GetGeneration(index uint) *Generation {
+	if index >= uint(len(f.Generations)) {
+		return nil
+	}
+	return f.Generations[index]
+}
+
+func (f *File) GetSerialNumber(hash []byte) uint {
+	return f.hashIndex[string(hash)]
+}
+
+// MaxPayloadSize returns the largest piece or subspace message peers may
+// send for the file
+func (f *File) MaxPayloadSize() int {
+	return protocol.PayloadLimit(f.Field, f.NcFile.GetPieceCount(0), uint(f.NcFile.GetPieceLength()))
 }
 
 func (f *File) GetPieceCount(hash []byte) uint {
-	return uint(math.Ceil(float64(f.GetGenerationLength(hash)) / float64(1<<20)))
+	return f.NcFile.GetPieceCount(int(f.GetSerialNumber(hash)))
 }
 
 func (f *File) GetGenerationLength(hash []byte) uint {
+	generationLength := f.NcFile.GetGenerationLength()
 	if f.GetSerialNumber(hash) == uint(len(f.NcFile.Info.Hash)-1) {
-		return uint(f.NcFile.Info.Length % (1 << 27))
+		if rest := f.NcFile.Info.Length % generationLength; rest != 0 {
+			return uint(rest)
+		}
 	}
-	return 1 << 27
+	return uint(generationLength)
+}
+
+// GetGenerationOffset returns the offset of a generation in the files
+func (f *File) GetGenerationOffset(index uint) int64 {
+	return int64(index) * f.NcFile.GetGenerationLength()
 }
 
 func (f *File) GetTargetFile() string {
 	return f.Path[:len(f.Path)-len(filepath.Ext(f.Path))]
 }
 
+// GetStorage returns the files on disk which generations are read from
+// and saved to
+func (f *File) GetStorage() *seed.Storage {
+	return f.NcFile.NewStorage(f.GetTargetFile())
+}
+
+// GetAnnounceTiers returns the bootstrap peers which are not dead, grouped
+// by tier in the order they should be tried
+func (f *File) GetAnnounceTiers() [][]string {
+	return f.announces.tiers(false)
+}
+
+// GetTrackerTiers returns the tracker URLs which are not dead, grouped by
+// tier in the order they should be tried
+func (f *File) GetTrackerTiers() [][]string {
+	return f.announces.tiers(true)
+}
+
+// ReportAnnounce records whether a bootstrap node could be reached, it
+// does nothing for other nodes
+func (f *File) ReportAnnounce(addr string, ok bool) {
+	f.announces.report(addr, ok)
+}
+
+// IsAnnounceDead reports whether addr is a bootstrap node which failed too
+// often to be tried now
+func (f *File) IsAnnounceDead(addr string) bool {
+	return f.announces.isDead(addr)
+}
+
+func (f *File) GetAnnounceStatus() []Announce {
+	return f.announces.status()
+}
+
 func (f *File) AddNode(addr string) {
 	for _, g := range f.Generations {
 		g.AddNode(addr)
 	}
 }
 
+func (f *File) AddPeer(id protocol.PeerID, addr string) {
+	for _, g := range f.Generations {
+		g.AddPeer(id, addr)
+	}
+}
+
+// appendNodes appends nodes of every generation which are not in nodes
+// yet, until there are limit nodes
+func (f *File) appendNodes(nodes []*Node, limit int) []*Node {
+	for _, g := range f.Generations {
+		g.NodesMutex.RLock()
+		for _, n := range g.Nodes {
+			if len(nodes) >= limit {
+				break
+			}
+			if !containsNode(nodes, n) {
+				nodes = append(nodes, n)
+			}
+		}
+		g.NodesMutex.RUnlock()
+	}
+	return nodes
+}
+
 func (f *File) DeleteNode(addr string) {
 	for _, g := range f.Generations {
 		g.DeleteNode(addr)
@@ -142,6 +242,37 @@ func (f *File) IsDownloading() bool {
 	return false
 }
 
+// GetCompleted returns whether every generation is downloaded
+func (f *File) GetCompleted() []bool {
+	completed := make([]bool, len(f.Generations))
+	for i, g := range f.Generations {
+		completed[i] = g.IsDownloaded()
+	}
+	return completed
+}
+
+func (f *File) AddUploaded(n int) {
+	atomic.AddInt64(&f.uploaded, int64(n))
+}
+
+func (f *File) AddDownloaded(n int) {
+	atomic.AddInt64(&f.downloaded, int64(n))
+}
+
+func (f *File) GetUploaded() int64 {
+	return atomic.LoadInt64(&f.uploaded)
+}
+
+func (f *File) GetDownloaded() int64 {
+	return atomic.LoadInt64(&f.downloaded)
+}
+
+func (f *File) removeCheckpoints() {
+	for _, g := range f.Generations {
+		g.removeCheckpoint()
+	}
+}
+
 func (f *File) DropIdleEncoder() {
 	for _, g := range f.Generations {
 		g.DropIdleEncoder()
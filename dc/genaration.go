@@ -2,10 +2,10 @@ package dc
 
 import (
 	"context"
+	"crypto/sha1"
 	"encoding/hex"
+	"io"
 	"log"
-	"net"
-	"os"
 	"sync"
 	"time"
 
@@ -13,33 +13,63 @@ import (
 	"github.com/aecra/PeerCodeX/coder/decoder"
 	"github.com/aecra/PeerCodeX/coder/encoder"
 	"github.com/aecra/PeerCodeX/coder/recoder"
+	"github.com/aecra/PeerCodeX/protocol"
+	"github.com/aecra/PeerCodeX/tools"
 )
 
+// saveRetryInterval is how long a decoded generation which failed to be
+// saved waits before it is saved again
+const saveRetryInterval = 10 * time.Second
+
 type Generation struct {
-	Hash              []byte                 // hash of the file
-	File              *File                  // file which this generation belongs to
-	Nodes             []*Node                // nodes which have this generation
-	NodesMutex        *sync.RWMutex          // mutex of nodes
-	isDownloaded      bool                   // whether this generation is downloaded
-	isDownloading     bool                   // whether this generation is downloading
-	Conns             []net.Conn             // connections of this generation
-	connsMutex        *sync.Mutex            // mutex of conns
-	Encoder           encoder.Encoder        // encoder of this generation
-	encoderActiveTime time.Time              // time when last codedPiece is generated
-	Decoder           decoder.Decoder        // decoder of this generation
-	Recoder           recoder.Recoder        // recoder of this generation
-	AddCodedPieceChan chan *coder.CodedPiece // channel to receive coded piece
-	cancelReceiving   context.CancelFunc     // cancel function of receiving
+	Hash              []byte                   // hash of the file
+	Index             uint                     // serial number of this generation in the file
+	File              *File                    // file which this generation belongs to
+	Nodes             []*Node                  // nodes which have this generation
+	NodesMutex        *sync.RWMutex            // mutex of nodes
+	isDownloaded      bool                     // whether this generation is downloaded
+	isDownloading     bool                     // whether this generation is downloading
+	streams           []stream                 // streams of coded pieces of this generation
+	connsMutex        *sync.Mutex              // mutex of streams
+	Encoder           encoder.Encoder          // encoder of this generation
+	encoderActiveTime time.Time                // time when last codedPiece is generated
+	encoderMutex      *sync.Mutex              // mutex of encoder and encoderActiveTime
+	Decoder           decoder.Decoder          // decoder of this generation
+	Recoder           recoder.Recoder          // recoder of this generation
+	decoderMutex      *sync.Mutex              // mutex of decoder and recoder
+	decoderMemory     int64                    // memory budget reserved by the decoder
+	checkpointRank    uint                     // rank of decoder when last checkpoint is saved
+	inFlight          uint                     // credit granted to senders which is not decoded yet
+	creditMutex       *sync.Mutex              // mutex of inFlight
+	checks            *checks                  // hashes of source pieces under a secret key
+	checksRequests    map[string]checksRequest // keys of checks asked of nodes
+	checksRefused     map[string]bool          // nodes which can't send checks
+	checksMutex       *sync.Mutex              // mutex of checks
+	addCodedPieceChan chan receivedPiece       // channel to receive coded piece
+	received          []receivedPiece          // pieces added to the decoder along with their senders
+	suspects          []receivedPiece          // pieces of the last attempt which decoded to a wrong hash
+	hashFailures      uint                     // attempts which decoded to a wrong hash
+	closed            bool                     // the file is deleted, guarded by decoderMutex
+	receivingCtx      context.Context          // done when receiving is stopped
+	cancelReceiving   context.CancelFunc       // cancel function of receiving
 }
 
-func NewGeneration(file *File, hash []byte, announceList []string, isDownloaded bool) *Generation {
+func NewGeneration(file *File, index uint, hash []byte, announceList []string, isDownloaded bool) *Generation {
 	generation := &Generation{
-		Hash:       hash,
-		File:       file,
-		Nodes:      make([]*Node, 0),
-		NodesMutex: &sync.RWMutex{},
-		Conns:      make([]net.Conn, 0),
-		connsMutex: &sync.Mutex{},
+		Hash:         hash,
+		Index:        index,
+		File:         file,
+		Nodes:        make([]*Node, 0),
+		NodesMutex:   &sync.RWMutex{},
+		streams:      make([]stream, 0),
+		connsMutex:   &sync.Mutex{},
+		decoderMutex: &sync.Mutex{},
+		creditMutex:  &sync.Mutex{},
+		checksMutex:  &sync.Mutex{},
+		encoderMutex: &sync.Mutex{},
+
+		checksRequests: make(map[string]checksRequest),
+		checksRefused:  make(map[string]bool),
 	}
 	if isDownloaded {
 		generation.isDownloaded = true
@@ -52,6 +82,7 @@ func NewGeneration(file *File, hash []byte, announceList []string, isDownloaded
 	for _, item := range announceList {
 		generation.Nodes = append(generation.Nodes, &Node{
 			Addr:       item,
+			Addrs:      []string{item},
 			IsOn:       true,
 			HaveClient: false,
 		})
@@ -60,111 +91,219 @@ func NewGeneration(file *File, hash []byte, announceList []string, isDownloaded
 	return generation
 }
 
-func (g *Generation) AddCodedPiece(codedPiece *coder.CodedPiece) {
-	if g.isDownloaded {
-		return
+// AddCodedPiece adds a coded piece received from the node at addr, which
+// is empty if the sender is unknown
+func (g *Generation) AddCodedPiece(codedPiece *coder.CodedPiece, from string) {
+	// peers are penalised without holding the decoder
+	for _, addr := range g.addCodedPiece(codedPiece, from) {
+		g.File.penalize(addr)
+	}
+}
+
+// addCodedPiece returns the senders found to have sent corrupting pieces
+func (g *Generation) addCodedPiece(codedPiece *coder.CodedPiece, from string) []string {
+	g.decoderMutex.Lock()
+	defer g.decoderMutex.Unlock()
+	if g.isDownloaded || g.closed {
+		return nil
 	}
 	if g.Decoder == nil {
-		g.Decoder = decoder.NewGaussElimRLNCDecoder(g.File.GetPieceCount(g.Hash))
+		g.Decoder = g.newDecoder()
+	}
+	spilled := g.isSpilled()
+	required := g.Decoder.Required()
+	if spilled {
+		// only the sender is kept, to tell who sent a failed attempt
+		g.received = append(g.received, receivedPiece{from: from})
+		g.Decoder.AddPiece(codedPiece)
+	} else {
+		// the decoder reduces pieces in place, it's given a copy so that
+		// the piece kept and recoded from stays as it was received
+		g.received = append(g.received, receivedPiece{piece: codedPiece, from: from})
+		g.Decoder.AddPiece(clonePiece(codedPiece))
 	}
-	g.Decoder.AddPiece(codedPiece)
+	ReportPiece(from, g.Decoder.Required() < required)
 
-	if g.Recoder == nil {
+	if spilled {
+		// a recoder would hold the generation in memory
+	} else if g.Recoder == nil {
 		ps := make([]*coder.CodedPiece, 1)
 		ps[0] = codedPiece
-		g.Recoder = recoder.NewFullRLNCRecoder(ps)
+		g.Recoder = recoder.NewFullRLNCRecoder(g.File.Field, ps)
 	} else {
 		g.Recoder.AddCodedPiece(codedPiece)
 	}
 
-	if g.Decoder.IsDecoded() {
-		log.Println("Generation(" + hex.EncodeToString(g.Hash) + ") is downloaded")
-		g.isDownloaded = true
-		g.Save()
-		g.Decoder = nil
-		g.Recoder = nil
+	if !g.Decoder.IsDecoded() {
+		return nil
 	}
+	return g.commitDecoded()
 }
 
-func (g *Generation) Save() {
-	if g.Decoder == nil || g.Decoder.IsDecoded() == false {
-		return
+// commitDecoded saves the decoded generation and returns the senders found
+// to have sent corrupting pieces. If it fails to save, the decoder and its
+// checkpoint are kept to save it again. The caller holds decoderMutex.
+func (g *Generation) commitDecoded() []string {
+	// the decoded bytes are only committed if they match the seed
+	hash := sha1.New()
+	if err := g.decodedData(func(_ int64, data []byte) error {
+		_, err := hash.Write(data)
+		return err
+	}); err != nil {
+		log.Println("Generation(" + hex.EncodeToString(g.Hash) + ") decode: " + err.Error())
+		return g.resetDecoding()
+	}
+	if !tools.CompareHash(hash.Sum(nil), g.Hash) {
+		return g.resetDecoding()
 	}
+	log.Println("Generation(" + hex.EncodeToString(g.Hash) + ") is downloaded")
+	// the generation is served from the target file once it's saved
+	if err := g.Save(); err != nil {
+		log.Println("Generation(" + hex.EncodeToString(g.Hash) + ") save: " + err.Error())
+		return nil
+	}
+	g.isDownloaded = true
 
-	targetFile := g.File.GetTargetFile()
-	// if file is not exist, create it
-	if _, err := os.Stat(targetFile); os.IsNotExist(err) {
-		file, err := os.Create(targetFile)
-		if err != nil {
-			return
-		}
-		file.Close()
+	// pieces of a failed attempt are checked against the decoded ones
+	var pieces []coder.Piece
+	if len(g.suspects) > 0 {
+		pieces, _ = g.Decoder.GetPieces()
+	}
+	offenders := g.checkOffenders()
+	g.dropDecoder()
+	g.received = nil
+	g.removeCheckpoint()
+	for _, addr := range g.identifySuspects(pieces) {
+		offenders = appendAddr(offenders, addr)
 	}
+	return offenders
+}
 
-	for {
-		file, err := os.OpenFile(targetFile, os.O_WRONLY, 0666)
+// decodedData hands the decoded pieces to fn one at a time along with
+// their offset in the generation, without the padding of the last
+func (g *Generation) decodedData(fn func(offset int64, data []byte) error) error {
+	generationLenght := g.File.GetGenerationLength(g.Hash)
+	offset := uint(0)
+	for i := uint(0); offset < generationLenght; i++ {
+		piece, err := g.Decoder.GetPiece(i)
 		if err != nil {
-			time.Sleep(100 * time.Millisecond)
-			continue
+			return err
 		}
-		_, err = file.Seek(int64(g.File.GetSerialNumber(g.Hash)*1<<27), 0)
-		if err != nil {
-			return
+		if offset+uint(len(piece)) > generationLenght {
+			piece = piece[:generationLenght-offset]
 		}
-
-		pieces, err := g.Decoder.GetPieces()
-		if err != nil {
-			return
+		if err := fn(int64(offset), piece); err != nil {
+			return err
 		}
+		offset += uint(len(piece))
+	}
+	return nil
+}
 
-		currentLength := 0
-		generationLenght := g.File.GetGenerationLength(g.Hash)
-		for _, piece := range pieces {
-			if currentLength+len(piece) > int(generationLenght) {
-				file.Write(piece[:int(generationLenght)-currentLength])
-				break
-			}
-			file.Write(piece)
-			currentLength += len(piece)
-		}
+// retrySave saves a decoded generation which failed to be saved
+func (g *Generation) retrySave() {
+	g.decoderMutex.Lock()
+	var offenders []string
+	if !g.isDownloaded && !g.closed && g.Decoder != nil && g.Decoder.IsDecoded() {
+		offenders = g.commitDecoded()
+	}
+	g.decoderMutex.Unlock()
+	for _, addr := range offenders {
+		g.File.penalize(addr)
+	}
+}
 
-		file.Close()
-		break
+// Save writes the decoded pieces of the generation to the target file
+func (g *Generation) Save() error {
+	storage := g.File.GetStorage()
+	if err := storage.Allocate(); err != nil {
+		return err
 	}
+	start := g.File.GetGenerationOffset(g.Index)
+	return g.decodedData(func(offset int64, data []byte) error {
+		_, err := storage.WriteAt(data, start+offset)
+		return err
+	})
 }
 
+// GetCodedPiece returns a coded piece of the generation, recoded from the
+// pieces received if it is not downloaded yet, or nil if none are held.
+// Pieces are neither added nor dropped while they are recoded.
 func (g *Generation) GetCodedPiece() *coder.CodedPiece {
+	g.decoderMutex.Lock()
 	if g.Recoder != nil {
+		defer g.decoderMutex.Unlock()
 		codedPiece, err := g.Recoder.CodedPiece()
 		if err != nil {
 			return nil
 		}
 		return codedPiece
 	}
+	downloaded := g.isDownloaded
+	g.decoderMutex.Unlock()
 
-	g.encoderActiveTime = time.Now()
+	// the target file only holds downloaded generations
+	if !downloaded {
+		return nil
+	}
+	enc := g.getEncoder()
+	if enc == nil {
+		return nil
+	}
+	return enc.CodedPiece()
+}
 
-	if g.Encoder != nil {
-		return g.Encoder.CodedPiece()
+// GetInnovativeCodedPiece returns a coded piece which is innovative for
+// a receiver holding the subspace, or nil if no piece held is
+func (g *Generation) GetInnovativeCodedPiece(subspace *coder.Subspace) *coder.CodedPiece {
+	g.decoderMutex.Lock()
+	if g.Recoder != nil {
+		defer g.decoderMutex.Unlock()
+		codedPiece, err := g.Recoder.InnovativeCodedPiece(subspace)
+		if err != nil {
+			return nil
+		}
+		return codedPiece
 	}
+	downloaded := g.isDownloaded
+	g.decoderMutex.Unlock()
 
-	// create encoder
-	file, err := os.Open(g.File.GetTargetFile())
-	if err != nil {
+	if !downloaded {
+		return nil
+	}
+	enc := g.getEncoder()
+	if enc == nil {
 		return nil
 	}
-	data := make([]byte, g.File.GetGenerationLength(g.Hash))
-	_, err = file.ReadAt(data, int64(g.File.GetSerialNumber(g.Hash)*1<<27))
+	codedPiece, err := enc.InnovativeCodedPiece(subspace)
 	if err != nil {
 		return nil
 	}
-	file.Close()
+	return codedPiece
+}
+
+// getEncoder returns the encoder, which is created over the stored
+// generation if there is none. Source pieces are streamed from the files
+// as pieces are coded, through the cache shared by all generations. The
+// encoder returned is used even if it's dropped meanwhile.
+func (g *Generation) getEncoder() encoder.Encoder {
+	g.encoderMutex.Lock()
+	defer g.encoderMutex.Unlock()
+	g.encoderActiveTime = time.Now()
+
+	if g.Encoder != nil {
+		return g.Encoder
+	}
 
-	g.Encoder, err = encoder.NewSparseRLNCEncoderWithPieceCount(data, g.File.GetPieceCount(g.Hash), 0.95)
+	// create encoder
+	var err error
+	g.Encoder, err = encoder.NewStreamingRLNCEncoder(g.File.Field, g.File.GetStorage(), g.File.GetGenerationOffset(g.Index),
+		g.File.GetGenerationLength(g.Hash), g.File.GetPieceCount(g.Hash), g.File.NcFile.GetSparsity(), pieceCache, string(g.Hash))
 	if err != nil {
+		g.Encoder = nil
 		return nil
 	}
-	return g.Encoder.CodedPiece()
+	return g.Encoder
 }
 
 func (g *Generation) StartReceiving() {
@@ -172,28 +311,38 @@ func (g *Generation) StartReceiving() {
 		return
 	}
 
-	if g.Decoder != nil {
-		g.Decoder = decoder.NewGaussElimRLNCDecoder(g.File.GetPieceCount(g.Hash))
+	g.decoderMutex.Lock()
+	if g.Decoder == nil {
+		g.Decoder = g.newDecoder()
 	}
+	g.decoderMutex.Unlock()
 	g.isDownloading = true
 	g.isDownloaded = false
-	g.AddCodedPieceChan = make(chan *coder.CodedPiece, 10)
+	g.addCodedPieceChan = make(chan receivedPiece, 10)
 	ctx, cancel := context.WithCancel(context.Background())
+	g.receivingCtx = ctx
 	g.cancelReceiving = cancel
 
-	go func(ctx context.Context) {
+	go func(ctx context.Context, pieces chan receivedPiece) {
+		// no pieces may be sent once the generation is decoded, so one
+		// which failed to be saved is saved again after a while
+		retry := time.NewTicker(saveRetryInterval)
+		defer retry.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case codedPiece := <-g.AddCodedPieceChan:
-				g.AddCodedPiece(codedPiece)
-				if g.isDownloaded {
-					go g.StopReceiving()
-				}
+			case received := <-pieces:
+				g.AddCodedPiece(received.piece, received.from)
+				g.ReleaseCredit(1)
+			case <-retry.C:
+				g.retrySave()
+			}
+			if g.downloaded() {
+				go g.StopReceiving()
 			}
 		}
-	}(ctx)
+	}(ctx, g.addCodedPieceChan)
 }
 
 func (g *Generation) StopReceiving() {
@@ -203,12 +352,12 @@ func (g *Generation) StopReceiving() {
 	g.isDownloading = false
 
 	g.connsMutex.Lock()
-	for _, conn := range g.Conns {
-		if conn != nil {
-			conn.Close()
+	for _, s := range g.streams {
+		if s.conn != nil {
+			s.conn.Close()
 		}
 	}
-	g.Conns = []net.Conn{}
+	g.streams = []stream{}
 	g.connsMutex.Unlock()
 
 	g.NodesMutex.RLock()
@@ -218,24 +367,72 @@ func (g *Generation) StopReceiving() {
 	g.NodesMutex.RUnlock()
 
 	g.cancelReceiving()
-	g.AddCodedPieceChan = nil
+	g.addCodedPieceChan = nil
+
+	// pieces still in flight are dropped
+	g.creditMutex.Lock()
+	g.inFlight = 0
+	g.creditMutex.Unlock()
 }
 
 func (g *Generation) AddNode(addr string) {
 	g.NodesMutex.Lock()
 	defer g.NodesMutex.Unlock()
 	for _, node := range g.Nodes {
-		if node.Addr == addr {
+		if node.hasAddr(addr) {
 			return
 		}
 	}
 	g.Nodes = append(g.Nodes, &Node{
 		Addr:       addr,
+		Addrs:      []string{addr},
 		IsOn:       true,
 		HaveClient: false,
 	})
 }
 
+// AddPeer records that the peer proved its identity at addr. An unverified
+// node at addr becomes the peer, unless the peer is known already.
+func (g *Generation) AddPeer(id protocol.PeerID, addr string) {
+	g.NodesMutex.Lock()
+	defer g.NodesMutex.Unlock()
+	var peer, unverified *Node
+	for _, node := range g.Nodes {
+		if node.ID == id {
+			peer = node
+		} else if node.ID.IsZero() && node.Addr == addr {
+			unverified = node
+		}
+	}
+
+	switch {
+	case peer != nil:
+		peer.Addrs = appendAddr(peer.Addrs, addr)
+		if unverified != nil {
+			g.removeNode(unverified)
+		}
+	case unverified != nil:
+		unverified.ID = id
+	default:
+		g.Nodes = append(g.Nodes, &Node{
+			ID:         id,
+			Addr:       addr,
+			Addrs:      []string{addr},
+			IsOn:       true,
+			HaveClient: false,
+		})
+	}
+}
+
+func (g *Generation) removeNode(node *Node) {
+	for i, n := range g.Nodes {
+		if n == node {
+			g.Nodes = append(g.Nodes[:i], g.Nodes[i+1:]...)
+			return
+		}
+	}
+}
+
 func (g *Generation) DeleteNode(addr string) {
 	g.NodesMutex.Lock()
 	defer g.NodesMutex.Unlock()
@@ -268,21 +465,69 @@ func (g *Generation) GetProcessRate() float64 {
 	return g.Decoder.ProcessRate()
 }
 
-func (g *Generation) AddConn(conn net.Conn) {
+// PutCodedPiece hands a coded piece received from the node at addr to
+// the decoder, it returns false if the generation is not receiving
+func (g *Generation) PutCodedPiece(codedPiece *coder.CodedPiece, from string) bool {
+	addCodedPieceChan, ctx := g.addCodedPieceChan, g.receivingCtx
+	if addCodedPieceChan == nil || ctx == nil {
+		return false
+	}
+	select {
+	case addCodedPieceChan <- receivedPiece{piece: codedPiece, from: from}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// VerifyCodedPiece checks a coded piece received from the node at from
+// against the hashes of the source pieces in the seed, then against the
+// checks asked of another node, so that a polluted piece never reaches the
+// decoder or the recoder. Pieces of seeds without hashes pass the first.
+func (g *Generation) VerifyCodedPiece(codedPiece *coder.CodedPiece, from string) error {
+	hashes := g.File.NcFile.GetPieceHashes(int(g.Index))
+	if hashes != nil {
+		if err := coder.VerifyCodedPiece(g.File.Field, g.Hash, codedPiece, hashes); err != nil {
+			return err
+		}
+	}
+	return g.verifyChecks(codedPiece, from)
+}
+
+// SetHaveClient marks whether a client is receiving from the node
+func (g *Generation) SetHaveClient(addr string, haveClient bool) {
+	g.NodesMutex.RLock()
+	defer g.NodesMutex.RUnlock()
+	for _, node := range g.Nodes {
+		if node.Addr == addr {
+			node.HaveClient = haveClient
+		}
+	}
+}
+
+// AddConn adds the stream of coded pieces from the node at addr
+func (g *Generation) AddConn(addr string, conn io.Closer) {
 	g.connsMutex.Lock()
 	defer g.connsMutex.Unlock()
-	g.Conns = append(g.Conns, conn)
+	g.streams = append(g.streams, stream{addr: addr, conn: conn})
 }
 
 func (g *Generation) IsDownloading() bool {
 	return g.isDownloading
 }
 
+func (g *Generation) IsDownloaded() bool {
+	return g.isDownloaded
+}
+
 func (g *Generation) DropIdleEncoder() {
+	g.encoderMutex.Lock()
+	defer g.encoderMutex.Unlock()
 	if g.Encoder == nil {
 		return
 	}
 	if time.Now().Sub(g.encoderActiveTime) > 10*time.Second {
 		g.Encoder = nil
+		pieceCache.Drop(string(g.Hash))
 	}
 }
@@ -0,0 +1,136 @@
+package dc
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+)
+
+func TestRecodeWhileAdding(t *testing.T) {
+	f, data := newTestFile(t, 1<<10)
+	g := f.Generations[0]
+	pieceCount := f.GetPieceCount(g.Hash)
+	pieces, _, err := coder.OriginalPiecesFromDataAndPieceCount(data[:64<<10], pieceCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := encoder.NewFullRLNCEncoder(f.Field, pieces)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := uint(0); i < pieceCount; i++ {
+			g.AddCodedPiece(enc.CodedPiece(), "")
+		}
+	}()
+	// pieces recoded while the decoder reduces the ones received match
+	// their vectors
+	subspace := coder.NewSubspace(f.Field, pieceCount)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if piece := g.GetCodedPiece(); piece != nil && !isCombination(f.Field, piece, pieces) {
+			t.Fatal("recoded piece doesn't match its vector")
+		}
+		if piece := g.GetInnovativeCodedPiece(subspace); piece != nil {
+			if !isCombination(f.Field, piece, pieces) {
+				t.Fatal("recoded piece doesn't match its vector")
+			}
+			subspace.Add(piece.Vector)
+		}
+	}
+}
+
+func TestSaveFailure(t *testing.T) {
+	f, data := newTestFile(t, 16<<10)
+	g := f.Generations[0]
+	pieces, _, err := coder.OriginalPiecesFromDataAndPieceCount(data[:64<<10], f.GetPieceCount(g.Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := encoder.NewFullRLNCEncoder(f.Field, pieces)
+
+	// the target can't be written while a directory is in its place
+	if err := os.Mkdir(f.GetTargetFile(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*len(pieces) && (g.Decoder == nil || !g.Decoder.IsDecoded()); i++ {
+		g.AddCodedPiece(enc.CodedPiece(), "")
+	}
+	if g.downloaded() || g.Decoder == nil || !g.Decoder.IsDecoded() {
+		t.Fatal("decoder of a generation which failed to be saved is dropped")
+	}
+
+	if err := os.Remove(f.GetTargetFile()); err != nil {
+		t.Fatal(err)
+	}
+	g.retrySave()
+	if !g.downloaded() || g.Decoder != nil {
+		t.Fatal("generation is not saved again")
+	}
+	saved, err := os.ReadFile(f.GetTargetFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved[:64<<10], data[:64<<10]) {
+		t.Fatal("saved generation differs")
+	}
+}
+
+func TestCodeWhileDroppingEncoder(t *testing.T) {
+	f, data := newTestFile(t, 16<<10)
+	if err := os.WriteFile(f.GetTargetFile(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	g := f.Generations[0]
+	g.isDownloaded = true
+	pieces, _, err := coder.OriginalPiecesFromDataAndPieceCount(data[:64<<10], f.GetPieceCount(g.Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			subspace := coder.NewSubspace(f.Field, uint(len(pieces)))
+			for j := 0; j < 50; j++ {
+				piece := g.GetCodedPiece()
+				if piece == nil || !isCombination(f.Field, piece, pieces) {
+					t.Error("no coded piece of a dropped encoder")
+					return
+				}
+				if piece := g.GetInnovativeCodedPiece(subspace); piece != nil && !isCombination(f.Field, piece, pieces) {
+					t.Error("innovative piece doesn't match its vector")
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// the encoder is idle as soon as it is created
+		g.encoderMutex.Lock()
+		g.encoderActiveTime = time.Time{}
+		g.encoderMutex.Unlock()
+		g.DropIdleEncoder()
+	}
+}
@@ -0,0 +1,126 @@
+package dc
+
+import (
+	"encoding/hex"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/aecra/PeerCodeX/coder/decoder"
+)
+
+// DefaultDecoderMemory is the memory generations are decoded in unless
+// set otherwise, generations beyond it are decoded on disk
+const DefaultDecoderMemory = 512 << 20
+
+var (
+	decoderMemory      = int64(DefaultDecoderMemory) // budget of generations decoded in memory
+	decoderMemoryUsed  = int64(0)                    // reserved by decoders in memory
+	decoderMemoryMutex = sync.Mutex{}
+)
+
+// SetDecoderMemory sets the memory budget of generations decoded in
+// memory at the same time, 0 decodes all on disk. Decoders already
+// created are kept where they are.
+func SetDecoderMemory(budget int64) {
+	decoderMemoryMutex.Lock()
+	defer decoderMemoryMutex.Unlock()
+	if budget < 0 {
+		budget = 0
+	}
+	decoderMemory = budget
+}
+
+// GetDecoderMemory returns the memory budget of decoders and the part of
+// it reserved
+func GetDecoderMemory() (budget, used int64) {
+	decoderMemoryMutex.Lock()
+	defer decoderMemoryMutex.Unlock()
+	return decoderMemory, decoderMemoryUsed
+}
+
+func reserveDecoderMemory(cost int64) bool {
+	decoderMemoryMutex.Lock()
+	defer decoderMemoryMutex.Unlock()
+	if decoderMemoryUsed+cost > decoderMemory {
+		return false
+	}
+	decoderMemoryUsed += cost
+	return true
+}
+
+func releaseDecoderMemory(cost int64) {
+	decoderMemoryMutex.Lock()
+	defer decoderMemoryMutex.Unlock()
+	decoderMemoryUsed -= cost
+}
+
+// decoderCost estimates the memory of decoding the generation in memory,
+// where the decoder, the copies of received pieces and the recoder each
+// hold about the whole generation
+func (g *Generation) decoderCost() int64 {
+	return 3 * int64(g.File.GetGenerationLength(g.Hash))
+}
+
+// decodingDir returns the directory generations are decoded on disk in,
+// empty for the default directory of temporary files
+func decodingDir() string {
+	dir := GetStateDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, decodingDirName)
+}
+
+// newDecoder returns a decoder of the generation in memory if the budget
+// allows, otherwise one spilling coded pieces to the state directory.
+// The caller holds decoderMutex.
+func (g *Generation) newDecoder() decoder.Decoder {
+	pieceCount := g.File.GetPieceCount(g.Hash)
+	cost := g.decoderCost()
+	if reserveDecoderMemory(cost) {
+		g.decoderMemory = cost
+		return decoder.NewProgressiveRLNCDecoder(g.File.Field, pieceCount)
+	}
+	dec, err := decoder.NewDiskRLNCDecoder(g.File.Field, pieceCount, decodingDir())
+	if err != nil {
+		log.Println("Generation(" + hex.EncodeToString(g.Hash) + ") decoding in memory: " + err.Error())
+		return decoder.NewProgressiveRLNCDecoder(g.File.Field, pieceCount)
+	}
+	return dec
+}
+
+// isSpilled returns whether the generation is decoded on disk, in which
+// case no recoder or copies of received pieces are kept in memory. The
+// caller holds decoderMutex.
+func (g *Generation) isSpilled() bool {
+	_, ok := g.Decoder.(*decoder.DiskRLNCDecoder)
+	return ok
+}
+
+// dropDecoder drops the decoder and recoder of the generation, releasing
+// the memory reserved for them. The caller holds decoderMutex.
+func (g *Generation) dropDecoder() {
+	if closer, ok := g.Decoder.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Println("Generation(" + hex.EncodeToString(g.Hash) + ") decoder: " + err.Error())
+		}
+	}
+	releaseDecoderMemory(g.decoderMemory)
+	g.decoderMemory = 0
+	g.Decoder = nil
+	g.Recoder = nil
+}
+
+// close stops receiving the file and drops the decoders of all its
+// generations for good, pieces still being received are not decoded
+func (f *File) close() {
+	f.StopReceivingCodedPiece()
+	for _, g := range f.Generations {
+		g.decoderMutex.Lock()
+		g.closed = true
+		g.dropDecoder()
+		g.decoderMutex.Unlock()
+	}
+}
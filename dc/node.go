@@ -1,7 +1,62 @@
 package dc
 
+import "github.com/aecra/PeerCodeX/protocol"
+
+// Node is a peer of a generation. A node found by address is unverified
+// until it proves its identity in a handshake, from then on it is keyed
+// by its peer id and collects every address it is seen at.
 type Node struct {
-	Addr       string
+	ID         protocol.PeerID // zero while the node is unverified
+	Addr       string          // address the node is dialed at
+	Addrs      []string        // every address the node is seen at
 	IsOn       bool
 	HaveClient bool
 }
+
+// Reputation returns what the node has sent so far
+func (n *Node) Reputation() Reputation {
+	return GetReputation(n.ID, n.Addr)
+}
+
+// IsBanned reports whether the node is banned by its peer id or address
+func (n *Node) IsBanned() bool {
+	return IsBanned(n.ID, n.Addr)
+}
+
+func (n *Node) hasAddr(addr string) bool {
+	if n.Addr == addr {
+		return true
+	}
+	for _, a := range n.Addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func appendAddr(addrs []string, addr string) []string {
+	for _, a := range addrs {
+		if a == addr {
+			return addrs
+		}
+	}
+	return append(addrs, addr)
+}
+
+// key identifies the node in views, unverified nodes by their address
+func (n *Node) key() string {
+	if n.ID.IsZero() {
+		return n.Addr
+	}
+	return string(n.ID[:])
+}
+
+func containsNode(nodes []*Node, node *Node) bool {
+	for _, n := range nodes {
+		if n.key() == node.key() {
+			return true
+		}
+	}
+	return false
+}
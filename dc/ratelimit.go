@@ -0,0 +1,215 @@
+package dc
+
+import (
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aecra/PeerCodeX/ratelimit"
+	"github.com/zeebo/bencode"
+)
+
+const rateLimitsFileName = "limits"
+
+// RateLimits are bandwidth limits in bytes per second, 0 is unlimited.
+// The schedules set the limits of all connections by time of the week,
+// in the form of ratelimit.ParseSchedule.
+//
+// Limits are kept in the state directory, which a running node checks
+// for changes, so that they can be changed from another process.
+type RateLimits struct {
+	Upload           int64  `bencode:"upload"` // of all connections
+	Download         int64  `bencode:"download"`
+	PeerUpload       int64  `bencode:"peer upload"` // of the connections to one peer
+	PeerDownload     int64  `bencode:"peer download"`
+	FileUpload       int64  `bencode:"file upload"` // of the connections of one file
+	FileDownload     int64  `bencode:"file download"`
+	UploadSchedule   string `bencode:"upload schedule"`
+	DownloadSchedule string `bencode:"download schedule"`
+}
+
+// limiters limit the uploads and downloads of some connections
+type limiters struct {
+	upload   *ratelimit.Limiter
+	download *ratelimit.Limiter
+}
+
+func newLimiters(upload, download int64) *limiters {
+	return &limiters{upload: ratelimit.NewLimiter(upload), download: ratelimit.NewLimiter(download)}
+}
+
+// limit adds the limiters to conn, reads are downloads and writes uploads
+func (l *limiters) limit(conn *ratelimit.Conn) {
+	conn.Limit(l.download, l.upload)
+}
+
+var (
+	rateLimits          = RateLimits{}
+	globalLimiters      = newLimiters(0, 0)
+	peerLimiters        = make(map[string]*limiters) // by address of the peer
+	rateLimitsMutex     = sync.Mutex{}
+	rateLimitsModTime   = time.Time{} // of the limits file last loaded or saved
+	rateLimitsFileMutex = sync.Mutex{}
+)
+
+func init() {
+	// pick up limits changed by another process
+	go func() {
+		for {
+			time.Sleep(10 * time.Second)
+			if err := reloadRateLimits(); err != nil {
+				log.Println("rate limits: " + err.Error())
+			}
+		}
+	}()
+}
+
+func (r RateLimits) schedules() (upload ratelimit.Schedule, download ratelimit.Schedule, err error) {
+	if upload, err = ratelimit.ParseSchedule(r.UploadSchedule); err != nil {
+		return nil, nil, err
+	}
+	if download, err = ratelimit.ParseSchedule(r.DownloadSchedule); err != nil {
+		return nil, nil, err
+	}
+	return upload, download, nil
+}
+
+// Validate checks the schedules of the limits
+func (r RateLimits) Validate() error {
+	_, _, err := r.schedules()
+	return err
+}
+
+func GetRateLimits() RateLimits {
+	rateLimitsMutex.Lock()
+	defer rateLimitsMutex.Unlock()
+	return rateLimits
+}
+
+// SetRateLimits applies the limits to every connection, including those
+// which are open already
+func SetRateLimits(limits RateLimits) error {
+	uploadSchedule, downloadSchedule, err := limits.schedules()
+	if err != nil {
+		return err
+	}
+	rateLimitsMutex.Lock()
+	rateLimits = limits
+	globalLimiters.upload.SetRate(limits.Upload)
+	globalLimiters.upload.SetSchedule(uploadSchedule)
+	globalLimiters.download.SetRate(limits.Download)
+	globalLimiters.download.SetSchedule(downloadSchedule)
+	for _, l := range peerLimiters {
+		l.upload.SetRate(limits.PeerUpload)
+		l.download.SetRate(limits.PeerDownload)
+	}
+	rateLimitsMutex.Unlock()
+
+	FileListMutex.RLock()
+	defer FileListMutex.RUnlock()
+	for _, f := range FileList {
+		f.limiters.upload.SetRate(limits.FileUpload)
+		f.limiters.download.SetRate(limits.FileDownload)
+	}
+	return nil
+}
+
+// LimitConn wraps conn in the limits of all connections
+func LimitConn(conn net.Conn) *ratelimit.Conn {
+	limited := ratelimit.NewConn(conn)
+	globalLimiters.limit(limited)
+	return limited
+}
+
+// LimitPeer adds the limits of the peer at addr to conn
+func LimitPeer(conn *ratelimit.Conn, addr string) {
+	rateLimitsMutex.Lock()
+	l, ok := peerLimiters[addr]
+	if !ok {
+		l = newLimiters(rateLimits.PeerUpload, rateLimits.PeerDownload)
+		peerLimiters[addr] = l
+	}
+	rateLimitsMutex.Unlock()
+	l.limit(conn)
+}
+
+// LimitConn adds the limits of the file to conn
+func (f *File) LimitConn(conn *ratelimit.Conn) {
+	f.limiters.limit(conn)
+}
+
+func newFileLimiters() *limiters {
+	limits := GetRateLimits()
+	return newLimiters(limits.FileUpload, limits.FileDownload)
+}
+
+// LoadRateLimits applies the limits kept in the state directory, if any
+func LoadRateLimits() error {
+	dir := GetStateDir()
+	if dir == "" {
+		return nil
+	}
+	rateLimitsFileMutex.Lock()
+	defer rateLimitsFileMutex.Unlock()
+	path := filepath.Join(dir, rateLimitsFileName)
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	limits := RateLimits{}
+	if err := bencode.DecodeBytes(content, &limits); err != nil {
+		return err
+	}
+	rateLimitsModTime = fi.ModTime()
+	return SetRateLimits(limits)
+}
+
+// SaveRateLimits keeps the limits in the state directory
+func SaveRateLimits() error {
+	dir := GetStateDir()
+	if dir == "" {
+		return nil
+	}
+	content, err := bencode.EncodeBytes(GetRateLimits())
+	if err != nil {
+		return err
+	}
+	rateLimitsFileMutex.Lock()
+	defer rateLimitsFileMutex.Unlock()
+	path := filepath.Join(dir, rateLimitsFileName)
+	if err := writeFileAtomic(path, content); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(path); err == nil {
+		rateLimitsModTime = fi.ModTime()
+	}
+	return nil
+}
+
+func reloadRateLimits() error {
+	dir := GetStateDir()
+	if dir == "" {
+		return nil
+	}
+	fi, err := os.Stat(filepath.Join(dir, rateLimitsFileName))
+	if err != nil {
+		return nil
+	}
+	rateLimitsFileMutex.Lock()
+	changed := !fi.ModTime().Equal(rateLimitsModTime)
+	rateLimitsFileMutex.Unlock()
+	if !changed {
+		return nil
+	}
+	return LoadRateLimits()
+}
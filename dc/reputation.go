@@ -0,0 +1,223 @@
+package dc
+
+import (
+	"log"
+	"sync"
+
+	"github.com/aecra/PeerCodeX/protocol"
+)
+
+const (
+	minReputationEvents = 16  // events before a peer is judged by its score
+	deprioritizeScore   = 0.5 // peers below are only requested from if no other peer is
+	banScore            = 0.1 // peers below are banned
+)
+
+// Reputation is what a peer has sent so far. Peers are tracked by their
+// peer id once they proved it, unverified peers by their address.
+type Reputation struct {
+	Innovative     uint   // pieces which raised the rank of the decoder
+	NonInnovative  uint   // pieces which were linearly dependent
+	ProtocolErrors uint   // malformed messages or handshakes
+	Timeouts       uint   // dials or handshakes which timed out
+	HashFailures   uint   // polluted pieces, or pieces which corrupted a generation
+	Banned         bool   // banned peers are neither dialed nor accepted
+	BanReason      string // why the peer is banned
+}
+
+var (
+	reputations     = make(map[string]*Reputation)
+	peerIDs         = make(map[string]protocol.PeerID) // peer ids by the addresses they are seen at
+	reputationMutex = sync.Mutex{}
+)
+
+func (r Reputation) events() uint {
+	return r.Innovative + r.NonInnovative + r.ProtocolErrors + r.Timeouts + r.HashFailures
+}
+
+// Score is in (0, 1], a peer which only sent innovative pieces scores 1.
+// Errors weigh more than linearly dependent pieces, which several senders
+// of a generation produce now and then.
+func (r Reputation) Score() float64 {
+	good := float64(r.Innovative + 1)
+	bad := float64(r.NonInnovative)/2 + float64(r.ProtocolErrors)*4 + float64(r.Timeouts)*2 + float64(r.HashFailures)*16
+	return good / (good + bad)
+}
+
+// IsDeprioritized reports whether the peer is only worth requesting from
+// if no other peer is available
+func (r Reputation) IsDeprioritized() bool {
+	return r.Banned || r.events() >= minReputationEvents && r.Score() < deprioritizeScore
+}
+
+func reputationKey(id protocol.PeerID, addr string) string {
+	if id.IsZero() {
+		return addr
+	}
+	return id.String()
+}
+
+// getReputation returns the reputation of the peer at addr, under its peer
+// id if it is known, the caller holds reputationMutex
+func getReputation(addr string) *Reputation {
+	key := reputationKey(peerIDs[addr], addr)
+	r, ok := reputations[key]
+	if !ok {
+		r = &Reputation{}
+		reputations[key] = r
+	}
+	return r
+}
+
+// rememberPeerID records the peer id proven at addr, the reputation of the
+// address is merged into the one of the peer id
+func rememberPeerID(id protocol.PeerID, addr string) {
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+	peerIDs[addr] = id
+	byAddr, ok := reputations[addr]
+	if !ok {
+		return
+	}
+	delete(reputations, addr)
+	r := getReputation(addr)
+	r.Innovative += byAddr.Innovative
+	r.NonInnovative += byAddr.NonInnovative
+	r.ProtocolErrors += byAddr.ProtocolErrors
+	r.Timeouts += byAddr.Timeouts
+	r.HashFailures += byAddr.HashFailures
+	if byAddr.Banned && !r.Banned {
+		r.Banned, r.BanReason = true, byAddr.BanReason
+	}
+}
+
+// report updates the reputation of the peer at addr and bans it if its
+// score dropped below the threshold
+func report(addr string, update func(r *Reputation)) {
+	if addr == "" {
+		return
+	}
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+	r := getReputation(addr)
+	update(r)
+	if r.Banned {
+		return
+	}
+	if r.HashFailures > 0 {
+		r.Banned, r.BanReason = true, "sent corrupting pieces"
+	} else if r.events() >= minReputationEvents && r.Score() < banScore {
+		r.Banned, r.BanReason = true, "score below threshold"
+	}
+	if r.Banned {
+		log.Println("Banned " + addr + ": " + r.BanReason)
+	}
+}
+
+// ReportPiece records whether a piece from the peer at addr was innovative
+func ReportPiece(addr string, innovative bool) {
+	report(addr, func(r *Reputation) {
+		if innovative {
+			r.Innovative++
+		} else {
+			r.NonInnovative++
+		}
+	})
+}
+
+func ReportProtocolError(addr string) {
+	report(addr, func(r *Reputation) { r.ProtocolErrors++ })
+}
+
+func ReportTimeout(addr string) {
+	report(addr, func(r *Reputation) { r.Timeouts++ })
+}
+
+// ReportHashFailure records a polluted piece from the peer at addr, or a
+// generation it corrupted, which bans the peer
+func ReportHashFailure(addr string) {
+	report(addr, func(r *Reputation) { r.HashFailures++ })
+}
+
+// GetReputation returns a copy of the reputation of the peer, by its peer
+// id if it is known and by its address otherwise
+func GetReputation(id protocol.PeerID, addr string) Reputation {
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+	if id.IsZero() {
+		id = peerIDs[addr]
+	}
+	if r, ok := reputations[reputationKey(id, addr)]; ok {
+		return *r
+	}
+	return Reputation{}
+}
+
+// IsBanned reports whether the peer is banned by its peer id or address
+func IsBanned(id protocol.PeerID, addr string) bool {
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+	if id.IsZero() {
+		id = peerIDs[addr]
+	}
+	for _, key := range []string{reputationKey(id, addr), addr} {
+		if r, ok := reputations[key]; ok && r.Banned {
+			return true
+		}
+	}
+	return false
+}
+
+// Ban bans the peer by hand, peers are banned by their peer id once known
+func Ban(id protocol.PeerID, addr string, reason string) {
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+	if id.IsZero() {
+		id = peerIDs[addr]
+	}
+	key := reputationKey(id, addr)
+	r, ok := reputations[key]
+	if !ok {
+		r = &Reputation{}
+		reputations[key] = r
+	}
+	r.Banned, r.BanReason = true, reason
+}
+
+// Unban lifts the ban of the peer and forgets its reputation
+func Unban(id protocol.PeerID, addr string) {
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+	if id.IsZero() {
+		id = peerIDs[addr]
+	}
+	delete(reputations, reputationKey(id, addr))
+	delete(reputations, addr)
+}
+
+// getBans returns the reasons of banned peers by their key
+func getBans() map[string]string {
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+	bans := make(map[string]string)
+	for key, r := range reputations {
+		if r.Banned {
+			bans[key] = r.BanReason
+		}
+	}
+	return bans
+}
+
+// restoreBans bans the peers of a saved ban list
+func restoreBans(bans map[string]string) {
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+	for key, reason := range bans {
+		r, ok := reputations[key]
+		if !ok {
+			r = &Reputation{}
+			reputations[key] = r
+		}
+		r.Banned, r.BanReason = true, reason
+	}
+}
@@ -0,0 +1,57 @@
+package dc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/protocol"
+)
+
+func TestReputationBans(t *testing.T) {
+	for _, c := range []struct {
+		name          string
+		report        func(addr string)
+		times         int
+		banned        bool
+		reason        string
+		deprioritized bool
+	}{
+		{"hash failure", ReportHashFailure, 1, true, "sent corrupting pieces", true},
+		{"innovative pieces", func(addr string) { ReportPiece(addr, true) }, 100, false, "", false},
+		{"few protocol errors", ReportProtocolError, minReputationEvents - 1, false, "", false},
+		{"protocol errors", ReportProtocolError, minReputationEvents, true, "score below threshold", true},
+		{"non-innovative pieces", func(addr string) { ReportPiece(addr, false) }, minReputationEvents, false, "", true},
+	} {
+		addr := fmt.Sprintf("reputation %s", c.name)
+		for i := 0; i < c.times; i++ {
+			c.report(addr)
+		}
+		r := GetReputation(protocol.PeerID{}, addr)
+		if IsBanned(protocol.PeerID{}, addr) != c.banned || r.BanReason != c.reason {
+			t.Fatalf("%s: banned %v for %q", c.name, r.Banned, r.BanReason)
+		}
+		if r.IsDeprioritized() != c.deprioritized {
+			t.Fatalf("%s: deprioritized %v with score %f", c.name, r.IsDeprioritized(), r.Score())
+		}
+		Unban(protocol.PeerID{}, addr)
+		if IsBanned(protocol.PeerID{}, addr) {
+			t.Fatalf("%s: still banned", c.name)
+		}
+	}
+}
+
+func TestHashFailureBansPeerID(t *testing.T) {
+	id := protocol.PeerID{1, 2, 3}
+	addr := "reputation peer id"
+	ReportPiece(addr, true)
+	rememberPeerID(id, addr)
+	ReportHashFailure(addr)
+	// the ban follows the peer id to any address
+	if !IsBanned(id, "reputation other address") {
+		t.Fatal("expected the peer id to be banned")
+	}
+	if r := GetReputation(id, ""); r.Innovative != 1 || r.HashFailures != 1 {
+		t.Fatalf("reputation of the address is not merged: %+v", r)
+	}
+	Unban(id, addr)
+}
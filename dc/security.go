@@ -0,0 +1,45 @@
+package dc
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/aecra/PeerCodeX/protocol"
+)
+
+const identityFileName = "identity"
+
+var (
+	security      = &protocol.Security{Encryption: protocol.EncryptionOn}
+	securityMutex = sync.RWMutex{}
+)
+
+func init() {
+	// a node without state directory has a new identity every run
+	identity, err := protocol.NewIdentity()
+	if err == nil {
+		security.Identity = identity
+	}
+}
+
+func GetSecurity() *protocol.Security {
+	securityMutex.RLock()
+	defer securityMutex.RUnlock()
+	return security
+}
+
+func SetSecurity(s *protocol.Security) {
+	securityMutex.Lock()
+	defer securityMutex.Unlock()
+	security = s
+}
+
+// LoadIdentity returns the identity kept in the state directory, which is
+// created on first use. Without state directory a new identity is returned.
+func LoadIdentity() (*protocol.Identity, error) {
+	dir := GetStateDir()
+	if dir == "" {
+		return protocol.NewIdentity()
+	}
+	return protocol.LoadIdentity(filepath.Join(dir, identityFileName))
+}
@@ -0,0 +1,365 @@
+package dc
+
+import (
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aecra/PeerCodeX/coder/decoder"
+	"github.com/aecra/PeerCodeX/coder/recoder"
+	"github.com/aecra/PeerCodeX/seed"
+	"github.com/zeebo/bencode"
+)
+
+// The state directory keeps everything needed to resume a session after
+// restart: the list of added seeds, known peers of every generation, banned
+// peers and a checkpoint of every decoder which is not finished yet.
+//
+//	<state dir>/session                 added seeds, known and banned peers
+//	<state dir>/checkpoints/<hash>      decoder checkpoint of a generation
+var (
+	stateDir      = ""
+	stateMutex    = sync.Mutex{}
+	restoredNodes = make(map[string][]string)
+)
+
+const (
+	sessionFileName   = "session"
+	checkpointDirName = "checkpoints"
+	decodingDirName   = "decoding" // of generations decoded on disk
+)
+
+type savedFile struct {
+	Path        string `bencode:"path"`
+	Downloading bool   `bencode:"downloading"`
+}
+
+type savedState struct {
+	Files []savedFile         `bencode:"files"`
+	Nodes map[string][]string `bencode:"nodes"`
+	Bans  map[string]string   `bencode:"bans"` // reasons by peer id, or address of unverified peers
+}
+
+func init() {
+	// checkpoint session periodically
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			if err := SaveState(); err != nil {
+				log.Println("save state: " + err.Error())
+			}
+		}
+	}()
+}
+
+func SetStateDir(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(filepath.Join(dir, checkpointDirName), 0755); err != nil {
+			return err
+		}
+		// pieces spilled by a previous process are in its checkpoints
+		if err := os.RemoveAll(filepath.Join(dir, decodingDirName)); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(dir, decodingDirName), 0755); err != nil {
+			return err
+		}
+	}
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	stateDir = dir
+	return nil
+}
+
+func GetStateDir() string {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	return stateDir
+}
+
+// LoadState adds every seed recorded in the state directory and returns
+// the files which were downloading when the state was saved, so that the
+// caller can request them again
+func LoadState() ([]*File, error) {
+	dir := GetStateDir()
+	if dir == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(filepath.Join(dir, sessionFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	state := savedState{}
+	if err := bencode.DecodeBytes(content, &state); err != nil {
+		return nil, err
+	}
+
+	stateMutex.Lock()
+	if state.Nodes != nil {
+		restoredNodes = state.Nodes
+	}
+	stateMutex.Unlock()
+	restoreBans(state.Bans)
+
+	downloading := make([]*File, 0)
+	for _, item := range state.Files {
+		if err := AddFile(item.Path); err != nil {
+			log.Println(item.Path + ": " + err.Error())
+			continue
+		}
+		if f := GetFileByPath(item.Path); f != nil && item.Downloading {
+			downloading = append(downloading, f)
+		}
+	}
+	return downloading, nil
+}
+
+// SaveState writes added seeds and known peers to the state directory and
+// checkpoints every decoder which has received new pieces since last time
+func SaveState() error {
+	dir := GetStateDir()
+	if dir == "" {
+		return nil
+	}
+
+	FileListMutex.RLock()
+	files := make([]*File, len(FileList))
+	copy(files, FileList)
+	FileListMutex.RUnlock()
+
+	state := savedState{Files: make([]savedFile, 0, len(files)), Nodes: make(map[string][]string), Bans: getBans()}
+	for _, f := range files {
+		state.Files = append(state.Files, savedFile{Path: f.Path, Downloading: f.IsDownloading()})
+		for _, g := range f.Generations {
+			addrs := make([]string, 0)
+			g.NodesMutex.RLock()
+			for _, node := range g.Nodes {
+				addrs = append(addrs, node.Addr)
+			}
+			g.NodesMutex.RUnlock()
+			state.Nodes[hex.EncodeToString(g.Hash)] = addrs
+
+			if err := g.SaveCheckpoint(); err != nil {
+				log.Println("Generation(" + hex.EncodeToString(g.Hash) + ") checkpoint: " + err.Error())
+			}
+		}
+	}
+
+	content, err := bencode.EncodeBytes(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, sessionFileName), content)
+}
+
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func getRestoredNodes(hash []byte) []string {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	return restoredNodes[hex.EncodeToString(hash)]
+}
+
+func (g *Generation) checkpointPath() string {
+	return checkpointPathOf(g.Hash)
+}
+
+// checkpointPathOf returns the checkpoint of the generation of hash in the
+// state directory, empty if there is no state directory
+func checkpointPathOf(hash []byte) string {
+	dir := GetStateDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, checkpointDirName, hex.EncodeToString(hash))
+}
+
+// Progress is the progress of a seed read from the target file and the
+// checkpoint headers, without restoring any decoder
+type Progress struct {
+	NcFile    *seed.NcFile
+	Target    string
+	InfoHash  []byte
+	Announces []Announce
+	// Generations holds the process rate of every generation
+	Generations []float64
+}
+
+// ReadProgress reads the progress of the seed at path, which need not be
+// added. Unlike NewFile, it reserves no decoder memory.
+func ReadProgress(path string) (*Progress, error) {
+	ncfile, err := seed.NewNcFileFromSeedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	infoHash, err := ncfile.InfoHash()
+	if err != nil {
+		return nil, err
+	}
+	downloaded, err := ncfile.IsFileDownloaded(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Progress{
+		NcFile:      ncfile,
+		Target:      path[:len(path)-len(filepath.Ext(path))],
+		InfoHash:    infoHash,
+		Announces:   newAnnounces(ncfile.Announce, ncfile.AnnounceList).status(),
+		Generations: make([]float64, len(ncfile.Info.Hash)),
+	}
+	for i, h := range ncfile.Info.Hash {
+		if downloaded[i] {
+			p.Generations[i] = 1
+			continue
+		}
+		path := checkpointPathOf(h)
+		if path == "" {
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		pieceCount, rank, err := decoder.CheckpointRank(file)
+		file.Close()
+		if err == nil && pieceCount == ncfile.GetPieceCount(i) {
+			p.Generations[i] = float64(rank) / float64(pieceCount)
+		}
+	}
+	return p, nil
+}
+
+// GetProcessRate returns the share of the length of the seed decoded
+func (p *Progress) GetProcessRate() float64 {
+	generationLength := p.NcFile.GetGenerationLength()
+	decoded := float64(0)
+	for i, rate := range p.Generations {
+		length := generationLength
+		if i == len(p.Generations)-1 {
+			if rest := p.NcFile.Info.Length % generationLength; rest != 0 {
+				length = rest
+			}
+		}
+		decoded += rate * float64(length)
+	}
+	return decoded / float64(p.NcFile.Info.Length)
+}
+
+// SaveCheckpoint writes the decoder state of this generation to the
+// state directory, if it has received useful pieces since last checkpoint
+func (g *Generation) SaveCheckpoint() error {
+	path := g.checkpointPath()
+	if path == "" {
+		return nil
+	}
+
+	g.decoderMutex.Lock()
+	defer g.decoderMutex.Unlock()
+	if g.isDownloaded || g.Decoder == nil {
+		return nil
+	}
+	checkpointer, ok := g.Decoder.(decoder.Checkpointer)
+	if !ok {
+		return nil
+	}
+	rank := g.File.GetPieceCount(g.Hash) - g.Decoder.Required()
+	if rank == g.checkpointRank {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	err = checkpointer.Checkpoint(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	g.checkpointRank = rank
+	return nil
+}
+
+// restoreCheckpoint reloads the decoder state saved by SaveCheckpoint,
+// along with a recoder built from the restored pieces. Like newDecoder,
+// the state is restored to disk if the memory budget is used up.
+func (g *Generation) restoreCheckpoint() error {
+	path := g.checkpointPath()
+	if path == "" || g.isDownloaded {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	g.decoderMutex.Lock()
+	defer g.decoderMutex.Unlock()
+	g.dropDecoder()
+
+	pieceCount := g.File.GetPieceCount(g.Hash)
+	cost := g.decoderCost()
+	if !reserveDecoderMemory(cost) {
+		dec, err := decoder.NewDiskRLNCDecoderFromCheckpoint(file, g.File.Field, pieceCount, decodingDir())
+		if err != nil {
+			return err
+		}
+		g.Decoder = dec
+		g.checkpointRank = pieceCount - dec.Required()
+		return nil
+	}
+
+	dec, err := decoder.NewProgressiveRLNCDecoderFromCheckpoint(file, g.File.Field, pieceCount)
+	if err != nil {
+		releaseDecoderMemory(cost)
+		return err
+	}
+	g.Decoder = dec
+	g.decoderMemory = cost
+	if pieces := dec.(*decoder.ProgressiveRLNCDecoder).CodedPieces(); len(pieces) > 0 {
+		g.Recoder = recoder.NewFullRLNCRecoder(g.File.Field, pieces)
+	}
+	g.checkpointRank = pieceCount - dec.Required()
+	return nil
+}
+
+func (g *Generation) removeCheckpoint() {
+	path := g.checkpointPath()
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,141 @@
+package dc
+
+import (
+	"encoding/hex"
+	"io"
+	"log"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+// stream is a stream of coded pieces from the node at addr
+type stream struct {
+	addr string
+	conn io.Closer
+}
+
+// receivedPiece is a coded piece along with the address of its sender,
+// which is empty for pieces restored from a checkpoint
+type receivedPiece struct {
+	piece *coder.CodedPiece
+	from  string
+}
+
+func clonePiece(codedPiece *coder.CodedPiece) *coder.CodedPiece {
+	return &coder.CodedPiece{
+		Vector: append(coder.CodingVector{}, codedPiece.Vector...),
+		Piece:  append(coder.Piece{}, codedPiece.Piece...),
+	}
+}
+
+// resetDecoding drops the decoder state of an attempt which decoded to a
+// wrong hash. If a single node sent the pieces it is returned as the
+// offender, otherwise the pieces are kept until a later attempt decodes
+// the generation, against which every piece is checked.
+func (g *Generation) resetDecoding() []string {
+	g.hashFailures++
+	log.Printf("Generation(%s) decoded to a wrong hash, %d failures, decoding again", hex.EncodeToString(g.Hash), g.hashFailures)
+
+	senders := map[string]struct{}{}
+	for _, received := range g.received {
+		if received.from != "" {
+			senders[received.from] = struct{}{}
+		}
+	}
+	offenders := make([]string, 0)
+	if len(senders) == 1 {
+		for addr := range senders {
+			offenders = append(offenders, addr)
+		}
+	} else if len(senders) > 1 {
+		g.suspects = g.received
+	}
+
+	g.dropDecoder()
+	g.Decoder = g.newDecoder()
+	g.received = nil
+	g.checkpointRank = 0
+	g.removeCheckpoint()
+	return offenders
+}
+
+// identifySuspects returns the senders of the pieces kept from a failed
+// attempt which are no combination of the source pieces. Pieces of an
+// attempt decoded on disk are not kept, nor checked.
+func (g *Generation) identifySuspects(pieces []coder.Piece) []string {
+	suspects := g.suspects
+	g.suspects = nil
+	offenders := make([]string, 0)
+	if pieces == nil {
+		return offenders
+	}
+	for _, suspect := range suspects {
+		if suspect.from == "" || suspect.piece == nil || isCombination(g.File.Field, suspect.piece, pieces) {
+			continue
+		}
+		offenders = appendAddr(offenders, suspect.from)
+	}
+	return offenders
+}
+
+func isCombination(field galoisfield.Field, codedPiece *coder.CodedPiece, pieces []coder.Piece) bool {
+	if len(codedPiece.Vector) != len(pieces)*field.SymbolSize() {
+		return false
+	}
+	combination := make(coder.Piece, len(codedPiece.Piece))
+	for i := range pieces {
+		if len(pieces[i]) != len(combination) {
+			return false
+		}
+		combination.Multiply(pieces[i], field.Symbol(codedPiece.Vector, i), field)
+	}
+	return string(combination) == string(codedPiece.Piece)
+}
+
+// GetHashFailures returns the number of attempts which decoded the
+// generation to a wrong hash
+func (g *Generation) GetHashFailures() uint {
+	g.decoderMutex.Lock()
+	defer g.decoderMutex.Unlock()
+	return g.hashFailures
+}
+
+// closeStreams closes the streams of coded pieces from the node at addr
+func (g *Generation) closeStreams(addr string) {
+	g.connsMutex.Lock()
+	streams := make([]stream, 0, len(g.streams))
+	closing := make([]stream, 0)
+	for _, s := range g.streams {
+		if s.addr == addr {
+			closing = append(closing, s)
+		} else {
+			streams = append(streams, s)
+		}
+	}
+	g.streams = streams
+	g.connsMutex.Unlock()
+	for _, s := range closing {
+		s.conn.Close()
+	}
+}
+
+// GetHashFailures returns the number of attempts which decoded any
+// generation of the file to a wrong hash
+func (f *File) GetHashFailures() uint {
+	failures := uint(0)
+	for _, g := range f.Generations {
+		failures += g.GetHashFailures()
+	}
+	return failures
+}
+
+// penalize records that the node at addr sent pieces which corrupted a
+// generation, which bans it, and closes its streams
+func (f *File) penalize(addr string) {
+	log.Println(addr + " sent corrupting pieces")
+	ReportHashFailure(addr)
+	for _, g := range f.Generations {
+		g.closeStreams(addr)
+	}
+}
@@ -0,0 +1,84 @@
+package dc
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/seed"
+)
+
+// newTestFile returns a file of two 64KB generations, none of which is
+// downloaded, along with its data
+func newTestFile(t *testing.T, pieceLength int64) (*File, []byte) {
+	path, data := newTestSeed(t, pieceLength)
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(f.close)
+	return f, data
+}
+
+// newTestSeed returns the path of the seed of a file of two 64KB
+// generations, which is not at the path, along with the data of the file
+func newTestSeed(t *testing.T, pieceLength int64) (string, []byte) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+	data := make([]byte, 128<<10)
+	rand.Read(data)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := seed.Options{GenerationLength: 64 << 10, PieceLength: pieceLength, Sparsity: 0.5, Field: seed.DefaultField}
+	if err := seed.CreateSeedFileWithOptions(path, "", "127.0.0.1:8080", "", options); err != nil {
+		t.Fatal(err)
+	}
+	// the seed is moved away from the data, so that nothing is downloaded
+	seedPath := filepath.Join(t.TempDir(), "data.nc")
+	if err := os.Rename(path+".nc", seedPath); err != nil {
+		t.Fatal(err)
+	}
+	return seedPath, data
+}
+
+func TestResetDecoding(t *testing.T) {
+	f, _ := newTestFile(t, 16<<10)
+	for _, c := range []struct {
+		name      string
+		senders   []string // senders of the received pieces, empty if restored
+		offenders []string
+		suspects  bool // whether the pieces are kept to check the senders later
+	}{
+		{"single sender", []string{"a", "a", "a"}, []string{"a"}, false},
+		{"single sender and checkpoint", []string{"", "a", ""}, []string{"a"}, false},
+		{"multiple senders", []string{"a", "b", "a"}, []string{}, true},
+		{"checkpoint only", []string{"", ""}, []string{}, false},
+	} {
+		g := f.Generations[0]
+		g.suspects = nil
+		if g.Decoder == nil {
+			g.Decoder = g.newDecoder()
+		}
+		g.received = nil
+		for _, from := range c.senders {
+			g.received = append(g.received, receivedPiece{from: from})
+		}
+		failures := g.hashFailures
+
+		offenders := g.resetDecoding()
+		sort.Strings(offenders)
+		if !reflect.DeepEqual(offenders, c.offenders) {
+			t.Fatalf("%s: blamed %v, expected %v", c.name, offenders, c.offenders)
+		}
+		if (len(g.suspects) == len(c.senders)) != c.suspects {
+			t.Fatalf("%s: kept %d suspect pieces", c.name, len(g.suspects))
+		}
+		if g.hashFailures != failures+1 || g.received != nil || g.Decoder == nil || g.Decoder.Required() != 4 {
+			t.Fatalf("%s: decoding is not reset", c.name)
+		}
+	}
+}
@@ -0,0 +1,600 @@
+// Package dht implements a Kademlia distributed hash table for trackerless
+// peer discovery. Nodes speak ping, find_node, get_peers and announce_peer
+// over UDP, and swarms are keyed by the infohash of their seed.
+package dht
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeebo/bencode"
+)
+
+const (
+	alpha           = 3 // parallel queries of a lookup
+	DefaultTimeout  = 2 * time.Second
+	DefaultPeerTTL  = 30 * time.Minute // peers which do not announce again are dropped
+	secretRotation  = 5 * time.Minute  // tokens stay valid for up to two rotations
+	maxPeerValues   = 50               // peers returned by get_peers
+	maxMessageBytes = 1 << 16
+
+	DefaultMaxSwarms     = 10000 // infohashes peers are stored for
+	DefaultMaxSwarmPeers = 1000  // peers stored for an infohash
+)
+
+type DHT struct {
+	id      NodeID
+	conn    *net.UDPConn
+	table   *routingTable
+	timeout time.Duration
+
+	// peers which did not announce for peerTTL are dropped by a periodic
+	// sweep, along with swarms left empty
+	peers         map[string]map[string]time.Time // infohash -> peer address -> last announce
+	peerTTL       time.Duration
+	maxSwarms     int
+	maxSwarmPeers int
+	peersMutex    sync.Mutex
+
+	pending      map[string]chan *message // queries waiting for response, by transaction ID
+	pendingMutex sync.Mutex
+	txid         uint32
+
+	secret       []byte
+	prevSecret   []byte
+	secretTime   time.Time
+	secretsMutex sync.Mutex
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// New starts a DHT node with a random ID listening on the UDP address addr
+func New(addr string) (*DHT, error) {
+	return NewWithID(addr, NewRandomNodeID())
+}
+
+func NewWithID(addr string, id NodeID) (*DHT, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	d := &DHT{
+		id:      id,
+		conn:    conn,
+		table:   newRoutingTable(id),
+		timeout: DefaultTimeout,
+		peers:   make(map[string]map[string]time.Time),
+		pending: make(map[string]chan *message),
+		closed:  make(chan struct{}),
+
+		peerTTL:       DefaultPeerTTL,
+		maxSwarms:     DefaultMaxSwarms,
+		maxSwarmPeers: DefaultMaxSwarmPeers,
+	}
+	d.rotateSecret()
+	go d.readLoop()
+	go d.sweepLoop()
+	return d, nil
+}
+
+func (d *DHT) ID() NodeID {
+	return d.id
+}
+
+func (d *DHT) Addr() *net.UDPAddr {
+	return d.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// SetTimeout sets how long a query waits for its response
+func (d *DHT) SetTimeout(timeout time.Duration) {
+	d.timeout = timeout
+}
+
+// SetPeerTTL sets how long an announced peer is stored without announcing
+// again
+func (d *DHT) SetPeerTTL(ttl time.Duration) {
+	d.peersMutex.Lock()
+	defer d.peersMutex.Unlock()
+	d.peerTTL = ttl
+}
+
+// SetPeerLimits sets the number of infohashes peers are stored for, and
+// of peers stored for each. Announces beyond them are refused.
+func (d *DHT) SetPeerLimits(maxSwarms int, maxSwarmPeers int) {
+	d.peersMutex.Lock()
+	defer d.peersMutex.Unlock()
+	d.maxSwarms = maxSwarms
+	d.maxSwarmPeers = maxSwarmPeers
+}
+
+// Swarms returns the number of infohashes peers are stored for
+func (d *DHT) Swarms() int {
+	d.peersMutex.Lock()
+	defer d.peersMutex.Unlock()
+	return len(d.peers)
+}
+
+// Size returns the number of contacts in the routing table
+func (d *DHT) Size() int {
+	return d.table.size()
+}
+
+func (d *DHT) Close() error {
+	err := ErrClosed
+	d.closeOnce.Do(func() {
+		close(d.closed)
+		err = d.conn.Close()
+	})
+	return err
+}
+
+// Bootstrap joins the DHT through the nodes at addrs, then looks up the
+// own ID to fill the routing table
+func (d *DHT) Bootstrap(addrs []string) error {
+	wg := sync.WaitGroup{}
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			d.Ping(addr)
+		}(addr)
+	}
+	wg.Wait()
+	if d.table.size() == 0 {
+		return ErrNoNodes
+	}
+	d.FindNode(d.id)
+	return nil
+}
+
+// Ping checks the node at addr is alive and returns its ID
+func (d *DHT) Ping(addr string) (NodeID, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return NodeID{}, err
+	}
+	r, err := d.query(udpAddr, methodPing, &arguments{})
+	if err != nil {
+		return NodeID{}, err
+	}
+	id, _ := NodeIDFromBytes([]byte(r.ID))
+	return id, nil
+}
+
+// FindNode returns the contacts closest to target found in the DHT
+func (d *DHT) FindNode(target NodeID) []Contact {
+	closest, _, _ := d.lookup(target, methodFindNode)
+	contacts := make([]Contact, len(closest))
+	for i, c := range closest {
+		contacts[i] = *c
+	}
+	return contacts
+}
+
+// GetPeers returns addresses of the peers announced for infoHash
+func (d *DHT) GetPeers(infoHash []byte) ([]string, error) {
+	target, ok := NodeIDFromBytes(infoHash)
+	if !ok {
+		return nil, ErrBadMessage
+	}
+	closest, _, peers := d.lookup(target, methodGetPeers)
+	if len(closest) == 0 {
+		return nil, ErrNoNodes
+	}
+	return peers, nil
+}
+
+// AnnouncePeer announces that this host serves infoHash on port to the
+// nodes closest to infoHash
+func (d *DHT) AnnouncePeer(infoHash []byte, port int) error {
+	target, ok := NodeIDFromBytes(infoHash)
+	if !ok {
+		return ErrBadMessage
+	}
+	closest, tokens, _ := d.lookup(target, methodGetPeers)
+
+	announced := int32(0)
+	wg := sync.WaitGroup{}
+	for _, c := range closest {
+		token, ok := tokens[c.ID]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(c *Contact, token string) {
+			defer wg.Done()
+			args := &arguments{InfoHash: string(infoHash), Port: port, Token: token}
+			if _, err := d.query(c.Addr, methodAnnouncePeer, args); err == nil {
+				atomic.AddInt32(&announced, 1)
+			}
+		}(c, token)
+	}
+	wg.Wait()
+	if announced == 0 {
+		return ErrNoNodes
+	}
+	return nil
+}
+
+type lookupResult struct {
+	contact *Contact
+	results *results
+	err     error
+}
+
+// lookup queries the nodes closest to target iteratively, alpha at a
+// time, until the closest nodes found have all been queried. It returns
+// the closest nodes which responded, their tokens, and for get_peers the
+// peers they returned.
+func (d *DHT) lookup(target NodeID, method string) ([]*Contact, map[NodeID]string, []string) {
+	shortlist := d.table.closest(target, BucketSize)
+	known := map[NodeID]bool{d.id: true}
+	for _, c := range shortlist {
+		known[c.ID] = true
+	}
+	queried := map[NodeID]bool{}
+	responded := make([]*Contact, 0)
+	tokens := make(map[NodeID]string)
+	peers := make([]string, 0)
+	peerSet := map[string]struct{}{}
+
+	args := &arguments{Target: string(target[:])}
+	if method == methodGetPeers {
+		args = &arguments{InfoHash: string(target[:])}
+	}
+
+	for {
+		sortByDistance(shortlist, target)
+		batch := make([]*Contact, 0, alpha)
+		for i, c := range shortlist {
+			if i >= BucketSize || len(batch) >= alpha {
+				break
+			}
+			if !queried[c.ID] {
+				queried[c.ID] = true
+				batch = append(batch, c)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		resultChan := make(chan lookupResult, len(batch))
+		for _, c := range batch {
+			go func(c *Contact) {
+				r, err := d.query(c.Addr, method, args)
+				resultChan <- lookupResult{contact: c, results: r, err: err}
+			}(c)
+		}
+		failed := map[NodeID]bool{}
+		for range batch {
+			result := <-resultChan
+			if result.err != nil {
+				d.table.failed(result.contact.ID)
+				failed[result.contact.ID] = true
+				continue
+			}
+			responded = append(responded, result.contact)
+			if result.results.Token != "" {
+				tokens[result.contact.ID] = result.results.Token
+			}
+			for _, peer := range result.results.Values {
+				if _, ok := peerSet[peer]; !ok {
+					peerSet[peer] = struct{}{}
+					peers = append(peers, peer)
+				}
+			}
+			for _, info := range result.results.Nodes {
+				c, err := info.contact()
+				if err != nil || known[c.ID] {
+					continue
+				}
+				known[c.ID] = true
+				shortlist = append(shortlist, c)
+			}
+		}
+		// drop nodes which did not respond, so that the next closest are queried
+		alive := shortlist[:0]
+		for _, c := range shortlist {
+			if !failed[c.ID] {
+				alive = append(alive, c)
+			}
+		}
+		shortlist = alive
+	}
+
+	sortByDistance(responded, target)
+	if len(responded) > BucketSize {
+		responded = responded[:BucketSize]
+	}
+	return responded, tokens, peers
+}
+
+// query sends a query to addr and waits for its response
+func (d *DHT) query(addr *net.UDPAddr, method string, args *arguments) (*results, error) {
+	txid := make([]byte, 4)
+	binary.BigEndian.PutUint32(txid, atomic.AddUint32(&d.txid, 1))
+	t := string(txid)
+	responseChan := make(chan *message, 1)
+	d.pendingMutex.Lock()
+	d.pending[t] = responseChan
+	d.pendingMutex.Unlock()
+	defer func() {
+		d.pendingMutex.Lock()
+		delete(d.pending, t)
+		d.pendingMutex.Unlock()
+	}()
+
+	a := *args
+	a.ID = string(d.id[:])
+	if err := d.send(&message{T: t, Y: typeQuery, Q: method, A: &a}, addr); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	select {
+	case msg := <-responseChan:
+		if msg.Y == typeError {
+			return nil, errors.New(msg.E)
+		}
+		if msg.R == nil {
+			return nil, ErrBadMessage
+		}
+		id, ok := NodeIDFromBytes([]byte(msg.R.ID))
+		if !ok {
+			return nil, ErrBadMessage
+		}
+		d.seen(id, addr)
+		return msg.R, nil
+	case <-timer.C:
+		return nil, ErrTimeout
+	case <-d.closed:
+		return nil, ErrClosed
+	}
+}
+
+func (d *DHT) send(msg *message, addr *net.UDPAddr) error {
+	content, err := bencode.EncodeBytes(msg)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.WriteToUDP(content, addr)
+	return err
+}
+
+func (d *DHT) readLoop() {
+	buf := make([]byte, maxMessageBytes)
+	for {
+		n, from, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-d.closed:
+				return
+			default:
+				continue
+			}
+		}
+		msg := &message{}
+		if err := bencode.DecodeBytes(buf[:n], msg); err != nil {
+			continue
+		}
+		d.handleMessage(msg, from)
+	}
+}
+
+func (d *DHT) handleMessage(msg *message, from *net.UDPAddr) {
+	switch msg.Y {
+	case typeQuery:
+		r, err := d.handleQuery(msg, from)
+		if err != nil {
+			d.send(&message{T: msg.T, Y: typeError, E: err.Error()}, from)
+			return
+		}
+		d.send(&message{T: msg.T, Y: typeResponse, R: r}, from)
+	case typeResponse, typeError:
+		d.pendingMutex.Lock()
+		responseChan, ok := d.pending[msg.T]
+		d.pendingMutex.Unlock()
+		if ok {
+			select {
+			case responseChan <- msg:
+			default:
+			}
+		}
+	}
+}
+
+func (d *DHT) handleQuery(msg *message, from *net.UDPAddr) (*results, error) {
+	if msg.A == nil {
+		return nil, ErrBadMessage
+	}
+	id, ok := NodeIDFromBytes([]byte(msg.A.ID))
+	if !ok {
+		return nil, ErrBadMessage
+	}
+	d.seen(id, from)
+
+	r := &results{ID: string(d.id[:])}
+	switch msg.Q {
+	case methodPing:
+	case methodFindNode:
+		target, ok := NodeIDFromBytes([]byte(msg.A.Target))
+		if !ok {
+			return nil, ErrBadMessage
+		}
+		r.Nodes = newContactInfos(d.table.closest(target, BucketSize))
+	case methodGetPeers:
+		target, ok := NodeIDFromBytes([]byte(msg.A.InfoHash))
+		if !ok {
+			return nil, ErrBadMessage
+		}
+		r.Token = d.token(from.IP)
+		r.Values = d.getPeers(msg.A.InfoHash)
+		r.Nodes = newContactInfos(d.table.closest(target, BucketSize))
+	case methodAnnouncePeer:
+		if _, ok := NodeIDFromBytes([]byte(msg.A.InfoHash)); !ok {
+			return nil, ErrBadMessage
+		}
+		if msg.A.Port <= 0 || msg.A.Port > 65535 {
+			return nil, ErrBadMessage
+		}
+		if !d.isValidToken(msg.A.Token, from.IP) {
+			return nil, ErrBadToken
+		}
+		if err := d.addPeer(msg.A.InfoHash, net.JoinHostPort(from.IP.String(), strconv.Itoa(msg.A.Port))); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnknownQuery
+	}
+	return r, nil
+}
+
+// seen adds a node which sent a message to the routing table. If its
+// bucket is full, the least recently seen node is pinged and replaced
+// when it does not respond.
+func (d *DHT) seen(id NodeID, addr *net.UDPAddr) {
+	oldest := d.table.seen(id, addr)
+	if oldest == nil {
+		return
+	}
+	go func() {
+		if _, err := d.query(oldest.Addr, methodPing, &arguments{}); err != nil {
+			d.table.failed(oldest.ID)
+		}
+	}()
+}
+
+// addPeer stores a peer announced for infoHash, expired peers make room
+// for it when the store is full
+func (d *DHT) addPeer(infoHash string, addr string) error {
+	d.peersMutex.Lock()
+	defer d.peersMutex.Unlock()
+	swarm, ok := d.peers[infoHash]
+	if !ok {
+		if len(d.peers) >= d.maxSwarms {
+			d.sweep()
+		}
+		if len(d.peers) >= d.maxSwarms {
+			return ErrTooManySwarms
+		}
+		swarm = make(map[string]time.Time)
+		d.peers[infoHash] = swarm
+	}
+	if _, ok := swarm[addr]; !ok && len(swarm) >= d.maxSwarmPeers {
+		d.expire(swarm)
+		if len(swarm) >= d.maxSwarmPeers {
+			return ErrTooManyPeers
+		}
+	}
+	swarm[addr] = time.Now()
+	return nil
+}
+
+// sweepLoop sweeps expired peers and empty swarms every peerTTL, until
+// the DHT is closed. Swarms nobody announces to anymore are only dropped
+// by the sweep.
+func (d *DHT) sweepLoop() {
+	for {
+		d.peersMutex.Lock()
+		ttl := d.peerTTL
+		d.peersMutex.Unlock()
+		select {
+		case <-d.closed:
+			return
+		case <-time.After(ttl):
+			d.SweepPeers()
+		}
+	}
+}
+
+// SweepPeers drops the peers which did not announce for the peer TTL, and
+// the swarms left without peers
+func (d *DHT) SweepPeers() {
+	d.peersMutex.Lock()
+	defer d.peersMutex.Unlock()
+	d.sweep()
+}
+
+func (d *DHT) sweep() {
+	for infoHash, swarm := range d.peers {
+		d.expire(swarm)
+		if len(swarm) == 0 {
+			delete(d.peers, infoHash)
+		}
+	}
+}
+
+// expire drops the peers of swarm which did not announce for peerTTL, the
+// caller holds peersMutex
+func (d *DHT) expire(swarm map[string]time.Time) {
+	for addr, announced := range swarm {
+		if time.Since(announced) > d.peerTTL {
+			delete(swarm, addr)
+		}
+	}
+}
+
+func (d *DHT) getPeers(infoHash string) []string {
+	d.peersMutex.Lock()
+	defer d.peersMutex.Unlock()
+	peers := make([]string, 0)
+	for addr, announced := range d.peers[infoHash] {
+		if time.Since(announced) > d.peerTTL {
+			delete(d.peers[infoHash], addr)
+			continue
+		}
+		if len(peers) < maxPeerValues {
+			peers = append(peers, addr)
+		}
+	}
+	return peers
+}
+
+func (d *DHT) rotateSecret() {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		log.Println(err)
+	}
+	d.prevSecret = d.secret
+	d.secret = secret
+	d.secretTime = time.Now()
+}
+
+// token returns the token an announce_peer from ip must carry
+func (d *DHT) token(ip net.IP) string {
+	d.secretsMutex.Lock()
+	defer d.secretsMutex.Unlock()
+	if time.Since(d.secretTime) > secretRotation {
+		d.rotateSecret()
+	}
+	return tokenOf(d.secret, ip)
+}
+
+func (d *DHT) isValidToken(token string, ip net.IP) bool {
+	d.secretsMutex.Lock()
+	defer d.secretsMutex.Unlock()
+	if token == tokenOf(d.secret, ip) {
+		return true
+	}
+	return d.prevSecret != nil && token == tokenOf(d.prevSecret, ip)
+}
+
+func tokenOf(secret []byte, ip net.IP) string {
+	hash := sha1.Sum(append(append([]byte{}, secret...), ip.To16()...))
+	return string(hash[:8])
+}
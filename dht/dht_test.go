@@ -0,0 +1,177 @@
+package dht_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aecra/PeerCodeX/dht"
+)
+
+// newNetwork starts count nodes on loopback, all bootstrapped through the
+// first one
+func newNetwork(t *testing.T, count int) []*dht.DHT {
+	nodes := make([]*dht.DHT, count)
+	for i := range nodes {
+		d, err := dht.New("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.SetTimeout(500 * time.Millisecond)
+		nodes[i] = d
+	}
+	t.Cleanup(func() {
+		for _, d := range nodes {
+			d.Close()
+		}
+	})
+	for _, d := range nodes[1:] {
+		if err := d.Bootstrap([]string{nodes[0].Addr().String()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return nodes
+}
+
+func TestPing(t *testing.T) {
+	nodes := newNetwork(t, 2)
+	id, err := nodes[1].Ping(nodes[0].Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != nodes[0].ID() {
+		t.Fatalf("expected %s, got %s", nodes[0].ID(), id)
+	}
+	if nodes[0].Size() != 1 || nodes[1].Size() != 1 {
+		t.Fatalf("expected both nodes to know each other, sizes %d and %d", nodes[0].Size(), nodes[1].Size())
+	}
+}
+
+func TestBootstrapWithoutNodes(t *testing.T) {
+	d, err := dht.New("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.SetTimeout(100 * time.Millisecond)
+
+	other, err := dht.New("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := other.Addr().String()
+	other.Close()
+
+	if err := d.Bootstrap([]string{addr}); err != dht.ErrNoNodes {
+		t.Fatalf("expected %v, got %v", dht.ErrNoNodes, err)
+	}
+}
+
+func TestFindNode(t *testing.T) {
+	nodes := newNetwork(t, 20)
+	for _, target := range []*dht.DHT{nodes[3], nodes[11], nodes[19]} {
+		found := false
+		for _, c := range nodes[7].FindNode(target.ID()) {
+			if c.ID == target.ID() {
+				found = true
+			}
+		}
+		if !found && target != nodes[7] {
+			t.Fatalf("node %s not found", target.ID())
+		}
+	}
+}
+
+func TestAnnounceAndGetPeers(t *testing.T) {
+	nodes := newNetwork(t, 20)
+	infoHash := bytes.Repeat([]byte{0x5a}, 20)
+
+	if err := nodes[5].AnnouncePeer(infoHash, 9000); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[13].AnnouncePeer(infoHash, 9001); err != nil {
+		t.Fatal(err)
+	}
+
+	peers, err := nodes[17].GetPeers(infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"127.0.0.1:9000": false, "127.0.0.1:9001": false}
+	for _, peer := range peers {
+		if _, ok := want[peer]; ok {
+			want[peer] = true
+		}
+	}
+	for peer, ok := range want {
+		if !ok {
+			t.Fatalf("peer %s not found in %v", peer, peers)
+		}
+	}
+
+	// another swarm has no peers
+	peers, err = nodes[17].GetPeers(bytes.Repeat([]byte{0xa5}, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 0 {
+		t.Fatalf("expected no peers, got %v", peers)
+	}
+}
+
+func TestPeerLimits(t *testing.T) {
+	nodes := newNetwork(t, 2)
+	nodes[0].SetPeerLimits(1, 1)
+	a := bytes.Repeat([]byte{0x5a}, 20)
+	b := bytes.Repeat([]byte{0xa5}, 20)
+
+	if err := nodes[1].AnnouncePeer(a, 9000); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[1].AnnouncePeer(b, 9000); err != dht.ErrNoNodes {
+		t.Fatalf("expected announce of another infohash to be refused, got %v", err)
+	}
+	if err := nodes[1].AnnouncePeer(a, 9001); err != dht.ErrNoNodes {
+		t.Fatalf("expected announce of another peer to be refused, got %v", err)
+	}
+	if err := nodes[1].AnnouncePeer(a, 9000); err != nil {
+		t.Fatalf("expected stored peer to announce again, got %v", err)
+	}
+	if nodes[0].Swarms() != 1 {
+		t.Fatalf("expected 1 swarm, got %d", nodes[0].Swarms())
+	}
+
+	// expired peers make room for new ones
+	nodes[0].SetPeerTTL(10 * time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if err := nodes[1].AnnouncePeer(b, 9000); err != nil {
+		t.Fatalf("expected expired swarm to be swept, got %v", err)
+	}
+	peers, err := nodes[1].GetPeers(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 0 {
+		t.Fatalf("expected expired peers to be dropped, got %v", peers)
+	}
+}
+
+func TestSweepPeers(t *testing.T) {
+	nodes := newNetwork(t, 2)
+	for i := byte(0); i < 3; i++ {
+		if err := nodes[1].AnnouncePeer(bytes.Repeat([]byte{i}, 20), 9000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if nodes[0].Swarms() != 3 {
+		t.Fatalf("expected 3 swarms, got %d", nodes[0].Swarms())
+	}
+
+	// swarms nobody announces to again are dropped by the sweep alone
+	nodes[0].SetPeerTTL(10 * time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	nodes[0].SweepPeers()
+	if nodes[0].Swarms() != 0 {
+		t.Fatalf("expected expired swarms to be dropped, got %d", nodes[0].Swarms())
+	}
+}
@@ -0,0 +1,81 @@
+package dht
+
+import (
+	"errors"
+	"net"
+)
+
+// Messages are bencoded dictionaries in the spirit of the BitTorrent DHT.
+// A query has y = "q", the method in q and arguments in a. A response
+// has y = "r" and results in r, an error has y = "e" and the reason in e.
+// The transaction ID t of a query is echoed by its response.
+const (
+	typeQuery    = "q"
+	typeResponse = "r"
+	typeError    = "e"
+
+	methodPing         = "ping"
+	methodFindNode     = "find_node"
+	methodGetPeers     = "get_peers"
+	methodAnnouncePeer = "announce_peer"
+)
+
+type message struct {
+	T string     `bencode:"t"`
+	Y string     `bencode:"y"`
+	Q string     `bencode:"q,omitempty"`
+	A *arguments `bencode:"a,omitempty"`
+	R *results   `bencode:"r,omitempty"`
+	E string     `bencode:"e,omitempty"`
+}
+
+type arguments struct {
+	ID       string `bencode:"id"`
+	Target   string `bencode:"target,omitempty"`
+	InfoHash string `bencode:"info_hash,omitempty"`
+	Port     int    `bencode:"port,omitempty"`
+	Token    string `bencode:"token,omitempty"`
+}
+
+type results struct {
+	ID     string        `bencode:"id"`
+	Nodes  []contactInfo `bencode:"nodes,omitempty"`
+	Values []string      `bencode:"values,omitempty"` // peers as host:port
+	Token  string        `bencode:"token,omitempty"`
+}
+
+type contactInfo struct {
+	ID   string `bencode:"id"`
+	Addr string `bencode:"addr"`
+}
+
+var (
+	ErrTimeout       = errors.New("query timed out")
+	ErrClosed        = errors.New("dht is closed")
+	ErrBadMessage    = errors.New("malformed message")
+	ErrBadToken      = errors.New("invalid token")
+	ErrNoNodes       = errors.New("no reachable nodes")
+	ErrUnknownQuery  = errors.New("unknown query")
+	ErrTooManySwarms = errors.New("too many infohashes, no new one is stored")
+	ErrTooManyPeers  = errors.New("too many peers of the infohash, no new one is stored")
+)
+
+func newContactInfos(contacts []*Contact) []contactInfo {
+	infos := make([]contactInfo, len(contacts))
+	for i, c := range contacts {
+		infos[i] = contactInfo{ID: string(c.ID[:]), Addr: c.Addr.String()}
+	}
+	return infos
+}
+
+func (c contactInfo) contact() (*Contact, error) {
+	id, ok := NodeIDFromBytes([]byte(c.ID))
+	if !ok {
+		return nil, ErrBadMessage
+	}
+	addr, err := net.ResolveUDPAddr("udp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Contact{ID: id, Addr: addr}, nil
+}
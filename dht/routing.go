@@ -0,0 +1,176 @@
+package dht
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"math/bits"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	IDLength   = 20 // same length as an infohash
+	BucketSize = 8  // k, contacts per bucket
+)
+
+type NodeID [IDLength]byte
+
+func NewRandomNodeID() NodeID {
+	id := NodeID{}
+	rand.Read(id[:])
+	return id
+}
+
+// NodeIDFromBytes returns the ID made of b, which is an infohash or the
+// raw ID of a message
+func NodeIDFromBytes(b []byte) (NodeID, bool) {
+	id := NodeID{}
+	if len(b) != IDLength {
+		return id, false
+	}
+	copy(id[:], b)
+	return id, true
+}
+
+func (id NodeID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// distance returns the XOR distance of two IDs
+func (id NodeID) distance(other NodeID) NodeID {
+	d := NodeID{}
+	for i := range id {
+		d[i] = id[i] ^ other[i]
+	}
+	return d
+}
+
+// prefixLen returns the number of leading zero bits
+func (id NodeID) prefixLen() int {
+	for i, b := range id {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return IDLength * 8
+}
+
+// Contact is a node of the DHT
+type Contact struct {
+	ID       NodeID
+	Addr     *net.UDPAddr
+	lastSeen time.Time
+	failures int // queries without response in a row
+}
+
+// sortByDistance sorts contacts by their distance to target, closest first
+func sortByDistance(contacts []*Contact, target NodeID) {
+	sort.Slice(contacts, func(i, j int) bool {
+		di := contacts[i].ID.distance(target)
+		dj := contacts[j].ID.distance(target)
+		return bytes.Compare(di[:], dj[:]) < 0
+	})
+}
+
+// routingTable keeps at most BucketSize contacts for every prefix length
+// of the distance to the own ID. Contacts of a bucket are ordered by the
+// time they were last seen, least recently seen first.
+type routingTable struct {
+	self    NodeID
+	buckets [IDLength*8 + 1][]*Contact
+	mutex   sync.RWMutex
+}
+
+func newRoutingTable(self NodeID) *routingTable {
+	return &routingTable{self: self}
+}
+
+func (t *routingTable) bucketIndex(id NodeID) int {
+	return t.self.distance(id).prefixLen()
+}
+
+// seen records a contact which sent a message. If its bucket is full, a
+// contact which failed to respond is replaced, otherwise the new contact is
+// dropped. It returns the least recently seen contact of a full bucket, so
+// that the caller can check it is still alive.
+func (t *routingTable) seen(id NodeID, addr *net.UDPAddr) *Contact {
+	if id == t.self {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	i := t.bucketIndex(id)
+	bucket := t.buckets[i]
+	for j, c := range bucket {
+		if c.ID == id {
+			c.Addr = addr
+			c.lastSeen = time.Now()
+			c.failures = 0
+			t.buckets[i] = append(append(bucket[:j:j], bucket[j+1:]...), c)
+			return nil
+		}
+	}
+
+	contact := &Contact{ID: id, Addr: addr, lastSeen: time.Now()}
+	if len(bucket) < BucketSize {
+		t.buckets[i] = append(bucket, contact)
+		return nil
+	}
+	for j, c := range bucket {
+		if c.failures > 0 {
+			t.buckets[i] = append(append(bucket[:j:j], bucket[j+1:]...), contact)
+			return nil
+		}
+	}
+	oldest := *bucket[0]
+	return &oldest
+}
+
+// failed records a contact which did not respond to a query
+func (t *routingTable) failed(id NodeID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	i := t.bucketIndex(id)
+	for j, c := range t.buckets[i] {
+		if c.ID == id {
+			c.failures++
+			// remove contacts which keep failing
+			if c.failures >= 3 {
+				t.buckets[i] = append(t.buckets[i][:j:j], t.buckets[i][j+1:]...)
+			}
+			return
+		}
+	}
+}
+
+// closest returns at most count contacts closest to target
+func (t *routingTable) closest(target NodeID, count int) []*Contact {
+	t.mutex.RLock()
+	contacts := make([]*Contact, 0)
+	for _, bucket := range t.buckets {
+		for _, c := range bucket {
+			copied := *c
+			contacts = append(contacts, &copied)
+		}
+	}
+	t.mutex.RUnlock()
+
+	sortByDistance(contacts, target)
+	if len(contacts) > count {
+		contacts = contacts[:count]
+	}
+	return contacts
+}
+
+func (t *routingTable) size() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	n := 0
+	for _, bucket := range t.buckets {
+		n += len(bucket)
+	}
+	return n
+}
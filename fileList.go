@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +31,12 @@ func makeNewSeedButton() *widget.Button {
 		commentWidget := widget.NewEntry()
 		announceWidget := widget.NewEntry()
 		announceListWidget := widget.NewMultiLineEntry()
+		generationLengthWidget := widget.NewEntry()
+		generationLengthWidget.SetText("128MB")
+		pieceLengthWidget := widget.NewEntry()
+		pieceLengthWidget.SetText("1MB")
+		sparsityWidget := widget.NewEntry()
+		sparsityWidget.SetText(strconv.FormatFloat(seed.DefaultSparsity, 'f', -1, 64))
 		items := []*widget.FormItem{
 			widget.NewFormItem("File", widget.NewButton("Select File", func() {
 				fd := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
@@ -48,9 +55,29 @@ func makeNewSeedButton() *widget.Button {
 
 				fd.Show()
 			})),
+			widget.NewFormItem("Folder", widget.NewButton("Select Folder", func() {
+				fd := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
+					if err != nil {
+						dialog.ShowError(err, topWindow)
+						return
+					}
+					if uri == nil {
+						log.Println("Cancelled")
+						return
+					}
+
+					log.Println(uri.Path())
+					filePath = uri.Path()
+				}, topWindow)
+
+				fd.Show()
+			})),
 			widget.NewFormItem("Comment", commentWidget),
 			widget.NewFormItem("Announce", announceWidget),
 			widget.NewFormItem("Announce List", announceListWidget),
+			widget.NewFormItem("Generation Length", generationLengthWidget),
+			widget.NewFormItem("Piece Length", pieceLengthWidget),
+			widget.NewFormItem("Sparsity", sparsityWidget),
 		}
 		formDialog := dialog.NewForm("Create New Seed File", "Create", "Cancel", items, func(b bool) {
 			if !b {
@@ -65,10 +92,25 @@ func makeNewSeedButton() *widget.Button {
 				for i, v := range v1 {
 					v1[i] = strings.TrimSpace(v)
 				}
-				announceList = strings.Join(v1, ",")
+				// every line is a tier of comma separated nodes
+				announceList = strings.Join(v1, ";")
+			}
+			options := seed.DefaultOptions()
+			var err error
+			if options.GenerationLength, err = tools.ParseByteSize(generationLengthWidget.Text); err != nil {
+				dialog.ShowError(err, topWindow)
+				return
+			}
+			if options.PieceLength, err = tools.ParseByteSize(pieceLengthWidget.Text); err != nil {
+				dialog.ShowError(err, topWindow)
+				return
+			}
+			if options.Sparsity, err = strconv.ParseFloat(sparsityWidget.Text, 64); err != nil {
+				dialog.ShowError(err, topWindow)
+				return
 			}
 			openLoadingMask()
-			err := seed.CreateSeedFile(filePath, comment, announce, announceList)
+			err = seed.CreateSeedFileWithOptions(filePath, comment, announce, announceList, options)
 			closeLoadingMask()
 			if err != nil {
 				dialog.ShowError(err, topWindow)
@@ -77,7 +119,7 @@ func makeNewSeedButton() *widget.Button {
 				dialog.ShowInformation("Create New Seed File", "Create New Seed File Success", topWindow)
 			}
 		}, topWindow)
-		formDialog.Resize(fyne.NewSize(500, 350))
+		formDialog.Resize(fyne.NewSize(500, 450))
 		formDialog.Show()
 	})
 }
@@ -134,13 +176,20 @@ func makeFileListItem(parent *widget.List) *fyne.Container {
 		items := []*widget.FormItem{
 			widget.NewFormItem("Name", widget.NewLabel(filepath.Base(f.Path))),
 			widget.NewFormItem("Path", widget.NewLabel(f.Path)),
+			widget.NewFormItem("Infohash", widget.NewLabel(fmt.Sprintf("%x", f.InfoHash))),
 			widget.NewFormItem("SHA1 Hash", widget.NewLabel(hashs)),
 			widget.NewFormItem("Comment", widget.NewLabel(f.NcFile.Comment)),
 			widget.NewFormItem("Creation Date", widget.NewLabel(f.NcFile.CreationDate.String())),
 			widget.NewFormItem("Announce", widget.NewLabel(f.NcFile.Announce)),
-			widget.NewFormItem("Announce List", widget.NewLabel(strings.Join(f.NcFile.AnnounceList, "\n"))),
+			widget.NewFormItem("Announce List", widget.NewLabel(strings.ReplaceAll(f.NcFile.AnnounceList.String(), ";", "\n"))),
 			widget.NewFormItem("Length", widget.NewLabel(tools.FormatByteSize(f.NcFile.Info.Length))),
 		}
+		if f.NcFile.IsDir() {
+			items = append(items, widget.NewFormItem("Files", widget.NewLabel(fmt.Sprint(len(f.NcFile.Info.Files)))))
+		}
+		if failures := f.GetHashFailures(); failures > 0 {
+			items = append(items, widget.NewFormItem("Hash Failures", widget.NewLabel(fmt.Sprintf("%d, corrupted generations are decoded again", failures))))
+		}
 		form := &widget.Form{Items: items}
 		formDialog := dialog.NewCustom("File Info", "OK", form, topWindow)
 		formDialog.Show()
@@ -27,7 +27,6 @@ require (
 	golang.org/x/image v0.10.0 // indirect
 	golang.org/x/mobile v0.0.0-20211207041440-4e6c2922fdee // indirect
 	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	honnef.co/go/js/dom v0.0.0-20210725211120-f030747120f2 // indirect
@@ -36,4 +35,5 @@ require (
 require (
 	fyne.io/fyne/v2 v2.3.3
 	github.com/zeebo/bencode v1.0.0
+	golang.org/x/sys v0.13.0
 )
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"log"
+	"os"
+	"path/filepath"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/aecra/PeerCodeX/client"
 	"github.com/aecra/PeerCodeX/data"
+	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/protocol"
 )
 
 var topWindow fyne.Window
@@ -66,7 +73,41 @@ func main() {
 	// set the minimum window size
 	w.Resize(fyne.NewSize(800, 600))
 
+	restoreSession()
 	w.ShowAndRun()
+	if err := dc.SaveState(); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resume seeds and partial downloads of the previous session
+func restoreSession() {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := dc.SetStateDir(filepath.Join(dir, "PeerCodeX")); err != nil {
+		log.Println(err)
+		return
+	}
+	if identity, err := dc.LoadIdentity(); err == nil {
+		dc.SetSecurity(&protocol.Security{Encryption: dc.GetSecurity().Encryption, Identity: identity})
+	} else {
+		log.Println(err)
+	}
+	if err := dc.LoadRateLimits(); err != nil {
+		log.Println(err)
+	}
+	reloadSettings()
+	downloading, err := dc.LoadState()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, file := range downloading {
+		client.RequestForFile(file)
+	}
 }
 
 // Open the masklayer
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -15,6 +17,8 @@ import (
 	"github.com/aecra/PeerCodeX/client"
 	"github.com/aecra/PeerCodeX/data"
 	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/protocol"
+	"github.com/aecra/PeerCodeX/ratelimit"
 	"github.com/aecra/PeerCodeX/server"
 )
 
@@ -88,10 +92,12 @@ func makeServiceStatusContent() fyne.CanvasObject {
 	p2 := widget.NewForm(
 		widget.NewFormItem("Service Host", widget.NewEntry()),
 		widget.NewFormItem("Service Port", widget.NewEntry()),
+		widget.NewFormItem("Encryption", widget.NewSelect([]string{"off", "on", "require"}, nil)),
 	)
 	// set default value
 	p2.Items[0].Widget.(*widget.Entry).SetText("0.0.0.0")
 	p2.Items[1].Widget.(*widget.Entry).SetText("8080")
+	p2.Items[2].Widget.(*widget.Select).SetSelected(dc.GetSecurity().Encryption.String())
 
 	defer func() {
 		// if panic occurs, show a dialog
@@ -101,6 +107,11 @@ func makeServiceStatusContent() fyne.CanvasObject {
 		}
 	}()
 
+	// peers pin this node by its identity key, which is loaded with the
+	// session and shown once the service is started
+	identity := widget.NewLabel("")
+	identity.Wrapping = fyne.TextWrapBreak
+
 	// p3 is a button with primary color
 	var p3 *widget.Button
 	p3 = &widget.Button{
@@ -112,6 +123,7 @@ func makeServiceStatusContent() fyne.CanvasObject {
 					return
 				}
 				serverInstance.Stop()
+				client.StopDHT()
 				status = false
 				statusIcon.Resource = data.StatusOff
 				p3.Text = "Start Service"
@@ -126,6 +138,12 @@ func makeServiceStatusContent() fyne.CanvasObject {
 				serverInstance.SetPort(port)
 				dc.SetHost(host)
 				dc.SetPort(port)
+				if encryption, err := protocol.ParseEncryption(p2.Items[2].Widget.(*widget.Select).Selected); err == nil {
+					security := *dc.GetSecurity()
+					security.Encryption = encryption
+					dc.SetSecurity(&security)
+				}
+				identity.SetText("Identity: " + hex.EncodeToString(dc.GetSecurity().Identity.PublicKey()))
 
 				panicChan := make(chan error)
 				go serverInstance.Start(panicChan)
@@ -147,6 +165,9 @@ func makeServiceStatusContent() fyne.CanvasObject {
 				}()
 				time.Sleep(50 * time.Millisecond)
 				if serverInstance.IsRunning() {
+					if err := client.StartDHT(host, port, nil); err != nil {
+						log.Println(err)
+					}
 					status = true
 					statusIcon.Resource = data.StatusOn
 					p3.Text = "Stop Service"
@@ -162,7 +183,7 @@ func makeServiceStatusContent() fyne.CanvasObject {
 	intro.Wrapping = fyne.TextWrapWord
 
 	ServiceStatusPage = container.NewBorder(
-		container.NewVBox(title, widget.NewSeparator(), p1, p2, p3, intro), nil, nil, nil, nil)
+		container.NewVBox(title, widget.NewSeparator(), p1, p2, p3, intro, identity), nil, nil, nil, nil)
 	return ServiceStatusPage
 }
 
@@ -190,6 +211,12 @@ func makeFileListContent() fyne.CanvasObject {
 			downloadedTextLabel := item.(*fyne.Container).Objects[1].(*fyne.Container).Objects[2].(*widget.Label)
 			if f.GetProcessRate() == 1 {
 				progressBar.SetValue(1)
+				downloadedTextLabel.SetText("(Downloaded)")
+				downloadedTextLabel.Show()
+			} else if failures := f.GetHashFailures(); failures > 0 {
+				// generations which decoded to a wrong hash are decoded again
+				progressBar.SetValue(f.GetProcessRate())
+				downloadedTextLabel.SetText(fmt.Sprintf("(%d hash failures)", failures))
 				downloadedTextLabel.Show()
 			} else {
 				progressBar.SetValue(f.GetProcessRate())
@@ -221,21 +248,39 @@ func makeNodeListContent() fyne.CanvasObject {
 			return len(dc.GetNodeStatusList())
 		},
 		func() fyne.CanvasObject {
-			// address, status Icon, refresh button, delete button
+			// address, peer id, reputation, status Icon, refresh button,
+			// ban button, delete button
 			statusIcon := canvas.NewImageFromResource(data.StatusOff)
 			statusIcon.FillMode = canvas.ImageFillContain
 			statusIcon.SetMinSize(fyne.NewSize(16, 16))
 			address := widget.NewLabel("")
+			peerID := widget.NewLabel("")
+			reputation := widget.NewLabel("")
 			return container.NewBorder(
 				nil,
 				nil,
-				container.NewHBox(widget.NewLabel(" "), statusIcon, address),
+				container.NewHBox(widget.NewLabel(" "), statusIcon, address, peerID, reputation),
 				container.NewHBox(widget.NewToolbar(
 					widget.NewToolbarSpacer(),
 					widget.NewToolbarAction(theme.ViewRefreshIcon(), func() {
 						client.CkeckServerStatus(address.Text)
 						nodeListWidget.Refresh()
 					}),
+					widget.NewToolbarAction(theme.ErrorIcon(), func() {
+						// bans the node, or lifts its ban
+						for _, node := range dc.GetNodeStatusList() {
+							if node.Addr != address.Text {
+								continue
+							}
+							if node.IsBanned() {
+								dc.Unban(node.ID, node.Addr)
+							} else {
+								dc.Ban(node.ID, node.Addr, "banned by hand")
+							}
+							break
+						}
+						nodeListWidget.Refresh()
+					}),
 					widget.NewToolbarAction(theme.DeleteIcon(), func() {
 						dc.DeleteNode(address.Text)
 						nodeListWidget.Refresh()
@@ -246,6 +291,21 @@ func makeNodeListContent() fyne.CanvasObject {
 		func(id widget.ListItemID, item fyne.CanvasObject) {
 			// add data to the widget
 			item.(*fyne.Container).Objects[0].(*fyne.Container).Objects[2].(*widget.Label).SetText(dc.GetNodeStatusList()[id].Addr)
+			node := dc.GetNodeStatusList()[id]
+			reputation := node.Reputation()
+			if reputation.Banned {
+				item.(*fyne.Container).Objects[0].(*fyne.Container).Objects[4].(*widget.Label).SetText("banned: " + reputation.BanReason)
+			} else {
+				item.(*fyne.Container).Objects[0].(*fyne.Container).Objects[4].(*widget.Label).SetText(fmt.Sprintf(
+					"score %.2f, %d/%d innovative, %d errors, %d timeouts", reputation.Score(), reputation.Innovative,
+					reputation.Innovative+reputation.NonInnovative, reputation.ProtocolErrors, reputation.Timeouts))
+			}
+			// nodes only added by address have not proven an identity yet
+			if peer := node.ID; peer.IsZero() {
+				item.(*fyne.Container).Objects[0].(*fyne.Container).Objects[3].(*widget.Label).SetText("unverified")
+			} else {
+				item.(*fyne.Container).Objects[0].(*fyne.Container).Objects[3].(*widget.Label).SetText(peer.String()[:16])
+			}
 			if dc.GetNodeStatusList()[id].IsOn {
 				item.(*fyne.Container).Objects[0].(*fyne.Container).Objects[1].(*canvas.Image).Resource = data.StatusOn
 			} else {
@@ -298,8 +358,79 @@ func makeNodeListContent() fyne.CanvasObject {
 		container.NewMax(nodeListWidget))
 }
 
+// reloadSettings shows the settings in effect, they change once the
+// previous session is restored
+var reloadSettings = func() {}
+
 func makeSettingContent() fyne.CanvasObject {
-	return nil
+	title := widget.NewLabel("Settings")
+	intro := widget.NewLabel("Bandwidth limits like 5MB/s, 0 is unlimited. Schedules set the limits of all connections by time, e.g. \"1MB/s 09:00-17:00 mon-fri; 0 00:00-24:00 sat,sun\".")
+	intro.Wrapping = fyne.TextWrapWord
+
+	rates := make([]*widget.Entry, 6)
+	for i := range rates {
+		rates[i] = widget.NewEntry()
+	}
+	uploadSchedule := widget.NewEntry()
+	downloadSchedule := widget.NewEntry()
+	form := widget.NewForm(
+		widget.NewFormItem("Upload Limit", rates[0]),
+		widget.NewFormItem("Download Limit", rates[1]),
+		widget.NewFormItem("Peer Upload Limit", rates[2]),
+		widget.NewFormItem("Peer Download Limit", rates[3]),
+		widget.NewFormItem("File Upload Limit", rates[4]),
+		widget.NewFormItem("File Download Limit", rates[5]),
+		widget.NewFormItem("Upload Schedule", uploadSchedule),
+		widget.NewFormItem("Download Schedule", downloadSchedule),
+	)
+
+	reloadSettings = func() {
+		limits := dc.GetRateLimits()
+		for i, rate := range []int64{limits.Upload, limits.Download, limits.PeerUpload, limits.PeerDownload, limits.FileUpload, limits.FileDownload} {
+			rates[i].SetText(ratelimit.FormatRate(rate))
+		}
+		uploadSchedule.SetText(limits.UploadSchedule)
+		downloadSchedule.SetText(limits.DownloadSchedule)
+	}
+	reloadSettings()
+
+	form.SubmitText = "Apply"
+	form.OnSubmit = func() {
+		values := make([]int64, len(rates))
+		for i, entry := range rates {
+			rate, err := ratelimit.ParseRate(entry.Text)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("%s: %w", form.Items[i].Text, err), topWindow)
+				return
+			}
+			values[i] = rate
+		}
+		limits := dc.RateLimits{
+			Upload:           values[0],
+			Download:         values[1],
+			PeerUpload:       values[2],
+			PeerDownload:     values[3],
+			FileUpload:       values[4],
+			FileDownload:     values[5],
+			UploadSchedule:   uploadSchedule.Text,
+			DownloadSchedule: downloadSchedule.Text,
+		}
+		if err := dc.SetRateLimits(limits); err != nil {
+			dialog.ShowError(err, topWindow)
+			return
+		}
+		if err := dc.SaveRateLimits(); err != nil {
+			dialog.ShowError(err, topWindow)
+		}
+	}
+	form.CancelText = "Revert"
+	form.OnCancel = func() {
+		reloadSettings()
+	}
+
+	return container.NewBorder(
+		container.NewVBox(title, widget.NewSeparator(), intro), nil, nil, nil,
+		container.NewVScroll(form))
 }
 
 func makeAboutContent() fyne.CanvasObject {
@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+// The handshake opens every connection, the client sends its handshake
+// first and the server answers with its own:
+//
+//	[pstrlen = 14]["Network Coding"][reserved 8][infohash 20][port 2]
+//
+// reserved[0] is the protocol version, reserved[2] the ID of the field
+// the swarm is coded over, the remaining reserved bytes are feature flags.
+// The server answers with a zero infohash if it does not serve the swarm.
+// Port is the service port of the sender.
+//
+// Handshakes are exchanged twice, first to negotiate the transport (see
+// Negotiate) and then for the swarm over the negotiated transport.
+const (
+	protocolName  = "Network Coding"
+	HandshakeSize = 1 + len(protocolName) + 8 + 20 + 2
+)
+
+// HandshakeTimeout bounds negotiating the transport along with the
+// handshakes for the swarm
+const HandshakeTimeout = 10 * time.Second
+
+var (
+	ErrBadProtocolName = errors.New("protocolName is not Network Coding")
+	ErrBadVersion      = errors.New("unsupported protocol version")
+	ErrFieldMismatch   = errors.New("swarm is coded over another field by the peer")
+)
+
+type Handshake struct {
+	Reserved [8]byte
+	InfoHash [20]byte
+	Port     uint16
+}
+
+func NewHandshake(infoHash []byte, port uint16) *Handshake {
+	h := &Handshake{Port: port}
+	h.Reserved[0] = Version
+	copy(h.InfoHash[:], infoHash)
+	return h
+}
+
+func (h *Handshake) Version() byte {
+	return h.Reserved[0]
+}
+
+// Field returns the ID of the field the sender codes the swarm over, zero
+// in handshakes negotiating the transport and answers for unknown swarms
+func (h *Handshake) Field() galoisfield.ID {
+	return galoisfield.ID(h.Reserved[2])
+}
+
+func (h *Handshake) SetField(id galoisfield.ID) {
+	h.Reserved[2] = byte(id)
+}
+
+func (h *Handshake) Bytes() []byte {
+	buf := make([]byte, HandshakeSize)
+	buf[0] = byte(len(protocolName))
+	copy(buf[1:15], protocolName)
+	copy(buf[15:23], h.Reserved[:])
+	copy(buf[23:43], h.InfoHash[:])
+	binary.BigEndian.PutUint16(buf[43:45], h.Port)
+	return buf
+}
+
+func WriteHandshake(w io.Writer, h *Handshake) error {
+	_, err := w.Write(h.Bytes())
+	return err
+}
+
+// ReadHandshake reads a handshake and checks the protocol name and version
+func ReadHandshake(r io.Reader) (*Handshake, error) {
+	buf := make([]byte, HandshakeSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if buf[0] != byte(len(protocolName)) || string(buf[1:15]) != protocolName {
+		return nil, ErrBadProtocolName
+	}
+	h := &Handshake{Port: binary.BigEndian.Uint16(buf[43:45])}
+	copy(h.Reserved[:], buf[15:23])
+	copy(h.InfoHash[:], buf[23:43])
+	if h.Version() != Version {
+		return h, ErrBadVersion
+	}
+	return h, nil
+}
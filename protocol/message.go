@@ -0,0 +1,372 @@
+// Package protocol implements the wire protocol between peers. After the
+// handshake, both sides exchange framed messages:
+//
+//	[version 1][type 1][length 4][payload]
+//
+// so that a single connection carries requests and pieces of several
+// generations along with control messages.
+//
+// Pieces flow under credit granted by the receiver. A request carries no
+// credit, the receiver grants credit as its decoder still needs pieces and
+// reports its rank, so the sender never codes pieces nobody can use. The
+// receiver also sends the subspace its decoder spans, so that every piece
+// the sender codes is innovative for it.
+//
+// A receiver asks one node holding a generation for the homomorphic hashes
+// of its source pieces under a key of its own, against which it checks the
+// pieces of every other sender. The key is never sent to them, so they
+// cannot craft polluted pieces passing the check.
+//
+// A sender serves a limited number of receivers at once and chokes the
+// others, which void the credit they granted it until it unchokes them.
+// A node at its connection limits answers the handshake with a busy
+// message instead of its identity and closes the connection.
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+)
+
+const (
+	Version        = 0x09
+	headerSize     = 6
+	MaxPayloadSize = 1 << 28
+	// MaxControlPayloadSize bounds the payload of every message but pieces
+	// and subspaces, and of those too until the connection sets a limit
+	// from the file, so that an unauthenticated peer never makes us
+	// allocate more than this
+	MaxControlPayloadSize = 64 << 10
+)
+
+type MessageType byte
+
+const (
+	MsgKeepAlive         MessageType = 0x00 // empty, answered by a keepalive
+	MsgHaveGeneration    MessageType = 0x01 // [index 4], sender can serve the generation
+	MsgRequestGeneration MessageType = 0x02 // [index 4], pieces of the generation are wanted, sent against credit
+	MsgPiece             MessageType = 0x03 // [index 4][vector encoding 1][vector length 4][vector][piece], see coder.VectorEncoding
+	MsgRankUpdate        MessageType = 0x04 // [index 4][rank 4], rank of the decoder of the receiver
+	MsgStop              MessageType = 0x05 // [index 4], stop sending pieces of the generation
+	MsgError             MessageType = 0x06 // [reason], sender closes the connection after it
+	MsgGetNeighbours     MessageType = 0x07 // empty
+	MsgNeighbours        MessageType = 0x08 // [comma separated addresses]
+	MsgCredit            MessageType = 0x09 // [index 4][credit 4], sender may send credit more pieces of the generation
+	MsgSubspace          MessageType = 0x0a // [index 4][subspace], span of the decoder of the receiver
+	MsgIdentity          MessageType = 0x0b // [public key 32][signature 64], follows the handshake
+	MsgChoke             MessageType = 0x0c // empty, sender sends no pieces until it unchokes, credit granted to it is void
+	MsgUnchoke           MessageType = 0x0d // empty, sender sends pieces against credit again
+	MsgBusy              MessageType = 0x0e // [reason], sent in place of the identity, sender closes the connection after it
+	MsgRequestChecks     MessageType = 0x0f // [index 4][key], hashes of the source pieces under key are wanted
+	MsgChecks            MessageType = 0x10 // [index 4][hash]..., one per source piece, none if the generation is not held
+)
+
+var (
+	ErrPayloadTooLarge = errors.New("payload is too large")
+	ErrBadPayload      = errors.New("malformed payload")
+	ErrUnexpected      = errors.New("unexpected message")
+	ErrBusy            = errors.New("peer is busy")
+)
+
+// IsProtocolError reports whether err is a violation of the protocol by
+// the peer, rather than a failure of the connection
+func IsProtocolError(err error) bool {
+	for _, target := range []error{
+		ErrBadProtocolName, ErrBadVersion, ErrPayloadTooLarge, ErrBadPayload,
+		ErrUnexpected, ErrBadSignature, ErrPinMismatch, ErrFieldMismatch,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+type Message struct {
+	Type    MessageType
+	Payload []byte
+}
+
+// PayloadLimit returns the largest payload of a piece, a subspace or the
+// checks of a generation of pieceCount pieces of pieceLength bytes over
+// field
+func PayloadLimit(field galoisfield.Field, pieceCount uint, pieceLength uint) int {
+	symbol := uint64(field.SymbolSize())
+	n := uint64(pieceCount)
+	// sparse vector holding every symbol is the longest encoding
+	piece := 9 + 8 + n*(4+symbol) + uint64(pieceLength)
+	// rank*(n-rank) free symbols is largest at half rank
+	subspace := 4 + 8 + 4*n + n*n/4*symbol
+	checks := 4 + n*coder.HashLength
+	limit := piece
+	if subspace > limit {
+		limit = subspace
+	}
+	if checks > limit {
+		limit = checks
+	}
+	if limit > MaxPayloadSize {
+		return MaxPayloadSize
+	}
+	return int(limit)
+}
+
+// ReadMessage reads a message whose payload is at most
+// MaxControlPayloadSize long
+func ReadMessage(r io.Reader) (*Message, error) {
+	return readMessage(r, MaxControlPayloadSize)
+}
+
+// readMessage reads a message, a piece, a subspace or checks may be up to
+// limit long
+func readMessage(r io.Reader, limit int) (*Message, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != Version {
+		return nil, ErrBadVersion
+	}
+	t := MessageType(header[1])
+	if t != MsgPiece && t != MsgSubspace && t != MsgChecks || limit < MaxControlPayloadSize {
+		limit = MaxControlPayloadSize
+	}
+	length := binary.BigEndian.Uint32(header[2:6])
+	if uint64(length) > uint64(limit) {
+		return nil, ErrPayloadTooLarge
+	}
+	m := &Message{Type: t, Payload: make([]byte, length)}
+	if _, err := io.ReadFull(r, m.Payload); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func WriteMessage(w io.Writer, m *Message) error {
+	if len(m.Payload) > MaxPayloadSize {
+		return ErrPayloadTooLarge
+	}
+	buf := make([]byte, headerSize+len(m.Payload))
+	buf[0] = Version
+	buf[1] = byte(m.Type)
+	binary.BigEndian.PutUint32(buf[2:6], uint32(len(m.Payload)))
+	copy(buf[headerSize:], m.Payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// Conn is a connection whose messages may be written from several
+// goroutines
+type Conn struct {
+	net.Conn
+	writeMutex sync.Mutex
+	maxPayload int
+}
+
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{Conn: conn, maxPayload: MaxControlPayloadSize}
+}
+
+// SetMaxPayloadSize lets pieces, subspaces and checks read from the
+// connection be up to size long, as given by PayloadLimit for the file
+// once the handshake has named it
+func (c *Conn) SetMaxPayloadSize(size int) {
+	c.maxPayload = size
+}
+
+func (c *Conn) ReadMessage() (*Message, error) {
+	return readMessage(c.Conn, c.maxPayload)
+}
+
+func (c *Conn) WriteMessage(m *Message) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return WriteMessage(c.Conn, m)
+}
+
+func indexMessage(t MessageType, index uint32) *Message {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, index)
+	return &Message{Type: t, Payload: payload}
+}
+
+func NewKeepAlive() *Message {
+	return &Message{Type: MsgKeepAlive}
+}
+
+func NewHaveGeneration(index uint32) *Message {
+	return indexMessage(MsgHaveGeneration, index)
+}
+
+func NewRequestGeneration(index uint32) *Message {
+	return indexMessage(MsgRequestGeneration, index)
+}
+
+func NewStop(index uint32) *Message {
+	return indexMessage(MsgStop, index)
+}
+
+func NewRankUpdate(index uint32, rank uint32) *Message {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint32(payload[0:4], index)
+	binary.BigEndian.PutUint32(payload[4:8], rank)
+	return &Message{Type: MsgRankUpdate, Payload: payload}
+}
+
+func NewCredit(index uint32, credit uint32) *Message {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint32(payload[0:4], index)
+	binary.BigEndian.PutUint32(payload[4:8], credit)
+	return &Message{Type: MsgCredit, Payload: payload}
+}
+
+func NewSubspace(index uint32, subspace *coder.Subspace) *Message {
+	data := subspace.Bytes()
+	payload := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(payload[0:4], index)
+	copy(payload[4:], data)
+	return &Message{Type: MsgSubspace, Payload: payload}
+}
+
+// NewPiece sends the coding vector in the encoding chosen by the encoder
+// of the piece
+func NewPiece(index uint32, codedPiece *coder.CodedPiece, field galoisfield.Field) *Message {
+	vector := codedPiece.EncodedVector(field)
+	payload := make([]byte, 9+len(vector)+len(codedPiece.Piece))
+	binary.BigEndian.PutUint32(payload[0:4], index)
+	payload[4] = byte(codedPiece.Encoding)
+	binary.BigEndian.PutUint32(payload[5:9], uint32(len(vector)))
+	copy(payload[9:], vector)
+	copy(payload[9+len(vector):], codedPiece.Piece)
+	return &Message{Type: MsgPiece, Payload: payload}
+}
+
+func NewRequestChecks(index uint32, key []byte) *Message {
+	payload := make([]byte, 4+len(key))
+	binary.BigEndian.PutUint32(payload[0:4], index)
+	copy(payload[4:], key)
+	return &Message{Type: MsgRequestChecks, Payload: payload}
+}
+
+// NewChecks sends the hashes of the source pieces one after another, nil
+// if the generation is not held
+func NewChecks(index uint32, hashes []byte) *Message {
+	payload := make([]byte, 4+len(hashes))
+	binary.BigEndian.PutUint32(payload[0:4], index)
+	copy(payload[4:], hashes)
+	return &Message{Type: MsgChecks, Payload: payload}
+}
+
+func NewError(reason string) *Message {
+	return &Message{Type: MsgError, Payload: []byte(reason)}
+}
+
+func NewChoke() *Message {
+	return &Message{Type: MsgChoke}
+}
+
+func NewUnchoke() *Message {
+	return &Message{Type: MsgUnchoke}
+}
+
+func NewBusy(reason string) *Message {
+	return &Message{Type: MsgBusy, Payload: []byte(reason)}
+}
+
+func NewGetNeighbours() *Message {
+	return &Message{Type: MsgGetNeighbours}
+}
+
+func NewNeighbours(addrs []string) *Message {
+	return &Message{Type: MsgNeighbours, Payload: []byte(strings.Join(addrs, ","))}
+}
+
+// Index returns the generation index of have, request, stop, rank update
+// and piece messages
+func (m *Message) Index() (uint32, error) {
+	if len(m.Payload) < 4 {
+		return 0, ErrBadPayload
+	}
+	return binary.BigEndian.Uint32(m.Payload[0:4]), nil
+}
+
+func (m *Message) Rank() (index uint32, rank uint32, err error) {
+	if m.Type != MsgRankUpdate || len(m.Payload) != 8 {
+		return 0, 0, ErrBadPayload
+	}
+	return binary.BigEndian.Uint32(m.Payload[0:4]), binary.BigEndian.Uint32(m.Payload[4:8]), nil
+}
+
+func (m *Message) Credit() (index uint32, credit uint32, err error) {
+	if m.Type != MsgCredit || len(m.Payload) != 8 {
+		return 0, 0, ErrBadPayload
+	}
+	return binary.BigEndian.Uint32(m.Payload[0:4]), binary.BigEndian.Uint32(m.Payload[4:8]), nil
+}
+
+func (m *Message) Subspace(field galoisfield.Field) (uint32, *coder.Subspace, error) {
+	if m.Type != MsgSubspace || len(m.Payload) < 4 {
+		return 0, nil, ErrBadPayload
+	}
+	subspace, err := coder.NewSubspaceFromBytes(field, m.Payload[4:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint32(m.Payload[0:4]), subspace, nil
+}
+
+// Piece returns the coded piece with its coding vector in full
+func (m *Message) Piece(field galoisfield.Field) (uint32, *coder.CodedPiece, error) {
+	if m.Type != MsgPiece || len(m.Payload) < 9 {
+		return 0, nil, ErrBadPayload
+	}
+	index := binary.BigEndian.Uint32(m.Payload[0:4])
+	vlen := binary.BigEndian.Uint32(m.Payload[5:9])
+	if uint64(vlen) > uint64(len(m.Payload)-9) {
+		return 0, nil, ErrBadPayload
+	}
+	vector, err := coder.DecodeVector(field, coder.VectorEncoding(m.Payload[4]), m.Payload[9:9+vlen])
+	if err != nil {
+		return 0, nil, ErrBadPayload
+	}
+	return index, &coder.CodedPiece{
+		Vector: vector,
+		Piece:  m.Payload[9+vlen:],
+	}, nil
+}
+
+// CheckKey returns the key of a checks request
+func (m *Message) CheckKey() (uint32, []byte, error) {
+	if m.Type != MsgRequestChecks || len(m.Payload) != 4+coder.CheckKeyLength {
+		return 0, nil, ErrBadPayload
+	}
+	return binary.BigEndian.Uint32(m.Payload[0:4]), m.Payload[4:], nil
+}
+
+// Checks returns the hashes of the source pieces, empty if the sender
+// does not hold the generation
+func (m *Message) Checks() (uint32, []byte, error) {
+	if m.Type != MsgChecks || len(m.Payload) < 4 || (len(m.Payload)-4)%coder.HashLength != 0 {
+		return 0, nil, ErrBadPayload
+	}
+	return binary.BigEndian.Uint32(m.Payload[0:4]), m.Payload[4:], nil
+}
+
+func (m *Message) Neighbours() []string {
+	if len(m.Payload) == 0 {
+		return []string{}
+	}
+	return strings.Split(string(m.Payload), ",")
+}
+
+// Reason returns the reason of an error or busy message
+func (m *Message) Reason() string {
+	return string(m.Payload)
+}
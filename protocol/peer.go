@@ -0,0 +1,106 @@
+package protocol
+
+import (
+	"crypto/ed25519"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// PeerID identifies a node by its identity key, whichever address it is
+// reached at
+type PeerID [20]byte
+
+var (
+	ErrBadSignature = errors.New("identity signature of the peer is invalid")
+	ErrBadPeerID    = errors.New("peer id is not 40 hex digits")
+)
+
+func PeerIDFromKey(key ed25519.PublicKey) PeerID {
+	return PeerID(sha1.Sum(key))
+}
+
+func ParsePeerID(s string) (PeerID, error) {
+	id := PeerID{}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(id) {
+		return id, ErrBadPeerID
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func (id PeerID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id PeerID) IsZero() bool {
+	return id == PeerID{}
+}
+
+func (i *Identity) PeerID() PeerID {
+	return PeerIDFromKey(i.PublicKey())
+}
+
+// Transport is a negotiated connection. After the handshakes of the swarm,
+// both peers send an identity message:
+//
+//	[public key 32][signature 64]
+//
+// signing the nonce of the other peer, their own nonce and their own swarm
+// handshake, which binds the claimed infohash and port to the key. Over an
+// encrypted transport the key must be the one of the TLS certificate.
+type Transport struct {
+	net.Conn
+	PeerKey   ed25519.PublicKey // identity key proven by TLS, nil if plain
+	security  *Security
+	nonce     [20]byte
+	peerNonce [20]byte
+}
+
+const identityContext = "PeerCodeX identity"
+
+func identityMessage(verifierNonce, signerNonce [20]byte, h *Handshake) []byte {
+	message := []byte(identityContext)
+	message = append(message, verifierNonce[:]...)
+	message = append(message, signerNonce[:]...)
+	return append(message, h.Bytes()...)
+}
+
+// WriteIdentity proves the identity of the node for the handshake it sent
+func (t *Transport) WriteIdentity(h *Handshake) error {
+	if t.security == nil || t.security.Identity == nil {
+		return ErrBadIdentity
+	}
+	identity := t.security.Identity
+	signature := ed25519.Sign(identity.key, identityMessage(t.peerNonce, t.nonce, h))
+	payload := append([]byte(identity.PublicKey()), signature...)
+	return WriteMessage(t.Conn, &Message{Type: MsgIdentity, Payload: payload})
+}
+
+// ReadIdentity reads the identity proof of the peer for the handshake it
+// sent, and returns its peer id. ErrBusy is returned if the peer refuses
+// the connection for its limits.
+func (t *Transport) ReadIdentity(h *Handshake) (PeerID, error) {
+	m, err := ReadMessage(t.Conn)
+	if err != nil {
+		return PeerID{}, err
+	}
+	if m.Type == MsgBusy {
+		return PeerID{}, fmt.Errorf("%w: %s", ErrBusy, m.Reason())
+	}
+	if m.Type != MsgIdentity || len(m.Payload) != ed25519.PublicKeySize+ed25519.SignatureSize {
+		return PeerID{}, ErrUnexpected
+	}
+	key := ed25519.PublicKey(m.Payload[:ed25519.PublicKeySize])
+	signature := m.Payload[ed25519.PublicKeySize:]
+	if !ed25519.Verify(key, identityMessage(t.nonce, t.peerNonce, h), signature) {
+		return PeerID{}, ErrBadSignature
+	}
+	if t.PeerKey != nil && !t.PeerKey.Equal(key) {
+		return PeerID{}, ErrBadSignature
+	}
+	return PeerIDFromKey(key), nil
+}
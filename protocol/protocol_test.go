@@ -0,0 +1,215 @@
+package protocol_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
+	"github.com/aecra/PeerCodeX/protocol"
+)
+
+func TestHandshake(t *testing.T) {
+	infoHash := bytes.Repeat([]byte{0xab}, 20)
+	buf := &bytes.Buffer{}
+	local := protocol.NewHandshake(infoHash, 8080)
+	local.SetField(galoisfield.GF65536.ID())
+	if err := protocol.WriteHandshake(buf, local); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != protocol.HandshakeSize {
+		t.Fatalf("expected %d bytes, got %d", protocol.HandshakeSize, buf.Len())
+	}
+	h, err := protocol.ReadHandshake(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.InfoHash[:], infoHash) || h.Port != 8080 || h.Version() != protocol.Version {
+		t.Fatalf("unexpected handshake %+v", h)
+	}
+	if field, err := galoisfield.ByID(h.Field()); err != nil || field != galoisfield.GF65536 {
+		t.Fatalf("unexpected field %d", h.Field())
+	}
+	if protocol.NewHandshake(infoHash, 8080).Field() != 0 {
+		t.Fatal("expected no field unless set")
+	}
+
+	// a peer of the first protocol version sends a zero reserved byte
+	old := protocol.NewHandshake(infoHash, 8080)
+	old.Reserved[0] = 0x00
+	if _, err := protocol.ReadHandshake(bytes.NewReader(old.Bytes())); err != protocol.ErrBadVersion {
+		t.Fatalf("expected ErrBadVersion, got %v", err)
+	}
+	bad := old.Bytes()
+	bad[1] = 'n'
+	if _, err := protocol.ReadHandshake(bytes.NewReader(bad)); err != protocol.ErrBadProtocolName {
+		t.Fatalf("expected ErrBadProtocolName, got %v", err)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	codedPiece := &coder.CodedPiece{Vector: []byte{1, 2, 3}, Piece: []byte("coded piece")}
+	subspace := coder.NewSubspace(galoisfield.GF256, 3)
+	subspace.Add(codedPiece.Vector)
+	messages := []*protocol.Message{
+		protocol.NewKeepAlive(),
+		protocol.NewHaveGeneration(3),
+		protocol.NewRequestGeneration(4),
+		protocol.NewPiece(5, codedPiece, galoisfield.GF256),
+		protocol.NewRankUpdate(6, 7),
+		protocol.NewStop(8),
+		protocol.NewError("generation not found"),
+		protocol.NewGetNeighbours(),
+		protocol.NewNeighbours([]string{"a:1", "b:2"}),
+		protocol.NewCredit(9, 10),
+		protocol.NewSubspace(11, subspace),
+		protocol.NewChoke(),
+		protocol.NewUnchoke(),
+		protocol.NewBusy("too many connections"),
+		protocol.NewRequestChecks(12, bytes.Repeat([]byte{1}, coder.CheckKeyLength)),
+		protocol.NewChecks(13, bytes.Repeat([]byte{2}, 2*coder.HashLength)),
+		protocol.NewChecks(14, nil),
+	}
+	buf := &bytes.Buffer{}
+	for _, m := range messages {
+		if err := protocol.WriteMessage(buf, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range messages {
+		m, err := protocol.ReadMessage(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != want.Type || !bytes.Equal(m.Payload, want.Payload) {
+			t.Fatalf("expected %+v, got %+v", want, m)
+		}
+	}
+
+	index, piece, err := messages[3].Piece(galoisfield.GF256)
+	if err != nil || index != 5 || !bytes.Equal(piece.Vector, codedPiece.Vector) || !bytes.Equal(piece.Piece, codedPiece.Piece) {
+		t.Fatalf("unexpected piece %d %+v %v", index, piece, err)
+	}
+	if index, rank, err := messages[4].Rank(); err != nil || index != 6 || rank != 7 {
+		t.Fatalf("unexpected rank update %d %d %v", index, rank, err)
+	}
+	if index, credit, err := messages[9].Credit(); err != nil || index != 9 || credit != 10 {
+		t.Fatalf("unexpected credit %d %d %v", index, credit, err)
+	}
+	if index, decoded, err := messages[10].Subspace(galoisfield.GF256); err != nil || index != 11 || decoded.Rank() != 1 || decoded.IsInnovative(codedPiece.Vector) {
+		t.Fatalf("unexpected subspace %d %v", index, err)
+	}
+	if index, err := messages[5].Index(); err != nil || index != 8 {
+		t.Fatalf("unexpected stop %d %v", index, err)
+	}
+	if neighbours := messages[8].Neighbours(); len(neighbours) != 2 || neighbours[1] != "b:2" {
+		t.Fatalf("unexpected neighbours %v", neighbours)
+	}
+	if reason := messages[6].Reason(); reason != "generation not found" {
+		t.Fatalf("unexpected reason %q", reason)
+	}
+	if reason := messages[13].Reason(); reason != "too many connections" {
+		t.Fatalf("unexpected busy reason %q", reason)
+	}
+	if index, key, err := messages[14].CheckKey(); err != nil || index != 12 || len(key) != coder.CheckKeyLength {
+		t.Fatalf("unexpected checks request %d %v", index, err)
+	}
+	if index, hashes, err := messages[15].Checks(); err != nil || index != 13 || len(hashes) != 2*coder.HashLength {
+		t.Fatalf("unexpected checks %d %v", index, err)
+	}
+	if index, hashes, err := messages[16].Checks(); err != nil || index != 14 || len(hashes) != 0 {
+		t.Fatalf("unexpected empty checks %d %v", index, err)
+	}
+}
+
+func TestPieceVectorEncodings(t *testing.T) {
+	field := galoisfield.GF65536
+	pieces := make([]coder.Piece, 200)
+	for i := range pieces {
+		pieces[i] = bytes.Repeat([]byte{byte(i)}, 32)
+	}
+	for _, enc := range []encoder.Encoder{
+		encoder.NewFullRLNCEncoder(field, pieces),
+		encoder.NewSparseRLNCEncoder(field, pieces, 0.95),
+		encoder.NewSystematicRLNCEncoder(field, pieces),
+	} {
+		codedPiece := enc.CodedPiece()
+		m := protocol.NewPiece(7, codedPiece, field)
+		if len(m.Payload) >= 9+len(codedPiece.Vector)+len(codedPiece.Piece) {
+			t.Fatalf("vector of encoding %d isn't sent in fewer bytes", codedPiece.Encoding)
+		}
+		index, piece, err := m.Piece(field)
+		if err != nil || index != 7 || !bytes.Equal(piece.Vector, codedPiece.Vector) || !bytes.Equal(piece.Piece, codedPiece.Piece) {
+			t.Fatalf("piece changed by vector encoding %d: %v", codedPiece.Encoding, err)
+		}
+	}
+}
+
+func TestMalformedMessages(t *testing.T) {
+	// unknown version
+	if _, err := protocol.ReadMessage(bytes.NewReader([]byte{0x01, 0x00, 0, 0, 0, 0})); err != protocol.ErrBadVersion {
+		t.Fatalf("expected ErrBadVersion, got %v", err)
+	}
+	// payload larger than allowed
+	if _, err := protocol.ReadMessage(bytes.NewReader([]byte{protocol.Version, 0x03, 0xff, 0xff, 0xff, 0xff})); err != protocol.ErrPayloadTooLarge {
+		t.Fatalf("expected ErrPayloadTooLarge, got %v", err)
+	}
+	// vector longer than the payload
+	m := &protocol.Message{Type: protocol.MsgPiece, Payload: []byte{0, 0, 0, 1, 0, 0, 0, 0, 9, 1}}
+	if _, _, err := m.Piece(galoisfield.GF256); err != protocol.ErrBadPayload {
+		t.Fatalf("expected ErrBadPayload, got %v", err)
+	}
+	// unknown vector encoding
+	m = &protocol.Message{Type: protocol.MsgPiece, Payload: []byte{0, 0, 0, 1, 0xff, 0, 0, 0, 1, 1}}
+	if _, _, err := m.Piece(galoisfield.GF256); err != protocol.ErrBadPayload {
+		t.Fatalf("expected ErrBadPayload, got %v", err)
+	}
+	if _, err := (&protocol.Message{Type: protocol.MsgStop}).Index(); err != protocol.ErrBadPayload {
+		t.Fatalf("expected ErrBadPayload, got %v", err)
+	}
+	// key of the wrong length, hashes of a partial piece
+	if _, _, err := protocol.NewRequestChecks(1, []byte("key")).CheckKey(); err != protocol.ErrBadPayload {
+		t.Fatalf("expected ErrBadPayload, got %v", err)
+	}
+	if _, _, err := protocol.NewChecks(1, []byte("hash")).Checks(); err != protocol.ErrBadPayload {
+		t.Fatalf("expected ErrBadPayload, got %v", err)
+	}
+}
+
+func TestPayloadLimits(t *testing.T) {
+	field := galoisfield.GF65536
+	limit := protocol.PayloadLimit(field, 64, 256<<10)
+	piece := &protocol.Message{Type: protocol.MsgPiece, Payload: make([]byte, limit)}
+	errorMessage := &protocol.Message{Type: protocol.MsgError, Payload: make([]byte, protocol.MaxControlPayloadSize+1)}
+	if limit <= protocol.MaxControlPayloadSize || protocol.PayloadLimit(field, 1<<16, 1<<20) != protocol.MaxPayloadSize {
+		t.Fatalf("unexpected limit %d", limit)
+	}
+
+	for _, c := range []struct {
+		name  string
+		m     *protocol.Message
+		limit int // 0 leaves the connection as it is before the handshake
+		err   error
+	}{
+		{"piece before handshake", piece, 0, protocol.ErrPayloadTooLarge},
+		{"piece within limit", piece, limit, nil},
+		{"piece above limit", piece, limit - 1, protocol.ErrPayloadTooLarge},
+		{"control message", errorMessage, limit, protocol.ErrPayloadTooLarge},
+	} {
+		local, remote := net.Pipe()
+		go func() {
+			protocol.WriteMessage(remote, c.m)
+			remote.Close()
+		}()
+		conn := protocol.NewConn(local)
+		if c.limit != 0 {
+			conn.SetMaxPayloadSize(c.limit)
+		}
+		if _, err := conn.ReadMessage(); err != c.err {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+		local.Close()
+	}
+}
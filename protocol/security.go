@@ -0,0 +1,280 @@
+package protocol
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Peers agree on encryption through the feature flags of a first handshake
+// which carries a random nonce instead of an infohash, and no port. Each
+// peer later signs the nonce of the other to prove its identity (see
+// Transport). If both support encryption, the
+// connection is upgraded to TLS 1.3 with self-signed certificates of the
+// Ed25519 identity keys of both nodes, and the handshake of the swarm
+// follows inside it. A peer is pinned by the public key of its identity.
+const (
+	FlagEncryption        = 0x01 // reserved[1], sender supports encryption
+	FlagRequireEncryption = 0x02 // reserved[1], sender only talks encrypted
+)
+
+type Encryption int
+
+const (
+	EncryptionOff      Encryption = iota // never encrypt
+	EncryptionOn                         // encrypt if the peer supports it
+	EncryptionRequired                   // close connections to peers which do not encrypt
+)
+
+var (
+	ErrEncryptionRequired = errors.New("encryption is required by one of the peers")
+	ErrPinMismatch        = errors.New("identity of the peer does not match its pinned key")
+	ErrBadIdentity        = errors.New("identity key is malformed")
+	ErrBadEncryption      = errors.New("encryption is one of off, on or require")
+)
+
+func ParseEncryption(s string) (Encryption, error) {
+	switch s {
+	case "off":
+		return EncryptionOff, nil
+	case "on":
+		return EncryptionOn, nil
+	case "require":
+		return EncryptionRequired, nil
+	}
+	return EncryptionOff, ErrBadEncryption
+}
+
+func (e Encryption) String() string {
+	switch e {
+	case EncryptionOn:
+		return "on"
+	case EncryptionRequired:
+		return "require"
+	}
+	return "off"
+}
+
+// Identity is the long-term key of a node
+type Identity struct {
+	key         ed25519.PrivateKey
+	certificate tls.Certificate
+}
+
+func NewIdentity() (*Identity, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newIdentity(key)
+}
+
+// LoadIdentity reads the identity key at path, a new key is created and
+// written there if there is none yet
+func LoadIdentity(path string) (*Identity, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		identity, err := NewIdentity()
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(identity.key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		block := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		return identity, os.WriteFile(path, block, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, ErrBadIdentity
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrBadIdentity
+	}
+	return newIdentity(edKey)
+}
+
+func newIdentity(key ed25519.PrivateKey) (*Identity, error) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		key:         key,
+		certificate: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+	}, nil
+}
+
+func (i *Identity) PublicKey() ed25519.PublicKey {
+	return i.key.Public().(ed25519.PublicKey)
+}
+
+// Security is the transport configuration of a node
+type Security struct {
+	Encryption Encryption
+	Identity   *Identity
+	Pins       map[string]ed25519.PublicKey // identity keys of peers by address
+}
+
+// ParsePins parses comma separated pins of the form addr=hex key
+func ParsePins(s string) (map[string]ed25519.PublicKey, error) {
+	pins := make(map[string]ed25519.PublicKey)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		addr, keyHex, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, errors.New("pin is not of the form addr=key: " + item)
+		}
+		key, err := hex.DecodeString(keyHex)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("pin key is not a hex Ed25519 public key: " + item)
+		}
+		pins[addr] = ed25519.PublicKey(key)
+	}
+	return pins, nil
+}
+
+func (s *Security) flags() byte {
+	if s == nil || s.Identity == nil {
+		return 0
+	}
+	switch s.Encryption {
+	case EncryptionOn:
+		return FlagEncryption
+	case EncryptionRequired:
+		return FlagEncryption | FlagRequireEncryption
+	}
+	return 0
+}
+
+func (s *Security) pin(addr string) ed25519.PublicKey {
+	if s == nil || addr == "" {
+		return nil
+	}
+	return s.Pins[addr]
+}
+
+// tlsConfig accepts any self-signed certificate of an Ed25519 key, as the
+// key is the identity. The pin is checked if there is one.
+func (s *Security) tlsConfig(pin ed25519.PublicKey) *tls.Config {
+	return &tls.Config{
+		Certificates:       []tls.Certificate{s.Identity.certificate},
+		MinVersion:         tls.VersionTLS13,
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			key, err := peerKey(rawCerts)
+			if err != nil {
+				return err
+			}
+			if pin != nil && !pin.Equal(key) {
+				return ErrPinMismatch
+			}
+			return nil
+		},
+	}
+}
+
+func peerKey(rawCerts [][]byte) (ed25519.PublicKey, error) {
+	if len(rawCerts) == 0 {
+		return nil, ErrBadIdentity
+	}
+	certificate, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := certificate.CheckSignature(certificate.SignatureAlgorithm, certificate.RawTBSCertificate, certificate.Signature); err != nil {
+		return nil, err
+	}
+	key, ok := certificate.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, ErrBadIdentity
+	}
+	return key, nil
+}
+
+// Negotiate agrees on encryption with the peer and upgrades the connection
+// if both support it. The returned transport is the connection to talk
+// over, on which the identity of the peer is proven later. addr is the
+// address dialed by a client, whose pin is checked.
+func Negotiate(conn net.Conn, addr string, isServer bool, security *Security) (*Transport, error) {
+	t := &Transport{Conn: conn, security: security}
+	if _, err := rand.Read(t.nonce[:]); err != nil {
+		return nil, err
+	}
+	local := NewHandshake(t.nonce[:], 0)
+	local.Reserved[1] = security.flags()
+
+	var remote *Handshake
+	var err error
+	if isServer {
+		if remote, err = ReadHandshake(conn); err != nil {
+			return nil, err
+		}
+		err = WriteHandshake(conn, local)
+	} else {
+		if err = WriteHandshake(conn, local); err == nil {
+			remote, err = ReadHandshake(conn)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.peerNonce = remote.InfoHash
+
+	localFlags, remoteFlags := local.Reserved[1], remote.Reserved[1]
+	pin := security.pin(addr)
+	if localFlags&FlagEncryption == 0 || remoteFlags&FlagEncryption == 0 {
+		if (localFlags|remoteFlags)&FlagRequireEncryption != 0 {
+			return nil, ErrEncryptionRequired
+		}
+		if pin != nil {
+			return nil, ErrPinMismatch
+		}
+		return t, nil
+	}
+
+	var tlsConn *tls.Conn
+	if isServer {
+		tlsConn = tls.Server(conn, security.tlsConfig(nil))
+	} else {
+		tlsConn = tls.Client(conn, security.tlsConfig(pin))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	t.Conn = tlsConn
+	// the key is checked by VerifyPeerCertificate already
+	t.PeerKey = tlsConn.ConnectionState().PeerCertificates[0].PublicKey.(ed25519.PublicKey)
+	return t, nil
+}
@@ -0,0 +1,187 @@
+package protocol_test
+
+import (
+	"crypto/ed25519"
+	"crypto/tls"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/protocol"
+)
+
+type negotiated struct {
+	conn *protocol.Transport
+	err  error
+}
+
+// negotiate runs both sides of the negotiation over loopback
+func negotiate(t *testing.T, client, server *protocol.Security) (negotiated, negotiated) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	results := make(chan negotiated)
+	go func() {
+		serverConn, err := listener.Accept()
+		if err != nil {
+			results <- negotiated{err: err}
+			return
+		}
+		t.Cleanup(func() { serverConn.Close() })
+		conn, err := protocol.Negotiate(serverConn, "", true, server)
+		if err != nil {
+			// unblock the client waiting for the peer
+			serverConn.Close()
+		}
+		results <- negotiated{conn, err}
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clientConn.Close() })
+	conn, err := protocol.Negotiate(clientConn, "peer:1", false, client)
+	if err != nil {
+		clientConn.Close()
+	}
+	return negotiated{conn, err}, <-results
+}
+
+func newSecurity(t *testing.T, encryption protocol.Encryption) *protocol.Security {
+	identity, err := protocol.NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &protocol.Security{Encryption: encryption, Identity: identity}
+}
+
+func TestNegotiateEncrypted(t *testing.T) {
+	client := newSecurity(t, protocol.EncryptionOn)
+	server := newSecurity(t, protocol.EncryptionRequired)
+	c, s := negotiate(t, client, server)
+	if c.err != nil || s.err != nil {
+		t.Fatal(c.err, s.err)
+	}
+	if _, ok := c.conn.Conn.(*tls.Conn); !ok {
+		t.Fatal("expected encrypted connection")
+	}
+	if !c.conn.PeerKey.Equal(server.Identity.PublicKey()) || !s.conn.PeerKey.Equal(client.Identity.PublicKey()) {
+		t.Fatal("peers do not see the identity keys of each other")
+	}
+
+	// the swarm handshake follows inside the encrypted transport
+	go protocol.WriteHandshake(c.conn, protocol.NewHandshake(make([]byte, 20), 8080))
+	h, err := protocol.ReadHandshake(s.conn)
+	if err != nil || h.Port != 8080 {
+		t.Fatalf("unexpected handshake %+v %v", h, err)
+	}
+}
+
+func TestNegotiatePlain(t *testing.T) {
+	c, s := negotiate(t, newSecurity(t, protocol.EncryptionOn), newSecurity(t, protocol.EncryptionOff))
+	if c.err != nil || s.err != nil {
+		t.Fatal(c.err, s.err)
+	}
+	if c.conn.PeerKey != nil || s.conn.PeerKey != nil {
+		t.Fatal("expected plain connection")
+	}
+
+	c, s = negotiate(t, newSecurity(t, protocol.EncryptionRequired), newSecurity(t, protocol.EncryptionOff))
+	if c.err != protocol.ErrEncryptionRequired || s.err != protocol.ErrEncryptionRequired {
+		t.Fatalf("expected ErrEncryptionRequired, got %v %v", c.err, s.err)
+	}
+}
+
+func TestNegotiatePin(t *testing.T) {
+	client := newSecurity(t, protocol.EncryptionOn)
+	server := newSecurity(t, protocol.EncryptionOn)
+
+	client.Pins = map[string]ed25519.PublicKey{"peer:1": server.Identity.PublicKey()}
+	if c, s := negotiate(t, client, server); c.err != nil || s.err != nil {
+		t.Fatal(c.err, s.err)
+	}
+
+	client.Pins["peer:1"] = newSecurity(t, protocol.EncryptionOn).Identity.PublicKey()
+	if c, _ := negotiate(t, client, server); c.err == nil {
+		t.Fatal("expected pin mismatch")
+	}
+
+	// a pinned peer must encrypt
+	client.Pins["peer:1"] = server.Identity.PublicKey()
+	server.Encryption = protocol.EncryptionOff
+	if c, _ := negotiate(t, client, server); c.err != protocol.ErrPinMismatch {
+		t.Fatalf("expected ErrPinMismatch, got %v", c.err)
+	}
+}
+
+func TestLoadIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity")
+	identity, err := protocol.LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := protocol.LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.PublicKey().Equal(identity.PublicKey()) {
+		t.Fatal("identity changed after reload")
+	}
+
+	pins, err := protocol.ParsePins("a:1=" + hexKey(identity.PublicKey()) + ", ")
+	if err != nil || !pins["a:1"].Equal(identity.PublicKey()) {
+		t.Fatalf("unexpected pins %v %v", pins, err)
+	}
+	if _, err := protocol.ParsePins("a:1=00"); err == nil {
+		t.Fatal("expected error for short key")
+	}
+}
+
+func hexKey(key ed25519.PublicKey) string {
+	const digits = "0123456789abcdef"
+	buf := make([]byte, 0, 2*len(key))
+	for _, b := range key {
+		buf = append(buf, digits[b>>4], digits[b&0x0f])
+	}
+	return string(buf)
+}
+
+func TestIdentity(t *testing.T) {
+	for _, encryption := range []protocol.Encryption{protocol.EncryptionOff, protocol.EncryptionOn} {
+		client := newSecurity(t, encryption)
+		server := newSecurity(t, encryption)
+		c, s := negotiate(t, client, server)
+		if c.err != nil || s.err != nil {
+			t.Fatal(c.err, s.err)
+		}
+
+		h := protocol.NewHandshake(make([]byte, 20), 8080)
+		go c.conn.WriteIdentity(h)
+		id, err := s.conn.ReadIdentity(h)
+		if err != nil || id != client.Identity.PeerID() {
+			t.Fatalf("unexpected peer id %s %v", id, err)
+		}
+
+		// the signature covers the claimed port
+		go s.conn.WriteIdentity(h)
+		if _, err := c.conn.ReadIdentity(protocol.NewHandshake(make([]byte, 20), 8081)); err != protocol.ErrBadSignature {
+			t.Fatalf("expected ErrBadSignature, got %v", err)
+		}
+
+		// a node at its limits refuses in place of its identity
+		go protocol.WriteMessage(s.conn, protocol.NewBusy("too many connections"))
+		if _, err := c.conn.ReadIdentity(h); !errors.Is(err, protocol.ErrBusy) {
+			t.Fatalf("expected ErrBusy, got %v", err)
+		}
+	}
+
+	id := newSecurity(t, protocol.EncryptionOn).Identity.PeerID()
+	parsed, err := protocol.ParsePeerID(id.String())
+	if err != nil || parsed != id || id.IsZero() {
+		t.Fatalf("unexpected peer id %s %v", parsed, err)
+	}
+}
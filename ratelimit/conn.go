@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"net"
+	"sync"
+)
+
+// chunkSize is the most a write sends before waiting on its limiters
+// again, so that limited connections are smooth rather than bursty
+const chunkSize = 16 << 10
+
+// Conn is a connection whose reads and writes wait on limiters. Limiters
+// may be added once the peer or the file of the connection is known.
+type Conn struct {
+	net.Conn
+	mutex sync.RWMutex
+	read  []*Limiter
+	write []*Limiter
+}
+
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{Conn: conn}
+}
+
+// Limit adds limiters of the reads and the writes, either may be nil
+func (c *Conn) Limit(read, write *Limiter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if read != nil {
+		c.read = append(c.read, read)
+	}
+	if write != nil {
+		c.write = append(c.write, write)
+	}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mutex.RLock()
+	limiters := c.read
+	c.mutex.RUnlock()
+	for _, l := range limiters {
+		l.WaitN(n)
+	}
+	return n, err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		c.mutex.RLock()
+		limiters := c.write
+		c.mutex.RUnlock()
+		for _, l := range limiters {
+			l.WaitN(len(chunk))
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,95 @@
+// Package ratelimit limits the bandwidth of connections with token
+// buckets. A connection is wrapped in a Conn, which waits on every
+// limiter it is limited by, e.g. a global, a per-peer and a per-file one.
+//
+// Rates are in bytes per second, a rate of 0 is unlimited. The rate of a
+// limiter may follow a Schedule, which sets other rates at certain times
+// of the week.
+package ratelimit
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aecra/PeerCodeX/tools"
+)
+
+// Limiter is a token bucket, which holds at most one second of tokens
+type Limiter struct {
+	mutex    sync.Mutex
+	rate     int64 // rate when no rule of the schedule applies
+	schedule Schedule
+	tokens   float64
+	last     time.Time
+}
+
+func NewLimiter(rate int64) *Limiter {
+	return &Limiter{rate: rate, last: time.Now()}
+}
+
+// SetRate sets the rate which applies outside of the schedule
+func (l *Limiter) SetRate(rate int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rate = rate
+}
+
+func (l *Limiter) SetSchedule(schedule Schedule) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.schedule = schedule
+}
+
+// Rate returns the rate which applies now
+func (l *Limiter) Rate() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.schedule.RateAt(time.Now(), l.rate)
+}
+
+// WaitN takes n tokens from the bucket, blocking until the bucket has
+// refilled enough. A nil limiter never blocks.
+func (l *Limiter) WaitN(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mutex.Lock()
+	now := time.Now()
+	rate := l.schedule.RateAt(now, l.rate)
+	if rate <= 0 {
+		l.tokens, l.last = 0, now
+		l.mutex.Unlock()
+		return
+	}
+	l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+	if l.tokens > float64(rate) {
+		l.tokens = float64(rate)
+	}
+	l.last = now
+	// tokens go negative for a deficit, which later callers wait for too
+	l.tokens -= float64(n)
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+	}
+	l.mutex.Unlock()
+	time.Sleep(wait)
+}
+
+// ParseRate parses rates like "5MB", "5MB/s" or "0" into bytes per second
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	return tools.ParseByteSize(strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "/S"))
+}
+
+// FormatRate formats a rate in the form accepted by ParseRate
+func FormatRate(rate int64) string {
+	if rate <= 0 {
+		return "0"
+	}
+	return strings.ReplaceAll(tools.FormatByteSize(rate), " ", "") + "/s"
+}
@@ -0,0 +1,95 @@
+package ratelimit_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aecra/PeerCodeX/ratelimit"
+)
+
+func TestLimiter(t *testing.T) {
+	l := ratelimit.NewLimiter(10 << 20)
+	start := time.Now()
+	l.WaitN(5 << 20)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("expected to wait about 500ms, waited %v", elapsed)
+	}
+
+	l.SetRate(0)
+	start = time.Now()
+	l.WaitN(100 << 20)
+	if time.Since(start) > 50*time.Millisecond {
+		t.Fatal("unlimited limiter blocked")
+	}
+	var nilLimiter *ratelimit.Limiter
+	nilLimiter.WaitN(1 << 30)
+}
+
+func TestConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := ratelimit.NewConn(client)
+	conn.Limit(nil, ratelimit.NewLimiter(4<<20))
+	conn.Limit(nil, nil)
+
+	data := make([]byte, 2<<20)
+	start := time.Now()
+	go func() {
+		conn.Write(data)
+		conn.Close()
+	}()
+	received, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != len(data) {
+		t.Fatalf("expected %d bytes, got %d", len(data), len(received))
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("expected to take about 500ms, took %v", elapsed)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	schedule, err := ratelimit.ParseSchedule("5MB/s 09:00-17:00 mon-fri; 1MB 22:00-06:00 ;0 00:00-24:00 sat,sun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2023-06-05 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2023, 6, 5+day, hour, minute, 0, 0, time.Local)
+	}
+	cases := []struct {
+		t    time.Time
+		rate int64
+	}{
+		{at(0, 9, 0), 5 << 20},
+		{at(4, 16, 59), 5 << 20},
+		{at(0, 17, 0), 100},
+		{at(1, 23, 0), 1 << 20},
+		{at(2, 5, 59), 1 << 20},
+		{at(5, 12, 0), 0},
+		{at(6, 23, 30), 1 << 20},
+	}
+	for _, c := range cases {
+		if rate := schedule.RateAt(c.t, 100); rate != c.rate {
+			t.Errorf("%v: expected rate %d, got %d", c.t, c.rate, rate)
+		}
+	}
+
+	parsed, err := ratelimit.ParseSchedule(schedule.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.String() != schedule.String() {
+		t.Fatalf("schedule changed by formatting: %q, %q", schedule.String(), parsed.String())
+	}
+
+	for _, bad := range []string{"5MB", "5MB 9-17", "5MB 09:00-25:00", "5MB 09:00-17:00 monday", "x 09:00-17:00"} {
+		if _, err := ratelimit.ParseSchedule(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
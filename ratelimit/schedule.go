@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule sets the rate of a limiter at certain times of the week. It is
+// written as rules separated by ';', each of the form
+//
+//	<rate> <HH:MM>-<HH:MM> [days]
+//
+// e.g. "5MB/s 09:00-17:00 mon-fri". Days are a range or a list separated
+// by ',' of mon, tue, wed, thu, fri, sat and sun, every day if omitted. A
+// window ending before it starts spans midnight. The first rule applying
+// sets the rate, the rate of the limiter applies if none does.
+type Schedule []Rule
+
+type Rule struct {
+	Rate  int64
+	Start int // minutes since midnight
+	End   int
+	Days  [7]bool // indexed by time.Weekday
+}
+
+var ErrBadSchedule = errors.New("schedule rule is not of the form <rate> <HH:MM>-<HH:MM> [days]")
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func ParseSchedule(s string) (Schedule, error) {
+	schedule := Schedule{}
+	for _, item := range strings.Split(s, ";") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, ErrBadSchedule
+		}
+		rule := Rule{}
+		var err error
+		if rule.Rate, err = ParseRate(fields[0]); err != nil {
+			return nil, err
+		}
+		window := strings.Split(fields[1], "-")
+		if len(window) != 2 {
+			return nil, ErrBadSchedule
+		}
+		if rule.Start, err = parseClock(window[0]); err != nil {
+			return nil, err
+		}
+		if rule.End, err = parseClock(window[1]); err != nil {
+			return nil, err
+		}
+		if len(fields) == 3 {
+			if rule.Days, err = parseDays(fields[2]); err != nil {
+				return nil, err
+			}
+		} else {
+			for i := range rule.Days {
+				rule.Days[i] = true
+			}
+		}
+		schedule = append(schedule, rule)
+	}
+	return schedule, nil
+}
+
+func parseClock(s string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(s, "%d:%d", &hour, &minute); err != nil {
+		return 0, ErrBadSchedule
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, ErrBadSchedule
+	}
+	return hour*60 + minute, nil
+}
+
+func parseWeekday(s string) (int, error) {
+	for i, day := range weekdays {
+		if strings.EqualFold(s, day) {
+			return i, nil
+		}
+	}
+	return 0, ErrBadSchedule
+}
+
+func parseDays(s string) ([7]bool, error) {
+	days := [7]bool{}
+	for _, item := range strings.Split(s, ",") {
+		bounds := strings.Split(item, "-")
+		if len(bounds) > 2 {
+			return days, ErrBadSchedule
+		}
+		first, err := parseWeekday(bounds[0])
+		if err != nil {
+			return days, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseWeekday(bounds[1]); err != nil {
+				return days, err
+			}
+		}
+		// a range may wrap around the end of the week, e.g. fri-mon
+		for i := first; ; i = (i + 1) % 7 {
+			days[i] = true
+			if i == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// applies reports whether the rule applies at t, a window spanning
+// midnight belongs to the day it starts on
+func (r Rule) applies(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+	if r.Start <= r.End {
+		return r.Days[day] && minute >= r.Start && minute < r.End
+	}
+	if minute >= r.Start {
+		return r.Days[day]
+	}
+	return minute < r.End && r.Days[(day+6)%7]
+}
+
+// RateAt returns the rate at t, rate if no rule applies
+func (s Schedule) RateAt(t time.Time, rate int64) int64 {
+	for _, rule := range s {
+		if rule.applies(t) {
+			return rule.Rate
+		}
+	}
+	return rate
+}
+
+// String formats the schedule in the form accepted by ParseSchedule
+func (s Schedule) String() string {
+	rules := make([]string, len(s))
+	for i, rule := range s {
+		rules[i] = fmt.Sprintf("%s %02d:%02d-%02d:%02d", FormatRate(rule.Rate), rule.Start/60, rule.Start%60, rule.End/60, rule.End%60)
+		days := make([]string, 0)
+		for day, ok := range rule.Days {
+			if ok {
+				days = append(days, weekdays[day])
+			}
+		}
+		if len(days) < 7 {
+			rules[i] += " " + strings.Join(days, ",")
+		}
+	}
+	return strings.Join(rules, ";")
+}
@@ -1,32 +1,279 @@
 package seed
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"github.com/aecra/PeerCodeX/tools"
 	"github.com/zeebo/bencode"
 )
 
 type NcFile struct {
-	Announce     string   `bencode:"announce"`
-	AnnounceList []string `bencode:"announce-list"`
+	Announce     string       `bencode:"announce"`
+	AnnounceList AnnounceList `bencode:"announce-list"`
 
 	Comment string `bencode:"comment"`
 
 	CreateBy     string    `bencode:"created by"`
 	CreationDate time.Time `bencode:"creation date"`
 
-	Info struct {
-		Name   string   `bencode:"name"`
-		Hash   [][]byte `bencode:"hash"`
-		Length int64    `bencode:"length"`
-	} `bencode:"info"`
+	Info NcInfo `bencode:"info"`
+}
+
+// AnnounceList holds tiers of backup announce nodes. Tiers are tried in
+// order, a tier is only used when no node of the tiers before is reachable
+type AnnounceList [][]string
+
+func (a *AnnounceList) UnmarshalBencode(data []byte) error {
+	tiers := [][]string{}
+	if err := bencode.DecodeBytes(data, &tiers); err == nil {
+		*a = tiers
+		return nil
+	}
+	// seeds created before tiers were introduced store a flat list, in
+	// which every node is a tier on its own
+	flat := []string{}
+	if err := bencode.DecodeBytes(data, &flat); err != nil {
+		return err
+	}
+	*a = make(AnnounceList, 0, len(flat))
+	for _, v := range flat {
+		*a = append(*a, []string{v})
+	}
+	return nil
+}
+
+// ParseAnnounceList parses tiers separated by ';' of nodes separated by ','
+func ParseAnnounceList(s string) AnnounceList {
+	tiers := make(AnnounceList, 0)
+	for _, tier := range strings.Split(s, ";") {
+		nodes := make([]string, 0)
+		for _, node := range strings.Split(tier, ",") {
+			if node = strings.TrimSpace(node); node != "" {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) > 0 {
+			tiers = append(tiers, nodes)
+		}
+	}
+	return tiers
+}
+
+// String formats the tiers in the form accepted by ParseAnnounceList
+func (a AnnounceList) String() string {
+	tiers := make([]string, len(a))
+	for i, tier := range a {
+		tiers[i] = strings.Join(tier, ",")
+	}
+	return strings.Join(tiers, ";")
+}
+
+type NcInfo struct {
+	Name   string   `bencode:"name"`
+	Hash   [][]byte `bencode:"hash"`
+	Length int64    `bencode:"length"` // total length of all files
+	// Files is only set for a directory, in which case Name is the name
+	// of the directory and generations span file boundaries
+	Files []FileInfo `bencode:"files,omitempty"`
+
+	// coding parameters, seeds created before they were introduced
+	// leave them empty and use the defaults
+	GenerationLength int64  `bencode:"generation length,omitempty"`
+	PieceLength      int64  `bencode:"piece length,omitempty"`
+	Sparsity         string `bencode:"sparsity,omitempty"` // decimal, bencode has no floats
+	Field            string `bencode:"field,omitempty"`
+
+	// PieceHashes holds the homomorphic hashes of the source pieces of
+	// every generation, concatenated. Coded pieces are verified against
+	// them before decoding, seeds created before they were introduced
+	// leave them empty and are not verified.
+	PieceHashes [][]byte `bencode:"piece hashes,omitempty"`
+}
+
+const (
+	DefaultGenerationLength = 1 << 27 // 128MB
+	DefaultPieceLength      = 1 << 20 // 1MB
+	DefaultSparsity         = 0.95
+	DefaultField            = "gf256"
+)
+
+// Options are the coding parameters of a seed
+type Options struct {
+	GenerationLength int64
+	PieceLength      int64
+	Sparsity         float64 // probability of a zero coefficient in coding vectors
+	Field            string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		GenerationLength: DefaultGenerationLength,
+		PieceLength:      DefaultPieceLength,
+		Sparsity:         DefaultSparsity,
+		Field:            DefaultField,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.GenerationLength <= 0 {
+		return errors.New("generation length must be positive")
+	}
+	if o.PieceLength <= 0 || o.PieceLength > o.GenerationLength {
+		return errors.New("piece length must be positive and not larger than generation length")
+	}
+	if o.GenerationLength/o.PieceLength < 2 {
+		return errors.New("a generation must contain at least 2 pieces")
+	}
+	if o.Sparsity < 0 || o.Sparsity >= 1 {
+		return errors.New("sparsity must be in [0, 1)")
+	}
+	field, err := galoisfield.ByName(o.Field)
+	if err != nil {
+		return errors.New("unsupported field " + o.Field)
+	}
+	if o.PieceLength%int64(field.SymbolSize()) != 0 {
+		return fmt.Errorf("piece length must be a multiple of %d bytes with %s", field.SymbolSize(), o.Field)
+	}
+	return nil
+}
+
+type FileInfo struct {
+	Path   []string `bencode:"path"` // path components relative to the directory
+	Length int64    `bencode:"length"`
+}
+
+// GetGenerationLength returns the length of every generation but the last
+func (f *NcFile) GetGenerationLength() int64 {
+	if f.Info.GenerationLength <= 0 {
+		return DefaultGenerationLength
+	}
+	return f.Info.GenerationLength
+}
+
+// GetPieceLength returns the length of the source pieces of a generation
+func (f *NcFile) GetPieceLength() int64 {
+	if f.Info.PieceLength <= 0 {
+		return DefaultPieceLength
+	}
+	return f.Info.PieceLength
+}
+
+// GetSparsity returns the probability of a zero coefficient in the coding
+// vectors of the sparse encoder
+func (f *NcFile) GetSparsity() float64 {
+	sparsity, err := strconv.ParseFloat(f.Info.Sparsity, 64)
+	if err != nil || sparsity < 0 || sparsity >= 1 {
+		return DefaultSparsity
+	}
+	return sparsity
+}
+
+func (f *NcFile) GetField() string {
+	if f.Info.Field == "" {
+		return DefaultField
+	}
+	return f.Info.Field
+}
+
+// GetCodingField returns the field generations are coded over
+func (f *NcFile) GetCodingField() (galoisfield.Field, error) {
+	return galoisfield.ByName(f.GetField())
+}
+
+// GetPieceCount returns the number of source pieces of generation i
+func (f *NcFile) GetPieceCount(i int) uint {
+	length := f.GetGenerationLength()
+	if i == len(f.Info.Hash)-1 {
+		if rest := f.Info.Length % length; rest != 0 {
+			length = rest
+		}
+	}
+	return uint((length + f.GetPieceLength() - 1) / f.GetPieceLength())
+}
+
+// GetPieceHashes returns the homomorphic hashes of the source pieces of
+// generation i, nil if the seed has none
+func (f *NcFile) GetPieceHashes(i int) [][]byte {
+	if i < 0 || i >= len(f.Info.PieceHashes) {
+		return nil
+	}
+	hashes := f.Info.PieceHashes[i]
+	if uint(len(hashes)) != f.GetPieceCount(i)*coder.HashLength {
+		return nil
+	}
+	result := make([][]byte, 0, len(hashes)/coder.HashLength)
+	for j := 0; j < len(hashes); j += coder.HashLength {
+		result = append(result, hashes[j:j+coder.HashLength])
+	}
+	return result
+}
+
+// generatePieceHashes hashes the source pieces of every generation. The
+// key of a generation is its hash.
+func (f *NcFile) generatePieceHashes(reader io.ReaderAt) error {
+	f.Info.PieceHashes = make([][]byte, len(f.Info.Hash))
+	for i := range f.Info.Hash {
+		hashes, err := f.HashPieces(reader, i, f.Info.Hash[i])
+		if err != nil {
+			return err
+		}
+		f.Info.PieceHashes[i] = hashes
+	}
+	return nil
+}
+
+// HashPieces returns the homomorphic hashes under key of the source pieces
+// of generation i read from the file, split the way the encoder splits
+// them, one after another
+func (f *NcFile) HashPieces(reader io.ReaderAt, i int, key []byte) ([]byte, error) {
+	field, err := f.GetCodingField()
+	if err != nil {
+		return nil, err
+	}
+	generationLength := f.GetGenerationLength()
+	offset := int64(i) * generationLength
+	length := f.Info.Length - offset
+	if length > generationLength {
+		length = generationLength
+	}
+	data := make([]byte, length)
+	if _, err := reader.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+	// the last piece is padded with zeros, which do not change its hash
+	pieceCount := int64(f.GetPieceCount(i))
+	pieceSize := int64(coder.PieceSize(field, uint(length), uint(pieceCount)))
+	hashes := make([]byte, 0, pieceCount*coder.HashLength)
+	for j := int64(0); j < pieceCount; j++ {
+		start, end := j*pieceSize, (j+1)*pieceSize
+		if end > length {
+			end = length
+		}
+		if start > end {
+			start = end
+		}
+		hashes = append(hashes, coder.HomomorphicHash(field, key, data[start:end])...)
+	}
+	return hashes, nil
+}
+
+func (f *NcFile) setOptions(options Options) {
+	f.Info.GenerationLength = options.GenerationLength
+	f.Info.PieceLength = options.PieceLength
+	f.Info.Sparsity = strconv.FormatFloat(options.Sparsity, 'f', -1, 64)
+	f.Info.Field = options.Field
 }
 
 func (f *NcFile) GenarateInfo(path string) error {
@@ -36,18 +283,82 @@ func (f *NcFile) GenarateInfo(path string) error {
 	if err != nil {
 		return err
 	}
-	if info.IsDir() {
-		return errors.New("directory is not supported yet")
-	} else {
-		f.Info.Name = info.Name()
-		hashs, err := tools.GetHashsofFile(path)
+	f.Info.Name = info.Name()
+	f.Info.Files = nil
+	if !info.IsDir() {
+		hashs, err := tools.GetHashsofFile(path, f.GetGenerationLength())
 		if err != nil {
 			return err
 		}
 		f.Info.Hash = hashs
 		f.Info.Length = info.Size()
+		return f.generatePieceHashes(f.NewStorage(path))
 	}
-	return nil
+
+	// walk the directory in lexical order, so that the layout is stable
+	length := int64(0)
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		f.Info.Files = append(f.Info.Files, FileInfo{
+			Path:   strings.Split(filepath.ToSlash(rel), "/"),
+			Length: fi.Size(),
+		})
+		length += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(f.Info.Files) == 0 {
+		return errors.New("directory is empty")
+	}
+	f.Info.Length = length
+
+	hashs, err := tools.GetHashsofReader(io.NewSectionReader(f.NewStorage(path), 0, length), f.GetGenerationLength())
+	if err != nil {
+		return err
+	}
+	f.Info.Hash = hashs
+	return f.generatePieceHashes(f.NewStorage(path))
+}
+
+// InfoHash returns the SHA-1 of the bencoded info dictionary, which
+// identifies the swarm of this seed
+func (f *NcFile) InfoHash() ([]byte, error) {
+	info, err := bencode.EncodeBytes(f.Info)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum(info)
+	return hash[:], nil
+}
+
+// InfoHashV2 returns the SHA-256 of the bencoded info dictionary
+func (f *NcFile) InfoHashV2() ([]byte, error) {
+	info, err := bencode.EncodeBytes(f.Info)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(info)
+	return hash[:], nil
+}
+
+// IsDir reports whether the seed describes a directory
+func (f *NcFile) IsDir() bool {
+	return len(f.Info.Files) > 0
 }
 
 func (f *NcFile) Bencoding() (res []byte, err error) {
@@ -78,14 +389,118 @@ func (f *NcFile) Load(file *os.File) error {
 	if err != nil {
 		return err
 	}
-	bencode.DecodeBytes(content, f)
-	announcelist := make([]string, 0)
-	for _, v := range f.AnnounceList {
-		if v != "" {
-			announcelist = append(announcelist, v)
+	if err := bencode.DecodeBytes(content, f); err != nil {
+		return err
+	}
+	f.AnnounceList = ParseAnnounceList(f.AnnounceList.String())
+	if err := f.checkInfo(); err != nil {
+		return err
+	}
+	return f.checkPaths()
+}
+
+// checkInfo makes sure that the coding parameters, hashes and files of a
+// seed agree with its length, so that nothing derived from them later is
+// out of range
+func (f *NcFile) checkInfo() error {
+	options, err := f.options()
+	if err != nil {
+		return err
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	if f.Info.Length < 0 {
+		return errors.New("length of seed is negative")
+	}
+	generationLength := f.GetGenerationLength()
+	generationCount := (f.Info.Length + generationLength - 1) / generationLength
+	if int64(len(f.Info.Hash)) != generationCount {
+		return fmt.Errorf("seed has %d generation hashes for %d generations", len(f.Info.Hash), generationCount)
+	}
+	for _, hash := range f.Info.Hash {
+		if len(hash) != sha1.Size {
+			return errors.New("generation hash of seed is not a SHA-1")
+		}
+	}
+	if len(f.Info.PieceHashes) != 0 {
+		if len(f.Info.PieceHashes) != len(f.Info.Hash) {
+			return fmt.Errorf("seed has piece hashes of %d generations out of %d", len(f.Info.PieceHashes), len(f.Info.Hash))
+		}
+		for i, hashes := range f.Info.PieceHashes {
+			if uint(len(hashes)) != f.GetPieceCount(i)*coder.HashLength {
+				return fmt.Errorf("seed has %d bytes of piece hashes for generation %d of %d pieces", len(hashes), i, f.GetPieceCount(i))
+			}
+		}
+	}
+	if f.IsDir() {
+		length := int64(0)
+		for _, item := range f.Info.Files {
+			if item.Length < 0 {
+				return errors.New("length of a file of seed is negative")
+			}
+			length += item.Length
+		}
+		if length != f.Info.Length {
+			return fmt.Errorf("files of seed hold %d bytes out of %d", length, f.Info.Length)
+		}
+	}
+	return nil
+}
+
+// options returns the coding parameters recorded in the seed, those left
+// empty by older seeds are the defaults
+func (f *NcFile) options() (Options, error) {
+	options := DefaultOptions()
+	if f.Info.GenerationLength != 0 {
+		options.GenerationLength = f.Info.GenerationLength
+	}
+	if f.Info.PieceLength != 0 {
+		options.PieceLength = f.Info.PieceLength
+	}
+	if f.Info.Sparsity != "" {
+		sparsity, err := strconv.ParseFloat(f.Info.Sparsity, 64)
+		if err != nil {
+			return options, errors.New("invalid sparsity " + f.Info.Sparsity + " in seed")
+		}
+		options.Sparsity = sparsity
+	}
+	if f.Info.Field != "" {
+		options.Field = f.Info.Field
+	}
+	return options, nil
+}
+
+// checkPaths makes sure that the files of a seed are stored below the
+// directory it is downloaded to, whatever the seed names them
+func (f *NcFile) checkPaths() error {
+	if err := checkPathComponent(f.Info.Name); err != nil {
+		return err
+	}
+	for _, item := range f.Info.Files {
+		if len(item.Path) == 0 {
+			return errors.New("file of seed has no path")
 		}
+		for _, component := range item.Path {
+			if err := checkPathComponent(component); err != nil {
+				return err
+			}
+		}
+		if !filepath.IsLocal(filepath.Join(item.Path...)) {
+			return errors.New("path of seed leaves its directory: " + strings.Join(item.Path, "/"))
+		}
+	}
+	return nil
+}
+
+// checkPathComponent rejects a name of a file of a seed which isn't a
+// single plain name
+func checkPathComponent(component string) error {
+	if component == "" || component == "." || component == ".." ||
+		strings.ContainsAny(component, `/\`) ||
+		filepath.VolumeName(component) != "" || !filepath.IsLocal(component) {
+		return fmt.Errorf("invalid path component %q in seed", component)
 	}
-	f.AnnounceList = announcelist
 	return nil
 }
 
@@ -95,27 +510,31 @@ func (f *NcFile) IsFileDownloaded(dir string) ([]bool, error) {
 		return nil, errors.New("This is a file is empty")
 	}
 
-	fi, err := os.Stat(filepath.Join(dir, f.Info.Name))
-	if err != nil {
-		if os.IsNotExist(err) {
-			return result, nil
-		}
+	storage := f.NewStorage(filepath.Join(dir, f.Info.Name))
+	exist, err := storage.Check()
+	if err != nil || !exist {
 		return result, err
 	}
-	if fi.Size() != f.Info.Length {
-		return result, errors.New("the size of existing file is not equal to the size of seed file")
-	}
 
-	hashs, err := tools.GetHashsofFile(filepath.Join(dir, f.Info.Name))
-	if err != nil {
-		return result, err
-	}
-
-	if len(f.Info.Hash) != len(hashs) {
-		return nil, errors.New("the size of existing file is not equal to the size of seed file")
-	}
+	// check every generation on its own, files of a directory may be
+	// missing while the generations stored in other files are complete
+	generationLength := f.GetGenerationLength()
+	buf := make([]byte, generationLength)
 	for i := 0; i < len(f.Info.Hash); i++ {
-		if tools.CompareHash(f.Info.Hash[i], hashs[i]) {
+		offset := int64(i) * generationLength
+		length := f.Info.Length - offset
+		if length > generationLength {
+			length = generationLength
+		}
+		_, err := storage.ReadAt(buf[:length], offset)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return result, err
+		}
+		hash := sha1.Sum(buf[:length])
+		if tools.CompareHash(f.Info.Hash[i], hash[:]) {
 			result[i] = true
 		}
 	}
@@ -140,14 +559,24 @@ func NewNcFileFromSeedFile(path string) (*NcFile, error) {
 }
 
 func CreateSeedFile(path string, comment string, announce string, announceList string) error {
+	return CreateSeedFileWithOptions(path, comment, announce, announceList, DefaultOptions())
+}
+
+// CreateSeedFileWithOptions creates a seed whose generations are coded
+// with the given parameters
+func CreateSeedFileWithOptions(path string, comment string, announce string, announceList string, options Options) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
 	// create seed from path
 	ncFile := NcFile{
 		Announce:     announce,
-		AnnounceList: strings.Split(announceList, ","),
+		AnnounceList: ParseAnnounceList(announceList),
 		Comment:      comment,
 		CreateBy:     "PeerCodeX 0.0.1",
 		CreationDate: time.Now(),
 	}
+	ncFile.setOptions(options)
 	err := ncFile.GenarateInfo(path)
 	if err != nil {
 		return err
@@ -3,9 +3,14 @@ package seed_test
 import (
 	"crypto/rand"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/coder/encoder"
+	"github.com/aecra/PeerCodeX/coder/galoisfield"
 	"github.com/aecra/PeerCodeX/seed"
+	"github.com/zeebo/bencode"
 )
 
 func TestCreateSeedFile(t *testing.T) {
@@ -32,3 +37,399 @@ func TestCreateSeedFile(t *testing.T) {
 
 	os.Remove(f.Name() + ".nc")
 }
+
+func TestCreateSeedFileOfDirectory(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "tree")
+	files := map[string]int{
+		"a.txt":         1000,
+		"sub/b.bin":     1 << 20,
+		"sub/deep/c.go": 3,
+		"sub/empty":     0,
+	}
+	for name, size := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, size)
+		rand.Read(data)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = seed.CreateSeedFile(root, "This is a test", "127.0.0.1:8080", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ncFile, err := seed.NewNcFileFromSeedFile(filepath.Join(dir, "tree.nc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ncFile.IsDir() || len(ncFile.Info.Files) != len(files) {
+		t.Fatalf("expected %d files, got %d", len(files), len(ncFile.Info.Files))
+	}
+	if ncFile.Info.Length != 1000+1<<20+3 {
+		t.Fatalf("unexpected length %d", ncFile.Info.Length)
+	}
+
+	downloaded, err := ncFile.IsFileDownloaded(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downloaded) != 1 || !downloaded[0] {
+		t.Fatal("expected generation to be downloaded")
+	}
+
+	// read the seed back through storage and rebuild it somewhere else
+	data := make([]byte, ncFile.Info.Length)
+	if _, err := ncFile.NewStorage(root).ReadAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	copyDir := filepath.Join(dir, "copy")
+	storage := ncFile.NewStorage(filepath.Join(copyDir, ncFile.Info.Name))
+	if err := storage.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.WriteAt(data[:500], 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.WriteAt(data[500:], 500); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err = ncFile.IsFileDownloaded(copyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !downloaded[0] {
+		t.Fatal("expected rebuilt generation to be downloaded")
+	}
+
+	os.Remove(filepath.Join(root, "sub", "deep", "c.go"))
+	downloaded, err = ncFile.IsFileDownloaded(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloaded[0] {
+		t.Fatal("expected generation with missing file not to be downloaded")
+	}
+}
+
+func TestInfoHash(t *testing.T) {
+	f, err := os.CreateTemp("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	err = seed.CreateSeedFile(f.Name(), "This is a test", "127.0.0.1:8080", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name() + ".nc")
+	ncFile, err := seed.NewNcFileFromSeedFile(f.Name() + ".nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infoHash, err := ncFile.InfoHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infoHash) != 20 {
+		t.Fatalf("expected 20 byte infohash, got %d", len(infoHash))
+	}
+	infoHashV2, err := ncFile.InfoHashV2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infoHashV2) != 32 {
+		t.Fatalf("expected 32 byte infohash, got %d", len(infoHashV2))
+	}
+
+	// fields outside of info do not change the identity of the swarm
+	ncFile.Comment = "Another comment"
+	ncFile.Announce = "127.0.0.1:8081"
+	other, _ := ncFile.InfoHash()
+	if string(other) != string(infoHash) {
+		t.Fatal("infohash changed with fields outside of info")
+	}
+
+	ncFile.Info.Name = "renamed"
+	other, _ = ncFile.InfoHash()
+	if string(other) == string(infoHash) {
+		t.Fatal("infohash did not change with info")
+	}
+}
+
+func TestCreateSeedFileWithOptions(t *testing.T) {
+	f, err := os.CreateTemp("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	data := make([]byte, 200<<10)
+	rand.Read(data)
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	options := seed.Options{GenerationLength: 64 << 10, PieceLength: 16 << 10, Sparsity: 0.5, Field: seed.DefaultField}
+	err = seed.CreateSeedFileWithOptions(f.Name(), "This is a test", "127.0.0.1:8080", "", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name() + ".nc")
+	ncFile, err := seed.NewNcFileFromSeedFile(f.Name() + ".nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ncFile.GetGenerationLength() != 64<<10 || ncFile.GetPieceLength() != 16<<10 || ncFile.GetSparsity() != 0.5 {
+		t.Fatalf("options are not stored in seed: %+v", ncFile.Info)
+	}
+	if len(ncFile.Info.Hash) != 4 {
+		t.Fatalf("expected 4 generations, got %d", len(ncFile.Info.Hash))
+	}
+	// coded pieces of a generation match its piece hashes
+	hashes := ncFile.GetPieceHashes(0)
+	if len(hashes) != 4 {
+		t.Fatalf("expected 4 piece hashes, got %d", len(hashes))
+	}
+	enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(galoisfield.GF256, data[:64<<10], 4, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := coder.VerifyCodedPiece(galoisfield.GF256, ncFile.Info.Hash[0], enc.CodedPiece(), hashes); err != nil {
+		t.Fatal(err)
+	}
+
+	downloaded, err := ncFile.IsFileDownloaded(filepath.Dir(f.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ok := range downloaded {
+		if !ok {
+			t.Fatalf("expected generation %d to be downloaded", i)
+		}
+	}
+
+	options.PieceLength = options.GenerationLength
+	if err := seed.CreateSeedFileWithOptions(f.Name(), "", "", "", options); err == nil {
+		t.Fatal("expected error for a generation with a single piece")
+	}
+}
+
+func TestCreateSeedFileOverGF65536(t *testing.T) {
+	f, err := os.CreateTemp("", "seed-field-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	// the last generation is of an odd length
+	data := make([]byte, 100<<10+333)
+	rand.Read(data)
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	options := seed.Options{GenerationLength: 64 << 10, PieceLength: 16 << 10, Sparsity: 0.5, Field: "gf65536"}
+	if err := seed.CreateSeedFileWithOptions(f.Name(), "", "", "", options); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name() + ".nc")
+	ncFile, err := seed.NewNcFileFromSeedFile(f.Name() + ".nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	field, err := ncFile.GetCodingField()
+	if err != nil || field != galoisfield.GF65536 {
+		t.Fatalf("expected seed to be coded over gf65536, got %v", ncFile.GetField())
+	}
+
+	last := data[64<<10:]
+	pieceCount := ncFile.GetPieceCount(1)
+	enc, err := encoder.NewSparseRLNCEncoderWithPieceCount(field, last, pieceCount, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := coder.VerifyCodedPiece(field, ncFile.Info.Hash[1], enc.CodedPiece(), ncFile.GetPieceHashes(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	options.PieceLength = 16<<10 + 1
+	if err := seed.CreateSeedFileWithOptions(f.Name(), "", "", "", options); err == nil {
+		t.Fatal("expected error for a piece length of a partial symbol")
+	}
+	options.Field = "gf3"
+	if err := seed.CreateSeedFileWithOptions(f.Name(), "", "", "", options); err == nil {
+		t.Fatal("expected error for an unknown field")
+	}
+}
+
+func TestAnnounceList(t *testing.T) {
+	tiers := seed.ParseAnnounceList(" a:1, b:2 ;;c:3,")
+	if tiers.String() != "a:1,b:2;c:3" {
+		t.Fatalf("unexpected tiers %q", tiers.String())
+	}
+
+	// a flat list written before tiers were introduced
+	flat, err := bencode.EncodeBytes(map[string]interface{}{
+		"announce":      "a:1",
+		"announce-list": []string{"b:2", "c:3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ncFile := seed.NcFile{}
+	if err := bencode.DecodeBytes(flat, &ncFile); err != nil {
+		t.Fatal(err)
+	}
+	if ncFile.AnnounceList.String() != "b:2;c:3" {
+		t.Fatalf("unexpected tiers %q", ncFile.AnnounceList.String())
+	}
+
+	content, err := (&seed.NcFile{AnnounceList: tiers}).Bencoding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ncFile = seed.NcFile{}
+	if err := bencode.DecodeBytes(content, &ncFile); err != nil {
+		t.Fatal(err)
+	}
+	if ncFile.AnnounceList.String() != tiers.String() {
+		t.Fatalf("unexpected tiers %q", ncFile.AnnounceList.String())
+	}
+}
+
+func TestSeedPaths(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "tree")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", filepath.Join("sub", "b.txt")} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("data of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := seed.CreateSeedFile(root, "", "127.0.0.1:8080", ""); err != nil {
+		t.Fatal(err)
+	}
+	ncFile, err := seed.NewNcFileFromSeedFile(root + ".nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name string
+		path []string
+	}{
+		{"tree", []string{"..", "..", "escaped"}},
+		{"tree", []string{"sub", "..", "..", "escaped"}},
+		{"tree", []string{"sub", ""}},
+		{"tree", []string{"."}},
+		{"tree", []string{"sub/../../escaped"}},
+		{"tree", []string{`sub\..\..\escaped`}},
+		{"tree", []string{"/etc", "passwd"}},
+		{"tree", []string{}},
+		{"..", []string{"a.txt"}},
+		{"", []string{"a.txt"}},
+	} {
+		tampered := *ncFile
+		tampered.Info.Name = c.name
+		tampered.Info.Files = append([]seed.FileInfo{}, ncFile.Info.Files...)
+		tampered.Info.Files[0].Path = c.path
+		content, err := bencode.EncodeBytes(tampered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "tampered.nc")
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := seed.NewNcFileFromSeedFile(path); err == nil {
+			t.Fatalf("seed naming %q %q is loaded", c.name, c.path)
+		}
+	}
+}
+
+func TestLoadInvalidSeed(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "tree")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.bin", "b.bin"} {
+		data := make([]byte, 40<<10)
+		rand.Read(data)
+		if err := os.WriteFile(filepath.Join(root, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	options := seed.Options{GenerationLength: 32 << 10, PieceLength: 8 << 10, Sparsity: 0.5, Field: seed.DefaultField}
+	if err := seed.CreateSeedFileWithOptions(root, "", "127.0.0.1:8080", "", options); err != nil {
+		t.Fatal(err)
+	}
+	ncFile, err := seed.NewNcFileFromSeedFile(root + ".nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ncFile.Info.Hash) != 3 || len(ncFile.Info.PieceHashes) != 3 {
+		t.Fatalf("unexpected seed of %d generations", len(ncFile.Info.Hash))
+	}
+
+	for name, tamper := range map[string]func(info *seed.NcInfo){
+		"missing generation hash": func(info *seed.NcInfo) { info.Hash = info.Hash[:2] },
+		"extra generation hash":   func(info *seed.NcInfo) { info.Hash = append(info.Hash, info.Hash[0]) },
+		"short generation hash":   func(info *seed.NcInfo) { info.Hash[1] = info.Hash[1][:4] },
+		"missing piece hashes":    func(info *seed.NcInfo) { info.PieceHashes = info.PieceHashes[:2] },
+		"short piece hashes": func(info *seed.NcInfo) {
+			info.PieceHashes[2] = info.PieceHashes[2][:len(info.PieceHashes[2])-coder.HashLength]
+		},
+		"file lengths":         func(info *seed.NcInfo) { info.Files[1].Length++ },
+		"negative file length": func(info *seed.NcInfo) { info.Files[0].Length, info.Files[1].Length = -1, info.Length+1 },
+		"piece length":         func(info *seed.NcInfo) { info.PieceLength = info.GenerationLength + 1 },
+		"generation length":    func(info *seed.NcInfo) { info.GenerationLength = -1 },
+		"sparsity":             func(info *seed.NcInfo) { info.Sparsity = "high" },
+		"field":                func(info *seed.NcInfo) { info.Field = "gf3" },
+	} {
+		tampered := *ncFile
+		tampered.Info.Hash = append([][]byte{}, ncFile.Info.Hash...)
+		tampered.Info.PieceHashes = append([][]byte{}, ncFile.Info.PieceHashes...)
+		tampered.Info.Files = append([]seed.FileInfo{}, ncFile.Info.Files...)
+		tamper(&tampered.Info)
+		content, err := bencode.EncodeBytes(tampered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "tampered.nc")
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := seed.NewNcFileFromSeedFile(path); err == nil {
+			t.Fatalf("seed with wrong %s is loaded", name)
+		}
+	}
+
+	path := filepath.Join(dir, "garbage.nc")
+	if err := os.WriteFile(path, []byte("d4:info"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seed.NewNcFileFromSeedFile(path); err == nil {
+		t.Fatal("truncated seed is loaded")
+	}
+}
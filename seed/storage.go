@@ -0,0 +1,169 @@
+package seed
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Storage maps the contiguous byte range described by a seed onto the
+// files on disk. A single file seed is stored at root, a directory seed
+// stores every file of Info.Files below root.
+type Storage struct {
+	files []storageFile
+}
+
+type storageFile struct {
+	path   string
+	offset int64 // offset of the file in the byte range of the seed
+	length int64
+}
+
+func (f *NcFile) NewStorage(root string) *Storage {
+	if !f.IsDir() {
+		return &Storage{files: []storageFile{{path: root, offset: 0, length: f.Info.Length}}}
+	}
+	s := &Storage{files: make([]storageFile, 0, len(f.Info.Files))}
+	offset := int64(0)
+	for _, item := range f.Info.Files {
+		s.files = append(s.files, storageFile{
+			path:   filepath.Join(append([]string{root}, item.Path...)...),
+			offset: offset,
+			length: item.Length,
+		})
+		offset += item.Length
+	}
+	return s
+}
+
+// Length returns the total length of all files
+func (s *Storage) Length() int64 {
+	if len(s.files) == 0 {
+		return 0
+	}
+	last := s.files[len(s.files)-1]
+	return last.offset + last.length
+}
+
+// Check reports whether any file of the storage exists on disk, and
+// returns an error if an existing file does not have the expected size
+func (s *Storage) Check() (bool, error) {
+	exist := false
+	for _, item := range s.files {
+		fi, err := os.Stat(item.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return exist, err
+		}
+		if fi.Size() != item.length {
+			return exist, errors.New("the size of existing file is not equal to the size of seed file")
+		}
+		exist = true
+	}
+	return exist, nil
+}
+
+// ReadAt reads len(p) bytes starting at offset off of the seed, crossing
+// file boundaries where necessary
+func (s *Storage) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, item := range s.files {
+		start, end, ok := item.overlap(off, len(p))
+		if !ok {
+			continue
+		}
+		file, err := os.Open(item.path)
+		if err != nil {
+			return n, err
+		}
+		m, err := file.ReadAt(p[item.offset+start-off:item.offset+end-off], start)
+		file.Close()
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes p at offset off of the seed. Missing files and
+// directories are created, new files are allocated to their full length
+func (s *Storage) WriteAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, item := range s.files {
+		start, end, ok := item.overlap(off, len(p))
+		if !ok {
+			continue
+		}
+		file, err := item.open()
+		if err != nil {
+			return n, err
+		}
+		m, err := file.WriteAt(p[item.offset+start-off:item.offset+end-off], start)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, errors.New("write beyond the end of seed")
+	}
+	return n, nil
+}
+
+// Allocate creates every file of the storage at its full length, including
+// empty files which are never written
+func (s *Storage) Allocate() error {
+	for _, item := range s.files {
+		file, err := item.open()
+		if err != nil {
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overlap returns the range [start, end) inside this file which is
+// covered by length bytes starting at offset off of the seed
+func (f *storageFile) overlap(off int64, length int) (start int64, end int64, ok bool) {
+	start = off - f.offset
+	end = start + int64(length)
+	if start < 0 {
+		start = 0
+	}
+	if end > f.length {
+		end = f.length
+	}
+	return start, end, start < end
+}
+
+func (f *storageFile) open() (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err == nil && fi.Size() != f.length {
+		err = file.Truncate(f.length)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/protocol"
+)
+
+// chokeInterval is how often the upload slots are handed out again, the
+// optimistic unchoke moves on every optimisticRounds of them
+const (
+	chokeInterval    = 10 * time.Second
+	optimisticRounds = 3
+)
+
+// choker hands the upload slots to the interested peers which sent this
+// node the most innovative pieces in the last round, and to those it sent
+// the most while it has nothing to download. One more peer is unchoked
+// optimistically, so that new peers get the chance to reciprocate.
+type choker struct {
+	server     *Server
+	mutex      sync.Mutex
+	sessions   map[*session]*transfer
+	optimistic *session
+	rounds     int
+}
+
+// transfer is the traffic with a peer in the last round
+type transfer struct {
+	received       uint // innovative pieces from the peer
+	sent           uint64
+	lastInnovative uint
+	lastSent       uint64
+}
+
+func newChoker(server *Server) *choker {
+	return &choker{server: server, sessions: make(map[*session]*transfer)}
+}
+
+func (c *choker) add(s *session) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sessions[s] = &transfer{lastInnovative: dc.GetReputation(protocol.PeerID{}, s.addr).Innovative}
+}
+
+func (c *choker) remove(s *session) {
+	c.mutex.Lock()
+	delete(c.sessions, s)
+	if c.optimistic == s {
+		c.optimistic = nil
+	}
+	c.mutex.Unlock()
+	c.rechoke(false)
+}
+
+func (c *choker) run(ctx context.Context) {
+	ticker := time.NewTicker(chokeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.rechoke(true)
+	}
+}
+
+// rechoke hands out the upload slots, at the end of a round the traffic
+// of the round ranks the peers. Slots are handed out between rounds too,
+// when peers become interested or leave.
+func (c *choker) rechoke(round bool) {
+	slots := c.server.GetLimits().UploadSlots
+
+	c.mutex.Lock()
+	if round {
+		c.rounds++
+		for s, t := range c.sessions {
+			innovative := dc.GetReputation(protocol.PeerID{}, s.addr).Innovative
+			sent := s.getSent()
+			t.received, t.sent = innovative-t.lastInnovative, sent-t.lastSent
+			t.lastInnovative, t.lastSent = innovative, sent
+		}
+	}
+	interested := make([]*session, 0)
+	for s := range c.sessions {
+		if s.isInterested() {
+			interested = append(interested, s)
+		}
+	}
+	choked := make(map[*session]bool)
+	if slots > 0 {
+		sort.Slice(interested, func(i, j int) bool {
+			a, b := c.sessions[interested[i]], c.sessions[interested[j]]
+			if a.received != b.received {
+				return a.received > b.received
+			}
+			return a.sent > b.sent
+		})
+		candidates := make([]*session, 0)
+		for i, s := range interested {
+			choked[s] = i >= slots
+			if choked[s] {
+				candidates = append(candidates, s)
+			}
+		}
+		// keep the optimistic unchoke for its rounds, unless it got a
+		// slot or is not interested any more
+		if c.optimistic == nil || !choked[c.optimistic] || round && c.rounds%optimisticRounds == 0 {
+			c.optimistic = nil
+			if len(candidates) > 0 {
+				c.optimistic = candidates[rand.Intn(len(candidates))]
+			}
+		}
+		if c.optimistic != nil {
+			choked[c.optimistic] = false
+		}
+	}
+	c.mutex.Unlock()
+
+	for _, s := range interested {
+		s.setChoked(choked[s])
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/protocol"
+)
+
+// newTestSession returns an interested session whose messages are
+// discarded
+func newTestSession(t *testing.T, server *Server, addr string) *session {
+	local, remote := net.Pipe()
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+	go io.Copy(io.Discard, remote)
+	s := newSession(server, protocol.NewConn(local), nil, addr)
+	s.requested = append(s.requested, 0)
+	return s
+}
+
+func TestChokerUnchokesByReputation(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		slots      int
+		innovative []int    // innovative pieces each peer sent in the round
+		sent       []uint64 // bytes sent to each peer in the round
+		unchoked   []int    // peers holding a slot
+	}{
+		{"innovative pieces", 2, []int{5, 1, 3, 0}, []uint64{0, 0, 0, 0}, []int{0, 2}},
+		{"bytes sent", 1, []int{0, 0, 0}, []uint64{10, 30, 20}, []int{1}},
+		{"innovative pieces before bytes sent", 1, []int{0, 1, 0}, []uint64{50, 0, 40}, []int{1}},
+		{"fewer peers than slots", 4, []int{0, 2}, []uint64{0, 0}, []int{0, 1}},
+	} {
+		server := NewServer()
+		server.limits.UploadSlots = c.slots
+		sessions := make([]*session, len(c.innovative))
+		for i := range sessions {
+			sessions[i] = newTestSession(t, server, fmt.Sprintf("choke %s %d", c.name, i))
+			server.choker.add(sessions[i])
+		}
+		for i, s := range sessions {
+			for j := 0; j < c.innovative[i]; j++ {
+				dc.ReportPiece(s.addr, true)
+			}
+			s.sent = c.sent[i]
+		}
+		server.choker.rechoke(true)
+
+		unchoked := 0
+		for _, s := range sessions {
+			if !s.choked {
+				unchoked++
+			}
+		}
+		for _, i := range c.unchoked {
+			if sessions[i].choked {
+				t.Fatalf("%s: expected peer %d to be unchoked", c.name, i)
+			}
+		}
+		// one more peer is unchoked optimistically
+		expected := c.slots + 1
+		if expected > len(sessions) {
+			expected = len(sessions)
+		}
+		if unchoked != expected {
+			t.Fatalf("%s: %d peers unchoked, expected %d", c.name, unchoked, expected)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"sync"
+)
+
+// Limits bound the peers the server serves at once, 0 is unlimited
+type Limits struct {
+	MaxConnections      int // connections of all peers
+	MaxConnectionsPerIP int
+	MaxGenerationPeers  int // peers sent pieces of one generation, each costs an encoder
+	UploadSlots         int // peers unchoked for reciprocating, one more is unchoked optimistically
+}
+
+var DefaultLimits = Limits{
+	MaxConnections:      128,
+	MaxConnectionsPerIP: 8,
+	MaxGenerationPeers:  32,
+	UploadSlots:         4,
+}
+
+// maxRefusing bounds the connections being refused with a busy message at
+// once, connections beyond it are closed right away
+const maxRefusing = 32
+
+const (
+	busyConnections = "too many connections"
+	busyIP          = "too many connections from the address"
+)
+
+type generationKey struct {
+	infoHash string
+	index    uint32
+}
+
+// admission counts what the peers being served hold against the limits
+type admission struct {
+	mutex       sync.Mutex
+	connections int
+	refusing    int
+	ips         map[string]int
+	generations map[generationKey]int
+}
+
+func newAdmission() *admission {
+	return &admission{ips: make(map[string]int), generations: make(map[generationKey]int)}
+}
+
+// admit takes a connection from ip, or returns the reason to refuse it
+// for. A refused connection has to be released by refused.
+func (a *admission) admit(limits Limits, ip string) (reason string, ok bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	switch {
+	case limits.MaxConnections > 0 && a.connections >= limits.MaxConnections:
+		reason = busyConnections
+	case limits.MaxConnectionsPerIP > 0 && a.ips[ip] >= limits.MaxConnectionsPerIP:
+		reason = busyIP
+	default:
+		a.connections++
+		a.ips[ip]++
+		return "", true
+	}
+	a.refusing++
+	return reason, false
+}
+
+func (a *admission) release(ip string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.connections--
+	if a.ips[ip]--; a.ips[ip] <= 0 {
+		delete(a.ips, ip)
+	}
+}
+
+// canRefuse reports whether a refused connection is answered, rather
+// than closed right away
+func (a *admission) canRefuse() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.refusing <= maxRefusing
+}
+
+func (a *admission) refused() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.refusing--
+}
+
+// admitGeneration takes a place among the peers sent pieces of the
+// generation
+func (a *admission) admitGeneration(limits Limits, infoHash []byte, index uint32) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	key := generationKey{string(infoHash), index}
+	if limits.MaxGenerationPeers > 0 && a.generations[key] >= limits.MaxGenerationPeers {
+		return false
+	}
+	a.generations[key]++
+	return true
+}
+
+func (a *admission) releaseGeneration(infoHash []byte, index uint32) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	key := generationKey{string(infoHash), index}
+	if a.generations[key]--; a.generations[key] <= 0 {
+		delete(a.generations, key)
+	}
+}
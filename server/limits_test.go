@@ -0,0 +1,72 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestAdmission(t *testing.T) {
+	limits := Limits{MaxConnections: 3, MaxConnectionsPerIP: 2}
+	a := newAdmission()
+	for _, c := range []struct {
+		ip      string
+		release bool // releases a connection from ip instead of admitting one
+		reason  string
+	}{
+		{ip: "10.0.0.1"},
+		{ip: "10.0.0.1"},
+		{ip: "10.0.0.1", reason: busyIP},
+		{ip: "10.0.0.2"},
+		{ip: "10.0.0.3", reason: busyConnections},
+		{ip: "10.0.0.1", release: true},
+		{ip: "10.0.0.3"},
+		{ip: "10.0.0.2", reason: busyConnections},
+	} {
+		if c.release {
+			a.release(c.ip)
+			continue
+		}
+		reason, ok := a.admit(limits, c.ip)
+		if reason != c.reason || ok != (c.reason == "") {
+			t.Fatalf("%s: got %q, expected %q", c.ip, reason, c.reason)
+		}
+		if !ok {
+			a.refused()
+		}
+	}
+	if a.connections != 3 || a.refusing != 0 {
+		t.Fatalf("%d connections and %d refusing left", a.connections, a.refusing)
+	}
+
+	unlimited := newAdmission()
+	for i := 0; i < 2*DefaultLimits.MaxConnections; i++ {
+		if _, ok := unlimited.admit(Limits{}, "10.0.0.1"); !ok {
+			t.Fatal("expected connections to be admitted without limits")
+		}
+	}
+}
+
+func TestAdmitGeneration(t *testing.T) {
+	limits := Limits{MaxGenerationPeers: 2}
+	a := newAdmission()
+	infoHash := []byte("infohash")
+	for i, c := range []struct {
+		index   uint32
+		release bool
+		ok      bool
+	}{
+		{0, false, true},
+		{0, false, true},
+		{0, false, false},
+		{1, false, true},
+		{0, true, false},
+		{0, false, true},
+	} {
+		if c.release {
+			a.releaseGeneration(infoHash, c.index)
+			continue
+		}
+		if ok := a.admitGeneration(limits, infoHash, c.index); ok != c.ok {
+			t.Fatalf("step %d: admitted %v, expected %v", i, ok, c.ok)
+		}
+	}
+}
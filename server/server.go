@@ -2,29 +2,34 @@ package server
 
 import (
 	"context"
-	"encoding/binary"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"strconv"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/protocol"
 )
 
 type Server struct {
-	host   string
-	port   string
-	cancel context.CancelFunc
-	mu     sync.Mutex
+	host      string
+	port      string
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	limits    Limits
+	admission *admission
+	choker    *choker
 }
 
 func NewServer() *Server {
 	// create a new server
 	log.Println("NewServer")
-	return &Server{host: "127.0.0.1", port: "8080", cancel: nil, mu: sync.Mutex{}}
+	s := &Server{host: "127.0.0.1", port: "8080", cancel: nil, mu: sync.Mutex{}, limits: DefaultLimits, admission: newAdmission()}
+	s.choker = newChoker(s)
+	return s
 }
 
 func (s *Server) SetHost(host string) {
@@ -35,141 +40,132 @@ func (s *Server) SetPort(port string) {
 	s.port = port
 }
 
+// SetLimits sets the limits of the peers served, connections already
+// served are not closed for them
+func (s *Server) SetLimits(limits Limits) {
+	s.mu.Lock()
+	s.limits = limits
+	s.mu.Unlock()
+	s.choker.rechoke(false)
+}
+
+func (s *Server) GetLimits() Limits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limits
+}
+
 func handleConnection(ctx context.Context, conn net.Conn, server *Server) {
 	// handle a connection
 	defer conn.Close()
 
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		<-ctx.Done()
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
 		conn.Close()
 	}()
 
-	reserved, hash, err := handShake(conn, server)
+	// connections beyond the limits are answered busy, unless too many are
+	// being answered already
+	ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	busy, admitted := server.admission.admit(server.GetLimits(), ip)
+	if admitted {
+		defer server.admission.release(ip)
+	} else {
+		defer server.admission.refused()
+		if !server.admission.canRefuse() {
+			return
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(protocol.HandshakeTimeout))
+	limited := dc.LimitConn(conn)
+	secureConn, err := protocol.Negotiate(limited, "", true, dc.GetSecurity())
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	if reserved[0] == 0x01 {
-		// This is a heartbeat
+	infoHash, addr, err := handShake(secureConn, server, busy)
+	if err != nil {
+		log.Println(err)
 		return
 	}
-
-	if reserved[1] == 0x01 {
-		// send byte 0x01 to client
-		_, err := conn.Write([]byte{0x01})
-		if err != nil {
-			log.Println(err)
-		}
-		// This is a request for neighbours
-		neighbourItems := dc.GetNeighbours(hash)
-		// join neighbours' addr by ','
-		neighbours := make([]string, len(neighbourItems))
-		for i, item := range neighbourItems {
-			neighbours[i] = item.Addr
-		}
-		neighbourStr := strings.Join(neighbours, ",")
-		// send neighbours to client
-		pstrlenbuf := make([]byte, 4)
-		pstrbuf := []byte(neighbourStr)
-		binary.BigEndian.PutUint32(pstrlenbuf, uint32(len(pstrbuf)))
-		n, err := conn.Write(pstrlenbuf)
-		if err != nil || n != 4 {
-			log.Println(err)
-		}
-		n, err = conn.Write(pstrbuf)
-		if err != nil || n != len(pstrbuf) {
-			log.Println(err)
-		}
-		return
+	dc.LimitPeer(limited, addr)
+	messageConn := protocol.NewConn(secureConn)
+	if file := dc.GetFileByInfoHash(infoHash); file != nil {
+		file.LimitConn(limited)
+		messageConn.SetMaxPayloadSize(file.MaxPayloadSize())
 	}
-
-	// send codedPieces to client
-	// send byte 0x02 to client
-	for {
-		_, err = conn.Write([]byte{0x02})
-		if err != nil {
-			log.Println(err)
-		}
-
-		codedPiece := dc.GetCodedPiece(hash)
-		if codedPiece == nil {
-			break
-		}
-		// data format: [vector length][vector][piece length][piece]
-		// send codedPiece to client
-		lenbuf := make([]byte, 8)
-		binary.BigEndian.PutUint64(lenbuf, uint64(len(codedPiece.Vector)))
-		n, err := conn.Write(lenbuf)
-		if err != nil || n != 8 {
-			log.Println(err)
-			break
-		}
-		n, err = conn.Write(codedPiece.Vector)
-		if err != nil || n != len(codedPiece.Vector) {
-			log.Println(err)
-			break
-		}
-		binary.BigEndian.PutUint64(lenbuf, uint64(len(codedPiece.Piece)))
-		n, err = conn.Write(lenbuf)
-		if err != nil || n != 8 {
-			log.Println(err)
-			break
-		}
-		n, err = conn.Write(codedPiece.Piece)
-		if err != nil || n != len(codedPiece.Piece) {
-			log.Println(err)
-			break
-		}
+	if err := secureConn.SetDeadline(time.Time{}); err != nil {
+		return
 	}
+	newSession(server, messageConn, infoHash, addr).run()
 }
 
-func handShake(conn net.Conn, server *Server) (reserved []byte, hash []byte, err error) {
-	rbuf := make([]byte, 45)
-	n, err := io.ReadFull(conn, rbuf)
-	if err != nil || n != 45 {
-		return reserved, nil, err
+// handShake answers the handshake for the swarm, both sides prove their
+// identity for it and the node is recorded under its peer id, whose
+// address is returned. Banned nodes are refused, and so is every node if
+// busy gives a reason to.
+func handShake(t *protocol.Transport, server *Server, busy string) (infoHash []byte, addr string, err error) {
+	h, err := protocol.ReadHandshake(t)
+	if err != nil {
+		return nil, "", err
+	}
+	clientIP, _, err := net.SplitHostPort(t.RemoteAddr().String())
+	if err != nil {
+		return nil, "", err
 	}
-	// pstrlen
-	if rbuf[0] != 0x0e {
-		return reserved, nil, fmt.Errorf("pstrlen is not 14")
+	addr = net.JoinHostPort(clientIP, strconv.Itoa(int(h.Port)))
+	if dc.IsBanned(protocol.PeerID{}, addr) {
+		return nil, "", errBanned
 	}
-	// protocol name
-	if string(rbuf[1:15]) != "Network Coding" {
-		return reserved, nil, fmt.Errorf("protocolName is not Network Coding")
+	defer func() {
+		if protocol.IsProtocolError(err) {
+			dc.ReportProtocolError(addr)
+		}
+	}()
+	file := dc.GetFileByInfoHash(h.InfoHash[:])
+	if file != nil && h.Field() != file.Field.ID() {
+		return nil, "", protocol.ErrFieldMismatch
 	}
-	clientIP := strings.Split(conn.RemoteAddr().String(), ":")[0]
-	serverPort := binary.BigEndian.Uint16(rbuf[43:45])
-	addr := clientIP + ":" + strconv.Itoa(int(serverPort))
-	dc.AddNode(addr)
-	exist := dc.IsGenerationExist(rbuf[23:43])
 
 	// response
-	sbuf := make([]byte, 45)
-	sbuf[0] = 0x0e
-	// protocolName
-	copy(sbuf[1:15], []byte("Network Coding"))
-	// reserved
-	copy(sbuf[15:23], rbuf[15:23])
-	// infohash
-	if exist {
-		copy(sbuf[23:43], rbuf[23:43])
-	} else {
-		copy(sbuf[23:43], make([]byte, 20))
-	}
-	// serverport
 	myUint64, err := strconv.ParseUint(server.port, 10, 16)
 	if err != nil {
-		return reserved, hash, err
+		return nil, "", err
+	}
+	// infohash is zero if the swarm is not served
+	response := protocol.NewHandshake(nil, uint16(myUint64))
+	if file != nil {
+		response.InfoHash = h.InfoHash
+		response.SetField(file.Field.ID())
 	}
-	binary.BigEndian.PutUint16(rbuf[43:45], uint16(myUint64))
-	// send response
-	n, err = conn.Write(sbuf)
-	if err != nil || n != 45 {
-		return reserved, hash, err
+	if err := protocol.WriteHandshake(t, response); err != nil {
+		return nil, "", err
 	}
-	reserved = rbuf[15:23]
-	hash = rbuf[23:43]
-	return reserved, hash, nil
+	if busy != "" {
+		protocol.WriteMessage(t, protocol.NewBusy(busy))
+		return nil, "", fmt.Errorf("refused %s: %w: %s", addr, protocol.ErrBusy, busy)
+	}
+	if err := t.WriteIdentity(response); err != nil {
+		return nil, "", err
+	}
+	id, err := t.ReadIdentity(h)
+	if err != nil {
+		return nil, "", err
+	}
+	if id == dc.GetSecurity().Identity.PeerID() {
+		return nil, "", errSelf
+	}
+	if dc.IsBanned(id, addr) {
+		return nil, "", errBanned
+	}
+	dc.AddPeer(id, addr)
+	return h.InfoHash[:], addr, nil
 }
 
 func (s *Server) Start(panicOccurred chan error) {
@@ -203,6 +199,7 @@ func (s *Server) Start(panicOccurred chan error) {
 	// print server address
 	addr := listener.Addr()
 	log.Println("Server started at " + addr.String())
+	go s.choker.run(ctx)
 
 	go func() {
 		<-ctx.Done()
@@ -243,3 +240,10 @@ func (s *Server) IsRunning() bool {
 	}
 	return true
 }
+
+var (
+	errSelf   = errors.New("connected to self")
+	errBanned = errors.New("node is banned")
+)
+
+var errGenerationNotFound = errors.New("generation not found")
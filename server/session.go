@@ -0,0 +1,371 @@
+package server
+
+import (
+	"io"
+	"log"
+	"sync"
+
+	"github.com/aecra/PeerCodeX/coder"
+	"github.com/aecra/PeerCodeX/dc"
+	"github.com/aecra/PeerCodeX/protocol"
+)
+
+// session serves the messages of one connection. Requested generations
+// are served in turn as long as the client grants credit for them and the
+// choker leaves it unchoked, control messages are answered in between.
+type session struct {
+	server    *Server
+	addr      string // service address of the peer
+	conn      *protocol.Conn
+	infoHash  []byte
+	file      *dc.File // nil if the swarm is not served
+	requested []uint32 // generations to send pieces of, in turn
+	credit    map[uint32]uint
+	subspaces map[uint32]*coder.Subspace // spans of the decoders of the client
+	hashing   map[uint32]bool            // generations whose checks are computed
+	next      int                        // position in requested of the next piece
+	choked    bool
+	sent      uint64 // bytes of pieces sent
+	mutex     sync.Mutex
+	wake      chan struct{}
+	done      chan struct{}
+}
+
+func newSession(server *Server, conn *protocol.Conn, infoHash []byte, addr string) *session {
+	return &session{
+		server:    server,
+		addr:      addr,
+		conn:      conn,
+		infoHash:  infoHash,
+		file:      dc.GetFileByInfoHash(infoHash),
+		requested: make([]uint32, 0),
+		credit:    make(map[uint32]uint),
+		subspaces: make(map[uint32]*coder.Subspace),
+		hashing:   make(map[uint32]bool),
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+func (s *session) run() {
+	s.server.choker.add(s)
+	defer func() {
+		close(s.done)
+		s.mutex.Lock()
+		requested := s.requested
+		s.requested = nil
+		s.mutex.Unlock()
+		for _, index := range requested {
+			s.server.admission.releaseGeneration(s.infoHash, index)
+		}
+		s.server.choker.remove(s)
+	}()
+	if s.file != nil {
+		for i, downloaded := range s.file.GetCompleted() {
+			if downloaded {
+				if err := s.conn.WriteMessage(protocol.NewHaveGeneration(uint32(i))); err != nil {
+					return
+				}
+			}
+		}
+	}
+	go s.sendPieces()
+
+	for {
+		m, err := s.conn.ReadMessage()
+		if err != nil {
+			if err != io.EOF {
+				log.Println(err)
+			}
+			return
+		}
+		if err := s.handleMessage(m); err != nil {
+			log.Println(err)
+			s.conn.WriteMessage(protocol.NewError(err.Error()))
+			return
+		}
+		if m.Type == protocol.MsgError {
+			log.Println("peer error: " + m.Reason())
+			return
+		}
+	}
+}
+
+func (s *session) handleMessage(m *protocol.Message) error {
+	switch m.Type {
+	case protocol.MsgKeepAlive:
+		return s.conn.WriteMessage(protocol.NewKeepAlive())
+	case protocol.MsgGetNeighbours:
+		neighbourItems := dc.GetNeighbours(s.infoHash)
+		neighbours := make([]string, len(neighbourItems))
+		for i, item := range neighbourItems {
+			neighbours[i] = item.Addr
+		}
+		return s.conn.WriteMessage(protocol.NewNeighbours(neighbours))
+	case protocol.MsgRequestGeneration:
+		index, err := m.Index()
+		if err != nil {
+			return err
+		}
+		if s.file == nil || s.file.GetGeneration(uint(index)) == nil {
+			return errGenerationNotFound
+		}
+		if !s.request(index) {
+			// too many peers are sent the generation, the client may
+			// request it again later
+			return s.conn.WriteMessage(protocol.NewStop(index))
+		}
+	case protocol.MsgStop:
+		index, err := m.Index()
+		if err != nil {
+			return err
+		}
+		s.stop(index)
+	case protocol.MsgCredit:
+		index, credit, err := m.Credit()
+		if err != nil {
+			return err
+		}
+		s.addCredit(index, uint(credit))
+	case protocol.MsgRankUpdate:
+		index, rank, err := m.Rank()
+		if err != nil {
+			return err
+		}
+		// the client has all it needs, even if it did not stop yet
+		if s.file == nil {
+			return errGenerationNotFound
+		}
+		if generation := s.file.GetGeneration(uint(index)); generation != nil &&
+			uint(rank) >= s.file.GetPieceCount(generation.Hash) {
+			s.stop(index)
+		}
+	case protocol.MsgSubspace:
+		if s.file == nil {
+			return errGenerationNotFound
+		}
+		index, subspace, err := m.Subspace(s.file.Field)
+		if err != nil {
+			return err
+		}
+		s.setSubspace(index, subspace)
+	case protocol.MsgRequestChecks:
+		index, key, err := m.CheckKey()
+		if err != nil {
+			return err
+		}
+		if s.file == nil || s.file.GetGeneration(uint(index)) == nil {
+			return errGenerationNotFound
+		}
+		// hashing reads the whole generation, the session goes on meanwhile
+		go s.sendChecks(s.file.GetGeneration(uint(index)), index, key)
+	case protocol.MsgHaveGeneration, protocol.MsgError:
+	default:
+		return protocol.ErrUnexpected
+	}
+	return nil
+}
+
+// request adds the generation to those sent, unless too many peers are
+// sent it already
+func (s *session) request(index uint32) bool {
+	s.mutex.Lock()
+	for _, i := range s.requested {
+		if i == index {
+			s.mutex.Unlock()
+			return true
+		}
+	}
+	if !s.server.admission.admitGeneration(s.server.GetLimits(), s.infoHash, index) {
+		s.mutex.Unlock()
+		return false
+	}
+	s.requested = append(s.requested, index)
+	s.mutex.Unlock()
+	s.server.choker.rechoke(false)
+	return true
+}
+
+// addCredit adds credit of the generation, credit granted while choked
+// is void
+func (s *session) addCredit(index uint32, credit uint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.choked {
+		return
+	}
+	for _, i := range s.requested {
+		if i == index {
+			s.credit[index] += credit
+			select {
+			case s.wake <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+func (s *session) stop(index uint32) {
+	s.mutex.Lock()
+	for i, item := range s.requested {
+		if item == index {
+			s.requested = append(s.requested[:i], s.requested[i+1:]...)
+			delete(s.credit, index)
+			delete(s.subspaces, index)
+			interested := len(s.requested) > 0
+			s.mutex.Unlock()
+			s.server.admission.releaseGeneration(s.infoHash, index)
+			if !interested {
+				// the upload slot is free for another peer
+				s.server.choker.rechoke(false)
+			}
+			return
+		}
+	}
+	s.mutex.Unlock()
+}
+
+func (s *session) isInterested() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.requested) > 0
+}
+
+func (s *session) getSent() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sent
+}
+
+// setChoked tells the client if its choke state changes, the credit it
+// granted is void once it is choked
+func (s *session) setChoked(choked bool) {
+	s.mutex.Lock()
+	if s.choked == choked {
+		s.mutex.Unlock()
+		return
+	}
+	s.choked = choked
+	m := protocol.NewUnchoke()
+	if choked {
+		s.credit = make(map[uint32]uint)
+		m = protocol.NewChoke()
+	}
+	s.mutex.Unlock()
+
+	// a failed write ends the session in its read loop
+	s.conn.WriteMessage(m)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *session) setSubspace(index uint32, subspace *coder.Subspace) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, i := range s.requested {
+		if i == index {
+			s.subspaces[index] = subspace
+			return
+		}
+	}
+}
+
+// codedPiece codes a piece of the generation which is innovative for the
+// client if its subspace is known. Pieces sent are added to the subspace,
+// so that pieces in flight are not coded again.
+func (s *session) codedPiece(index uint32) *coder.CodedPiece {
+	generation := s.file.GetGeneration(uint(index))
+	s.mutex.Lock()
+	subspace := s.subspaces[index]
+	s.mutex.Unlock()
+	if subspace == nil || subspace.PieceCount() != s.file.GetPieceCount(generation.Hash) {
+		return generation.GetCodedPiece()
+	}
+
+	codedPiece := generation.GetInnovativeCodedPiece(subspace)
+	if codedPiece != nil {
+		s.mutex.Lock()
+		subspace.Add(codedPiece.Vector)
+		s.mutex.Unlock()
+	}
+	return codedPiece
+}
+
+// nextRequested returns the next generation with credit to send a piece
+// of in turn, and uses up one of its credit. Nothing is sent while choked.
+func (s *session) nextRequested() (uint32, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.choked {
+		return 0, false
+	}
+	for range s.requested {
+		s.next = s.next % len(s.requested)
+		index := s.requested[s.next]
+		s.next++
+		if s.credit[index] > 0 {
+			s.credit[index]--
+			return index, true
+		}
+	}
+	return 0, false
+}
+
+func (s *session) sendPieces() {
+	for {
+		index, ok := s.nextRequested()
+		if !ok {
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+
+		codedPiece := s.codedPiece(index)
+		if codedPiece == nil {
+			// nothing useful to code the generation from, tell the client
+			s.stop(index)
+			if err := s.conn.WriteMessage(protocol.NewStop(index)); err != nil {
+				return
+			}
+			continue
+		}
+		m := protocol.NewPiece(index, codedPiece, s.file.Field)
+		if err := s.conn.WriteMessage(m); err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.sent += uint64(len(m.Payload))
+		s.mutex.Unlock()
+		s.file.AddUploaded(len(m.Payload))
+	}
+}
+
+// sendChecks sends the hashes of the source pieces of the generation under
+// the key of the client, none if it is not held. Checks of a generation
+// are computed for one request at a time, the others get none.
+func (s *session) sendChecks(generation *dc.Generation, index uint32, key []byte) {
+	s.mutex.Lock()
+	busy := s.hashing[index]
+	s.hashing[index] = true
+	s.mutex.Unlock()
+	var hashes []byte
+	if !busy {
+		var err error
+		if hashes, err = generation.HashPieces(key); err != nil {
+			log.Println(err)
+			hashes = nil
+		}
+		s.mutex.Lock()
+		delete(s.hashing, index)
+		s.mutex.Unlock()
+	}
+	if err := s.conn.WriteMessage(protocol.NewChecks(index, hashes)); err != nil {
+		log.Println(err)
+	}
+}
@@ -6,19 +6,23 @@ import (
 	"os"
 )
 
-func GetHashsofFile(path string) (hashs [][]byte, err error) {
+func GetHashsofFile(path string, generationLength int64) (hashs [][]byte, err error) {
 	// get hash of a file
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
-	// calculate hash per 128MB
+	return GetHashsofReader(file, generationLength)
+}
+
+func GetHashsofReader(reader io.Reader, generationLength int64) (hashs [][]byte, err error) {
+	// calculate hash per generation
 	hashCalculator := sha1.New()
+	buf := make([]byte, generationLength)
 	for {
-		buf := make([]byte, 1<<27)
-		n, err := file.Read(buf)
-		if err != nil && err != io.EOF {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 			return nil, err
 		}
 		if n == 0 {
@@ -1,8 +1,11 @@
 package tools
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 func FormatByteSize(bytes int64) string {
@@ -21,3 +24,24 @@ func FormatByteSize(bytes int64) string {
 
 	return formatted
 }
+
+// ParseByteSize parses sizes like "128MB", "1 KB" or "4096" into bytes,
+// units are powers of 1024 as in FormatByteSize
+func ParseByteSize(s string) (int64, error) {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	exponent := 0
+	for i := len(units) - 1; i >= 0; i-- {
+		if strings.HasSuffix(s, units[i]) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, units[i]))
+			exponent = i
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, errors.New("invalid byte size")
+	}
+	return int64(value * math.Pow(1024, float64(exponent))), nil
+}
@@ -0,0 +1,57 @@
+package tracker
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/zeebo/bencode"
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Announce sends an announce to the tracker at announceURL
+func Announce(announceURL string, req *Request) (*Response, error) {
+	u, err := url.Parse(announceURL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("info_hash", hex.EncodeToString(req.InfoHash))
+	query.Set("port", strconv.Itoa(int(req.Port)))
+	query.Set("uploaded", strconv.FormatInt(req.Uploaded, 10))
+	query.Set("downloaded", strconv.FormatInt(req.Downloaded, 10))
+	query.Set("completed", hex.EncodeToString(req.Completed))
+	if req.Event != EventNone {
+		query.Set("event", req.Event)
+	}
+	if req.NumWant > 0 {
+		query.Set("numwant", strconv.Itoa(req.NumWant))
+	}
+	u.RawQuery = query.Encode()
+
+	httpResp, err := httpClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, errors.New("tracker responded " + httpResp.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	resp := &Response{}
+	if err := bencode.DecodeBytes(content, resp); err != nil {
+		return nil, err
+	}
+	if resp.FailureReason != "" {
+		return resp, errors.New(resp.FailureReason)
+	}
+	return resp, nil
+}
@@ -0,0 +1,226 @@
+package tracker
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zeebo/bencode"
+)
+
+type peer struct {
+	Peer
+	lastSeen time.Time
+}
+
+// Tracker keeps the peers of every swarm announced to it. Peers which did
+// not announce for two intervals are dropped, along with swarms left
+// empty, and at most maxSwarms swarms are tracked at once.
+type Tracker struct {
+	interval  time.Duration
+	maxSwarms int
+	swarms    map[string]map[string]*peer // infohash -> addr -> peer
+	mu        sync.Mutex
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		interval:  DefaultInterval * time.Second,
+		maxSwarms: DefaultMaxSwarms,
+		swarms:    make(map[string]map[string]*peer),
+	}
+}
+
+func (t *Tracker) SetMaxSwarms(maxSwarms int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxSwarms = maxSwarms
+}
+
+// Swarms returns the number of swarms tracked
+func (t *Tracker) Swarms() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.swarms)
+}
+
+// Run sweeps expired peers and empty swarms every interval, until ctx is
+// done. Swarms nobody announces to anymore are only dropped by the sweep.
+func (t *Tracker) Run(ctx context.Context) {
+	for {
+		t.mu.Lock()
+		interval := t.interval
+		t.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+			t.Sweep()
+		}
+	}
+}
+
+// Sweep drops the peers which did not announce for two intervals, and the
+// swarms left without peers
+func (t *Tracker) Sweep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep()
+}
+
+func (t *Tracker) sweep() {
+	for key, swarm := range t.swarms {
+		t.expire(swarm)
+		if len(swarm) == 0 {
+			delete(t.swarms, key)
+		}
+	}
+}
+
+func (t *Tracker) SetInterval(interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.interval = interval
+}
+
+// Handler returns the HTTP handler serving announces at /announce
+func (t *Tracker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/announce", t.handleAnnounce)
+	return mux
+}
+
+func (t *Tracker) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	req, err := parseRequest(r)
+	if err != nil {
+		writeResponse(w, &Response{FailureReason: err.Error()})
+		return
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		writeResponse(w, &Response{FailureReason: err.Error()})
+		return
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(req.Port)))
+	writeResponse(w, t.Announce(addr, req))
+}
+
+// Announce records the announce of the peer at addr and returns the other
+// peers of the swarm
+func (t *Tracker) Announce(addr string, req *Request) *Response {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := string(req.InfoHash)
+	swarm, ok := t.swarms[key]
+	if !ok && req.Event != EventStopped {
+		if len(t.swarms) >= t.maxSwarms {
+			t.sweep()
+		}
+		if len(t.swarms) >= t.maxSwarms {
+			return &Response{FailureReason: ErrTooManySwarms.Error()}
+		}
+		swarm = make(map[string]*peer)
+		t.swarms[key] = swarm
+	}
+	t.expire(swarm)
+
+	if req.Event == EventStopped {
+		delete(swarm, addr)
+		if len(swarm) == 0 {
+			delete(t.swarms, key)
+		}
+		return &Response{Interval: int64(t.interval / time.Second), Peers: []Peer{}}
+	}
+	swarm[addr] = &peer{
+		Peer: Peer{
+			Addr:       addr,
+			Uploaded:   req.Uploaded,
+			Downloaded: req.Downloaded,
+			Completed:  req.Completed,
+		},
+		lastSeen: time.Now(),
+	}
+
+	numWant := req.NumWant
+	if numWant <= 0 {
+		numWant = DefaultNumWant
+	}
+	peers := make([]Peer, 0)
+	for _, p := range swarm {
+		if p.Addr != addr {
+			peers = append(peers, p.Peer)
+		}
+	}
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	if len(peers) > numWant {
+		peers = peers[:numWant]
+	}
+	return &Response{Interval: int64(t.interval / time.Second), Peers: peers}
+}
+
+// Peers returns the peers of a swarm
+func (t *Tracker) Peers(infoHash []byte) []Peer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	swarm := t.swarms[string(infoHash)]
+	t.expire(swarm)
+	peers := make([]Peer, 0, len(swarm))
+	for _, p := range swarm {
+		peers = append(peers, p.Peer)
+	}
+	return peers
+}
+
+func (t *Tracker) expire(swarm map[string]*peer) {
+	for addr, p := range swarm {
+		if time.Since(p.lastSeen) > 2*t.interval {
+			delete(swarm, addr)
+		}
+	}
+}
+
+func parseRequest(r *http.Request) (*Request, error) {
+	query := r.URL.Query()
+	req := &Request{Event: query.Get("event")}
+
+	infoHash, err := hex.DecodeString(query.Get("info_hash"))
+	if err != nil || len(infoHash) != 20 {
+		return nil, ErrBadInfoHash
+	}
+	req.InfoHash = infoHash
+	port, err := strconv.ParseUint(query.Get("port"), 10, 16)
+	if err != nil || port == 0 {
+		return nil, ErrBadPort
+	}
+	req.Port = uint16(port)
+	switch req.Event {
+	case EventNone, EventStarted, EventCompleted, EventStopped:
+	default:
+		return nil, ErrBadEvent
+	}
+
+	// statistics are informative, ignore malformed values
+	req.Uploaded, _ = strconv.ParseInt(query.Get("uploaded"), 10, 64)
+	req.Downloaded, _ = strconv.ParseInt(query.Get("downloaded"), 10, 64)
+	req.Completed, _ = hex.DecodeString(query.Get("completed"))
+	req.NumWant, _ = strconv.Atoi(query.Get("numwant"))
+	return req, nil
+}
+
+func writeResponse(w http.ResponseWriter, resp *Response) {
+	content, err := bencode.EncodeBytes(resp)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(content)
+}
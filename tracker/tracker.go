@@ -0,0 +1,96 @@
+// Package tracker implements a small HTTP tracker. Peers announce the
+// infohash of a swarm, the port they serve on, the generations they have
+// completed and how many bytes they exchanged, and get back the other
+// peers of the swarm.
+//
+// An announce is a GET request to the announce URL with the parameters
+//
+//	info_hash   infohash of the swarm, hex encoded
+//	port        port the peer serves on
+//	uploaded    bytes uploaded since the peer started
+//	downloaded  bytes downloaded since the peer started
+//	completed   bitfield of completed generations, hex encoded
+//	event       started, completed, stopped or empty
+//	numwant     maximum number of peers to return
+//
+// and the response is a bencoded Response.
+package tracker
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	EventNone      = ""
+	EventStarted   = "started"
+	EventCompleted = "completed"
+	EventStopped   = "stopped"
+)
+
+const (
+	DefaultInterval  = 60 // seconds between announces
+	DefaultNumWant   = 50
+	DefaultMaxSwarms = 100000
+)
+
+// Request is an announce of a peer
+type Request struct {
+	InfoHash   []byte
+	Port       uint16
+	Uploaded   int64
+	Downloaded int64
+	Completed  []byte // bitfield of completed generations
+	Event      string
+	NumWant    int
+}
+
+// Response is the answer of the tracker to an announce
+type Response struct {
+	FailureReason string `bencode:"failure reason,omitempty"`
+	Interval      int64  `bencode:"interval"`
+	Peers         []Peer `bencode:"peers"`
+}
+
+// Peer is a member of a swarm as seen by the tracker
+type Peer struct {
+	Addr       string `bencode:"addr"`
+	Uploaded   int64  `bencode:"uploaded"`
+	Downloaded int64  `bencode:"downloaded"`
+	Completed  []byte `bencode:"completed"`
+}
+
+// HasGeneration reports whether the peer has completed generation i
+func (p *Peer) HasGeneration(i uint) bool {
+	return HasBit(p.Completed, i)
+}
+
+// IsTrackerURL reports whether an announce is a tracker rather than a peer
+func IsTrackerURL(announce string) bool {
+	return strings.HasPrefix(announce, "http://") || strings.HasPrefix(announce, "https://")
+}
+
+// NewBitfield returns a bitfield with bit i set for every true entry
+func NewBitfield(bits []bool) []byte {
+	bitfield := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			bitfield[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return bitfield
+}
+
+func HasBit(bitfield []byte, i uint) bool {
+	if i/8 >= uint(len(bitfield)) {
+		return false
+	}
+	return bitfield[i/8]&(0x80>>(i%8)) != 0
+}
+
+var (
+	ErrBadInfoHash   = errors.New("info_hash must be 20 bytes")
+	ErrBadPort       = errors.New("port is invalid")
+	ErrBadEvent      = errors.New("event is invalid")
+	ErrTooManySwarms = errors.New("tracker is full, no new swarm is tracked")
+)
@@ -0,0 +1,134 @@
+package tracker_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aecra/PeerCodeX/tracker"
+)
+
+func TestAnnounce(t *testing.T) {
+	server := httptest.NewServer(tracker.NewTracker().Handler())
+	defer server.Close()
+	announceURL := server.URL + "/announce"
+
+	infoHash := bytes.Repeat([]byte{0xab}, 20)
+	seeder := &tracker.Request{
+		InfoHash:  infoHash,
+		Port:      8080,
+		Uploaded:  1 << 20,
+		Completed: tracker.NewBitfield([]bool{true, true, true}),
+		Event:     tracker.EventStarted,
+	}
+	resp, err := tracker.Announce(announceURL, seeder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Peers) != 0 {
+		t.Fatalf("expected no peers, got %d", len(resp.Peers))
+	}
+	if resp.Interval != tracker.DefaultInterval {
+		t.Fatalf("unexpected interval %d", resp.Interval)
+	}
+
+	leecher := &tracker.Request{
+		InfoHash:  infoHash,
+		Port:      8081,
+		Completed: tracker.NewBitfield([]bool{false, true, false}),
+		Event:     tracker.EventStarted,
+	}
+	resp, err = tracker.Announce(announceURL, leecher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Peers) != 1 {
+		t.Fatalf("expected 1 peer, got %d", len(resp.Peers))
+	}
+	peer := resp.Peers[0]
+	if peer.Addr != "127.0.0.1:8080" || peer.Uploaded != 1<<20 {
+		t.Fatalf("unexpected peer %+v", peer)
+	}
+	if !peer.HasGeneration(0) || !peer.HasGeneration(2) || peer.HasGeneration(3) {
+		t.Fatalf("unexpected completed generations %x", peer.Completed)
+	}
+
+	// a different swarm does not see the peers
+	other := *leecher
+	other.InfoHash = bytes.Repeat([]byte{0xcd}, 20)
+	resp, err = tracker.Announce(announceURL, &other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Peers) != 0 {
+		t.Fatalf("expected no peers, got %d", len(resp.Peers))
+	}
+
+	seeder.Event = tracker.EventStopped
+	if _, err := tracker.Announce(announceURL, seeder); err != nil {
+		t.Fatal(err)
+	}
+	leecher.Event = tracker.EventNone
+	resp, err = tracker.Announce(announceURL, leecher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Peers) != 0 {
+		t.Fatalf("expected stopped peer to be removed, got %d peers", len(resp.Peers))
+	}
+}
+
+func TestAnnounceFailure(t *testing.T) {
+	server := httptest.NewServer(tracker.NewTracker().Handler())
+	defer server.Close()
+
+	_, err := tracker.Announce(server.URL+"/announce", &tracker.Request{InfoHash: []byte{0x01}, Port: 8080})
+	if err == nil || err.Error() != tracker.ErrBadInfoHash.Error() {
+		t.Fatalf("expected %v, got %v", tracker.ErrBadInfoHash, err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	tr := tracker.NewTracker()
+	tr.SetInterval(10 * time.Millisecond)
+	for i := byte(0); i < 3; i++ {
+		req := &tracker.Request{InfoHash: bytes.Repeat([]byte{i}, 20), Port: 8080, Event: tracker.EventStarted}
+		if resp := tr.Announce("127.0.0.1:8080", req); resp.FailureReason != "" {
+			t.Fatal(resp.FailureReason)
+		}
+	}
+	if tr.Swarms() != 3 {
+		t.Fatalf("expected 3 swarms, got %d", tr.Swarms())
+	}
+
+	// swarms nobody announces to again are dropped by the sweep alone
+	time.Sleep(30 * time.Millisecond)
+	tr.Sweep()
+	if tr.Swarms() != 0 {
+		t.Fatalf("expected expired swarms to be dropped, got %d", tr.Swarms())
+	}
+}
+
+func TestMaxSwarms(t *testing.T) {
+	tr := tracker.NewTracker()
+	tr.SetInterval(10 * time.Millisecond)
+	tr.SetMaxSwarms(2)
+	announce := func(b byte) *tracker.Response {
+		return tr.Announce("127.0.0.1:8080", &tracker.Request{InfoHash: bytes.Repeat([]byte{b}, 20), Port: 8080})
+	}
+	announce(1)
+	announce(2)
+	if resp := announce(3); resp.FailureReason != tracker.ErrTooManySwarms.Error() {
+		t.Fatalf("expected %v, got %q", tracker.ErrTooManySwarms, resp.FailureReason)
+	}
+	if resp := announce(2); resp.FailureReason != "" {
+		t.Fatalf("expected tracked swarm to be announced to, got %q", resp.FailureReason)
+	}
+
+	// expired swarms make room for new ones
+	time.Sleep(30 * time.Millisecond)
+	if resp := announce(3); resp.FailureReason != "" || tr.Swarms() != 1 {
+		t.Fatalf("expected expired swarms to be swept, got %q and %d swarms", resp.FailureReason, tr.Swarms())
+	}
+}